@@ -0,0 +1,73 @@
+package swp
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Ack latency.
+//
+// The RTT measures the network. The ack latency of a
+// packet is what its producer sees: from Push, through
+// any wait for the window, to its first ack. The sender
+// passes each to OnPacketAcked, and keeps the latest
+// AckLatencyWindow for AckLatencyPercentile and
+// SessionStats. A packet acked again after a retry
+// counts only once, since it leaves the Txq on its
+// first ack.
+
+// AckLatencyWindow is how many of the latest
+// ack latencies the sender keeps.
+const AckLatencyWindow = 1000
+
+// latencyWindow is a ring of the latest
+// AckLatencyWindow latencies.
+type latencyWindow struct {
+	mut     sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	if len(w.samples) < AckLatencyWindow {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % AckLatencyWindow
+}
+
+// percentile returns the p-th percentile, for p
+// in [0, 1], or 0 with no samples.
+func (w *latencyWindow) percentile(p float64) time.Duration {
+	w.mut.Lock()
+	sorted := make([]time.Duration, len(w.samples))
+	copy(sorted, w.samples)
+	w.mut.Unlock()
+	if len(sorted) == 0 {
+		return 0
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(p * float64(len(sorted)-1))
+	return sorted[i]
+}
+
+// ackedAfter records latency for slot, just acked.
+// Only the sendloop calls it.
+func (s *SenderState) ackedAfter(slot *TxqSlot, latency time.Duration) {
+	s.ackLatency.add(latency)
+	if s.OnPacketAcked != nil {
+		s.OnPacketAcked(slot.Pack.SeqNum, latency)
+	}
+}
+
+// AckLatencyPercentile returns the p-th percentile, for
+// p in [0, 1], of the latest AckLatencyWindow ack
+// latencies, or 0 before the first ack. It is safe to
+// call from any goroutine.
+func (s *SenderState) AckLatencyPercentile(p float64) time.Duration {
+	return s.ackLatency.percentile(p)
+}
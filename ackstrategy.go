@@ -0,0 +1,158 @@
+package swp
+
+import (
+	"time"
+)
+
+// Acknowledgment strategies.
+//
+// By default the receiver acks each delivery as the
+// consumer takes it. An AckStrategy can hold those acks
+// back instead, to send fewer of them: acks are
+// cumulative, so one ack covers everything consumed
+// before it. The recvloop asks ShouldAck as the consumer
+// takes each delivery; on false it holds the ack, and
+// the strategy sends it later, from ShouldAck or from
+// OnTimer, which the recvloop runs every
+// AckTimerInterval. Any ack we send for other reasons,
+// a nak or the answer to a keepalive say, also sends
+// what is held.
+//
+// Acks for data we drop, or that arrives outside of
+// our window, still go at once, as the sender needs
+// them to recover.
+//
+// Beware holding acks for long: the sender keeps what
+// it sends until acked, so it stalls for want of a
+// window once it has a window's worth unacked, and
+// retries those it doesn't hear of within its retry
+// deadline. Hold for less than an rtt, or fewer than a
+// window of packets.
+
+// DefaultAckTimerInterval is how often an AckStrategy's
+// OnTimer runs, unless AckTimerInterval says otherwise.
+const DefaultAckTimerInterval = 5 * time.Millisecond
+
+// AckStrategy decides when the receiver acks
+// consumed data. Both methods run on the recvloop,
+// so they must not block.
+type AckStrategy interface {
+	// ShouldAck is called as the consumer takes
+	// pack, the last packet of a delivery. To ack
+	// it now return true; to hold the ack, false.
+	ShouldAck(r *RecvState, pack *Packet) bool
+
+	// OnTimer runs every AckTimerInterval, to send
+	// any held ack that is due with r.SendHeldAck.
+	OnTimer(r *RecvState)
+}
+
+// HeldAck returns the packet whose ack our AckStrategy
+// is holding, and since when, or nil if none is held.
+// Only the recvloop, and so an AckStrategy, may call it.
+func (r *RecvState) HeldAck() (pack *Packet, since time.Time) {
+	return r.heldAck, r.heldAckSince
+}
+
+// AcksOwed returns how many packets the consumer has
+// taken that no ack of ours has covered yet. Only the
+// recvloop, and so an AckStrategy, may call it.
+func (r *RecvState) AcksOwed() int64 {
+	return r.LastFrameClientConsumed - r.ackedThrough
+}
+
+// SendHeldAck sends the ack our AckStrategy is
+// holding, if any. Only the recvloop, and so an
+// AckStrategy, may call it.
+func (r *RecvState) SendHeldAck() {
+	if r.heldAck != nil {
+		r.ack(r.LastFrameClientConsumed, r.heldAck, EventDataAck)
+	}
+}
+
+// dataAck acks the consumption of pack, or holds
+// the ack, as our AckStrategy says.
+func (r *RecvState) dataAck(pack *Packet) {
+	if r.AckStrategy == nil || r.AckStrategy.ShouldAck(r, pack) {
+		r.ack(r.LastFrameClientConsumed, pack, EventDataAck)
+		return
+	}
+	if r.heldAck == nil {
+		r.heldAckSince = r.Clk.Now()
+	}
+	r.heldAck = pack
+}
+
+// armAckTimer schedules the next OnTimer,
+// if we have an AckStrategy.
+func (r *RecvState) armAckTimer() {
+	if r.AckStrategy == nil {
+		return
+	}
+	if r.AckTimerInterval <= 0 {
+		r.AckTimerInterval = DefaultAckTimerInterval
+	}
+	r.ackTimer = time.After(r.AckTimerInterval)
+}
+
+// ImmediateAck acks each delivery at once,
+// as we do without an AckStrategy.
+func ImmediateAck() AckStrategy {
+	return immediateAck{}
+}
+
+type immediateAck struct{}
+
+func (immediateAck) ShouldAck(r *RecvState, pack *Packet) bool { return true }
+func (immediateAck) OnTimer(r *RecvState)                      {}
+
+// DelayedAck holds each ack for delay, so that one ack
+// covers all that the consumer takes in the meantime.
+// The ack goes out on the first OnTimer at least delay
+// after the first delivery it covers.
+func DelayedAck(delay time.Duration) AckStrategy {
+	return &hybridAck{delay: delay}
+}
+
+// EveryNAck acks once the consumer has taken n packets
+// since our last ack. So that the last few of a transfer
+// aren't left unacked, OnTimer sends what is held.
+func EveryNAck(n int) AckStrategy {
+	return &everyNAck{n: int64(n)}
+}
+
+type everyNAck struct {
+	n int64
+}
+
+func (e *everyNAck) ShouldAck(r *RecvState, pack *Packet) bool {
+	return r.AcksOwed() >= e.n
+}
+
+func (e *everyNAck) OnTimer(r *RecvState) {
+	r.SendHeldAck()
+}
+
+// HybridAck is DelayedAck, but acking at once
+// when the consumer has taken maxGap packets since
+// our last ack, as EveryNAck(maxGap) would.
+func HybridAck(delay time.Duration, maxGap int) AckStrategy {
+	return &hybridAck{delay: delay, maxGap: int64(maxGap)}
+}
+
+// hybridAck is DelayedAck when maxGap is 0.
+type hybridAck struct {
+	delay  time.Duration
+	maxGap int64
+}
+
+func (h *hybridAck) ShouldAck(r *RecvState, pack *Packet) bool {
+	return h.maxGap > 0 && r.AcksOwed() >= h.maxGap
+}
+
+func (h *hybridAck) OnTimer(r *RecvState) {
+	pack, since := r.HeldAck()
+	if pack != nil && r.Clk.Now().Sub(since) >= h.delay {
+		r.SendHeldAck()
+	}
+}
@@ -2,8 +2,18 @@ package swp
 
 import (
 	"sync"
+	"time"
 )
 
+// DefaultAsapDropTimeout is how long the receiver
+// waits to hand a packet to the AsapHelper before
+// dropping it, as used by Session.RegisterAsap.
+const DefaultAsapDropTimeout = 100 * time.Millisecond
+
+// DefaultAsapLimit is the queue limit used
+// by Session.RegisterAsapWithDeadline.
+const DefaultAsapLimit = 1000
+
 // AsapHelper is a simple queue
 // goroutine that delivers packets
 // to ASAP clients as soon as they
@@ -21,6 +31,12 @@ type AsapHelper struct {
 	// rather than stale.
 	Limit int64
 
+	// DropTimeout: wait this long to enqueue
+	// a packet before dropping it. If zero,
+	// the receiver instead blocks until the client
+	// has received it, and nothing is dropped.
+	DropTimeout time.Duration
+
 	rcv     chan *Packet
 	enqueue chan *Packet
 	mut     sync.Mutex
@@ -34,11 +50,12 @@ type AsapHelper struct {
 // Soon As Possible.
 func NewAsapHelper(rcvUnordered chan *Packet, max int64) *AsapHelper {
 	return &AsapHelper{
-		ReqStop: make(chan bool),
-		Done:    make(chan bool),
-		rcv:     rcvUnordered,
-		enqueue: make(chan *Packet),
-		Limit:   max,
+		ReqStop:     make(chan bool),
+		Done:        make(chan bool),
+		rcv:         rcvUnordered,
+		enqueue:     make(chan *Packet),
+		Limit:       max,
+		DropTimeout: DefaultAsapDropTimeout,
 	}
 }
 
@@ -0,0 +1,59 @@
+package swp
+
+import (
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test065AsapWithDeadlineAndUnregister(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe(WithWindowMsgCount(3))
+	panicOn(err)
+
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	asap := make(chan *Packet)
+	err = B.RegisterAsapWithDeadline(asap, 0)
+	panicOn(err)
+
+	A.Push(&Packet{
+		From:     "A",
+		Dest:     "B",
+		Data:     []byte("one"),
+		TcpEvent: EventData,
+	})
+
+	var got *Packet
+	select {
+	case got = <-asap:
+	case <-time.After(5 * time.Second):
+	}
+
+	errUnreg := B.UnregisterAsap()
+	A.Push(&Packet{
+		From:     "A",
+		Dest:     "B",
+		Data:     []byte("two"),
+		TcpEvent: EventData,
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	var extra *Packet
+	select {
+	case extra = <-asap:
+	default:
+	}
+
+	cleanup()
+
+	cv.Convey("Given RegisterAsapWithDeadline with a zero timeout, the packet should be delivered to the asap channel; after UnregisterAsap, no more packets should show up there.", t, func() {
+		cv.So(got, cv.ShouldNotBeNil)
+		cv.So(string(got.Data), cv.ShouldEqual, "one")
+		cv.So(errUnreg, cv.ShouldBeNil)
+		cv.So(extra, cv.ShouldBeNil)
+		cv.So(B.CountPacketsReadConsumed(), cv.ShouldEqual, 2)
+	})
+}
@@ -0,0 +1,92 @@
+package swp
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultAutoTuneMinSamples is the number of RTT
+// samples we want before trusting a bandwidth-delay
+// product estimate.
+const DefaultAutoTuneMinSamples = 10
+
+// AutoTune sizes the send window to the
+// bandwidth-delay product (BDP) of the path: the
+// number of packets that must be in flight to
+// keep it full. We measure the delivery rate
+// in acked packets per second and multiply by
+// the smoothed RTT; our MSS is one packet.
+//
+// Since the delivery rate can never exceed
+// window/RTT, we allow twice the estimate,
+// so an underused path lets the window grow.
+// The Txq and the remote Rxq are sized at
+// NewSession time, so the tuned window stays
+// within [2, WindowMsgCount].
+//
+// AutoTune is only accessed from the sender goroutine,
+// except for Adjustments, which is read with
+// atomic.LoadInt64.
+type AutoTune struct {
+	MinSamples  int64
+	Window      int64
+	Adjustments int64
+
+	maxWindow int64
+	start     time.Time
+	acked     int64
+}
+
+// NewAutoTune returns an AutoTune that starts
+// at, and never exceeds, maxWindow.
+func NewAutoTune(maxWindow int64, minSamples int) *AutoTune {
+	if minSamples <= 0 {
+		minSamples = DefaultAutoTuneMinSamples
+	}
+	return &AutoTune{
+		MinSamples: int64(minSamples),
+		Window:     maxWindow,
+		maxWindow:  maxWindow,
+	}
+}
+
+// OnAck is called with the number of packets an ack
+// newly acknowledged. It returns true if the
+// Window was changed.
+func (a *AutoTune) OnAck(now time.Time, numNewlyAcked int, rtt *RTT) bool {
+	if numNewlyAcked == 0 {
+		return false
+	}
+	if a.start.IsZero() {
+		// the first ack starts our measurement interval.
+		a.start = now
+		return false
+	}
+	a.acked += int64(numNewlyAcked)
+	elapsed := now.Sub(a.start)
+	if rtt.N < a.MinSamples || elapsed <= 0 {
+		return false
+	}
+
+	rate := float64(a.acked) / float64(elapsed)
+	bdp := int64(math.Ceil(rate * float64(rtt.GetEstimate())))
+	w := 2 * bdp
+	if w < 2 {
+		w = 2
+	}
+	if w > a.maxWindow {
+		w = a.maxWindow
+	}
+
+	// start a fresh interval, so we track changes in the path.
+	a.start = now
+	a.acked = 0
+
+	if w == a.Window {
+		return false
+	}
+	a.Window = w
+	atomic.AddInt64(&a.Adjustments, 1)
+	return true
+}
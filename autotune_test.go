@@ -0,0 +1,37 @@
+package swp
+
+import (
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test073AutoTuneFollowsBandwidthDelayProduct(t *testing.T) {
+
+	cv.Convey("Given a 10 msec RTT, AutoTune should size the window to twice the observed bandwidth-delay product, clamped to [2, maxWindow].", t, func() {
+		rtt := NewRTT()
+		for i := 0; i < 10; i++ {
+			rtt.AddSample(10 * time.Millisecond)
+		}
+		a := NewAutoTune(50, 0)
+		cv.So(a.MinSamples, cv.ShouldEqual, DefaultAutoTuneMinSamples)
+		cv.So(a.Window, cv.ShouldEqual, 50)
+
+		t0 := time.Now()
+		cv.So(a.OnAck(t0, 1, rtt), cv.ShouldBeFalse)
+
+		// 100 packets/sec * 10 msec = 1 packet in flight.
+		cv.So(a.OnAck(t0.Add(100*time.Millisecond), 10, rtt), cv.ShouldBeTrue)
+		cv.So(a.Window, cv.ShouldEqual, 2)
+
+		// 1000 packets/sec * 10 msec = 10 packets in flight.
+		cv.So(a.OnAck(t0.Add(200*time.Millisecond), 100, rtt), cv.ShouldBeTrue)
+		cv.So(a.Window, cv.ShouldEqual, 20)
+
+		// way more than maxWindow.
+		cv.So(a.OnAck(t0.Add(300*time.Millisecond), 10000, rtt), cv.ShouldBeTrue)
+		cv.So(a.Window, cv.ShouldEqual, 50)
+		cv.So(a.Adjustments, cv.ShouldEqual, 3)
+	})
+}
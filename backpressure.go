@@ -0,0 +1,107 @@
+package swp
+
+import (
+	"sync"
+)
+
+// Receiver-side back-pressure signaling.
+//
+// When SessionConfig.HighWaterMark is > 0, the
+// receiver watches how many packets it holds that the
+// consumer has yet to read. Once that climbs past
+// HighWaterMark*RecvWindowSize, the channel returned by
+// BackpressureCh is closed. Once it falls back under
+// LowWaterMark*RecvWindowSize, BackpressureCh hands
+// out a fresh, open channel. This lets an application
+// pause its own producers directly, instead of waiting
+// for the remote sender's flow control to notice.
+
+// backpressure is shared between the recvloop,
+// which updates it, and any callers of BackpressureCh.
+type backpressure struct {
+	mut  sync.Mutex
+	high int64
+	low  int64
+	on   bool
+
+	// pressure is closed while on; relief is closed while !on.
+	pressure chan struct{}
+	relief   chan struct{}
+}
+
+func newBackpressure(high, low int64) *backpressure {
+	b := &backpressure{
+		high:     high,
+		low:      low,
+		pressure: make(chan struct{}),
+		relief:   make(chan struct{}),
+	}
+	close(b.relief)
+	return b
+}
+
+// update is called by the recvloop with the
+// number of packets held for the consumer.
+func (b *backpressure) update(held int64) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	switch {
+	case !b.on && held > b.high:
+		b.on = true
+		close(b.pressure)
+		b.relief = make(chan struct{})
+	case b.on && held < b.low:
+		b.on = false
+		close(b.relief)
+		b.pressure = make(chan struct{})
+	}
+}
+
+func (b *backpressure) chans() (pressure, relief chan struct{}) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.pressure, b.relief
+}
+
+// BackpressureCh returns a channel that is closed when
+// our receiver holds more than its HighWaterMark of
+// unread packets. Call it again after relief for a
+// new channel. Without a HighWaterMark configured it
+// returns nil, which never fires.
+func (s *Session) BackpressureCh() <-chan struct{} {
+	bp := s.Swp.Recver.bp
+	if bp == nil {
+		return nil
+	}
+	pressure, _ := bp.chans()
+	return pressure
+}
+
+// waitForRelief blocks Write while our receiver is
+// signaling back-pressure, or until the write deadline.
+func (s *Session) waitForRelief() error {
+	bp := s.Swp.Recver.bp
+	if bp == nil {
+		return nil
+	}
+	_, relief := bp.chans()
+	var w deadlineWait
+	defer w.stop()
+	for {
+		dl, changed := s.getWriteDeadline()
+		if pastDeadline(dl) {
+			return ErrDeadlineExceeded
+		}
+		w.arm(dl, changed)
+		select {
+		case <-relief:
+			return nil
+		case <-w.expired:
+			return ErrDeadlineExceeded
+		case <-w.changed:
+			// look again.
+		case <-s.Halt.Done.Chan:
+			return ErrSessDone
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package swp
+
+import (
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func Test078BackpressureChSignalsHighAndLowWater(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe(OnlyOn("B", func(cfg *SessionConfig) { cfg.HighWaterMark = 0.5 }))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+
+	before := isClosed(B.BackpressureCh())
+
+	// B doesn't read yet, so its backlog grows.
+	for i := 0; i < 8; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("data"), TcpEvent: EventData})
+	}
+	time.Sleep(100 * time.Millisecond)
+	during := isClosed(B.BackpressureCh())
+
+	// consume the backlog.
+	var nread int
+	select {
+	case seq := <-B.ReadMessagesCh:
+		nread = len(seq.Seq)
+	case <-time.After(time.Second):
+	}
+	time.Sleep(50 * time.Millisecond)
+	after := isClosed(B.BackpressureCh())
+
+	cleanup()
+
+	cv.Convey("Given a HighWaterMark of half the window, BackpressureCh should be closed while the unread backlog exceeds 5 packets, and open again once it is read.", t, func() {
+		cv.So(before, cv.ShouldBeFalse)
+		cv.So(during, cv.ShouldBeTrue)
+		cv.So(nread, cv.ShouldEqual, 8)
+		cv.So(after, cv.ShouldBeFalse)
+	})
+}
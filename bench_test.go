@@ -0,0 +1,253 @@
+package swp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glycerine/bchan"
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+// The benchmarks here run over a ChanNet, or a zero
+// latency SimNet when they need loss, so that they
+// measure our own overhead rather than the network's.
+// Each reports allocations, as if run with -benchmem.
+
+// benchPair makes sessions A and B over net, with B
+// consuming everything it receives.
+func benchPair(net Network, window int64, windowBytes int64, timeout time.Duration) (A, B *Session) {
+	A, err := NewSession(SessionConfig{Net: net, LocalInbox: "A", DestInbox: "B", WindowMsgCount: window, WindowByteSz: windowBytes, Timeout: timeout, Clk: RealClk})
+	panicOn(err)
+	B, err = NewSession(SessionConfig{Net: net, LocalInbox: "B", DestInbox: "A", WindowMsgCount: window, WindowByteSz: windowBytes, Timeout: timeout, Clk: RealClk})
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+	return A, B
+}
+
+// pushAndWaitForAck pushes n packets of payload from A
+// to B, and waits until B has acked the last of them.
+func pushAndWaitForAck(b *testing.B, A *Session, n int, payload []byte) {
+	ca := bchan.New(1)
+	for i := 0; i < n; i++ {
+		pack := &Packet{From: "A", Dest: "B", Data: payload, TcpEvent: EventData}
+		if i == n-1 {
+			pack.CliAcked = ca
+		}
+		err := A.Push(pack)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	if n == 0 {
+		return
+	}
+	select {
+	case <-ca.Ch:
+		ca.BcastAck()
+	case <-time.After(time.Minute):
+		b.Fatalf("timed out waiting for the ack of packet %v", n-1)
+	}
+}
+
+func benchmarkPushAck(b *testing.B, window int64) {
+	A, B := benchPair(NewChanNet(1000), window, -1, 100*time.Millisecond)
+	defer B.Stop()
+	defer A.Stop()
+	payload := []byte("benchmark payload")
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	pushAndWaitForAck(b, A, b.N, payload)
+}
+
+func BenchmarkPushAck1(b *testing.B)   { benchmarkPushAck(b, 1) }
+func BenchmarkPushAck16(b *testing.B)  { benchmarkPushAck(b, 16) }
+func BenchmarkPushAck256(b *testing.B) { benchmarkPushAck(b, 256) }
+
+func BenchmarkHighLoss(b *testing.B) {
+	A, B := benchPair(NewSimNet(0.05, 0), 16, -1, 10*time.Millisecond)
+	defer B.Stop()
+	defer A.Stop()
+	payload := []byte("benchmark payload")
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	pushAndWaitForAck(b, A, b.N, payload)
+}
+
+// benchmarkCong times 1000 packet transfers from A,
+// running algo, to B, over a SimNet losing 2%.
+func benchmarkCong(b *testing.B, algo CongAlgo) {
+	payload := []byte("benchmark payload")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		net := NewSimNet(0.02, 0)
+		A, err := NewSession(SessionConfig{Net: net, LocalInbox: "A", DestInbox: "B", WindowMsgCount: 64, WindowByteSz: -1, Timeout: 10 * time.Millisecond, Clk: RealClk, CongestionControl: true, CongestionAlgorithm: algo})
+		panicOn(err)
+		B, err := NewSession(SessionConfig{Net: net, LocalInbox: "B", DestInbox: "A", WindowMsgCount: 64, WindowByteSz: -1, Timeout: 10 * time.Millisecond, Clk: RealClk})
+		panicOn(err)
+		A.SelfConsumeForTesting()
+		B.SelfConsumeForTesting()
+		pushAndWaitForAck(b, A, 1000, payload)
+		b.StopTimer()
+		A.Stop()
+		B.Stop()
+		b.StartTimer()
+	}
+}
+
+func BenchmarkCongAIMD2PctLoss(b *testing.B)  { benchmarkCong(b, CongAlgoAIMD) }
+func BenchmarkCongCUBIC2PctLoss(b *testing.B) { benchmarkCong(b, CongAlgoCUBIC) }
+
+func BenchmarkLargePayload(b *testing.B) {
+	payload := make([]byte, 1<<20)
+	A, B := benchPair(NewChanNet(1000), 16, 32<<20, 100*time.Millisecond)
+	defer B.Stop()
+	defer A.Stop()
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	pushAndWaitForAck(b, A, b.N, payload)
+}
+
+func BenchmarkASAP(b *testing.B) {
+	A, B := benchPair(NewChanNet(1000), 16, -1, 100*time.Millisecond)
+	defer B.Stop()
+	defer A.Stop()
+	asap := make(chan *Packet, 1000)
+	panicOn(B.RegisterAsapWithDeadline(asap, 0))
+	got := make(chan bool)
+	go func() {
+		for i := 0; i < b.N; i++ {
+			<-asap
+		}
+		close(got)
+	}()
+	payload := []byte("benchmark payload")
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: payload, TcpEvent: EventData})
+	}
+	<-got
+}
+
+// BenchmarkFlowControlRampUp times a cold start: fresh
+// sessions, whose flow control starts from nothing,
+// moving 4 windows worth of packets.
+func BenchmarkFlowControlRampUp(b *testing.B) {
+	window := int64(16)
+	payload := []byte("benchmark payload")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		A, B := benchPair(NewChanNet(1000), window, -1, 100*time.Millisecond)
+		pushAndWaitForAck(b, A, int(4*window), payload)
+		b.StopTimer()
+		A.Stop()
+		B.Stop()
+		b.StartTimer()
+	}
+}
+
+func BenchmarkPushIndividually10(b *testing.B) {
+	A, B := benchPair(NewChanNet(1000), 100, -1, 100*time.Millisecond)
+	defer B.Stop()
+	defer A.Stop()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 10; j++ {
+			A.Push(&Packet{From: "A", Dest: "B", Data: []byte("bench"), TcpEvent: EventData})
+		}
+	}
+}
+
+func BenchmarkPushBatch10(b *testing.B) {
+	A, B := benchPair(NewChanNet(1000), 100, -1, 100*time.Millisecond)
+	defer B.Stop()
+	defer A.Stop()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		batch := make([]*Packet, 10)
+		for j := range batch {
+			batch[j] = &Packet{From: "A", Dest: "B", Data: []byte("bench"), TcpEvent: EventData}
+		}
+		A.PushBatch(batch)
+	}
+}
+
+// ackBench is a sender whose sendloop has stopped, so the
+// benchmark can call its ack processing directly, with
+// no other goroutine allocating alongside it.
+type ackBench struct {
+	s    *SenderState
+	acks []*Packet
+}
+
+func newAckBench(window int64) *ackBench {
+	net := NewInProcNet(int(window))
+	A, err := NewSession(SessionConfig{Net: net, LocalInbox: "A", DestInbox: "B", WindowMsgCount: window, WindowByteSz: -1, Timeout: time.Second, Clk: RealClk})
+	panicOn(err)
+	A.Stop()
+	ab := &ackBench{s: A.Swp.Sender}
+	for i := int64(0); i < window; i++ {
+		ab.acks = append(ab.acks, &Packet{From: "B", Dest: "A", SeqNum: -99, TcpEvent: EventDataAck, AvailReaderMsgCap: window, AvailReaderBytesCap: 1 << 20})
+	}
+	return ab
+}
+
+// fill sends a window of packets to be acked by
+// the acks. There's no B, so InProcNet drops the sends.
+func (ab *ackBench) fill() {
+	for _, a := range ab.acks {
+		seq, _ := ab.s.doOrigDataSend(&Packet{From: "A", Dest: "B", Data: []byte("bench"), TcpEvent: EventData})
+		a.AckNum = seq
+		a.DataSendTm = time.Now()
+		a.ArrivedAtDestTm = a.DataSendTm
+	}
+	ab.s.SendHistory = ab.s.SendHistory[:0]
+}
+
+// allocsPerAck measures the allocations of acking each
+// packet of a window, one ack at a time.
+func (ab *ackBench) allocsPerAck() float64 {
+	ab.fill()
+	i := 0
+	// AllocsPerRun makes one more run, to warm up.
+	return testing.AllocsPerRun(len(ab.acks)-1, func() {
+		ab.s.gotPack(ab.acks[i])
+		i++
+	})
+}
+
+func BenchmarkAckProcessing(b *testing.B) {
+	window := int64(1000)
+	ab := newAckBench(window)
+	// fill the ack latency window first.
+	ab.allocsPerAck()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n += len(ab.acks) {
+		b.StopTimer()
+		ab.fill()
+		b.StartTimer()
+		for _, a := range ab.acks {
+			ab.s.gotPack(a)
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(ab.allocsPerAck(), "allocs/ack")
+}
+
+func Test148AckProcessingDoesNotAllocate(t *testing.T) {
+
+	ab := newAckBench(1000)
+	// the ack latency window fills on the first pass.
+	ab.allocsPerAck()
+	allocs := ab.allocsPerAck()
+
+	cv.Convey("Given a sender past its warm-up, processing an ack should not allocate.", t, func() {
+		cv.So(allocs, cv.ShouldEqual, 0)
+	})
+}
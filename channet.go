@@ -0,0 +1,57 @@
+package swp
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ChanNet is a Network that delivers packets instantly and
+// reliably over in-process channels, one per inbox. It is
+// simpler than SimNet when a test doesn't need latency or
+// loss simulation. See NewChanNet.
+type ChanNet struct {
+	BufSize int
+
+	mut sync.Mutex
+	Net map[string]chan *Packet
+}
+
+// NewChanNet makes a ChanNet whose per-inbox
+// channels have bufSize buffer slots.
+func NewChanNet(bufSize int) *ChanNet {
+	return &ChanNet{
+		BufSize: bufSize,
+		Net:     make(map[string]chan *Packet),
+	}
+}
+
+// Listen returns a channel that will be sent on when
+// packets have Dest inbox.
+func (cn *ChanNet) Listen(inbox string) (chan *Packet, error) {
+	ch := make(chan *Packet, cn.BufSize)
+	cn.mut.Lock()
+	cn.Net[inbox] = ch
+	cn.mut.Unlock()
+	return ch, nil
+}
+
+// Send does a blocking send of a copy of pack to the
+// channel for pack.Dest, returning an error if no
+// one is listening on pack.Dest.
+func (cn *ChanNet) Send(pack *Packet, why string) error {
+	// copy, as SimNet does, so sender and
+	// receiver don't share the Packet.
+	cp := *pack
+
+	cn.mut.Lock()
+	ch, ok := cn.Net[cp.Dest]
+	cn.mut.Unlock()
+	if !ok {
+		return fmt.Errorf("chan net sees packet for unknown node '%s'", cp.Dest)
+	}
+	ch <- &cp
+	return nil
+}
+
+// Flush is a no-op; sends are complete when Send returns.
+func (cn *ChanNet) Flush() {}
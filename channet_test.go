@@ -0,0 +1,61 @@
+package swp
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test070ChanNetDelivers(t *testing.T) {
+
+	net := NewChanNet(1000)
+	rtt := 100 * time.Millisecond
+
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithTimeout(rtt))
+	panicOn(err)
+
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	n := 20
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("hi"), TcpEvent: EventData})
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	cleanup()
+
+	cv.Convey("Given a ChanNet, all packets should arrive in order, and sends to an unknown inbox should error.", t, func() {
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, n)
+		cv.So(HistoryEqual(A.Swp.Sender.SendHistory, B.Swp.Recver.RecvHistory), cv.ShouldBeTrue)
+		cv.So(net.Send(&Packet{From: "A", Dest: "nobody"}, "test"), cv.ShouldNotBeNil)
+	})
+}
+
+func Test173InProcNetDeliversAndDrops(t *testing.T) {
+
+	net := NewInProcNet(1000)
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithTimeout(100*time.Millisecond))
+	panicOn(err)
+
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	n := 20
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("hi"), TcpEvent: EventData})
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	cleanup()
+	errNobody := net.Send(&Packet{From: "A", Dest: "nobody"}, "test")
+
+	cv.Convey("Given an InProcNet, all packets should arrive in order, and a send to an unknown inbox should be dropped and counted.", t, func() {
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, n)
+		cv.So(HistoryEqual(A.Swp.Sender.SendHistory, B.Swp.Recver.RecvHistory), cv.ShouldBeTrue)
+		cv.So(errNobody, cv.ShouldBeNil)
+		cv.So(atomic.LoadInt64(&net.Dropped), cv.ShouldBeGreaterThan, 0)
+	})
+}
@@ -0,0 +1,107 @@
+package swp
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// Chaos mode.
+//
+// With SessionConfig.ChaosMode, a chaos monkey goroutine
+// injects a fault at random intervals, between
+// chaosMinWait and chaosMaxWait, for as long as the
+// session runs. Each fault is drawn from those that
+// apply to the session:
+//
+//   - pause the sender for chaosOutage;
+//   - have a SimNet deliver the next packet twice;
+//   - close our inbox on a SimNet for chaosOutage,
+//     dropping everything sent to it, then reopen it;
+//   - advance a SimClock by the session Timeout.
+//
+// The faults and their timing come from ChaosSeed, so a
+// failing run can be repeated. The protocol should ride
+// out all of them; this is for resilience testing and
+// CI soak tests, not production.
+
+var (
+	chaosMinWait = 100 * time.Millisecond
+	chaosMaxWait = 5 * time.Second
+	chaosOutage  = 50 * time.Millisecond
+)
+
+// chaosMonkey injects faults until the session halts.
+func (s *Session) chaosMonkey(seed int64) {
+	rng := rand.New(rand.NewSource(seed))
+	minWait, maxWait := chaosMinWait, chaosMaxWait
+	outage := chaosOutage
+	sim, _ := s.Net.(*SimNet)
+	clk, _ := s.Swp.Sender.Clk.(*SimClock)
+
+	var faults []func()
+	faults = append(faults, func() {
+		snd := s.Swp.Sender
+		if snd.Paused() {
+			// leave the consumer's own Pause alone.
+			return
+		}
+		mylog.Printf("%s chaos: pausing sender for %v", s.MyInbox, outage)
+		snd.Pause()
+		s.chaosWait(outage)
+		snd.Resume()
+	})
+	if sim != nil {
+		faults = append(faults, func() {
+			mylog.Printf("%s chaos: duplicating next packet", s.MyInbox)
+			atomic.StoreUint32(&sim.DuplicateNext, 1)
+		})
+		faults = append(faults, func() {
+			mylog.Printf("%s chaos: closing inbox for %v", s.MyInbox, outage)
+			sim.setInboxClosed(s.MyInbox, true)
+			s.chaosWait(outage)
+			sim.setInboxClosed(s.MyInbox, false)
+		})
+	}
+	if clk != nil {
+		faults = append(faults, func() {
+			mylog.Printf("%s chaos: advancing clock by %v", s.MyInbox, s.Cfg.Timeout)
+			clk.Advance(s.Cfg.Timeout)
+		})
+	}
+
+	for {
+		wait := minWait + time.Duration(rng.Int63n(int64(maxWait-minWait)+1))
+		if !s.chaosWait(wait) {
+			return
+		}
+		atomic.AddInt64(&s.ChaosFaults, 1)
+		faults[rng.Intn(len(faults))]()
+	}
+}
+
+// chaosWait sleeps for d, returning false early
+// if the session halts first.
+func (s *Session) chaosWait(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-s.Swp.Sender.Halt.ReqStop.Chan:
+		return false
+	}
+}
+
+// setInboxClosed has sim drop everything
+// sent to inbox while closed is true.
+func (sim *SimNet) setInboxClosed(inbox string, closed bool) {
+	sim.mapMut.Lock()
+	defer sim.mapMut.Unlock()
+	if sim.closedInbox == nil {
+		sim.closedInbox = make(map[string]bool)
+	}
+	if closed {
+		sim.closedInbox[inbox] = true
+	} else {
+		delete(sim.closedInbox, inbox)
+	}
+}
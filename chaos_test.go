@@ -0,0 +1,59 @@
+package swp
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test133ChaosModeTransferSurvivesFaults(t *testing.T) {
+
+	defer func(min, max time.Duration) {
+		chaosMinWait, chaosMaxWait = min, max
+	}(chaosMinWait, chaosMaxWait)
+	chaosMinWait, chaosMaxWait = 5*time.Millisecond, 20*time.Millisecond
+
+	chaos := func(cfg *SessionConfig) {
+		cfg.ChaosMode = true
+		cfg.ChaosSeed = 1
+	}
+	A, B, cleanup, err := SwpPipe(WithTimeout(20*time.Millisecond), OnlyOn("A", chaos), OnlyOn("B", chaos))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+
+	n := 50
+	go func() {
+		for i := 0; i < n; i++ {
+			A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	var got []string
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	for len(got) < n {
+		seq, err := B.ReadCtx(ctx)
+		if err != nil {
+			break
+		}
+		for _, pack := range seq.Seq {
+			got = append(got, string(pack.Data))
+		}
+	}
+	faultsA := atomic.LoadInt64(&A.ChaosFaults)
+	faultsB := atomic.LoadInt64(&B.ChaosFaults)
+	cleanup()
+
+	cv.Convey("Given ChaosMode on both ends, faults should be injected while a transfer runs, and every packet should still arrive, once each, in order.", t, func() {
+		cv.So(faultsA, cv.ShouldBeGreaterThan, 0)
+		cv.So(faultsB, cv.ShouldBeGreaterThan, 0)
+		cv.So(len(got), cv.ShouldEqual, n)
+		for i := range got {
+			cv.So(got[i], cv.ShouldEqual, fmt.Sprintf("%v", i))
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package swp
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Receive-side circuit breaker.
+//
+// A sender that keeps sending outside our window is
+// buggy, or worse, and each such packet costs us an
+// ack. With a CircuitBreakerThreshold, the recvloop
+// counts those discards, in DiscardCount, by the
+// second; once every second for CircuitBreakerDuration
+// has seen more than the threshold, it opens the
+// circuit. It then logs the fact, tells the sender with
+// a CircuitOpen control packet, and sends no acks at
+// all until the circuit closes again, CircuitResetTimeout
+// later. Data still arrives and is delivered as usual.
+//
+// The sender, on the CircuitOpen packet, waits: it
+// neither sends new packets nor retries old ones, as it
+// would under a network reconnect, until it sees an ack
+// from us again, made after the circuit opened: acks we
+// queued just before may arrive after the CircuitOpen
+// packet. We send one as the circuit closes. Should that
+// be lost, or never come, the sender waits no longer
+// than the CircuitResetTimeout the packet carries, plus
+// one of its KeepAliveIntervals of slack, before it
+// carries on anyway. Our keepalives go unanswered while
+// we are open, so a sender with KeepAliveExpectReply
+// may give up on us first.
+
+// DefaultCircuitResetTimeout is how long the circuit
+// stays open, unless CircuitResetTimeout says otherwise.
+const DefaultCircuitResetTimeout = 5 * time.Second
+
+// CircuitOpen reports whether our circuit breaker is
+// open. It is safe to call from any goroutine.
+func (r *RecvState) CircuitOpen() bool {
+	return atomic.LoadInt32(&r.circuitOpen) == 1
+}
+
+// circuitCheck notes a discard at now, opening the
+// circuit if it is time. It returns true while the
+// circuit is open. Only the recvloop calls it.
+func (r *RecvState) circuitCheck(now time.Time) bool {
+	if r.CircuitBreakerThreshold <= 0 {
+		return false
+	}
+	if r.CircuitOpen() {
+		return true
+	}
+	if elap := now.Sub(r.cbSecStart); elap >= time.Second {
+		// a new second: did the last one stay under?
+		perSec := float64(r.DiscardCount-r.cbSecBase) / elap.Seconds()
+		if perSec <= float64(r.CircuitBreakerThreshold) {
+			r.cbOverSince = time.Time{}
+		}
+		r.cbSecStart = now
+		r.cbSecBase = r.DiscardCount
+	}
+	if r.DiscardCount-r.cbSecBase > r.CircuitBreakerThreshold && r.cbOverSince.IsZero() {
+		r.cbOverSince = r.cbSecStart
+	}
+	if r.cbOverSince.IsZero() || now.Sub(r.cbOverSince) < r.CircuitBreakerDuration {
+		return false
+	}
+	r.openCircuit()
+	return true
+}
+
+// openCircuit stops our acks, and tells the
+// sender to wait. Only the recvloop calls it.
+func (r *RecvState) openCircuit() {
+	timeout := r.CircuitResetTimeout
+	if timeout <= 0 {
+		timeout = DefaultCircuitResetTimeout
+	}
+	atomic.StoreInt32(&r.circuitOpen, 1)
+	atomic.AddInt64(&r.CircuitOpens, 1)
+	r.circuitTimer = time.After(timeout)
+	mylog.Printf("%v circuit breaker open: '%s' sent %v packets outside our window; no acks for %v.",
+		r.Inbox, r.RemoteInbox, r.DiscardCount-r.cbSecBase, timeout)
+
+	// the sendloop may be busy, so don't hold up the
+	// recvloop waiting on it.
+	pack := &Packet{CircuitOpen: true, CircuitResetNsec: int64(timeout)}
+	select {
+	case r.snd.SendControl <- pack:
+	default:
+		go func() {
+			select {
+			case r.snd.SendControl <- pack:
+			case <-r.Halt.ReqStop.Chan:
+			}
+		}()
+	}
+}
+
+// closeCircuit lets our acks flow again, starting with
+// one that ends the sender's wait. Only the recvloop
+// calls it.
+func (r *RecvState) closeCircuit() {
+	atomic.StoreInt32(&r.circuitOpen, 0)
+	r.circuitTimer = nil
+	r.cbOverSince = time.Time{}
+	r.cbSecStart = time.Time{}
+	mylog.Printf("%v circuit breaker closed.", r.Inbox)
+	r.ack(r.LastFrameClientConsumed, nil, EventDataAck)
+}
+
+// CircuitWait reports whether we are waiting on the
+// peer's open circuit breaker. It is safe to call from
+// any goroutine.
+func (s *SenderState) CircuitWait() bool {
+	return atomic.LoadInt32(&s.circuitWait) == 1
+}
+
+// circuitOpened starts our wait, on the peer's
+// CircuitOpen packet pack.
+func (s *SenderState) circuitOpened(pack *Packet) {
+	reset := time.Duration(pack.CircuitResetNsec)
+	if reset <= 0 {
+		// a peer that doesn't say.
+		reset = DefaultCircuitResetTimeout
+	}
+	until := s.Clk.Now().Add(reset + s.KeepAliveInterval)
+	atomic.StoreInt64(&s.circuitOpenedAt, pack.DataSendTm.UnixNano())
+	atomic.StoreInt64(&s.circuitWaitUntil, until.UnixNano())
+	atomic.StoreInt32(&s.circuitWait, 1)
+	s.wakeForPause()
+}
+
+// circuitTimedOut ends a wait that has gone past
+// circuitWaitUntil with no ack to end it. Only the
+// sendloop calls it.
+func (s *SenderState) circuitTimedOut(now time.Time) {
+	if !s.CircuitWait() || now.UnixNano() < atomic.LoadInt64(&s.circuitWaitUntil) {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&s.circuitWait, 1, 0) {
+		mylog.Printf("%v no ack from '%s' since its circuit breaker opened; carrying on anyway.", s.Inbox, s.Dest)
+	}
+}
+
+// circuitClosed ends any wait, on the peer's ack a,
+// if the peer made a after opening its circuit. Both
+// times are on the peer's clock. Only the sendloop
+// calls it.
+func (s *SenderState) circuitClosed(a *Packet) {
+	if !s.CircuitWait() || a.AckReplyTm.UnixNano() <= atomic.LoadInt64(&s.circuitOpenedAt) {
+		return
+	}
+	atomic.CompareAndSwapInt32(&s.circuitWait, 1, 0)
+}
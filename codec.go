@@ -0,0 +1,111 @@
+package swp
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// Codec is the wire format for a Packet. Networks
+// that serialize packets, NatsNet and UnixNet, use
+// MsgpackCodec unless given another, either directly
+// with SetCodec or through SessionConfig.Codec. Both
+// ends must use the same Codec. Besides MsgpackCodec
+// there are JSONCodec, and ProtobufCodec in protobuf.go.
+type Codec interface {
+	Marshal(p *Packet) ([]byte, error)
+	Unmarshal(b []byte, p *Packet) error
+}
+
+// CodecNetwork is implemented by a Network that
+// serializes packets, and so can use any Codec.
+// The Codec belongs to the Network, so it is shared
+// by every session on that Network.
+type CodecNetwork interface {
+	Network
+	SetCodec(c Codec)
+}
+
+// MsgpackCodec is the default Codec, using the
+// generated msgp methods in swp_gen.go.
+type MsgpackCodec struct{}
+
+// Marshal implements Codec.
+func (MsgpackCodec) Marshal(p *Packet) ([]byte, error) {
+	return p.MarshalMsg(nil)
+}
+
+// Unmarshal implements Codec.
+func (MsgpackCodec) Unmarshal(b []byte, p *Packet) error {
+	_, err := decodePacket(b, p)
+	return err
+}
+
+// ErrMetadataSize is returned for a packet whose
+// Metadata claims more entries than it has bytes for.
+var ErrMetadataSize = fmt.Errorf("swp: packet Metadata claims more entries than the packet holds")
+
+// decodePacket is p.UnmarshalMsg(b) for bytes off the
+// network. The generated code sizes the Metadata map by
+// the count the packet claims, so we check that count
+// first: each entry takes at least two bytes, a key and
+// a value.
+func decodePacket(b []byte, p *Packet) ([]byte, error) {
+	err := checkMetadataSize(b)
+	if err != nil {
+		return b, err
+	}
+	return p.UnmarshalMsg(b)
+}
+
+// checkMetadataSize returns ErrMetadataSize if the
+// Metadata of the packet encoded in b claims more
+// entries than b could hold. Other trouble it leaves
+// for UnmarshalMsg to report.
+func checkMetadataSize(b []byte) error {
+	sz, b, err := msgp.ReadMapHeaderBytes(b)
+	if err != nil {
+		return nil
+	}
+	for i := uint32(0); i < sz; i++ {
+		var key []byte
+		key, b, err = msgp.ReadMapKeyZC(b)
+		if err != nil {
+			return nil
+		}
+		if string(key) == "Metadata" {
+			n, rest, err := msgp.ReadMapHeaderBytes(b)
+			if err == nil && int64(n) > int64(len(rest))/2 {
+				return ErrMetadataSize
+			}
+		}
+		b, err = msgp.Skip(b)
+		if err != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// JSONCodec encodes packets as JSON, as in packetjson.go.
+// It is larger and slower than msgp, but readable.
+type JSONCodec struct{}
+
+// Marshal implements Codec.
+func (JSONCodec) Marshal(p *Packet) ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// Unmarshal implements Codec.
+func (JSONCodec) Unmarshal(b []byte, p *Packet) error {
+	return json.Unmarshal(b, p)
+}
+
+// codecOrDefault returns c, or MsgpackCodec if c is nil.
+func codecOrDefault(c Codec) Codec {
+	if c == nil {
+		return MsgpackCodec{}
+	}
+	return c
+}
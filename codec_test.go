@@ -0,0 +1,111 @@
+package swp
+
+import (
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test100CodecsRoundTripPackets(t *testing.T) {
+
+	cv.Convey("MsgpackCodec, JSONCodec and ProtobufCodec should each round trip a Packet, and a Codec on a Network that can't take one should be refused.", t, func() {
+		pack := &Packet{
+			From:            "A",
+			Dest:            "B",
+			SeqNum:          42,
+			AckNum:          41,
+			TcpEvent:        EventData,
+			Data:            []byte("hello codec"),
+			Blake2bChecksum: Blake2bOfBytes([]byte("hello codec")),
+			Version:         ProtocolVersion,
+		}
+		for _, codec := range []Codec{MsgpackCodec{}, JSONCodec{}, ProtobufCodec{}} {
+			bts, err := codec.Marshal(pack)
+			cv.So(err, cv.ShouldBeNil)
+			var got Packet
+			cv.So(codec.Unmarshal(bts, &got), cv.ShouldBeNil)
+			cv.So(got.From, cv.ShouldEqual, pack.From)
+			cv.So(got.Dest, cv.ShouldEqual, pack.Dest)
+			cv.So(got.SeqNum, cv.ShouldEqual, pack.SeqNum)
+			cv.So(got.AckNum, cv.ShouldEqual, pack.AckNum)
+			cv.So(got.TcpEvent, cv.ShouldEqual, pack.TcpEvent)
+			cv.So(string(got.Data), cv.ShouldEqual, string(pack.Data))
+			cv.So(got.Blake2bChecksum, cv.ShouldResemble, pack.Blake2bChecksum)
+			cv.So(got.Version, cv.ShouldEqual, pack.Version)
+		}
+
+		_, err := NewSession(SessionConfig{Net: NewSimNet(0, time.Millisecond), LocalInbox: "A", DestInbox: "B",
+			WindowMsgCount: 10, WindowByteSz: -1, Timeout: time.Millisecond, Clk: RealClk, Codec: JSONCodec{}})
+		cv.So(err, cv.ShouldNotBeNil)
+	})
+}
+
+func Test167MsgpackCodecChecksMetadataSize(t *testing.T) {
+
+	// a Metadata map claiming 2^28 entries, in 15 bytes.
+	bomb := []byte{0x81, 0xa8, 'M', 'e', 't', 'a', 'd', 'a', 't', 'a', 0xdf, 0x0f, 0xff, 0xff, 0xff}
+	var got Packet
+	bombErr := MsgpackCodec{}.Unmarshal(bomb, &got)
+
+	pack := &Packet{From: "A", Dest: "B", Metadata: map[string]string{"k": "v", "trace": "abc"}}
+	bts, err := MsgpackCodec{}.Marshal(pack)
+	panicOn(err)
+	var back Packet
+	okErr := MsgpackCodec{}.Unmarshal(bts, &back)
+
+	cv.Convey("Given a packet whose Metadata claims more entries than it has bytes for, MsgpackCodec should refuse it without allocating for them, and still decode honest Metadata.", t, func() {
+		cv.So(bombErr, cv.ShouldEqual, ErrMetadataSize)
+		cv.So(got.Metadata == nil, cv.ShouldBeTrue)
+		cv.So(okErr, cv.ShouldBeNil)
+		cv.So(back.Metadata, cv.ShouldResemble, pack.Metadata)
+	})
+}
+
+func Test171ProtobufCodecWireFormat(t *testing.T) {
+
+	tm := time.Unix(0, 1488603967890123456)
+	pack := &Packet{
+		From: "A", Dest: "B", FromSessNonce: "fn", DestSessNonce: "dn",
+		ArrivedAtDestTm: tm, DataSendTm: tm.Add(time.Second), AckReplyTm: tm.Add(2 * time.Second),
+		SeqNum: 42, SeqRetry: 1, AckNum: -1, AckRetry: -777, NackNum: 3, Nak: true,
+		TcpEvent: EventDataAck, AvailReaderBytesCap: 1 << 40, AvailReaderMsgCap: 9,
+		ProposeWindowSize: 32, FromRttEstNsec: 5, FromRttSdNsec: 6, FromRttN: 7,
+		CumulBytesTransmitted: 100, Data: []byte("hello"), DataOffset: 2,
+		Blake2bChecksum: Blake2bOfBytes([]byte("hello")), Parity: true, Control: true,
+		Metadata: map[string]string{"k": "v", "trace": ""}, Version: ProtocolVersion,
+		StreamID: 1 << 31, StreamSeq: 8, Priority: 255, KAReply: true, CompressedSize: 4,
+		CircuitOpen: true, CircuitResetNsec: int64(time.Second), EOF: true, TraceParent: "00-abc", Nonce: []byte{1}, AuthTag: []byte{2},
+	}
+	bts, err := ProtobufCodec{}.Marshal(pack)
+	panicOn(err)
+	var got Packet
+	gotErr := ProtobufCodec{}.Unmarshal(bts, &got)
+
+	// From "A", then an unknown field 99 of each wire type.
+	unknown := []byte{0x0a, 0x01, 'A', 0x98, 0x06, 0x05, 0x99, 0x06, 1, 2, 3, 4, 5, 6, 7, 8,
+		0x9a, 0x06, 0x01, 'x', 0x9d, 0x06, 1, 2, 3, 4}
+	var skipped Packet
+	skipErr := ProtobufCodec{}.Unmarshal(unknown, &skipped)
+
+	var short Packet
+	shortErr := ProtobufCodec{}.Unmarshal(bts[:len(bts)-1], &short)
+
+	empty, err := ProtobufCodec{}.Marshal(&Packet{})
+	panicOn(err)
+
+	cv.Convey("ProtobufCodec should round trip every field of a Packet in the wire format of packet.proto, skip fields it doesn't know, refuse truncated bytes, and leave zero fields out.", t, func() {
+		cv.So(gotErr, cv.ShouldBeNil)
+		cv.So(got.ArrivedAtDestTm.Equal(pack.ArrivedAtDestTm), cv.ShouldBeTrue)
+		cv.So(got.DataSendTm.Equal(pack.DataSendTm), cv.ShouldBeTrue)
+		cv.So(got.AckReplyTm.Equal(pack.AckReplyTm), cv.ShouldBeTrue)
+		got.ArrivedAtDestTm, got.DataSendTm, got.AckReplyTm = pack.ArrivedAtDestTm, pack.DataSendTm, pack.AckReplyTm
+		cv.So(&got, cv.ShouldResemble, pack)
+		cv.So(bts[:3], cv.ShouldResemble, []byte{0x0a, 0x01, 'A'})
+
+		cv.So(skipErr, cv.ShouldBeNil)
+		cv.So(skipped.From, cv.ShouldEqual, "A")
+		cv.So(shortErr, cv.ShouldEqual, ErrProtobuf)
+		cv.So(len(empty), cv.ShouldEqual, 0)
+	})
+}
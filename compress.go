@@ -0,0 +1,135 @@
+package swp
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// Packet compression.
+//
+// With SessionConfig.Compress set, the sender deflates
+// each data packet's Data, before any encryption, and
+// sends it so when that makes it smaller, recording the
+// compressed length in Packet.CompressedSize. A packet
+// that doesn't shrink goes as it is, with CompressedSize
+// 0. The receiver inflates any packet with a non-zero
+// CompressedSize, just after decrypting it. The packet
+// delivered keeps its CompressedSize, for the curious.
+//
+// Inflating is where a peer could hurt us, with a few
+// bytes that inflate to gigabytes, so a receiver only
+// inflates with Compress set itself, and stops at
+// RecvWindowSizeBytes, the most it would ever buffer;
+// a packet that would inflate past that, or that
+// arrives compressed without Compress, is dropped and
+// counted in DecompressFailures. So set Compress at
+// both ends, and keep each packet's Data within the
+// receiver's byte window.
+//
+// As with encryption, the Blake2bChecksum is over the
+// Data sent, and flow control counts those bytes.
+// TotalBytesUncompressed and TotalBytesCompressed count
+// the Data before and after, so a packet sent as it is
+// counts the same in both. SessionStats.CompressionRatio
+// is their ratio over our latest compressionWindow
+// packets. FEC parity covers the Data sent, and a
+// packet it rebuilds is inflated like any other.
+
+// ErrDecompress means a packet's Data did not inflate,
+// within the limit.
+var ErrDecompress = fmt.Errorf("swp: packet failed decompression")
+
+// compressionWindow is how many recent packets
+// SessionStats.CompressionRatio covers.
+const compressionWindow = 128
+
+// packetCompressor deflates the Data of the packets
+// we send. Only the sendloop uses it.
+type packetCompressor struct {
+	w   *flate.Writer
+	buf bytes.Buffer
+
+	// the uncompressed and compressed length of
+	// each of our latest packets, in a ring.
+	orig []int64
+	sent []int64
+	next int
+
+	// recentOrig and recentSent are the sums of orig
+	// and sent, for CompressionRatio. Read with
+	// atomic.LoadInt64.
+	recentOrig int64
+	recentSent int64
+}
+
+func newPacketCompressor() *packetCompressor {
+	// only fails on a bad level.
+	w, err := flate.NewWriter(nil, flate.BestSpeed)
+	panicOn(err)
+	return &packetCompressor{
+		w:    w,
+		orig: make([]int64, compressionWindow),
+		sent: make([]int64, compressionWindow),
+	}
+}
+
+// compress replaces pack.Data with its deflation,
+// setting pack.CompressedSize, if that is shorter.
+// Only the sendloop calls it.
+func (s *SenderState) compress(pack *Packet) {
+	c := s.compressor
+	orig := len(pack.Data)
+	c.buf.Reset()
+	c.w.Reset(&c.buf)
+	c.w.Write(pack.Data)
+	c.w.Close()
+	if c.buf.Len() < orig {
+		pack.Data = append([]byte(nil), c.buf.Bytes()...)
+		pack.CompressedSize = int64(len(pack.Data))
+	}
+	atomic.AddInt64(&s.TotalBytesUncompressed, int64(orig))
+	atomic.AddInt64(&s.TotalBytesCompressed, int64(len(pack.Data)))
+
+	i := c.next
+	atomic.AddInt64(&c.recentOrig, int64(orig)-c.orig[i])
+	atomic.AddInt64(&c.recentSent, int64(len(pack.Data))-c.sent[i])
+	c.orig[i] = int64(orig)
+	c.sent[i] = int64(len(pack.Data))
+	c.next = (i + 1) % compressionWindow
+}
+
+// CompressionRatio returns the Data bytes we sent over
+// those we were given, across our latest
+// compressionWindow packets: 0.25 means they shrank to
+// a quarter. It is 0 without Compress, or before the
+// first packet. It is safe to call from any goroutine.
+func (s *SenderState) CompressionRatio() float64 {
+	if s.compressor == nil {
+		return 0
+	}
+	orig := atomic.LoadInt64(&s.compressor.recentOrig)
+	if orig == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&s.compressor.recentSent)) / float64(orig)
+}
+
+// decompress replaces pack.Data with its inflation,
+// returning an error, and leaving pack alone, if
+// it doesn't inflate to at most limit bytes.
+func decompress(pack *Packet, limit int64) error {
+	if int(pack.CompressedSize) != len(pack.Data) {
+		return ErrDecompress
+	}
+	rd := flate.NewReader(bytes.NewReader(pack.Data))
+	// read one past the limit, to know we'd go over.
+	plain, err := io.ReadAll(io.LimitReader(rd, limit+1))
+	if err != nil || int64(len(plain)) > limit {
+		return ErrDecompress
+	}
+	pack.Data = plain
+	return nil
+}
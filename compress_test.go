@@ -0,0 +1,130 @@
+package swp
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test155CompressedSession(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe(func(cfg *SessionConfig) { cfg.Compress = true })
+	panicOn(err)
+	defer cleanup()
+
+	n := 8
+	var want [][]byte
+	for i := 0; i < n; i++ {
+		data := bytes.Repeat([]byte(fmt.Sprintf("packet %v ", i)), 100)
+		want = append(want, data)
+		A.Push(&Packet{From: "A", Dest: "B", Data: data, TcpEvent: EventData})
+	}
+	// too short to shrink, so it goes as it is.
+	want = append(want, []byte("x"))
+	A.Push(&Packet{From: "A", Dest: "B", Data: []byte("x"), TcpEvent: EventData})
+
+	var got []*Packet
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for len(got) < len(want) {
+		seq, err := B.ReadCtx(ctx)
+		if err != nil {
+			break
+		}
+		got = append(got, seq.Seq...)
+	}
+
+	cv.Convey("Given SessionConfig.Compress at both ends, data packets should go deflated and arrive as they were pushed, and SessionStats.CompressionRatio should say how much they shrank", t, func() {
+		cv.So(len(got), cv.ShouldEqual, len(want))
+		for i, pack := range got {
+			cv.So(pack.Data, cv.ShouldResemble, want[i])
+		}
+		for _, pack := range got[:n] {
+			cv.So(pack.CompressedSize, cv.ShouldBeGreaterThan, 0)
+			cv.So(pack.CompressedSize, cv.ShouldBeLessThan, len(pack.Data))
+		}
+		cv.So(got[n].CompressedSize, cv.ShouldEqual, 0)
+
+		snd := A.Swp.Sender
+		var total int64
+		for _, w := range want {
+			total += int64(len(w))
+		}
+		cv.So(atomic.LoadInt64(&snd.TotalBytesUncompressed), cv.ShouldEqual, total)
+		cv.So(atomic.LoadInt64(&snd.TotalBytesCompressed), cv.ShouldBeLessThan, total/4)
+
+		ratio := A.Stats().CompressionRatio
+		cv.So(ratio, cv.ShouldBeGreaterThan, 0)
+		cv.So(ratio, cv.ShouldBeLessThan, 0.25)
+		cv.So(B.Stats().CompressionRatio, cv.ShouldEqual, 0)
+		cv.So(atomic.LoadInt64(&B.Swp.Recver.DecompressFailures), cv.ShouldEqual, 0)
+	})
+}
+
+// deflated returns data deflated, as the sender would send it.
+func deflated(data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	panicOn(err)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func Test159DecompressIsBoundedAndConfigured(t *testing.T) {
+
+	inject := func(A, B *Session, data []byte) {
+		net := A.Net.(*SimNet)
+		panicOn(net.InjectPacket("B", &Packet{
+			From:            "A",
+			Dest:            "B",
+			FromSessNonce:   A.LocalSessNonce,
+			DestSessNonce:   B.LocalSessNonce,
+			SeqNum:          0,
+			AckNum:          -1,
+			TcpEvent:        EventData,
+			Version:         ProtocolVersion,
+			Data:            data,
+			Blake2bChecksum: Blake2bOfBytes(data),
+			CompressedSize:  int64(len(data)),
+		}))
+	}
+	waitFail := func(B *Session) int64 {
+		for i := 0; i < 100 && atomic.LoadInt64(&B.Swp.Recver.DecompressFailures) == 0; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		return atomic.LoadInt64(&B.Swp.Recver.DecompressFailures)
+	}
+
+	// a few KB that inflate to 16MB.
+	A, B, cleanup, err := SwpPipe(func(cfg *SessionConfig) { cfg.Compress = true })
+	panicOn(err)
+	bomb := deflated(make([]byte, 16<<20))
+	inject(A, B, bomb)
+	bombFails := waitFail(B)
+	bombDelivered := len(B.Swp.Recver.RecvHistory)
+	limit := B.Swp.Recver.RecvWindowSizeBytes
+	cleanup()
+
+	// compressed data for a receiver without Compress.
+	A, B, cleanup, err = SwpPipe()
+	panicOn(err)
+	inject(A, B, deflated(bytes.Repeat([]byte("abc"), 100)))
+	unconfiguredFails := waitFail(B)
+	unconfiguredDelivered := len(B.Swp.Recver.RecvHistory)
+	cleanup()
+
+	cv.Convey("Given a packet that would inflate past RecvWindowSizeBytes, or one that arrives compressed at a receiver without Compress, the receiver should drop it, counting it in DecompressFailures, and deliver nothing.", t, func() {
+		cv.So(len(bomb), cv.ShouldBeLessThan, limit)
+		cv.So(bombFails, cv.ShouldEqual, 1)
+		cv.So(bombDelivered, cv.ShouldEqual, 0)
+		cv.So(unconfiguredFails, cv.ShouldEqual, 1)
+		cv.So(unconfiguredDelivered, cv.ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,195 @@
+package swp
+
+import (
+	"math"
+	"time"
+)
+
+// CongAlgo picks how CongCtrl grows and shrinks Cwnd
+// outside of slow start.
+type CongAlgo int
+
+const (
+	// CongAlgoAIMD is Reno: add one packet per window
+	// acked, and halve on loss.
+	CongAlgoAIMD CongAlgo = 0
+
+	// CongAlgoCUBIC is CUBIC (RFC 8312): shrink to Beta of
+	// the window on loss, then grow along a cubic in the
+	// time since, back to the window of the loss and on
+	// past it. It gets back up faster than AIMD after a
+	// loss from a big window. See CubicState.
+	CongAlgoCUBIC CongAlgo = 1
+)
+
+// CongCtrl implements loss-based congestion control
+// in the style of TCP Reno: slow start, congestion
+// avoidance, and a multiplicative decrease on loss.
+// The congestion window Cwnd is measured in packets
+// (our MSS is one packet), and the sender keeps
+// its in-flight count under min(Cwnd, flow control window).
+//
+// CongCtrl is only accessed from the sender goroutine.
+type CongCtrl struct {
+	Cwnd      float64
+	Ssthresh  float64
+	MinCwnd   float64
+	MaxCwnd   float64
+	SlowStart bool
+
+	// counts of loss events, for diagnostics.
+	Timeouts     int64
+	TripleDupAck int64
+
+	lastAckNum int64
+	dupAcks    int
+
+	// Cubic is nil for AIMD.
+	Cubic *CubicState
+}
+
+// CUBIC constants, from RFC 8312.
+const (
+	CubicC    = 0.4
+	CubicBeta = 0.7
+)
+
+// CubicState is the CUBIC part of a CongCtrl. On each
+// loss it notes the window in WMax; the window then
+// follows W(t) = C(t-K)^3 + WMax, with t the seconds
+// since the first ack after the loss, and K the time at
+// which W(t) gets back to WMax. We leave out RFC 8312's
+// TCP-friendly region, as our peers are all CUBIC or AIMD
+// sessions of our own.
+type CubicState struct {
+	WMax float64
+	K    float64
+
+	clk        Clock
+	epochStart time.Time
+}
+
+// NewCubicCongCtrl is NewCongCtrl for CongAlgoCUBIC;
+// clk times the cubic.
+func NewCubicCongCtrl(maxCwnd int64, clk Clock) *CongCtrl {
+	c := NewCongCtrl(maxCwnd)
+	c.Cubic = &CubicState{clk: clk}
+	return c
+}
+
+// onLoss notes cwnd as the window of a loss, and
+// returns the window to back off to.
+func (u *CubicState) onLoss(cwnd float64) float64 {
+	u.WMax = cwnd
+	u.epochStart = time.Time{}
+	return CubicBeta * cwnd
+}
+
+// grow returns cwnd after one more ack in congestion
+// avoidance.
+func (u *CubicState) grow(cwnd float64) float64 {
+	now := u.clk.Now()
+	if u.epochStart.IsZero() {
+		// first ack since the loss starts the clock.
+		u.epochStart = now
+		if cwnd < u.WMax {
+			u.K = math.Cbrt((u.WMax - cwnd) / CubicC)
+		} else {
+			u.K = 0
+			u.WMax = cwnd
+		}
+	}
+	t := now.Sub(u.epochStart).Seconds()
+	target := CubicC*math.Pow(t-u.K, 3) + u.WMax
+	if target > cwnd {
+		return cwnd + (target-cwnd)/cwnd
+	}
+	// at or over the curve: creep, so the next
+	// loss can still find the limit.
+	return cwnd + 0.01/cwnd
+}
+
+// NewCongCtrl returns a CongCtrl in slow start
+// with a Cwnd of 1, that will never grow Cwnd
+// beyond maxCwnd.
+func NewCongCtrl(maxCwnd int64) *CongCtrl {
+	return &CongCtrl{
+		Cwnd:       1,
+		Ssthresh:   float64(maxCwnd),
+		MinCwnd:    2,
+		MaxCwnd:    float64(maxCwnd),
+		SlowStart:  true,
+		lastAckNum: -1,
+	}
+}
+
+// Window returns the number of packets the
+// congestion window currently allows in flight.
+func (c *CongCtrl) Window() int64 {
+	w := int64(c.Cwnd)
+	if w < 1 {
+		w = 1
+	}
+	return w
+}
+
+// OnTimeout is called when a retry deadline expires.
+// We restart from slow start.
+func (c *CongCtrl) OnTimeout() {
+	c.Timeouts++
+	if c.Cubic != nil {
+		c.Ssthresh = c.Cubic.onLoss(c.Cwnd)
+	} else {
+		c.Ssthresh = c.Cwnd / 2
+	}
+	if c.Ssthresh < c.MinCwnd {
+		c.Ssthresh = c.MinCwnd
+	}
+	c.Cwnd = 1
+	c.SlowStart = true
+	c.dupAcks = 0
+}
+
+// OnAck is called for each data ack, with the
+// number of packets that ack newly acknowledged.
+func (c *CongCtrl) OnAck(ackNum int64, numNewlyAcked int) {
+	if numNewlyAcked == 0 {
+		if ackNum == c.lastAckNum {
+			c.dupAcks++
+			if c.dupAcks == 3 {
+				// fast recovery: halve (or for CUBIC, back
+				// off to Beta), and skip slow start.
+				c.TripleDupAck++
+				if c.Cubic != nil {
+					c.Ssthresh = c.Cubic.onLoss(c.Cwnd)
+				} else {
+					c.Ssthresh = c.Cwnd / 2
+				}
+				if c.Ssthresh < 1 {
+					c.Ssthresh = 1
+				}
+				c.Cwnd = c.Ssthresh
+				c.SlowStart = false
+			}
+		}
+		return
+	}
+	c.lastAckNum = ackNum
+	c.dupAcks = 0
+
+	for i := 0; i < numNewlyAcked; i++ {
+		if c.SlowStart {
+			c.Cwnd++
+			if c.Cwnd >= c.Ssthresh {
+				c.SlowStart = false
+			}
+		} else if c.Cubic != nil {
+			c.Cwnd = c.Cubic.grow(c.Cwnd)
+		} else {
+			c.Cwnd += 1 / c.Cwnd
+		}
+	}
+	if c.Cwnd > c.MaxCwnd {
+		c.Cwnd = c.MaxCwnd
+	}
+}
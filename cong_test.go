@@ -0,0 +1,134 @@
+package swp
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test064CongestionControlUnderLoss(t *testing.T) {
+
+	const n = 100
+	run := func(cong bool) (elap time.Duration, got int64, cc *CongCtrl) {
+		lossProb := float64(0.05)
+		lat := time.Millisecond
+		net := NewSimNet(lossProb, lat)
+		rtt := 2 * lat
+
+		A, B, cleanup, err := SwpPipe(WithNet(net), WithTimeout(rtt), OnlyOn("A", func(cfg *SessionConfig) { cfg.CongestionControl = cong }))
+		panicOn(err)
+
+		A.SelfConsumeForTesting()
+		B.SelfConsumeForTesting()
+
+		t0 := time.Now()
+		go func() {
+			for i := 0; i < n; i++ {
+				A.Push(&Packet{
+					From:     "A",
+					Dest:     "B",
+					Data:     []byte(fmt.Sprintf("%v", i)),
+					TcpEvent: EventData,
+				})
+			}
+		}()
+		for time.Since(t0) < 20*time.Second {
+			got = B.CountPacketsReadConsumed()
+			if got >= n {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		elap = time.Since(t0)
+
+		cleanup()
+		return elap, got, A.Swp.Sender.Cong
+	}
+
+	elapOff, gotOff, _ := run(false)
+	elapOn, gotOn, cc := run(true)
+
+	fmt.Printf("\n throughput under 5%% loss, %v packets:\n", n)
+	fmt.Printf("   congestion control off: %8.1f packets/sec  %s\n", float64(gotOff)/elapOff.Seconds(), bar(float64(gotOff)/elapOff.Seconds()))
+	fmt.Printf("   congestion control on:  %8.1f packets/sec  %s\n", float64(gotOn)/elapOn.Seconds(), bar(float64(gotOn)/elapOn.Seconds()))
+	fmt.Printf("   with cwnd=%.2f ssthresh=%.2f after %v timeouts and %v triple-dup-acks\n", cc.Cwnd, cc.Ssthresh, cc.Timeouts, cc.TripleDupAck)
+
+	cv.Convey("Given 5% packet loss, all packets should be delivered both with and without congestion control, and loss should have shrunk the congestion window at least once.", t, func() {
+		cv.So(gotOff, cv.ShouldEqual, n)
+		cv.So(gotOn, cv.ShouldEqual, n)
+		cv.So(cc.Timeouts+cc.TripleDupAck, cv.ShouldBeGreaterThan, 0)
+	})
+}
+
+// bar draws a crude horizontal bar graph, one # per 100.
+func bar(x float64) string {
+	s := ""
+	for i := 0; i < int(x/100); i++ {
+		s += "#"
+	}
+	return s
+}
+
+func Test122CubicRecoversFasterThanAIMD(t *testing.T) {
+
+	clk := &SimClock{}
+	clk.Set(time.Now())
+	aimd := NewCongCtrl(100)
+	cubic := NewCubicCongCtrl(100, clk)
+	for _, c := range []*CongCtrl{aimd, cubic} {
+		c.Cwnd = 50
+		c.SlowStart = false
+		c.lastAckNum = 10
+		// three dup acks: a loss.
+		for i := 0; i < 3; i++ {
+			c.OnAck(10, 0)
+		}
+	}
+	aimdBackoff, cubicBackoff := aimd.Cwnd, cubic.Cwnd
+
+	// a window's worth of acks each second, for 6 seconds.
+	ack := int64(10)
+	for i := 0; i < 6; i++ {
+		clk.Advance(time.Second)
+		ack += int64(cubic.Window())
+		aimd.OnAck(ack, int(aimd.Window()))
+		cubic.OnAck(ack, int(cubic.Window()))
+	}
+	k := math.Cbrt(50 * (1 - CubicBeta) / CubicC)
+
+	// and a whole session under loss.
+	lossProb := float64(0.05)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	rtt := 2 * lat
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithTimeout(rtt), OnlyOn("A", func(cfg *SessionConfig) { cfg.CongestionAlgorithm = CongAlgoCUBIC }))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+	n := int64(100)
+	go func() {
+		for i := int64(0); i < n; i++ {
+			A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+		}
+	}()
+	t0 := time.Now()
+	for B.CountPacketsReadConsumed() < n && time.Since(t0) < 20*time.Second {
+		time.Sleep(time.Millisecond)
+	}
+	got := B.CountPacketsReadConsumed()
+	cleanup()
+
+	cv.Convey("Given a loss at a window of 50, CUBIC should back off to 35 where AIMD halves to 25, and be back past 50 within a few seconds where AIMD is not; and a CUBIC session under 5% loss should deliver everything.", t, func() {
+		cv.So(aimdBackoff, cv.ShouldEqual, 25)
+		cv.So(cubicBackoff, cv.ShouldEqual, 35)
+		cv.So(cubic.Cubic.WMax, cv.ShouldEqual, 50)
+		cv.So(cubic.Cubic.K, cv.ShouldAlmostEqual, k, 1e-9)
+		cv.So(cubic.Cwnd, cv.ShouldBeGreaterThan, 50)
+		cv.So(aimd.Cwnd, cv.ShouldBeLessThan, 50)
+		cv.So(A.Swp.Sender.Cong.Cubic, cv.ShouldNotBeNil)
+		cv.So(got, cv.ShouldEqual, n)
+	})
+}
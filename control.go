@@ -0,0 +1,67 @@
+package swp
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Out-of-band control messages.
+//
+// A Packet with Control set skips the sliding window
+// entirely: it gets no sequence number (SeqNum is -1),
+// takes no window space, is never retried, and is
+// handed to the remote Session's ControlCh as soon
+// as it arrives, without regard to ordering. Use it
+// for urgent signals such as "cancel transfer" that
+// must get through even when the data window is full.
+
+// DefaultControlChSz is the buffer size of ControlCh.
+// Control packets that arrive while it is full are dropped.
+const DefaultControlChSz = 64
+
+// SendControl sends pack as an out-of-band control
+// message, bypassing flow control. Since control
+// messages aren't retried, delivery is best effort.
+func (s *Session) SendControl(pack *Packet) error {
+	select {
+	case s.Swp.Sender.SendControl <- pack:
+		return nil
+	case <-s.Swp.Sender.Halt.ReqStop.Chan:
+		if err := s.Swp.Sender.GetErr(); err != nil {
+			return err
+		}
+		return ErrSessDone
+	}
+}
+
+// doControlSend fills in the addressing for
+// a control packet and sends it.
+func (s *SenderState) doControlSend(pack *Packet) error {
+	pack.Control = true
+	pack.From = s.Inbox
+	pack.Dest = s.Dest
+	pack.FromSessNonce = s.LocalSessNonce
+	pack.DestSessNonce = s.RemoteSessNonce
+	pack.SeqNum = -1
+	pack.AckNum = -1
+	pack.DataSendTm = s.Clk.Now()
+	pack.Version = ProtocolVersion
+	if s.cipher != nil && len(pack.Data) > 0 {
+		// only fails if crypto/rand does.
+		panicOn(s.cipher.seal(pack, s.LocalSessNonce))
+	}
+	pack.Blake2bChecksum = Blake2bOfBytes(pack.Data)
+	return s.netSend(pack, fmt.Sprintf("control from %v", s.Inbox))
+}
+
+// deliverControl hands a control packet to the
+// ControlCh consumer, dropping it if ControlCh is full
+// so that the recvloop is never held up.
+func (r *RecvState) deliverControl(pack *Packet) {
+	select {
+	case r.ControlCh <- pack:
+	default:
+		atomic.AddInt64(&r.ControlDropped, 1)
+		//p("%v ControlCh full, dropping control packet", r.Inbox)
+	}
+}
@@ -0,0 +1,43 @@
+package swp
+
+import (
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test074ControlBypassesFullWindow(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe(WithWindowMsgCount(3))
+	panicOn(err)
+
+	// B never reads data, so A's window fills up.
+	go func() {
+		for i := 0; i < 10; i++ {
+			if A.Push(&Packet{From: "A", Dest: "B", Data: []byte("data"), TcpEvent: EventData}) != nil {
+				return
+			}
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	err = A.SendControl(&Packet{Data: []byte("cancel transfer")})
+	panicOn(err)
+
+	var ctl *Packet
+	select {
+	case ctl = <-B.ControlCh:
+	case <-time.After(time.Second):
+	}
+
+	cleanup()
+
+	cv.Convey("Given a full data window, a Control packet should still be delivered on ControlCh, without a SeqNum, ahead of the blocked data.", t, func() {
+		cv.So(ctl, cv.ShouldNotBeNil)
+		cv.So(string(ctl.Data), cv.ShouldEqual, "cancel transfer")
+		cv.So(ctl.Control, cv.ShouldBeTrue)
+		cv.So(ctl.SeqNum, cv.ShouldEqual, -1)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, 3)
+	})
+}
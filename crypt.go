@@ -0,0 +1,246 @@
+package swp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Packet encryption.
+//
+// With SessionConfig.EncryptionKey set, the sender seals
+// the Data of each data and control packet with
+// AES-256-GCM, putting the random nonce in Packet.Nonce,
+// and the receiver opens it again before anything else
+// looks at Data. The SeqNum is authenticated with the
+// Data, so it can't be replayed under another SeqNum.
+//
+// Every packet we send, acks, keepalives, parity and
+// control packets included, also carries an AuthTag:
+// an HMAC-SHA256 of all of its header fields, Metadata,
+// and Data as sent. The receiver checks it before it
+// looks at anything else in the packet, and drops any
+// that fail. The one field left out is ArrivedAtDestTm,
+// which is stamped on arrival. The AuthTag is made
+// afresh for each send, as a retry changes the header.
+//
+// Keys come from HKDF-SHA256, from the root key and the
+// label "From->Dest|FromSessNonce": each direction of
+// each session gets its own, so both ends share one
+// EncryptionKey, and a packet from one session fails
+// authentication in any other.
+//
+// The Blake2bChecksum is over the sealed Data, and
+// the receiver's flow control counts sealed bytes, which
+// run 16 more per packet. Metadata is authenticated but
+// not encrypted; parity Data is made from sealed Data,
+// so it needs no sealing itself.
+
+// EncryptionKeySz is the length of an EncryptionKey.
+const EncryptionKeySz = 32
+
+// ErrBadEncryptionKey is returned by NewSession for
+// an EncryptionKey that is not EncryptionKeySz bytes long.
+var ErrBadEncryptionKey = fmt.Errorf("swp: EncryptionKey must be %v bytes", EncryptionKeySz)
+
+// ErrDecrypt means a packet failed AES-GCM authentication:
+// a wrong key, or Data changed on the way.
+var ErrDecrypt = fmt.Errorf("swp: packet failed decryption")
+
+// ErrPacketAuth means a packet's AuthTag did not match:
+// a wrong key, another session's packet, or a header
+// changed on the way.
+var ErrPacketAuth = fmt.Errorf("swp: packet failed authentication")
+
+// GenerateKey sets cfg.EncryptionKey to a new random key,
+// and returns it, to be given to the peer's SessionConfig.
+func (cfg *SessionConfig) GenerateKey() ([]byte, error) {
+	key := make([]byte, EncryptionKeySz)
+	_, err := cryptorand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	cfg.EncryptionKey = key
+	return key, nil
+}
+
+// packetCipher seals, opens, and authenticates the
+// packets of one direction. The sender's is used by the
+// sendloop and the receiver's by the recvloop, but mut
+// guards the keys all the same.
+type packetCipher struct {
+	root  []byte
+	label string
+
+	mut  sync.Mutex
+	last *sessionKeys
+}
+
+// sessionKeys are the keys of one direction
+// of the session whose sender has sessNonce.
+type sessionKeys struct {
+	sessNonce string
+	aead      cipher.AEAD
+	macKey    []byte
+}
+
+// newPacketCipher keeps root, to derive the keys
+// for label as each session's nonce comes along.
+func newPacketCipher(root []byte, label string) (*packetCipher, error) {
+	if len(root) != EncryptionKeySz {
+		return nil, ErrBadEncryptionKey
+	}
+	return &packetCipher{root: append([]byte(nil), root...), label: label}, nil
+}
+
+// keys returns the keys for the session whose
+// sender has sessNonce, deriving them on a change.
+func (c *packetCipher) keys(sessNonce string) (*sessionKeys, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if c.last != nil && c.last.sessNonce == sessNonce {
+		return c.last, nil
+	}
+	km := hkdfSHA256(c.root, []byte(c.label+"|"+sessNonce), 2*EncryptionKeySz)
+	block, err := aes.NewCipher(km[:EncryptionKeySz])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	c.last = &sessionKeys{sessNonce: sessNonce, aead: aead, macKey: km[EncryptionKeySz:]}
+	return c.last, nil
+}
+
+// seal replaces pack.Data with its encryption, under
+// a fresh pack.Nonce and the keys of the session with
+// sessNonce, ours. pack.SeqNum must already be set.
+func (c *packetCipher) seal(pack *Packet, sessNonce string) error {
+	k, err := c.keys(sessNonce)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, k.aead.NonceSize())
+	_, err = cryptorand.Read(nonce)
+	if err != nil {
+		return err
+	}
+	pack.Nonce = nonce
+	pack.Data = k.aead.Seal(nil, nonce, pack.Data, seqnoAD(pack.SeqNum))
+	return nil
+}
+
+// open replaces pack.Data with its decryption, or
+// returns ErrDecrypt and leaves pack alone.
+func (c *packetCipher) open(pack *Packet) error {
+	k, err := c.keys(pack.FromSessNonce)
+	if err != nil || len(pack.Nonce) != k.aead.NonceSize() {
+		return ErrDecrypt
+	}
+	plain, err := k.aead.Open(nil, pack.Nonce, pack.Data, seqnoAD(pack.SeqNum))
+	if err != nil {
+		return ErrDecrypt
+	}
+	pack.Data = plain
+	return nil
+}
+
+// sign sets pack.AuthTag. Call it last thing
+// before the send, once the header is final.
+func (c *packetCipher) sign(pack *Packet) error {
+	k, err := c.keys(pack.FromSessNonce)
+	if err != nil {
+		return err
+	}
+	pack.AuthTag = packetMAC(k.macKey, pack)
+	return nil
+}
+
+// verify returns ErrPacketAuth unless pack.AuthTag
+// is right for it.
+func (c *packetCipher) verify(pack *Packet) error {
+	k, err := c.keys(pack.FromSessNonce)
+	if err != nil || len(pack.AuthTag) != sha256.Size {
+		return ErrPacketAuth
+	}
+	if !hmac.Equal(pack.AuthTag, packetMAC(k.macKey, pack)) {
+		return ErrPacketAuth
+	}
+	return nil
+}
+
+// packetMAC is the HMAC-SHA256, under key, of all that
+// pack carries bar its AuthTag and ArrivedAtDestTm. The
+// header is msgp encoded; Metadata goes separately, in
+// key order, as map order varies.
+func packetMAC(key []byte, pack *Packet) []byte {
+	hdr := *pack
+	hdr.Data = nil
+	hdr.Metadata = nil
+	hdr.AuthTag = nil
+	hdr.ArrivedAtDestTm = time.Time{}
+	bts, err := hdr.MarshalMsg(nil)
+	panicOn(err)
+
+	h := hmac.New(sha256.New, key)
+	macWrite(h, bts)
+	keys := make([]string, 0, len(pack.Metadata))
+	for k := range pack.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		macWrite(h, []byte(k))
+		macWrite(h, []byte(pack.Metadata[k]))
+	}
+	macWrite(h, pack.Data)
+	return h.Sum(nil)
+}
+
+// macWrite writes b to h, length first, so
+// that no two inputs to packetMAC run together.
+func macWrite(h hash.Hash, b []byte) {
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(b)))
+	h.Write(n[:])
+	h.Write(b)
+}
+
+// seqnoAD is the additional data authenticated with
+// each packet.
+func seqnoAD(seqno int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(seqno))
+	return b
+}
+
+// hkdfSHA256 is HKDF (RFC 5869) with SHA-256, no salt,
+// and info, returning n bytes of key.
+func hkdfSHA256(secret, info []byte, n int) []byte {
+	// extract; a missing salt is HashLen zero bytes.
+	ext := hmac.New(sha256.New, make([]byte, sha256.Size))
+	ext.Write(secret)
+	prk := ext.Sum(nil)
+
+	// expand
+	var out, prev []byte
+	for i := byte(1); len(out) < n; i++ {
+		h := hmac.New(sha256.New, prk)
+		h.Write(prev)
+		h.Write(info)
+		h.Write([]byte{i})
+		prev = h.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:n]
+}
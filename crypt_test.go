@@ -0,0 +1,176 @@
+package swp
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test119EncryptedSession(t *testing.T) {
+
+	var cfg SessionConfig
+	key, err := cfg.GenerateKey()
+	panicOn(err)
+	A, B, cleanup, err := SwpPipe(WithConfig(func(cfg *SessionConfig) { cfg.EncryptionKey = key }))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	net := A.Net.(*SimNet)
+	rtt := A.Cfg.Timeout
+
+	// C has the wrong key, so gets nothing from A.
+	wrongKey := make([]byte, EncryptionKeySz)
+	C, err := NewSession(SessionConfig{Net: net, LocalInbox: "C", DestInbox: "A", WindowMsgCount: 10, WindowByteSz: -1, Timeout: rtt, Clk: RealClk, EncryptionKey: wrongKey})
+	panicOn(err)
+
+	_, badKeyErr := NewSession(SessionConfig{Net: net, LocalInbox: "D", DestInbox: "A", WindowMsgCount: 10, WindowByteSz: -1, Timeout: rtt, Clk: RealClk, EncryptionKey: key[:16]})
+
+	n := 5
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("secret %v", i)), TcpEvent: EventData})
+	}
+	var got []string
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for len(got) < n {
+		seq, err := B.ReadCtx(ctx)
+		if err != nil {
+			break
+		}
+		for _, pack := range seq.Seq {
+			got = append(got, string(pack.Data))
+		}
+	}
+	wire := A.Swp.Sender.SendHistory[0]
+
+	// replay A's first packet, sealed for B, to C.
+	forged := *wire
+	forged.Dest = "C"
+	forged.DestSessNonce = ""
+	panicOn(net.Send(&forged, "forged"))
+	time.Sleep(50 * time.Millisecond)
+	failures := atomic.LoadInt64(&C.Swp.Recver.DecryptFailures)
+
+	cleanup()
+	C.Stop()
+
+	cv.Convey("Given a shared EncryptionKey, data should cross the network sealed and arrive in the clear; a peer with the wrong key should count a DecryptFailure and deliver nothing; and a short key should be refused.", t, func() {
+		cv.So(len(got), cv.ShouldEqual, n)
+		for i := range got {
+			cv.So(got[i], cv.ShouldEqual, fmt.Sprintf("secret %v", i))
+		}
+		cv.So(len(wire.Nonce), cv.ShouldEqual, fecNonceSz)
+		cv.So(bytes.Contains(wire.Data, []byte("secret")), cv.ShouldBeFalse)
+		cv.So(failures, cv.ShouldEqual, 1)
+		cv.So(atomic.LoadInt64(&C.Swp.Recver.CumulBytesDelivered), cv.ShouldEqual, 0)
+		cv.So(badKeyErr, cv.ShouldEqual, ErrBadEncryptionKey)
+	})
+}
+
+func Test120HKDFMatchesRFC5869(t *testing.T) {
+
+	cv.Convey("Given RFC 5869 test case 3, with no salt or info, hkdfSHA256 should give the published output key.", t, func() {
+		ikm := bytes.Repeat([]byte{0x0b}, 22)
+		okm := hkdfSHA256(ikm, nil, 42)
+		cv.So(hex.EncodeToString(okm), cv.ShouldEqual, "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8")
+	})
+}
+
+func Test160EncryptionAuthenticatesEveryPacket(t *testing.T) {
+
+	var cfg SessionConfig
+	key, err := cfg.GenerateKey()
+	panicOn(err)
+	A, B, cleanup, err := SwpPipe(func(cfg *SessionConfig) { cfg.EncryptionKey = key })
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+	net := A.Net.(*SimNet)
+
+	var mut sync.Mutex
+	var wire []*Packet
+	sniff := func(pack *Packet) {
+		mut.Lock()
+		wire = append(wire, pack)
+		mut.Unlock()
+	}
+	net.Sniff("A", sniff)
+	net.Sniff("B", sniff)
+
+	n := 5
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("secret %v", i)), TcpEvent: EventData})
+	}
+	panicOn(A.SendControl(&Packet{Data: []byte("cancel transfer")}))
+	var ctl *Packet
+	select {
+	case ctl = <-B.Swp.Recver.ControlCh:
+	case <-time.After(2 * time.Second):
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	drainErr := A.Drain(ctx)
+
+	// a forged CircuitOpen, with no AuthTag.
+	panicOn(net.InjectPacket("A", &Packet{
+		From:          "B",
+		Dest:          "A",
+		FromSessNonce: B.LocalSessNonce,
+		DestSessNonce: A.LocalSessNonce,
+		SeqNum:        -1,
+		AckNum:        -1,
+		Control:       true,
+		CircuitOpen:   true,
+		DataSendTm:    time.Now(),
+		Version:       ProtocolVersion,
+	}))
+	for i := 0; i < 100 && atomic.LoadInt64(&A.Swp.Recver.DecryptFailures) == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	forgedFailures := atomic.LoadInt64(&A.Swp.Recver.DecryptFailures)
+	forgedWait := A.Swp.Sender.CircuitWait()
+
+	mut.Lock()
+	sniffed := wire
+	wire = nil
+	mut.Unlock()
+
+	// another session between the same inboxes gets other keys.
+	c, err := newPacketCipher(key, "A->B")
+	panicOn(err)
+	k1, err := c.keys("session-1")
+	panicOn(err)
+	k1mac := k1.macKey
+	k2, err := c.keys("session-2")
+	panicOn(err)
+
+	cv.Convey("Given a shared EncryptionKey, every packet, acks and control packets included, should carry an AuthTag; control Data should go sealed; a forged CircuitOpen without an AuthTag should be dropped, leaving the sender running; and each session should get its own keys.", t, func() {
+		cv.So(drainErr, cv.ShouldBeNil)
+		cv.So(len(sniffed), cv.ShouldBeGreaterThan, n)
+		var acks, controls int
+		for _, pack := range sniffed {
+			cv.So(len(pack.AuthTag), cv.ShouldEqual, 32)
+			if pack.TcpEvent == EventDataAck {
+				acks++
+			}
+			if pack.Control {
+				controls++
+				cv.So(bytes.Contains(pack.Data, []byte("cancel")), cv.ShouldBeFalse)
+			}
+		}
+		cv.So(acks, cv.ShouldBeGreaterThan, 0)
+		cv.So(controls, cv.ShouldEqual, 1)
+		cv.So(ctl, cv.ShouldNotBeNil)
+		cv.So(string(ctl.Data), cv.ShouldEqual, "cancel transfer")
+		cv.So(forgedFailures, cv.ShouldEqual, 1)
+		cv.So(forgedWait, cv.ShouldBeFalse)
+		cv.So(bytes.Equal(k1mac, k2.macKey), cv.ShouldBeFalse)
+	})
+}
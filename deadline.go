@@ -0,0 +1,133 @@
+package swp
+
+import (
+	"time"
+)
+
+// deadlineExceededError is returned by Push, Read, and
+// ReadCtx once a deadline set with SetDeadline,
+// SetReadDeadline, or SetWriteDeadline passes.
+// It implements net.Error, with Timeout() true.
+type deadlineExceededError struct{}
+
+func (e *deadlineExceededError) Error() string   { return "i/o timeout: swp session deadline exceeded" }
+func (e *deadlineExceededError) Timeout() bool   { return true }
+func (e *deadlineExceededError) Temporary() bool { return true }
+
+// ErrDeadlineExceeded is a net.Error with Timeout() == true.
+var ErrDeadlineExceeded error = &deadlineExceededError{}
+
+// SetDeadline sets both the read and write deadlines,
+// as in net.Conn. The zero time clears them. As with
+// net.Conn, a new deadline applies to calls already
+// blocked, too.
+func (s *Session) SetDeadline(t time.Time) error {
+	s.mut.Lock()
+	s.readDeadline = t
+	s.writeDeadline = t
+	s.deadlineChangedLocked()
+	s.mut.Unlock()
+	return nil
+}
+
+// SetReadDeadline sets the deadline for Read and
+// ReadCtx calls. The zero time clears it.
+func (s *Session) SetReadDeadline(t time.Time) error {
+	s.mut.Lock()
+	s.readDeadline = t
+	s.deadlineChangedLocked()
+	s.mut.Unlock()
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for Push and
+// Write calls. The zero time clears it.
+func (s *Session) SetWriteDeadline(t time.Time) error {
+	s.mut.Lock()
+	s.writeDeadline = t
+	s.deadlineChangedLocked()
+	s.mut.Unlock()
+	return nil
+}
+
+// deadlineChangedLocked wakes the calls blocked on
+// the old deadlines. Call with s.mut held.
+func (s *Session) deadlineChangedLocked() {
+	if s.deadlineChanged != nil {
+		close(s.deadlineChanged)
+		s.deadlineChanged = nil
+	}
+}
+
+// getReadDeadline returns the read deadline, and a
+// channel closed when any deadline next changes.
+func (s *Session) getReadDeadline() (t time.Time, changed <-chan struct{}) {
+	s.mut.Lock()
+	t = s.readDeadline
+	changed = s.deadlineChangedChLocked()
+	s.mut.Unlock()
+	return
+}
+
+// getWriteDeadline is getReadDeadline for the
+// write deadline.
+func (s *Session) getWriteDeadline() (t time.Time, changed <-chan struct{}) {
+	s.mut.Lock()
+	t = s.writeDeadline
+	changed = s.deadlineChangedChLocked()
+	s.mut.Unlock()
+	return
+}
+
+// deadlineChangedChLocked returns the channel that the
+// next deadline change closes. Call with s.mut held.
+func (s *Session) deadlineChangedChLocked() chan struct{} {
+	if s.deadlineChanged == nil {
+		s.deadlineChanged = make(chan struct{})
+	}
+	return s.deadlineChanged
+}
+
+// deadlineWait is what a blocked call selects on for
+// its deadline: expired fires once it passes, and
+// changed once a Set*Deadline call changes it, to have
+// the call look again. With no deadline, expired stays
+// nil and no timer is made.
+type deadlineWait struct {
+	timer   *time.Timer
+	expired <-chan time.Time
+	changed <-chan struct{}
+}
+
+// arm readies w for deadline dl, got along with changed.
+func (w *deadlineWait) arm(dl time.Time, changed <-chan struct{}) {
+	w.stop()
+	w.changed = changed
+	if !dl.IsZero() {
+		w.timer = time.NewTimer(time.Until(dl))
+		w.expired = w.timer.C
+	}
+}
+
+// stop releases w's timer, if any.
+func (w *deadlineWait) stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+		w.expired = nil
+	}
+}
+
+// TimeoutErrors returns the channel on which the sender
+// reports each packet that exhausted its MaxRetries.
+// Unlike ErrCh, which carries the session-fatal error,
+// these identify the individual packets involved, so
+// the application can decide whether to resend them.
+func (s *Session) TimeoutErrors() <-chan TimeoutError {
+	return s.Swp.Sender.TimeoutErrors
+}
+
+// pastDeadline is true if dl is set and has passed.
+func pastDeadline(dl time.Time) bool {
+	return !dl.IsZero() && !time.Now().Before(dl)
+}
@@ -0,0 +1,42 @@
+package swp
+
+// dedupSet remembers the most recent max SeqNum
+// delivered to the consumer, evicting the oldest
+// first, so that the receiver can drop a replay
+// of something it has already handed over.
+type dedupSet struct {
+	seen map[int64]bool
+	ring []int64
+	next int
+	full bool
+}
+
+func newDedupSet(max int) *dedupSet {
+	return &dedupSet{
+		seen: make(map[int64]bool, max),
+		ring: make([]int64, max),
+	}
+}
+
+// has reports whether seqno is in the set.
+func (d *dedupSet) has(seqno int64) bool {
+	return d.seen[seqno]
+}
+
+// add puts seqno in the set, evicting the
+// oldest entry if we are at capacity.
+func (d *dedupSet) add(seqno int64) {
+	if d.seen[seqno] {
+		return
+	}
+	if d.full {
+		delete(d.seen, d.ring[d.next])
+	}
+	d.ring[d.next] = seqno
+	d.seen[seqno] = true
+	d.next++
+	if d.next == len(d.ring) {
+		d.next = 0
+		d.full = true
+	}
+}
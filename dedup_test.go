@@ -0,0 +1,30 @@
+package swp
+
+import (
+	"testing"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test072DedupSetEvictsOldest(t *testing.T) {
+
+	cv.Convey("Given a dedupSet of size 3, it should remember the 3 most recently added SeqNum, and forget older ones.", t, func() {
+		d := newDedupSet(3)
+		for i := int64(0); i < 3; i++ {
+			d.add(i)
+		}
+		cv.So(d.has(0), cv.ShouldBeTrue)
+		cv.So(d.has(2), cv.ShouldBeTrue)
+		cv.So(d.has(3), cv.ShouldBeFalse)
+
+		d.add(3)
+		cv.So(d.has(0), cv.ShouldBeFalse)
+		cv.So(d.has(1), cv.ShouldBeTrue)
+		cv.So(d.has(3), cv.ShouldBeTrue)
+
+		// re-adding is a no-op, and doesn't evict.
+		d.add(3)
+		cv.So(d.has(1), cv.ShouldBeTrue)
+		cv.So(len(d.seen), cv.ShouldEqual, 3)
+	})
+}
@@ -0,0 +1,81 @@
+package swp
+
+import (
+	"context"
+)
+
+// Draining the send window.
+//
+// DrainWindow waits for everything sent to be acked.
+// It asks the sendloop for a drained channel: one
+// already closed if nothing is in flight, else
+// drainNotify, which the sendloop closes at the top of
+// its loop once the last in-flight slot is gone, be it
+// acked or given up on under MaxRetries. The next
+// DrainWindow to find packets in flight makes a new one.
+//
+// A Push has returned once the sendloop has taken its
+// packet, and the sendloop sends it before looking at
+// the next request, so a DrainWindow after Push always
+// waits for that packet too.
+
+// drainReq asks the sendloop for a channel that is
+// closed once nothing is in flight, closing done
+// when drained is set.
+type drainReq struct {
+	drained chan struct{}
+	done    chan struct{}
+}
+
+// DrainWindow blocks until every packet sent has been
+// acked, and the send window is empty. It returns
+// ctx.Err() if ctx is done first, and ErrSessDone if the
+// sender shuts down.
+func (s *SenderState) DrainWindow(ctx context.Context) error {
+	req := &drainReq{done: make(chan struct{})}
+	select {
+	case s.drainCh <- req:
+		<-req.done
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.Halt.ReqStop.Chan:
+		return ErrSessDone
+	}
+	select {
+	case <-req.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.Halt.ReqStop.Chan:
+		return ErrSessDone
+	}
+}
+
+// drainWaiter returns the channel for a DrainWindow
+// to wait on. Only the sendloop calls it.
+func (s *SenderState) drainWaiter() chan struct{} {
+	if s.SentButNotAckedBySeqNum.tree.Len() == 0 {
+		ch := make(chan struct{})
+		close(ch)
+		return ch
+	}
+	if s.drainNotify == nil {
+		s.drainNotify = make(chan struct{})
+	}
+	return s.drainNotify
+}
+
+// noteInflight wakes the DrainWindow callers once
+// msgInflight reaches zero. Only the sendloop calls it.
+func (s *SenderState) noteInflight(msgInflight int64) {
+	if msgInflight == 0 && s.drainNotify != nil {
+		close(s.drainNotify)
+		s.drainNotify = nil
+	}
+}
+
+// Drain blocks until everything Push-ed so far has been
+// acked by the peer; see SenderState.DrainWindow.
+func (s *Session) Drain(ctx context.Context) error {
+	return s.Swp.Sender.DrainWindow(ctx)
+}
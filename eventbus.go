@@ -0,0 +1,161 @@
+package swp
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/glycerine/idem"
+)
+
+// EventType identifies a protocol lifecycle Event.
+type EventType int
+
+const (
+	PacketSent          EventType = 1
+	PacketAcked         EventType = 2
+	PacketRetransmitted EventType = 3
+	PacketDropped       EventType = 4
+	WindowOpened        EventType = 5
+	WindowClosed        EventType = 6
+	SessionError        EventType = 7
+)
+
+func (e EventType) String() string {
+	switch e {
+	case PacketSent:
+		return "PacketSent"
+	case PacketAcked:
+		return "PacketAcked"
+	case PacketRetransmitted:
+		return "PacketRetransmitted"
+	case PacketDropped:
+		return "PacketDropped"
+	case WindowOpened:
+		return "WindowOpened"
+	case WindowClosed:
+		return "WindowClosed"
+	case SessionError:
+		return "SessionError"
+	}
+	return "UnknownEventType"
+}
+
+// Event describes something that happened in the protocol.
+// SeqNum is -1 for events not about a particular packet.
+// For SessionError, Extra holds the error.
+type Event struct {
+	Type      EventType
+	SeqNum    int64
+	Timestamp time.Time
+	Extra     interface{}
+}
+
+// EventHandler is called, one Event at a time, on
+// the EventBus dispatch goroutine.
+type EventHandler func(ev Event)
+
+// DefaultEventBusCap is the default number of Events
+// held for dispatch before new ones are dropped.
+const DefaultEventBusCap = 1000
+
+// EventBus hands protocol Events to subscribers. Events
+// are queued on a buffered channel and dispatched on
+// a goroutine of their own, so the sender and receiver
+// never wait on a slow handler; if the queue is full
+// the Event is dropped and counted in Dropped. Read
+// Dropped with atomic.LoadInt64.
+type EventBus struct {
+	Dropped int64
+
+	mut    sync.Mutex
+	subs   map[int64]EventHandler
+	nextID int64
+
+	ch   chan Event
+	Halt *idem.Halter
+}
+
+// NewEventBus makes an EventBus with room for capacity
+// queued Events, and starts its dispatch goroutine.
+func NewEventBus(capacity int) *EventBus {
+	if capacity <= 0 {
+		capacity = DefaultEventBusCap
+	}
+	b := &EventBus{
+		subs: make(map[int64]EventHandler),
+		ch:   make(chan Event, capacity),
+		Halt: idem.NewHalter(),
+	}
+	go b.dispatch()
+	return b
+}
+
+func (b *EventBus) dispatch() {
+	defer b.Halt.Done.Close()
+	for {
+		select {
+		case ev := <-b.ch:
+			b.mut.Lock()
+			hs := make([]EventHandler, 0, len(b.subs))
+			for _, h := range b.subs {
+				hs = append(hs, h)
+			}
+			b.mut.Unlock()
+			for _, h := range hs {
+				h(ev)
+			}
+		case <-b.Halt.ReqStop.Chan:
+			return
+		}
+	}
+}
+
+// emit queues an Event without blocking. It is safe
+// to call on a nil *EventBus, which discards the Event.
+func (b *EventBus) emit(typ EventType, seqno int64, now time.Time, extra interface{}) {
+	if b == nil {
+		return
+	}
+	select {
+	case b.ch <- Event{Type: typ, SeqNum: seqno, Timestamp: now, Extra: extra}:
+	default:
+		atomic.AddInt64(&b.Dropped, 1)
+	}
+}
+
+// Stop shuts down the dispatch goroutine. Queued
+// Events not yet dispatched are discarded.
+func (b *EventBus) Stop() {
+	b.Halt.ReqStop.Close()
+	<-b.Halt.Done.Chan
+}
+
+// Subscription is returned by Session.Subscribe.
+type Subscription struct {
+	bus *EventBus
+	id  int64
+}
+
+// Subscribe registers handler to receive every
+// subsequent Event from the session.
+func (s *Session) Subscribe(handler EventHandler) Subscription {
+	b := s.Events
+	b.mut.Lock()
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = handler
+	b.mut.Unlock()
+	return Subscription{bus: b, id: id}
+}
+
+// Unsubscribe stops delivery to the handler. An Event
+// already being dispatched may still reach it.
+func (sub Subscription) Unsubscribe() {
+	if sub.bus == nil {
+		return
+	}
+	sub.bus.mut.Lock()
+	delete(sub.bus.subs, sub.id)
+	sub.bus.mut.Unlock()
+}
@@ -0,0 +1,52 @@
+package swp
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test083EventBusReportsLifecycle(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe(WithWindowMsgCount(3))
+	panicOn(err)
+
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	var mut sync.Mutex
+	count := make(map[EventType]int)
+	sub := A.Subscribe(func(ev Event) {
+		mut.Lock()
+		count[ev.Type]++
+		mut.Unlock()
+	})
+
+	n := 10
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("data"), TcpEvent: EventData})
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	sub.Unsubscribe()
+	mut.Lock()
+	sentBefore := count[PacketSent]
+	mut.Unlock()
+	A.Push(&Packet{From: "A", Dest: "B", Data: []byte("unseen"), TcpEvent: EventData})
+	time.Sleep(50 * time.Millisecond)
+
+	cleanup()
+
+	mut.Lock()
+	defer mut.Unlock()
+	cv.Convey("Given 10 pushes through a window of 3, subscribers should see every PacketSent and PacketAcked, and the window closing and reopening; after Unsubscribe, nothing more.", t, func() {
+		cv.So(sentBefore, cv.ShouldEqual, n)
+		cv.So(count[PacketSent], cv.ShouldEqual, n)
+		cv.So(count[PacketAcked], cv.ShouldEqual, n)
+		cv.So(count[WindowClosed], cv.ShouldBeGreaterThan, 0)
+		cv.So(count[WindowOpened], cv.ShouldBeGreaterThan, 0)
+		cv.So(PacketRetransmitted.String(), cv.ShouldEqual, "PacketRetransmitted")
+	})
+}
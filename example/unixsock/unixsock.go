@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/glycerine/go-sliding-window"
+)
+
+// unixsock copies stdin from one process to stdout of
+// another over Unix domain sockets, with no broker:
+//
+//	unixsock recv /tmp/b.sock /tmp/a.sock > out &
+//	unixsock send /tmp/a.sock /tmp/b.sock < in
+func main() {
+
+	if len(os.Args) != 4 || (os.Args[1] != "send" && os.Args[1] != "recv") {
+		fmt.Fprintf(os.Stderr, "usage: unixsock send|recv <local socket path> <remote socket path>\n")
+		os.Exit(1)
+	}
+	local, remote := os.Args[2], os.Args[3]
+
+	unet := swp.NewUnixNet()
+	defer unet.Stop()
+
+	to := time.Millisecond * 100
+	sess, err := swp.NewSession(swp.SessionConfig{Net: unet, LocalInbox: local, DestInbox: remote,
+		WindowMsgCount: 1000, WindowByteSz: 1 << 20, Timeout: to, Clk: swp.RealClk,
+		NumFailedKeepAlivesBeforeClosing: -1,
+	})
+	panicOn(err)
+	defer sess.Stop()
+
+	if os.Args[1] == "send" {
+		buf := make([]byte, 1<<16)
+		_, err = io.CopyBuffer(sess, os.Stdin, buf)
+		panicOn(err)
+		// give the last packets time to be acked.
+		time.Sleep(time.Second)
+		return
+	}
+
+	for {
+		select {
+		case seq := <-sess.ReadMessagesCh:
+			for _, pk := range seq.Seq {
+				_, err = os.Stdout.Write(pk.Data)
+				panicOn(err)
+			}
+		case <-sess.Halt.Done.Chan:
+			return
+		}
+	}
+}
+
+func panicOn(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
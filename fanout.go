@@ -0,0 +1,290 @@
+package swp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/glycerine/bchan"
+	"github.com/glycerine/idem"
+)
+
+// FanoutSession provides reliable one-to-many delivery
+// from a single localInbox. Internally it runs one
+// Session (and hence one SWP, with its own sequence
+// number space) per destination. The remote ends
+// are ordinary Sessions with DestInbox set to localInbox.
+//
+// Each destination has its own queue, and its own
+// goroutine pushing from it, so a destination that is
+// briefly slow does not hold up the rest. A queue holds
+// up to a window's worth of packets beyond those in
+// flight; when one is full, Push waits for it. See
+// MaxLag for giving up on a destination instead.
+type FanoutSession struct {
+	Net          Network
+	MyInbox      string
+	Destinations []string
+
+	// MaxLag, if non-zero, bounds how long Push waits
+	// for room in one destination's queue. A destination
+	// that keeps Push waiting longer is marked failed:
+	// it gets nothing more, and WaitAll reports
+	// ErrFanoutDropped. Zero, the default, waits as long
+	// as it takes, so no destination misses a packet.
+	// Set it before the first Push.
+	MaxLag time.Duration
+
+	// Sess holds the per-destination Session,
+	// keyed by destination inbox.
+	Sess map[string]*Session
+
+	Halt *idem.Halter
+
+	mut sync.Mutex
+	// lastAcked holds the CliAcked of the most
+	// recently pushed packet to each destination.
+	// Since acks are cumulative, once it fires
+	// everything pushed before it has been acked too.
+	lastAcked map[string]*bchan.Bchan
+
+	demux map[string]chan *Packet
+
+	// queue and dropped are per destination; dropped
+	// is read and written with atomic, and a non-zero
+	// count marks the destination failed.
+	queue   map[string]chan *Packet
+	dropped map[string]*int64
+	pushers sync.WaitGroup
+}
+
+// ErrFanoutDropped is returned by WaitAll when a
+// destination was marked failed; see MaxLag.
+var ErrFanoutDropped = fmt.Errorf("swp: fanout dropped packets for a lagging destination")
+
+// NewFanoutSession listens on localInbox and starts
+// one Session per entry in destInboxes.
+func NewFanoutSession(net Network, localInbox string, destInboxes []string, windowSz int64, timeout time.Duration) (*FanoutSession, error) {
+	if windowSz < 1 {
+		return nil, fmt.Errorf("windowMsgSz must be 1 or more")
+	}
+
+	f := &FanoutSession{
+		Net:          net,
+		MyInbox:      localInbox,
+		Destinations: destInboxes,
+		Sess:         make(map[string]*Session),
+		Halt:         idem.NewHalter(),
+		lastAcked:    make(map[string]*bchan.Bchan),
+		demux:        make(map[string]chan *Packet),
+		queue:        make(map[string]chan *Packet),
+		dropped:      make(map[string]*int64),
+	}
+	for _, dest := range destInboxes {
+		f.demux[dest] = make(chan *Packet, windowSz)
+		f.queue[dest] = make(chan *Packet, windowSz)
+		f.dropped[dest] = new(int64)
+	}
+
+	// all of our Sessions share localInbox, so
+	// we listen once and route on pack.From.
+	mr, err := net.Listen(localInbox)
+	if err != nil {
+		return nil, err
+	}
+	go f.demuxLoop(mr)
+
+	for _, dest := range destInboxes {
+		sess, err := NewSession(SessionConfig{
+			Net:            &fanoutNet{Network: net, inbox: localInbox, ch: f.demux[dest]},
+			LocalInbox:     localInbox,
+			DestInbox:      dest,
+			WindowMsgCount: windowSz,
+			WindowByteSz:   -1,
+			Timeout:        timeout,
+			Clk:            RealClk,
+		})
+		if err != nil {
+			f.Stop()
+			return nil, err
+		}
+		f.Sess[dest] = sess
+	}
+	for _, dest := range destInboxes {
+		f.pushers.Add(1)
+		go f.pushLoop(dest)
+	}
+	return f, nil
+}
+
+// pushLoop pushes what Push queued for dest into
+// its Session, in order.
+func (f *FanoutSession) pushLoop(dest string) {
+	defer f.pushers.Done()
+	sess := f.Sess[dest]
+	for {
+		select {
+		case pack := <-f.queue[dest]:
+			if sess.Push(pack) != nil {
+				// the Session is done.
+				atomic.AddInt64(f.dropped[dest], 1)
+			}
+		case <-f.Halt.ReqStop.Chan:
+			return
+		}
+	}
+}
+
+func (f *FanoutSession) demuxLoop(mr chan *Packet) {
+	defer f.Halt.Done.Close()
+	for {
+		select {
+		case pack := <-mr:
+			ch, ok := f.demux[pack.From]
+			if !ok {
+				//p("%v fanout dropping packet from unknown '%s'", f.MyInbox, pack.From)
+				continue
+			}
+			select {
+			case ch <- pack:
+			default:
+				// that Session is behind; drop rather
+				// than stall the others. It recovers
+				// as from any lost packet.
+			}
+		case <-f.Halt.ReqStop.Chan:
+			return
+		}
+	}
+}
+
+// Push queues a copy of pack for every destination,
+// waiting while a destination's queue is full (but
+// see MaxLag). It returns ErrSessDone if f is stopped
+// first. Push uses the CliAcked field of the copies
+// internally, so any CliAcked set on pack is ignored.
+func (f *FanoutSession) Push(pack *Packet) error {
+	for _, dest := range f.Destinations {
+		if atomic.LoadInt64(f.dropped[dest]) > 0 {
+			// failed; it gets nothing more.
+			atomic.AddInt64(f.dropped[dest], 1)
+			continue
+		}
+		cp := *pack
+		cp.Dest = dest
+		cp.CliAcked = bchan.New(1)
+		cp.Accounting = nil
+		err := f.enqueue(dest, &cp)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueue puts pack on the queue for dest, marking
+// dest failed if that takes longer than MaxLag.
+func (f *FanoutSession) enqueue(dest string, pack *Packet) error {
+	q := f.queue[dest]
+	select {
+	case q <- pack:
+		f.setLastAcked(dest, pack.CliAcked)
+		return nil
+	default:
+	}
+	var expired <-chan time.Time
+	if f.MaxLag > 0 {
+		t := time.NewTimer(f.MaxLag)
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case q <- pack:
+		f.setLastAcked(dest, pack.CliAcked)
+		return nil
+	case <-expired:
+		//p("%v fanout marking '%s' failed after MaxLag %v", f.MyInbox, dest, f.MaxLag)
+		atomic.AddInt64(f.dropped[dest], 1)
+		return nil
+	case <-f.Halt.ReqStop.Chan:
+		return ErrSessDone
+	}
+}
+
+func (f *FanoutSession) setLastAcked(dest string, ca *bchan.Bchan) {
+	f.mut.Lock()
+	f.lastAcked[dest] = ca
+	f.mut.Unlock()
+}
+
+// Laggards returns, for each destination marked
+// failed, how many packets it has missed.
+func (f *FanoutSession) Laggards() map[string]int64 {
+	lag := make(map[string]int64)
+	for _, dest := range f.Destinations {
+		if n := atomic.LoadInt64(f.dropped[dest]); n > 0 {
+			lag[dest] = n
+		}
+	}
+	return lag
+}
+
+// WaitAll blocks until every destination has acked
+// everything Push-ed so far, or ctx is done. If a
+// destination was marked failed, WaitAll returns
+// ErrFanoutDropped once the rest have acked.
+func (f *FanoutSession) WaitAll(ctx context.Context) error {
+	failed := false
+	for _, dest := range f.Destinations {
+		if atomic.LoadInt64(f.dropped[dest]) > 0 {
+			failed = true
+			continue
+		}
+		f.mut.Lock()
+		ca := f.lastAcked[dest]
+		f.mut.Unlock()
+		if ca == nil {
+			continue
+		}
+		select {
+		case <-ca.Ch:
+			// leave it set for the next WaitAll.
+			ca.BcastAck()
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-f.Sess[dest].Halt.Done.Chan:
+			return ErrSessDone
+		}
+	}
+	if failed {
+		return ErrFanoutDropped
+	}
+	return nil
+}
+
+// Stop shuts down all the per-destination Sessions.
+func (f *FanoutSession) Stop() {
+	for _, sess := range f.Sess {
+		sess.Stop()
+	}
+	f.Halt.ReqStop.Close()
+	<-f.Halt.Done.Chan
+	f.pushers.Wait()
+}
+
+// fanoutNet delivers to one Session of a FanoutSession
+// the packets that the demuxLoop routed to it.
+type fanoutNet struct {
+	Network
+	inbox string
+	ch    chan *Packet
+}
+
+func (n *fanoutNet) Listen(inbox string) (chan *Packet, error) {
+	if inbox != n.inbox {
+		return n.Network.Listen(inbox)
+	}
+	return n.ch, nil
+}
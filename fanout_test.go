@@ -0,0 +1,151 @@
+package swp
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test062FanoutDeliversToAllDestinations(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	net.DiscardOnce = 0
+	rtt := 2 * lat
+
+	B, err := NewSession(SessionConfig{Net: net, LocalInbox: "B", DestInbox: "A", WindowMsgCount: 10, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
+	panicOn(err)
+	C, err := NewSession(SessionConfig{Net: net, LocalInbox: "C", DestInbox: "A", WindowMsgCount: 10, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
+	panicOn(err)
+	B.SelfConsumeForTesting()
+	C.SelfConsumeForTesting()
+
+	A, err := NewFanoutSession(net, "A", []string{"B", "C"}, 10, rtt)
+	panicOn(err)
+
+	for _, s := range []string{"one", "two", "three", "four"} {
+		A.Push(&Packet{
+			From:     "A",
+			Data:     []byte(s),
+			TcpEvent: EventData,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err = A.WaitAll(ctx)
+	cancel()
+
+	A.Stop()
+	B.Stop()
+	C.Stop()
+
+	cv.Convey("Given a FanoutSession from A to B and C, every pushed packet should be delivered in order to both B and C, and WaitAll should return once both have acked.", t, func() {
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, 4)
+		cv.So(len(C.Swp.Recver.RecvHistory), cv.ShouldEqual, 4)
+		cv.So(HistoryEqual(A.Sess["B"].Swp.Sender.SendHistory, B.Swp.Recver.RecvHistory), cv.ShouldBeTrue)
+		cv.So(HistoryEqual(A.Sess["C"].Swp.Sender.SendHistory, C.Swp.Recver.RecvHistory), cv.ShouldBeTrue)
+	})
+}
+
+func Test175FanoutBurstReachesEveryDestination(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	net.DiscardOnce = 0
+	rtt := 2 * lat
+
+	B, err := NewSession(SessionConfig{Net: net, LocalInbox: "B", DestInbox: "A", WindowMsgCount: 10, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
+	panicOn(err)
+	C, err := NewSession(SessionConfig{Net: net, LocalInbox: "C", DestInbox: "A", WindowMsgCount: 10, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
+	panicOn(err)
+	B.SelfConsumeForTesting()
+	C.SelfConsumeForTesting()
+
+	A, err := NewFanoutSession(net, "A", []string{"B", "C"}, 10, rtt)
+	panicOn(err)
+
+	// far more than fits in the windows plus queues,
+	// with nothing pacing it.
+	n := 50
+	var pushErr error
+	for i := 0; i < n && pushErr == nil; i++ {
+		pushErr = A.Push(&Packet{
+			From:     "A",
+			Data:     []byte(fmt.Sprintf("%v", i)),
+			TcpEvent: EventData,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	waitErr := A.WaitAll(ctx)
+	cancel()
+	lag := A.Laggards()
+
+	A.Stop()
+	B.Stop()
+	C.Stop()
+
+	cv.Convey("Given a FanoutSession to B and C, an unpaced burst of 50 pushes should wait for room rather than drop, and reach both B and C whole.", t, func() {
+		cv.So(pushErr, cv.ShouldBeNil)
+		cv.So(waitErr, cv.ShouldBeNil)
+		cv.So(len(lag), cv.ShouldEqual, 0)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, n)
+		cv.So(len(C.Swp.Recver.RecvHistory), cv.ShouldEqual, n)
+		cv.So(HistoryEqual(A.Sess["B"].Swp.Sender.SendHistory, B.Swp.Recver.RecvHistory), cv.ShouldBeTrue)
+		cv.So(HistoryEqual(A.Sess["C"].Swp.Sender.SendHistory, C.Swp.Recver.RecvHistory), cv.ShouldBeTrue)
+	})
+}
+
+func Test176FanoutMaxLagMarksLaggardFailed(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	net.DiscardOnce = 0
+	// C never comes up, so A's Session to it stalls
+	// once its window is full.
+	net.AllowBlackHoleSends = true
+	rtt := 2 * lat
+
+	B, err := NewSession(SessionConfig{Net: net, LocalInbox: "B", DestInbox: "A", WindowMsgCount: 10, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
+	panicOn(err)
+	B.SelfConsumeForTesting()
+
+	A, err := NewFanoutSession(net, "A", []string{"C", "B"}, 10, rtt)
+	panicOn(err)
+	A.MaxLag = 50 * time.Millisecond
+
+	n := 50
+	var pushErr error
+	for i := 0; i < n && pushErr == nil; i++ {
+		pushErr = A.Push(&Packet{
+			From:     "A",
+			Data:     []byte(fmt.Sprintf("%v", i)),
+			TcpEvent: EventData,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	waitErr := A.WaitAll(ctx)
+	cancel()
+	lag := A.Laggards()
+
+	A.Stop()
+	B.Stop()
+
+	cv.Convey("Given a FanoutSession with MaxLag set, to B and to C where C never answers, C should be marked failed and reported, while B still gets every packet.", t, func() {
+		cv.So(pushErr, cv.ShouldBeNil)
+		cv.So(waitErr, cv.ShouldEqual, ErrFanoutDropped)
+		_, bLagged := lag["B"]
+		cv.So(bLagged, cv.ShouldBeFalse)
+		cv.So(lag["C"], cv.ShouldBeGreaterThan, 0)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, n)
+		cv.So(HistoryEqual(A.Sess["B"].Swp.Sender.SendHistory, B.Swp.Recver.RecvHistory), cv.ShouldBeTrue)
+	})
+}
@@ -0,0 +1,231 @@
+package swp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Forward error correction (FEC) with XOR parity.
+//
+// When SessionConfig.FECGroupSize is > 0, the sender
+// follows each group of FECGroupSize data packets
+// with one Parity packet. The parity Data is the XOR
+// of the fecBlock() of each packet in the group.
+// A receiver missing exactly one packet of the group
+// can then rebuild it without waiting for a retransmit.
+//
+// For Parity packets, SeqNum and AckNum give the
+// first and last SeqNum of the group covered.
+//
+// Parity covers each packet as it goes on the wire,
+// compressed and sealed, so the receiver keeps the
+// wire Data of each packet it gets, from before it
+// opens or inflates it, and a rebuilt packet goes back
+// through the recvloop to be opened and inflated like
+// any other. Being rebuilt, it has no AuthTag, but all
+// it is made of was authenticated as it arrived.
+
+// fecHeaderSz: 8 bytes of len(Data), 8 bytes
+// of CumulBytesTransmitted, 4 of StreamID, 8 of
+// StreamSeq, 8 of CompressedSize, and fecNonceSz of
+// Nonce (zero if none) precede Data in a fecBlock.
+const fecHeaderSz = 36 + fecNonceSz
+
+// fecNonceSz is the AES-GCM nonce size; see crypt.go.
+const fecNonceSz = 12
+
+// fecBlock is the portion of pack that
+// parity protects.
+func fecBlock(pack *Packet) []byte {
+	b := make([]byte, fecHeaderSz+len(pack.Data))
+	binary.BigEndian.PutUint64(b[:8], uint64(len(pack.Data)))
+	binary.BigEndian.PutUint64(b[8:16], uint64(pack.CumulBytesTransmitted))
+	binary.BigEndian.PutUint32(b[16:20], pack.StreamID)
+	binary.BigEndian.PutUint64(b[20:28], uint64(pack.StreamSeq))
+	binary.BigEndian.PutUint64(b[28:36], uint64(pack.CompressedSize))
+	copy(b[36:fecHeaderSz], pack.Nonce)
+	copy(b[fecHeaderSz:], pack.Data)
+	return b
+}
+
+// xorInto xors src into dst, growing dst
+// (zero padded) as need be.
+func xorInto(dst, src []byte) []byte {
+	for len(dst) < len(src) {
+		dst = append(dst, 0)
+	}
+	for i := range src {
+		dst[i] ^= src[i]
+	}
+	return dst
+}
+
+// fecAccumulate is called by the sender for each
+// original data send. It sends a parity packet
+// once a full group has been accumulated.
+func (s *SenderState) fecAccumulate(pack *Packet) {
+	if s.FECGroupSize <= 0 {
+		return
+	}
+	if len(s.fecParity) == 0 {
+		s.fecFirst = pack.SeqNum
+	}
+	s.fecParity = xorInto(s.fecParity, fecBlock(pack))
+	if pack.SeqNum-s.fecFirst+1 < int64(s.FECGroupSize) {
+		return
+	}
+
+	now := s.Clk.Now()
+	par := &Packet{
+		From:          s.Inbox,
+		Dest:          s.Dest,
+		FromSessNonce: s.LocalSessNonce,
+		DestSessNonce: s.RemoteSessNonce,
+		SeqNum:        s.fecFirst,
+		SeqRetry:      -555,
+		AckNum:        pack.SeqNum,
+		AckRetry:      -555,
+		DataSendTm:    now,
+		TcpEvent:      EventData,
+		Parity:        true,
+		Data:          s.fecParity,
+		Version:       ProtocolVersion,
+
+		AvailReaderBytesCap: pack.AvailReaderBytesCap,
+		AvailReaderMsgCap:   pack.AvailReaderMsgCap,
+		FromRttEstNsec:      pack.FromRttEstNsec,
+		FromRttSdNsec:       pack.FromRttSdNsec,
+		FromRttN:            pack.FromRttN,
+	}
+	par.Blake2bChecksum = Blake2bOfBytes(par.Data)
+	s.fecParity = nil
+
+	err := s.netSend(par, fmt.Sprintf("fec parity from %v", s.Inbox))
+	if err != nil {
+		// ignore; parity is only an optimization over retry.
+	}
+}
+
+// fecGotParity is called by the receiver upon arrival
+// of a parity packet. Since the parity may overtake
+// the tail of its group on the network, we hold onto
+// it until it is of no further use.
+func (r *RecvState) fecGotParity(par *Packet) {
+	first := par.SeqNum
+
+	// forget anything from earlier groups.
+	for seq := range r.fecRcvd {
+		if seq < first {
+			delete(r.fecRcvd, seq)
+		}
+	}
+	for f, pp := range r.fecPending {
+		if f < first && pp.AckNum < r.NextFrameExpected {
+			delete(r.fecPending, f)
+		}
+	}
+	r.fecPending[first] = par
+	r.fecTry(par)
+}
+
+// fecGotData lets any pending parity covering the
+// newly arrived pack have another try. wire is
+// pack.Data as it arrived, before we opened or
+// inflated it.
+func (r *RecvState) fecGotData(pack *Packet, wire []byte) {
+	cp := *pack
+	cp.Data = wire
+	r.fecRcvd[pack.SeqNum] = &cp
+	for _, par := range r.fecPending {
+		if par.SeqNum <= pack.SeqNum && pack.SeqNum <= par.AckNum {
+			r.fecTry(par)
+		}
+	}
+}
+
+// fecTry rebuilds the one missing packet of the group
+// covered by par, if exactly one is missing, and feeds
+// it back into the recvloop as though it had just arrived.
+func (r *RecvState) fecTry(par *Packet) {
+	first, last := par.SeqNum, par.AckNum
+
+	missing := int64(-1)
+	nmiss := 0
+	parity := append([]byte{}, par.Data...)
+	for seq := first; seq <= last; seq++ {
+		pk, ok := r.fecRcvd[seq]
+		if !ok {
+			missing = seq
+			nmiss++
+			continue
+		}
+		parity = xorInto(parity, fecBlock(pk))
+	}
+	switch {
+	case nmiss > 1:
+		// wait for more of the group to arrive; or leave it to retry.
+		//p("%v fec cannot yet recover %v missing packets in [%v, %v]", r.Inbox, nmiss, first, last)
+		return
+	case nmiss == 0:
+		// nothing lost
+	case missing < r.NextFrameExpected:
+		// already delivered via retry.
+	case len(parity) < fecHeaderSz:
+		mylog.Printf("%v fec parity packet for [%v, %v] is too short", r.Inbox, first, last)
+	default:
+		n := int64(binary.BigEndian.Uint64(parity[:8]))
+		if n < 0 || n > int64(len(parity)-fecHeaderSz) {
+			mylog.Printf("%v fec recovered a bad length %v for SeqNum %v", r.Inbox, n, missing)
+			break
+		}
+		rec := &Packet{
+			From:                  par.From,
+			Dest:                  par.Dest,
+			FromSessNonce:         par.FromSessNonce,
+			DestSessNonce:         par.DestSessNonce,
+			DataSendTm:            par.DataSendTm,
+			SeqNum:                missing,
+			AckNum:                -1,
+			TcpEvent:              EventData,
+			AvailReaderBytesCap:   par.AvailReaderBytesCap,
+			AvailReaderMsgCap:     par.AvailReaderMsgCap,
+			FromRttEstNsec:        par.FromRttEstNsec,
+			FromRttSdNsec:         par.FromRttSdNsec,
+			FromRttN:              par.FromRttN,
+			CumulBytesTransmitted: int64(binary.BigEndian.Uint64(parity[8:16])),
+			Data:                  parity[fecHeaderSz : fecHeaderSz+n],
+			Version:               par.Version,
+			StreamID:              binary.BigEndian.Uint32(parity[16:20]),
+			StreamSeq:             int64(binary.BigEndian.Uint64(parity[20:28])),
+			CompressedSize:        int64(binary.BigEndian.Uint64(parity[28:36])),
+			Nonce:                 fecNonce(parity[36:fecHeaderSz]),
+			recovered:             true,
+		}
+		rec.Blake2bChecksum = Blake2bOfBytes(rec.Data)
+		atomic.AddInt64(&r.FECRecoveries, 1)
+		//p("%v fec recovered SeqNum %v", r.Inbox, missing)
+
+		// hand it back to the recvloop, which we are running on.
+		go func() {
+			select {
+			case r.MsgRecv <- rec:
+			case <-time.After(10 * time.Second):
+			case <-r.Halt.ReqStop.Chan:
+			}
+		}()
+	}
+	delete(r.fecPending, first)
+}
+
+// fecNonce returns a copy of the recovered nonce b,
+// or nil if the packet had none.
+func fecNonce(b []byte) []byte {
+	for _, x := range b {
+		if x != 0 {
+			return append([]byte(nil), b...)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package swp
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test063FECRecoversSingleLoss(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	net.DiscardOnce = 0
+
+	// slow retry, so that parity wins the race
+	// against retransmission.
+	timeout := 400 * time.Millisecond
+
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithWindowMsgCount(3), WithTimeout(timeout), func(cfg *SessionConfig) { cfg.FECGroupSize = 3 })
+	panicOn(err)
+
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	for _, s := range []string{"one", "two", "three!"} {
+		A.Push(&Packet{
+			From:     "A",
+			Dest:     "B",
+			Data:     []byte(s),
+			TcpEvent: EventData,
+		})
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	cleanup()
+
+	cv.Convey("Given FECGroupSize 3 and the loss of the first of 3 packets, B should rebuild the lost packet from the parity packet before any retry.", t, func() {
+		cv.So(atomic.LoadInt64(&B.Swp.Recver.FECRecoveries), cv.ShouldEqual, 1)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, 3)
+		cv.So(string(B.Swp.Recver.RecvHistory[0].Data), cv.ShouldEqual, "one")
+		cv.So(HistoryEqual(A.Swp.Sender.SendHistory, B.Swp.Recver.RecvHistory), cv.ShouldBeTrue)
+	})
+}
+
+// fecRecoverFirst pushes 3 packets over a pipe with
+// FECGroupSize 3 and opt, losing the first, and returns
+// what B received, once parity has had time to rebuild it.
+func fecRecoverFirst(opt SessionOption) (got []string, B *Session) {
+	net := NewSimNet(0, time.Millisecond)
+	net.DiscardOnce = 0
+
+	// slow retry, so that parity wins the race
+	// against retransmission.
+	timeout := 400 * time.Millisecond
+
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithWindowMsgCount(3), WithTimeout(timeout), func(cfg *SessionConfig) { cfg.FECGroupSize = 3 }, opt)
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	for _, s := range []string{strings.Repeat("one ", 50), "two", strings.Repeat("three! ", 30)} {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(s), TcpEvent: EventData})
+	}
+	time.Sleep(100 * time.Millisecond)
+	cleanup()
+
+	for _, pack := range B.Swp.Recver.RecvHistory {
+		got = append(got, string(pack.Data))
+	}
+	return got, B
+}
+
+func fecWant() []string {
+	return []string{strings.Repeat("one ", 50), "two", strings.Repeat("three! ", 30)}
+}
+
+func Test161FECRecoversCompressedLoss(t *testing.T) {
+
+	got, B := fecRecoverFirst(func(cfg *SessionConfig) { cfg.Compress = true })
+
+	cv.Convey("Given FECGroupSize 3 with Compress, and the loss of the first of 3 packets, B should rebuild it from parity over the compressed Data, and inflate it.", t, func() {
+		cv.So(atomic.LoadInt64(&B.Swp.Recver.FECRecoveries), cv.ShouldEqual, 1)
+		cv.So(atomic.LoadInt64(&B.Swp.Recver.DecompressFailures), cv.ShouldEqual, 0)
+		cv.So(got, cv.ShouldResemble, fecWant())
+		cv.So(B.Swp.Recver.RecvHistory[0].CompressedSize, cv.ShouldBeGreaterThan, 0)
+	})
+}
+
+func Test162FECRecoversEncryptedLoss(t *testing.T) {
+
+	var cfg SessionConfig
+	key, err := cfg.GenerateKey()
+	panicOn(err)
+	got, B := fecRecoverFirst(func(cfg *SessionConfig) { cfg.EncryptionKey = key })
+
+	cv.Convey("Given FECGroupSize 3 with an EncryptionKey, and the loss of the first of 3 packets, B should rebuild it from parity over the sealed Data, and open it.", t, func() {
+		cv.So(atomic.LoadInt64(&B.Swp.Recver.FECRecoveries), cv.ShouldEqual, 1)
+		cv.So(atomic.LoadInt64(&B.Swp.Recver.DecryptFailures), cv.ShouldEqual, 0)
+		cv.So(got, cv.ShouldResemble, fecWant())
+	})
+}
+
+func Test163FECRecoversCompressedEncryptedLoss(t *testing.T) {
+
+	var cfg SessionConfig
+	key, err := cfg.GenerateKey()
+	panicOn(err)
+	got, B := fecRecoverFirst(func(cfg *SessionConfig) {
+		cfg.Compress = true
+		cfg.EncryptionKey = key
+	})
+
+	cv.Convey("Given FECGroupSize 3 with both Compress and an EncryptionKey, and the loss of the first of 3 packets, B should rebuild it from parity, then open and inflate it.", t, func() {
+		cv.So(atomic.LoadInt64(&B.Swp.Recver.FECRecoveries), cv.ShouldEqual, 1)
+		cv.So(atomic.LoadInt64(&B.Swp.Recver.DecryptFailures), cv.ShouldEqual, 0)
+		cv.So(atomic.LoadInt64(&B.Swp.Recver.DecompressFailures), cv.ShouldEqual, 0)
+		cv.So(got, cv.ShouldResemble, fecWant())
+	})
+}
@@ -1,6 +1,8 @@
 package swp
 
 import (
+	"context"
+	"math"
 	"sync"
 	"time"
 )
@@ -10,6 +12,44 @@ import (
 type FlowCtrl struct {
 	mut  sync.Mutex
 	Flow Flow
+
+	// MaxWindowChangeFraction, if > 0, low-pass filters
+	// the window we advertise: each UpdateFlow may move
+	// AvailReaderMsgCap and AvailReaderBytesCap by at
+	// most this fraction (e.g. 0.25 for 25%), and the
+	// rest is applied a step per RemoteRttEstNsec later,
+	// so the peer doesn't swing between full speed and
+	// stopped. Until we have an RTT estimate, changes
+	// apply in full. Set it before Start.
+	MaxWindowChangeFraction float64
+
+	// SmoothingAlpha, if between 0 and 1, puts the caps
+	// each UpdateFlow is given through an exponential
+	// moving average, smoothed = alpha*new +
+	// (1-alpha)*smoothed, and uses that in their place:
+	// 0.1 smooths heavily, and 1, or 0, not at all. The
+	// average trails the receiver's real window, so we
+	// may send a little more than it has room for as it
+	// closes. It applies ahead of MaxWindowChangeFraction.
+	// Set it before Start.
+	SmoothingAlpha float64
+
+	// the moving averages, which the caps we have
+	// when the first new ones arrive seed.
+	smoothMsgCap   float64
+	smoothBytesCap float64
+	smoothMsgSet   bool
+	smoothBytesSet bool
+
+	// the change still to apply, and whether a
+	// step to apply it is scheduled.
+	remMsgCap        int64
+	remBytesCap      int64
+	remainderPending bool
+
+	// changed is closed, and replaced, whenever
+	// the credits change; see WaitForCredits.
+	changed chan struct{}
 }
 
 // FlowCtrl data is shared by sender and receiver,
@@ -72,6 +112,50 @@ func (r *FlowCtrl) GetFlow() Flow {
 	return cp
 }
 
+// AvailableCredits returns the current
+// AvailReaderBytesCap and AvailReaderMsgCap,
+// for callers outside the SenderState, such as
+// congestion controllers and rate estimators.
+func (r *FlowCtrl) AvailableCredits() (byteCap, msgCap int64) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.Flow.AvailReaderBytesCap, r.Flow.AvailReaderMsgCap
+}
+
+// WaitForCredits blocks until AvailReaderBytesCap is
+// at least neededBytes, so a burst can be checked
+// before it is sent. It returns ctx.Err() if ctx is
+// done first.
+func (r *FlowCtrl) WaitForCredits(ctx context.Context, neededBytes int64) error {
+	for {
+		r.mut.Lock()
+		have := r.Flow.AvailReaderBytesCap
+		if r.changed == nil {
+			r.changed = make(chan struct{})
+		}
+		changed := r.changed
+		r.mut.Unlock()
+
+		if have >= neededBytes {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// creditsChanged wakes any WaitForCredits.
+// Caller holds r.mut.
+func (r *FlowCtrl) creditsChanged() {
+	if r.changed != nil {
+		close(r.changed)
+		r.changed = nil
+	}
+}
+
 // UpdateFlow updates the
 // flow information.
 // It returns the latest
@@ -90,17 +174,86 @@ func (r *FlowCtrl) UpdateFlow(who string, net Network,
 
 	r.mut.Lock()
 	defer r.mut.Unlock()
-	if availReaderMsgCap >= 0 {
-		r.Flow.AvailReaderMsgCap = availReaderMsgCap
-	}
-	if availReaderBytesCap >= 0 {
-		r.Flow.AvailReaderBytesCap = availReaderBytesCap
-	}
 	if pack != nil && pack.FromRttN > r.Flow.RemoteRttN {
 		r.Flow.RemoteRttEstNsec = pack.FromRttEstNsec
 		r.Flow.RemoteRttSdNsec = pack.FromRttSdNsec
 		r.Flow.RemoteRttN = pack.FromRttN
 	}
+	if availReaderMsgCap >= 0 {
+		target := r.smooth(&r.smoothMsgCap, &r.smoothMsgSet, r.Flow.AvailReaderMsgCap, availReaderMsgCap)
+		r.Flow.AvailReaderMsgCap, r.remMsgCap = r.clampChange(r.Flow.AvailReaderMsgCap, target)
+	}
+	if availReaderBytesCap >= 0 {
+		target := r.smooth(&r.smoothBytesCap, &r.smoothBytesSet, r.Flow.AvailReaderBytesCap, availReaderBytesCap)
+		r.Flow.AvailReaderBytesCap, r.remBytesCap = r.clampChange(r.Flow.AvailReaderBytesCap, target)
+	}
+	r.scheduleRemainder()
+	if availReaderMsgCap >= 0 || availReaderBytesCap >= 0 {
+		r.creditsChanged()
+	}
 	cp := r.Flow
 	return cp
 }
+
+// smooth folds cur into the moving average avg, which
+// prev seeds the first time, and returns the new
+// average, or cur itself without a SmoothingAlpha.
+// Caller holds r.mut.
+func (r *FlowCtrl) smooth(avg *float64, set *bool, prev, cur int64) int64 {
+	alpha := r.SmoothingAlpha
+	if alpha <= 0 || alpha >= 1 {
+		return cur
+	}
+	if !*set {
+		*avg = float64(prev)
+		*set = true
+	}
+	*avg = alpha*float64(cur) + (1-alpha)*(*avg)
+	return int64(math.Round(*avg))
+}
+
+// clampChange returns how far from cur toward target
+// MaxWindowChangeFraction lets us go now, and the
+// change that remains. Caller holds r.mut.
+func (r *FlowCtrl) clampChange(cur, target int64) (next, rem int64) {
+	if r.MaxWindowChangeFraction <= 0 || r.Flow.RemoteRttEstNsec <= 0 {
+		return target, 0
+	}
+	base := cur
+	if target > base {
+		base = target
+	}
+	step := int64(math.Ceil(r.MaxWindowChangeFraction * float64(base)))
+	if step < 1 {
+		step = 1
+	}
+	next = target
+	switch {
+	case target > cur+step:
+		next = cur + step
+	case target < cur-step:
+		next = cur - step
+	}
+	return next, target - next
+}
+
+// scheduleRemainder has a goroutine apply the next
+// step of any remaining change, one RTT from now.
+// Caller holds r.mut.
+func (r *FlowCtrl) scheduleRemainder() {
+	if r.remainderPending || (r.remMsgCap == 0 && r.remBytesCap == 0) {
+		return
+	}
+	r.remainderPending = true
+	time.AfterFunc(time.Duration(r.Flow.RemoteRttEstNsec), r.applyRemainder)
+}
+
+func (r *FlowCtrl) applyRemainder() {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.remainderPending = false
+	r.Flow.AvailReaderMsgCap, r.remMsgCap = r.clampChange(r.Flow.AvailReaderMsgCap, r.Flow.AvailReaderMsgCap+r.remMsgCap)
+	r.Flow.AvailReaderBytesCap, r.remBytesCap = r.clampChange(r.Flow.AvailReaderBytesCap, r.Flow.AvailReaderBytesCap+r.remBytesCap)
+	r.creditsChanged()
+	r.scheduleRemainder()
+}
@@ -1,9 +1,12 @@
 package swp
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"os"
 	"runtime/pprof"
+	"sync/atomic"
 	"time"
 
 	cv "github.com/glycerine/goconvey/convey"
@@ -81,14 +84,10 @@ func Test008ProvidesFlowControlToThrottleOverSending(t *testing.T) {
 
 	rtt := 100 * lat
 
-	A, err := NewSession(SessionConfig{Net: anet, LocalInbox: "A", DestInbox: "B",
-		WindowMsgCount: 1, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
-	panicOn(err)
 	p("receiver only wants 1 at a time")
 	// for some reason 1 at a time thrases the semaphores
 	// somewhere in the Go runtime.
-	B, err := NewSession(SessionConfig{Net: bnet, LocalInbox: "B", DestInbox: "A",
-		WindowMsgCount: 1, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
+	A, B, cleanup, err := SwpPipe(OnlyOn("A", WithNet(anet)), OnlyOn("B", WithNet(bnet)), WithWindowMsgCount(1), WithTimeout(rtt))
 	panicOn(err)
 
 	// easier to reason about when manually debugging,
@@ -172,8 +171,7 @@ func Test008ProvidesFlowControlToThrottleOverSending(t *testing.T) {
 	}
 	<-readsAllDone
 
-	A.Stop()
-	B.Stop()
+	cleanup()
 
 	cv.Convey("Given a faster sender A and a slower receiver B, flow-control in the SWP should throttle back the sender so it doesn't overwhelm the downstream receiver's buffers. The current test verifies that flow control was exerted and only one message at a time was sent before it being read by the consumer appliadtion.", t, func() {
 		cv.So(len(A.Swp.Sender.SendHistory), cv.ShouldEqual, n)
@@ -195,11 +193,7 @@ func Test009SimNetVerifiesFlowControlNotViolated(t *testing.T) {
 	net := NewSimNet(lossProb, lat)
 	rtt := 1000 * lat
 
-	A, err := NewSession(SessionConfig{Net: net, LocalInbox: "A", DestInbox: "B",
-		WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
-	panicOn(err)
-	B, err := NewSession(SessionConfig{Net: net, LocalInbox: "B", DestInbox: "A",
-		WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithWindowMsgCount(3), WithTimeout(rtt))
 	panicOn(err)
 
 	A.SelfConsumeForTesting()
@@ -238,8 +232,7 @@ func Test009SimNetVerifiesFlowControlNotViolated(t *testing.T) {
 
 	time.Sleep(1000 * time.Millisecond)
 
-	A.Stop()
-	B.Stop()
+	cleanup()
 
 	smy := net.Summary()
 	smy.Print()
@@ -253,3 +246,303 @@ func Test009SimNetVerifiesFlowControlNotViolated(t *testing.T) {
 		cv.So(HistoryEqual(A.Swp.Sender.SendHistory, B.Swp.Recver.RecvHistory), cv.ShouldBeTrue)
 	})
 }
+
+// shrinkNet advertises a tiny receiver window in every
+// packet headed to "A" while shrink is set.
+type shrinkNet struct {
+	*SimNet
+	shrink int32
+}
+
+func (n *shrinkNet) Send(pack *Packet, why string) error {
+	if pack.Dest == "A" && atomic.LoadInt32(&n.shrink) == 1 {
+		cp := *pack
+		cp.AvailReaderMsgCap = 2
+		pack = &cp
+	}
+	return n.SimNet.Send(pack, why)
+}
+
+func Test086SenderRespectsShrunkenWindow(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	sim := NewSimNet(lossProb, lat)
+	// lose SeqNum 0, so that B holds 1..7 and naks.
+	sim.DiscardOnce = 0
+	net := &shrinkNet{SimNet: sim, shrink: 1}
+	rtt := 2 * lat
+
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithTimeout(rtt))
+	panicOn(err)
+
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	n := 8
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+	}
+	// the 9th must wait for the window to reopen.
+	go A.Push(&Packet{From: "A", Dest: "B", Data: []byte("8"), TcpEvent: EventData})
+	time.Sleep(100 * time.Millisecond)
+	atomic.StoreInt32(&net.shrink, 0)
+	time.Sleep(500 * time.Millisecond)
+
+	cleanup()
+
+	cv.Convey("Given B's window shrinking to 2 with 8 packets in flight, A should notice, hold further sends until it reopens, and still deliver everything in order.", t, func() {
+		cv.So(atomic.LoadInt64(&A.Swp.Sender.WindowShrinks), cv.ShouldBeGreaterThan, 0)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, n+1)
+		cv.So(HistoryDiffString(A.Swp.Sender.SendHistory, B.Swp.Recver.RecvHistory), cv.ShouldEqual, "")
+	})
+}
+
+func Test112MaxBufferedBytesClosesTheWindow(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe(OnlyOn("B", func(cfg *SessionConfig) { cfg.MaxBufferedBytes = 35 }))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+
+	n := 20
+	go func() {
+		for i := 0; i < n; i++ {
+			A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("packet %03d", i)), TcpEvent: EventData})
+		}
+	}()
+	time.Sleep(200 * time.Millisecond)
+	held := B.Swp.Recver.HeldBytes()
+	sent := A.Swp.Sender.HeldBytes()
+	stalled := B.Stats()
+
+	var got []string
+	for len(got) < n {
+		seq, err := B.ReadCtx(context.Background())
+		panicOn(err)
+		for _, pack := range seq.Seq {
+			got = append(got, string(pack.Data))
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	drained := B.Swp.Recver.HeldBytes()
+
+	cleanup()
+
+	cv.Convey("Given MaxBufferedBytes 35 and 10 byte packets, a receiver whose consumer isn't reading should hold only 4 packets, drop the rest unacked, and still deliver them all in order once the consumer reads.", t, func() {
+		cv.So(held, cv.ShouldEqual, 40)
+		cv.So(stalled.HeldBytes, cv.ShouldEqual, 40)
+		cv.So(sent, cv.ShouldEqual, 100)
+		cv.So(stalled.DiscardsByReason.OverMemory, cv.ShouldBeGreaterThan, 0)
+		for i := range got {
+			cv.So(got[i], cv.ShouldEqual, fmt.Sprintf("packet %03d", i))
+		}
+		cv.So(drained, cv.ShouldEqual, 0)
+	})
+}
+
+func Test124SenderPauseAndResume(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	net := A.Net.(*SimNet)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	// lose SeqNum 0 once, so it must be retried while paused.
+	net.mapMut.Lock()
+	net.DiscardOnce = 0
+	net.mapMut.Unlock()
+
+	n := 6
+	for i := 0; i < n/2; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+	}
+	A.Swp.Sender.Pause()
+	pushed := make(chan bool)
+	go func() {
+		for i := n / 2; i < n; i++ {
+			A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+		}
+		close(pushed)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	paused := A.Swp.Sender.Paused()
+	duringPause := B.CountPacketsReadConsumed()
+	sentDuringPause := A.CountPacketsSentForTransfer()
+	var pushReturned bool
+	select {
+	case <-pushed:
+		pushReturned = true
+	default:
+	}
+
+	A.Swp.Sender.Resume()
+	<-pushed
+	for i := 0; i < 100 && B.CountPacketsReadConsumed() < int64(n); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	after := B.CountPacketsReadConsumed()
+
+	cleanup()
+
+	cv.Convey("Given a paused sender, Push should block and nothing new go out, while a lost packet already sent is still retried and delivered; after Resume the rest should follow.", t, func() {
+		cv.So(paused, cv.ShouldBeTrue)
+		cv.So(duringPause, cv.ShouldEqual, n/2)
+		cv.So(sentDuringPause, cv.ShouldEqual, n/2)
+		cv.So(pushReturned, cv.ShouldBeFalse)
+		cv.So(A.Swp.Sender.Paused(), cv.ShouldBeFalse)
+		cv.So(after, cv.ShouldEqual, n)
+		cv.So(HistoryDiffString(A.Swp.Sender.SendHistory, B.Swp.Recver.RecvHistory), cv.ShouldEqual, "")
+	})
+}
+
+func Test132MaxWindowChangeFractionSmoothsTheWindow(t *testing.T) {
+
+	rtt := 10 * time.Millisecond
+	fc := &FlowCtrl{Flow: Flow{AvailReaderMsgCap: 100, AvailReaderBytesCap: 1000}, MaxWindowChangeFraction: 0.25}
+	pack := &Packet{FromRttEstNsec: int64(rtt), FromRttN: 1}
+
+	first := fc.UpdateFlow("test", nil, 0, 1000, pack)
+	for i := 0; i < 100 && fc.GetFlow().AvailReaderMsgCap > 0; i++ {
+		time.Sleep(rtt)
+	}
+	settled := fc.GetFlow()
+
+	unfiltered := &FlowCtrl{Flow: Flow{AvailReaderMsgCap: 100}}
+	jump := unfiltered.UpdateFlow("test", nil, 0, -1, pack)
+
+	cv.Convey("Given MaxWindowChangeFraction 0.25, closing a 100 message window should first only drop it to 75, then reach 0 in later steps, leaving the unchanged byte cap alone; without it, the window should close at once.", t, func() {
+		cv.So(first.AvailReaderMsgCap, cv.ShouldEqual, 75)
+		cv.So(first.AvailReaderBytesCap, cv.ShouldEqual, 1000)
+		cv.So(settled.AvailReaderMsgCap, cv.ShouldEqual, 0)
+		cv.So(settled.AvailReaderBytesCap, cv.ShouldEqual, 1000)
+		cv.So(jump.AvailReaderMsgCap, cv.ShouldEqual, 0)
+	})
+}
+
+func Test141FlowCtrlAvailableCreditsAndWaitForCredits(t *testing.T) {
+
+	fc := &FlowCtrl{Flow: Flow{AvailReaderBytesCap: 100, AvailReaderMsgCap: 3}}
+	byteCap, msgCap := fc.AvailableCredits()
+
+	// already enough.
+	errNow := fc.WaitForCredits(context.Background(), 100)
+
+	// not enough, and never will be.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	errTimeout := fc.WaitForCredits(ctx, 1000)
+	cancel()
+
+	// enough once the window opens.
+	done := make(chan error, 1)
+	go func() { done <- fc.WaitForCredits(context.Background(), 1000) }()
+	time.Sleep(10 * time.Millisecond)
+	fc.UpdateFlow("test", nil, -1, 500, nil)
+	var early bool
+	select {
+	case <-done:
+		early = true
+	case <-time.After(10 * time.Millisecond):
+	}
+	fc.UpdateFlow("test", nil, -1, 2000, nil)
+	var errOpened error
+	select {
+	case errOpened = <-done:
+	case <-time.After(time.Second):
+		errOpened = fmt.Errorf("WaitForCredits still blocked")
+	}
+
+	cv.Convey("Given a FlowCtrl, AvailableCredits should report its credits, and WaitForCredits should return once AvailReaderBytesCap covers what's needed, or when its ctx is done.", t, func() {
+		cv.So(byteCap, cv.ShouldEqual, 100)
+		cv.So(msgCap, cv.ShouldEqual, 3)
+		cv.So(errNow, cv.ShouldBeNil)
+		cv.So(errTimeout, cv.ShouldEqual, context.DeadlineExceeded)
+		cv.So(early, cv.ShouldBeFalse)
+		cv.So(errOpened, cv.ShouldBeNil)
+	})
+}
+
+func Test153ReservedMsgCapHoldsBackHeadroom(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe(OnlyOn("B", func(cfg *SessionConfig) { cfg.ReservedMsgCap = 4 }))
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+
+	push := func(i int) {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+	}
+	// the ack of a first packet tells A of B's window.
+	push(0)
+	seq, err := B.ReadCtx(context.Background())
+	panicOn(err)
+	got := len(seq.Seq)
+	for i := 0; i < 100 && A.Swp.Sender.LargestAckedSeqno() < 0; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	n := 20
+	go func() {
+		for i := 1; i < n; i++ {
+			push(i)
+		}
+	}()
+	time.Sleep(200 * time.Millisecond)
+	ready := B.NumReadyPackets()
+	sent := A.Swp.Sender.LastSeqSent()
+
+	for got < n {
+		seq, err := B.ReadCtx(context.Background())
+		panicOn(err)
+		for _, pack := range seq.Seq {
+			if string(pack.Data) != fmt.Sprintf("%v", got) {
+				panic(fmt.Sprintf("got '%s' for packet %v", pack.Data, got))
+			}
+			got++
+		}
+	}
+
+	_, errBad := NewSession(SessionConfig{Net: NewSimNet(0, 0), LocalInbox: "C", DestInbox: "D", WindowMsgCount: 4, WindowByteSz: -1, Timeout: time.Millisecond, Clk: RealClk, ReservedMsgCap: 4})
+
+	cv.Convey("Given a window of 10 with ReservedMsgCap 4 at B, and a consumer that stops reading, A should only get 6 packets out; and all should arrive once the consumer reads again. A reservation of the whole window is an error.", t, func() {
+		cv.So(ready, cv.ShouldEqual, 6)
+		cv.So(sent, cv.ShouldEqual, 6)
+		cv.So(got, cv.ShouldEqual, n)
+		cv.So(errBad, cv.ShouldNotBeNil)
+	})
+}
+
+func Test156SmoothingAlphaAveragesTheByteCap(t *testing.T) {
+
+	smoothed := &FlowCtrl{Flow: Flow{AvailReaderMsgCap: 10, AvailReaderBytesCap: 1000000}, SmoothingAlpha: 0.1}
+	unfiltered := &FlowCtrl{Flow: Flow{AvailReaderMsgCap: 10, AvailReaderBytesCap: 1000000}, SmoothingAlpha: 1}
+
+	// the receiver's byte cap flips between closed and open.
+	prevS, prevU := int64(1000000), int64(1000000)
+	var maxStepS, maxStepU float64
+	var last int64
+	for i := 0; i < 20; i++ {
+		bytesCap := int64(0)
+		if i%2 == 1 {
+			bytesCap = 1000000
+		}
+		s := smoothed.UpdateFlow("test", nil, -1, bytesCap, nil).AvailReaderBytesCap
+		u := unfiltered.UpdateFlow("test", nil, -1, bytesCap, nil).AvailReaderBytesCap
+		if d := math.Abs(float64(s - prevS)); d > maxStepS {
+			maxStepS = d
+		}
+		if d := math.Abs(float64(u - prevU)); d > maxStepU {
+			maxStepU = d
+		}
+		prevS, prevU, last = s, u, s
+	}
+
+	cv.Convey("Given SmoothingAlpha 0.1, a byte cap flipping between 0 and 1000000 should move the window at most a tenth of the way each time, settling near the middle, and leave the message cap alone; with SmoothingAlpha 1 the window should follow each flip.", t, func() {
+		cv.So(maxStepS, cv.ShouldBeLessThanOrEqualTo, 100000)
+		cv.So(last, cv.ShouldBeGreaterThan, 400000)
+		cv.So(last, cv.ShouldBeLessThan, 600000)
+		cv.So(smoothed.GetFlow().AvailReaderMsgCap, cv.ShouldEqual, 10)
+		cv.So(maxStepU, cv.ShouldEqual, 1000000)
+		cv.So(prevU, cv.ShouldEqual, 1000000)
+	})
+}
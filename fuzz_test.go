@@ -0,0 +1,77 @@
+package swp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// FuzzPacketUnmarshalMsg feeds arbitrary bytes to
+// Packet.UnmarshalMsg, by way of decodePacket, which
+// is how packets off the network reach it. Run it with
+//
+//	go test -run XXX -fuzz FuzzPacketUnmarshalMsg
+//
+// Plain go test runs just the seeds.
+func FuzzPacketUnmarshalMsg(f *testing.F) {
+	now := time.Now()
+	big := make([]byte, 64<<10)
+	for i := range big {
+		big[i] = byte(i)
+	}
+	seeds := []*Packet{
+		{},
+		{From: "A", Dest: "B", SeqNum: 7, SeqRetry: 1, TcpEvent: EventData, DataSendTm: now, Data: []byte("hello"), Blake2bChecksum: Blake2bOfBytes([]byte("hello")), Version: ProtocolVersion},
+		{From: "B", Dest: "A", SeqNum: -99, AckNum: 6, Nak: true, NackNum: 7, TcpEvent: EventDataAck, AvailReaderMsgCap: 10, AvailReaderBytesCap: 1 << 20, AckReplyTm: now},
+		{From: "A", Dest: "B", TcpEvent: EventKeepAlive, ProposeWindowSize: 32},
+		{From: "A", Dest: "B", Control: true, Metadata: map[string]string{"trace": "abc"}, StreamID: 3},
+		{From: "A", Dest: "B", Parity: true, SeqNum: 10, AckNum: 13, Data: big},
+	}
+	for _, pack := range seeds {
+		bts, err := pack.MarshalMsg(nil)
+		panicOn(err)
+		f.Add(bts)
+		// and a truncated one.
+		f.Add(bts[:len(bts)/2])
+	}
+	f.Add([]byte{})
+	f.Add([]byte{0xc1})
+	// a Metadata map claiming 2^28 entries, which
+	// UnmarshalMsg alone would allocate up front.
+	f.Add([]byte{0x81, 0xa8, 'M', 'e', 't', 'a', 'd', 'a', 't', 'a', 0xdf, 0x0f, 0xff, 0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var p1 Packet
+		rest, err := decodePacket(b, &p1)
+		if err != nil {
+			return
+		}
+		if len(rest) > len(b) || !bytes.Equal(rest, b[len(b)-len(rest):]) {
+			t.Fatalf("decodePacket returned %v bytes that are not a suffix of its %v byte input", len(rest), len(b))
+		}
+
+		// b need not be in the form we write, so check
+		// that what we decode re-encodes to itself.
+		b2, err := p1.MarshalMsg(nil)
+		if err != nil {
+			t.Fatalf("MarshalMsg of a decoded packet: %v", err)
+		}
+		var p2 Packet
+		if _, err := p2.UnmarshalMsg(b2); err != nil {
+			t.Fatalf("UnmarshalMsg of our own encoding: %v", err)
+		}
+		// map order varies, so compare Metadata apart.
+		if len(p1.Metadata)+len(p2.Metadata) > 0 && !reflect.DeepEqual(p1.Metadata, p2.Metadata) {
+			t.Fatalf("Metadata changed in the round trip: %v -> %v", p1.Metadata, p2.Metadata)
+		}
+		p1.Metadata, p2.Metadata = nil, nil
+		b2, err = p1.MarshalMsg(nil)
+		panicOn(err)
+		b3, err := p2.MarshalMsg(nil)
+		panicOn(err)
+		if !bytes.Equal(b2, b3) {
+			t.Fatalf("round trip changed the packet:\n%x\n%x", b2, b3)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package swp
+
+import (
+	"fmt"
+	"time"
+)
+
+// HalfDuplexRole says which direction data
+// flows on a half-duplex Session.
+type HalfDuplexRole int
+
+const (
+	// FullDuplex sessions both send and receive data.
+	FullDuplex HalfDuplexRole = 0
+
+	// HalfDuplexSender sessions only Push data.
+	HalfDuplexSender HalfDuplexRole = 1
+
+	// HalfDuplexReceiver sessions only consume data.
+	HalfDuplexReceiver HalfDuplexRole = 2
+)
+
+func (r HalfDuplexRole) String() string {
+	switch r {
+	case FullDuplex:
+		return "FullDuplex"
+	case HalfDuplexSender:
+		return "HalfDuplexSender"
+	case HalfDuplexReceiver:
+		return "HalfDuplexReceiver"
+	}
+	return fmt.Sprintf("HalfDuplexRole(%d)", int(r))
+}
+
+var ErrHalfDuplexReceiver = fmt.Errorf("cannot Push on a HalfDuplexReceiver session")
+
+// NewHalfDuplexSession makes a one-directional Session.
+// Only the data window of the active side is allocated at
+// full size: a HalfDuplexSender has a one slot receive
+// window, and a HalfDuplexReceiver a one slot send window,
+// which is all that acks and keep-alives need. Both
+// the sender and receiver goroutines still run, as a
+// HalfDuplexReceiver's acks go out by its sender, while
+// a HalfDuplexSender hears them by its receiver. The
+// idle direction stays quiet: a HalfDuplexReceiver sends
+// only acks, and no keepalives, leaving those to its
+// peer, and a HalfDuplexSender, getting no data, has
+// nothing to ack.
+//
+// Push on a HalfDuplexReceiver returns ErrHalfDuplexReceiver.
+func NewHalfDuplexSession(net Network, role HalfDuplexRole, localInbox, destInbox string, windowMsgCount int64, timeout time.Duration) (*Session, error) {
+	return NewSession(SessionConfig{
+		Net:            net,
+		LocalInbox:     localInbox,
+		DestInbox:      destInbox,
+		WindowMsgCount: windowMsgCount,
+		WindowByteSz:   -1,
+		Timeout:        timeout,
+		Clk:            RealClk,
+		HalfDuplex:     role,
+	})
+}
@@ -0,0 +1,283 @@
+package swp
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test095OnAckAndOnDeliverHooks(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	var mut sync.Mutex
+	var acks []AckStatus
+	var delivered []int64
+	A.Swp.Sender.OnAck = func(ack AckStatus) {
+		mut.Lock()
+		acks = append(acks, ack)
+		mut.Unlock()
+	}
+	B.Swp.Recver.OnDeliver = func(seq InOrderSeq) {
+		mut.Lock()
+		for _, pack := range seq.Seq {
+			delivered = append(delivered, pack.SeqNum)
+		}
+		mut.Unlock()
+	}
+
+	n := 50
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{
+			From:     "A",
+			Dest:     "B",
+			Data:     []byte(fmt.Sprintf("%v", i)),
+			TcpEvent: EventData,
+		})
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	cleanup()
+
+	mut.Lock()
+	defer mut.Unlock()
+	cv.Convey("Given an OnAck hook on A's sender and an OnDeliver hook on B's receiver, sending 50 packets from A to B should show B delivering each SeqNum once and in order, and A seeing acks up through the last one.", t, func() {
+		cv.So(len(delivered), cv.ShouldEqual, n)
+		for i, seq := range delivered {
+			cv.So(seq, cv.ShouldEqual, int64(i))
+		}
+		cv.So(len(acks), cv.ShouldBeGreaterThan, 0)
+		maxAck := int64(-1)
+		for _, a := range acks {
+			if a.AckNum > maxAck {
+				maxAck = a.AckNum
+			}
+		}
+		cv.So(maxAck, cv.ShouldEqual, int64(n-1))
+	})
+}
+
+func Test136OnPacketAckedReportsAckLatency(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	var mut sync.Mutex
+	latency := make(map[int64]time.Duration)
+	A.Swp.Sender.OnPacketAcked = func(seqno int64, lat time.Duration) {
+		mut.Lock()
+		latency[seqno] += lat
+		mut.Unlock()
+	}
+
+	n := 20
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+	}
+	for i := 0; i < 100 && A.Swp.Sender.LargestAckedSeqno() < int64(n-1); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	st := A.Stats()
+
+	mut.Lock()
+	defer mut.Unlock()
+	cv.Convey("Given OnPacketAcked on A, each of 20 packets pushed should be reported once, with a positive latency, and Stats should give the ack latency percentiles.", t, func() {
+		cv.So(len(latency), cv.ShouldEqual, n)
+		for i := 0; i < n; i++ {
+			cv.So(latency[int64(i)], cv.ShouldBeGreaterThan, 0)
+		}
+		cv.So(st.AckLatencyP50, cv.ShouldBeGreaterThan, 0)
+		cv.So(st.AckLatencyP99, cv.ShouldBeGreaterThanOrEqualTo, st.AckLatencyP50)
+	})
+}
+
+func Test137ConsumedCallbackSeesEachPacket(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	var mut sync.Mutex
+	var seqs []int64
+	var bytes int
+	B.Swp.Recver.ConsumedCallback = func(seqno int64, dataLen int) {
+		mut.Lock()
+		seqs = append(seqs, seqno)
+		bytes += dataLen
+		mut.Unlock()
+	}
+
+	n := 20
+	want := 0
+	for i := 0; i < n; i++ {
+		data := []byte(fmt.Sprintf("packet %v", i))
+		want += len(data)
+		A.Push(&Packet{From: "A", Dest: "B", Data: data, TcpEvent: EventData})
+	}
+	for i := 0; i < 100 && A.Swp.Sender.LargestAckedSeqno() < int64(n-1); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mut.Lock()
+	defer mut.Unlock()
+	cv.Convey("Given a ConsumedCallback on B, it should see each of 20 packets consumed once, in SeqNum order, with their Data lengths.", t, func() {
+		cv.So(len(seqs), cv.ShouldEqual, n)
+		for i, seq := range seqs {
+			cv.So(seq, cv.ShouldEqual, int64(i))
+		}
+		cv.So(bytes, cv.ShouldEqual, want)
+	})
+}
+
+// testTracer records the spans it starts.
+type testTracer struct {
+	mut    sync.Mutex
+	n      int
+	sends  []*testSpan
+	delivs []*testSpan
+}
+
+type testSpan struct {
+	tr     *testTracer
+	tp     string
+	parent string
+	ended  bool
+}
+
+func (s *testSpan) TraceParent() string { return s.tp }
+
+func (s *testSpan) End() {
+	s.tr.mut.Lock()
+	s.ended = true
+	s.tr.mut.Unlock()
+}
+
+func (tr *testTracer) start(parent string) *testSpan {
+	tr.n++
+	return &testSpan{tr: tr, parent: parent,
+		tp: fmt.Sprintf("00-%032x-%016x-01", 1, tr.n)}
+}
+
+func (tr *testTracer) StartSend(pack *Packet) Span {
+	tr.mut.Lock()
+	defer tr.mut.Unlock()
+	s := tr.start(pack.TraceParent)
+	tr.sends = append(tr.sends, s)
+	return s
+}
+
+func (tr *testTracer) StartDelivery(pack *Packet) Span {
+	tr.mut.Lock()
+	defer tr.mut.Unlock()
+	s := tr.start(pack.TraceParent)
+	tr.delivs = append(tr.delivs, s)
+	return s
+}
+
+func Test142TelemetryTracesSendAndDelivery(t *testing.T) {
+
+	tr := &testTracer{}
+	A, B, cleanup, err := SwpPipe(func(cfg *SessionConfig) { cfg.Telemetry = tr })
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+
+	n := 3
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("data"), TcpEvent: EventData})
+	}
+	var got []*Packet
+	for len(got) < n {
+		seq, err := B.ReadTimeout(5 * time.Second)
+		if err != nil {
+			break
+		}
+		got = append(got, seq.Seq...)
+	}
+	for i := 0; i < 100 && A.Swp.Sender.LargestAckedSeqno() < int64(n-1); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	tr.mut.Lock()
+	defer tr.mut.Unlock()
+	cv.Convey("Given a Telemetry provider, each data packet should carry the traceparent of a send span ended by its ack, and get a delivery span, child of it, ended once consumed.", t, func() {
+		cv.So(len(got), cv.ShouldEqual, n)
+		cv.So(len(tr.sends), cv.ShouldEqual, n)
+		cv.So(len(tr.delivs), cv.ShouldEqual, n)
+		for i := 0; i < n; i++ {
+			cv.So(got[i].TraceParent, cv.ShouldEqual, tr.sends[i].tp)
+			cv.So(tr.sends[i].parent, cv.ShouldEqual, "")
+			cv.So(tr.sends[i].ended, cv.ShouldBeTrue)
+			cv.So(tr.delivs[i].parent, cv.ShouldEqual, tr.sends[i].tp)
+			cv.So(tr.delivs[i].ended, cv.ShouldBeTrue)
+		}
+	})
+}
+
+func Test177OnAckSeesDuplicateAcks(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	defer cleanup()
+	B.SelfConsumeForTesting()
+
+	var mut sync.Mutex
+	var acks []AckStatus
+	A.Swp.Sender.OnAck = func(ack AckStatus) {
+		mut.Lock()
+		acks = append(acks, ack)
+		mut.Unlock()
+	}
+	count := func(ackNum int64) (n int) {
+		mut.Lock()
+		defer mut.Unlock()
+		for _, a := range acks {
+			if a.AckNum == ackNum {
+				n++
+			}
+		}
+		return
+	}
+
+	panicOn(A.Push(&Packet{From: "A", Dest: "B", Data: []byte("one"), TcpEvent: EventData}))
+	for i := 0; i < 1000 && count(0) == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	before := count(0)
+
+	// the same ack again, as a lossy link would
+	// bring it: it moves nothing, but OnAck should
+	// still hear of it.
+	panicOn(A.Net.(*SimNet).InjectPacket("A", &Packet{
+		From:            "B",
+		Dest:            "A",
+		FromSessNonce:   B.LocalSessNonce,
+		DestSessNonce:   A.LocalSessNonce,
+		SeqNum:          -1,
+		AckNum:          0,
+		TcpEvent:        EventDataAck,
+		Version:         ProtocolVersion,
+		Blake2bChecksum: Blake2bOfBytes(nil),
+	}))
+	for i := 0; i < 1000 && count(0) == before; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	cv.Convey("Given an OnAck hook, a duplicate ack, which advances nothing, should still reach it.", t, func() {
+		cv.So(before, cv.ShouldBeGreaterThan, 0)
+		cv.So(count(0), cv.ShouldBeGreaterThan, before)
+	})
+}
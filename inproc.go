@@ -0,0 +1,66 @@
+package swp
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// InProcNet is a Network for sessions within one
+// process. Send hands a copy of the packet straight to
+// the channel of its Dest, with no latency, loss, or
+// goroutines of its own, so it costs next to nothing
+// beside the protocol; the benchmarks use it to measure
+// the protocol alone. Unlike ChanNet it never blocks or
+// fails: as on a real network, a packet for an inbox
+// nobody listens on, or whose channel is full, is
+// dropped, and counted in Dropped.
+type InProcNet struct {
+	BufSize int
+
+	// Dropped counts the packets Send dropped.
+	// Read with atomic.LoadInt64.
+	Dropped int64
+
+	mut sync.Mutex
+	net map[string]chan *Packet
+}
+
+// NewInProcNet makes an InProcNet whose per-inbox
+// channels have bufSize buffer slots.
+func NewInProcNet(bufSize int) *InProcNet {
+	return &InProcNet{
+		BufSize: bufSize,
+		net:     make(map[string]chan *Packet),
+	}
+}
+
+// Listen returns a channel that will be sent on when
+// packets have Dest inbox.
+func (n *InProcNet) Listen(inbox string) (chan *Packet, error) {
+	ch := make(chan *Packet, n.BufSize)
+	n.mut.Lock()
+	n.net[inbox] = ch
+	n.mut.Unlock()
+	return ch, nil
+}
+
+// Send delivers a copy of pack to the channel for
+// pack.Dest if it has room, and drops it otherwise.
+func (n *InProcNet) Send(pack *Packet, why string) error {
+	n.mut.Lock()
+	ch, ok := n.net[pack.Dest]
+	n.mut.Unlock()
+	if ok {
+		cp := *pack
+		select {
+		case ch <- &cp:
+			return nil
+		default:
+		}
+	}
+	atomic.AddInt64(&n.Dropped, 1)
+	return nil
+}
+
+// Flush is a no-op; sends are complete when Send returns.
+func (n *InProcNet) Flush() {}
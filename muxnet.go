@@ -0,0 +1,165 @@
+package swp
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/glycerine/idem"
+)
+
+// MuxNet carries many logical streams, each one session's
+// worth of traffic, over a single inbox of an underlying
+// Network, typically one NATS subject of a NatsNet. See
+// NewMuxNet and NewStream.
+//
+// On the wire, a stream's packets go to Dest ID, with
+// From rewritten to "ID:localID:destID"; MuxNet puts
+// From and Dest back before the receiving stream sees
+// them, so stream IDs must not contain ':'.
+//
+// All streams share one listener, so a stream whose
+// session stops reading holds up the rest. Packets
+// for streams we don't have are dropped, which lets
+// several MuxNets on one NATS subject each pick out
+// their own.
+type MuxNet struct {
+	ID  string
+	Net Network
+
+	// Unrouted counts packets dropped for lack of a
+	// stream to take them. Read with atomic.LoadInt64.
+	Unrouted int64
+
+	mut       sync.Mutex
+	streams   map[string]chan *Packet
+	listening bool
+	Halt      *idem.Halter
+}
+
+// NewMuxNet makes a MuxNet whose streams all travel
+// to and from inbox id on net.
+func NewMuxNet(net Network, id string) *MuxNet {
+	return &MuxNet{
+		ID:      id,
+		Net:     net,
+		streams: make(map[string]chan *Packet),
+		Halt:    idem.NewHalter(),
+	}
+}
+
+// NewStream returns a Network for one session, whose
+// LocalInbox should be localID and DestInbox destID.
+func (m *MuxNet) NewStream(localID, destID string) Network {
+	return &muxStream{m: m, localID: localID, destID: destID}
+}
+
+// Stop halts the demultiplexing goroutine.
+func (m *MuxNet) Stop() {
+	m.Halt.ReqStop.Close()
+}
+
+// listen registers ch for packets to localID, starting
+// our one listener on the underlying Network if need be.
+func (m *MuxNet) listen(localID string, ch chan *Packet) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if _, dup := m.streams[localID]; dup {
+		return fmt.Errorf("mux net '%s' already has a stream for '%s'", m.ID, localID)
+	}
+	if !m.listening {
+		in, err := m.Net.Listen(m.ID)
+		if err != nil {
+			return err
+		}
+		m.listening = true
+		go m.demux(in)
+	}
+	m.streams[localID] = ch
+	return nil
+}
+
+// demux hands each arriving packet to its stream.
+func (m *MuxNet) demux(in chan *Packet) {
+	for {
+		select {
+		case pack := <-in:
+			from, dest, ok := m.unwrap(pack.From)
+			if !ok {
+				atomic.AddInt64(&m.Unrouted, 1)
+				continue
+			}
+			m.mut.Lock()
+			ch := m.streams[dest]
+			m.mut.Unlock()
+			if ch == nil {
+				atomic.AddInt64(&m.Unrouted, 1)
+				continue
+			}
+			pack.From = from
+			pack.Dest = dest
+			select {
+			case ch <- pack:
+			case <-m.Halt.ReqStop.Chan:
+				return
+			}
+		case <-m.Halt.ReqStop.Chan:
+			return
+		}
+	}
+}
+
+// wrap gives the wire From for a packet on the
+// stream from localID to destID.
+func (m *MuxNet) wrap(localID, destID string) string {
+	return m.ID + ":" + localID + ":" + destID
+}
+
+// unwrap reverses wrap.
+func (m *MuxNet) unwrap(wireFrom string) (from, dest string, ok bool) {
+	rest := strings.TrimPrefix(wireFrom, m.ID+":")
+	if len(rest) == len(wireFrom) {
+		return "", "", false
+	}
+	parts := strings.SplitN(rest, ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// muxStream is the Network for one stream of a MuxNet.
+type muxStream struct {
+	m       *MuxNet
+	localID string
+	destID  string
+}
+
+// Listen returns the stream's channel. The inbox
+// must be the stream's localID.
+func (s *muxStream) Listen(inbox string) (chan *Packet, error) {
+	if inbox != s.localID {
+		return nil, fmt.Errorf("mux stream for '%s' can't listen on '%s'", s.localID, inbox)
+	}
+	ch := make(chan *Packet)
+	err := s.m.listen(s.localID, ch)
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// Send copies pack, addresses the copy for the
+// wire, and sends it on the underlying Network.
+func (s *muxStream) Send(pack *Packet, why string) error {
+	cp := *pack
+	cp.From = s.m.wrap(s.localID, s.destID)
+	cp.Dest = s.m.ID
+	return s.m.Net.Send(&cp, why)
+}
+
+// Flush flushes the underlying Network.
+func (s *muxStream) Flush() {
+	s.m.Net.Flush()
+}
@@ -0,0 +1,73 @@
+package swp
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test093MuxNetCarriesManySessionsOverOneInbox(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	rtt := 2 * lat
+	mux := NewMuxNet(net, "mux")
+
+	nsess := 10
+	npack := 5
+	var as, bs []*Session
+	for i := 0; i < nsess; i++ {
+		a := fmt.Sprintf("A%v", i)
+		b := fmt.Sprintf("B%v", i)
+		// stopped below.
+		A, B, _, err := SwpPipe(WithInboxes(a, b), WithTimeout(rtt),
+			OnlyOn(a, WithNet(mux.NewStream(a, b))), OnlyOn(b, WithNet(mux.NewStream(b, a))))
+		panicOn(err)
+		A.SelfConsumeForTesting()
+		B.SelfConsumeForTesting()
+		as = append(as, A)
+		bs = append(bs, B)
+	}
+
+	done := make(chan bool)
+	for i, A := range as {
+		go func(i int, A *Session) {
+			for j := 0; j < npack; j++ {
+				A.Push(&Packet{From: A.MyInbox, Dest: A.Destination, Data: []byte(fmt.Sprintf("%v-%v", i, j)), TcpEvent: EventData})
+			}
+			done <- true
+		}(i, A)
+	}
+	for range as {
+		<-done
+	}
+	time.Sleep(200 * time.Millisecond)
+	for i := range as {
+		as[i].Stop()
+		bs[i].Stop()
+	}
+	mux.Stop()
+
+	_, dupErr := mux.NewStream("A0", "B0").Listen("A0")
+	_, wrongErr := mux.NewStream("C", "D").Listen("E")
+
+	cv.Convey("Given 10 sessions sharing one MuxNet, each should get exactly its own packets, in order, while the SimNet sees just the one inbox.", t, func() {
+		cv.So(len(net.Net), cv.ShouldEqual, 1)
+		_, ok := net.Net["mux"]
+		cv.So(ok, cv.ShouldBeTrue)
+		for i, B := range bs {
+			hist := B.Swp.Recver.RecvHistory
+			cv.So(len(hist), cv.ShouldEqual, npack)
+			for j, pack := range hist {
+				cv.So(string(pack.Data), cv.ShouldEqual, fmt.Sprintf("%v-%v", i, j))
+				cv.So(pack.From, cv.ShouldEqual, fmt.Sprintf("A%v", i))
+				cv.So(pack.Dest, cv.ShouldEqual, fmt.Sprintf("B%v", i))
+			}
+		}
+		cv.So(dupErr, cv.ShouldNotBeNil)
+		cv.So(wrongErr, cv.ShouldNotBeNil)
+	})
+}
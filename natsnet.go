@@ -1,7 +1,10 @@
 package swp
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/glycerine/idem"
 	"github.com/glycerine/nats"
@@ -12,14 +15,50 @@ type NatsNet struct {
 	Cli  *NatsClient
 	mut  sync.Mutex
 	Halt *idem.Halter
+
+	// Codec is the wire format; nil means
+	// MsgpackCodec. See codec.go.
+	Codec Codec
+
+	// AutoReconnect has us dial the broker again, and
+	// resubscribe, when we find our nats.Conn closed.
+	// The nats.Conn itself already retries a dropped
+	// connection; this covers one that has given up.
+	// Attempts back off exponentially from 100 msec up
+	// to MaxReconnectBackoff (default 30 seconds).
+	// Set both before Listen. Reconnects counts our
+	// successes, and is read with atomic.LoadInt64.
+	AutoReconnect       bool
+	MaxReconnectBackoff time.Duration
+	Reconnects          int64
+
+	// 1 while reconnecting; read with atomic.LoadInt32.
+	reconnecting int32
+
+	// kept to resubscribe after a reconnect.
+	inbox string
+	hand  nats.MsgHandler
+
+	// redial is redialNats, except in tests.
+	redial func() error
 }
 
+// ErrReconnecting is returned by NatsNet.Send while
+// AutoReconnect is re-establishing our connection.
+// The sender takes it as a pause, not a failure.
+var ErrReconnecting = fmt.Errorf("swp: nats net is reconnecting")
+
+// DefaultMaxReconnectBackoff caps the wait between
+// reconnect attempts if MaxReconnectBackoff is unset.
+const DefaultMaxReconnectBackoff = 30 * time.Second
+
 // NewNatsNet makes a new NataNet based on an actual nats client.
 func NewNatsNet(cli *NatsClient) *NatsNet {
 	net := &NatsNet{
 		Cli:  cli,
 		Halt: idem.NewHalter(),
 	}
+	net.redial = net.redialNats
 	return net
 }
 
@@ -38,10 +77,9 @@ func (n *NatsNet) Listen(inbox string) (chan *Packet, error) {
 
 	//p("%s NatsNet.Listen(inbox='%s') called... (prior n.Cli.Scrip='%#v') ... attempting subscription on inbox", n.Cli.Cfg.NatsNodeName, inbox, n.Cli.Scrip)
 
-	// do actual subscription
-	err := n.Cli.MakeSub(inbox, func(msg *nats.Msg) {
+	hand := func(msg *nats.Msg) {
 		var pack Packet
-		_, err := pack.UnmarshalMsg(msg.Data)
+		err := codecOrDefault(n.Codec).Unmarshal(msg.Data, &pack)
 		panicOn(err)
 		select {
 		case mr <- &pack:
@@ -49,7 +87,18 @@ func (n *NatsNet) Listen(inbox string) (chan *Packet, error) {
 			//		case <-time.After(10 * time.Second):
 			//			p("NatsNet dropping pack.SeqNum=%v after 10 seconds of failing to deliver to receiver", pack.SeqNum)
 		}
-	})
+	}
+
+	// do actual subscription
+	n.mut.Lock()
+	n.inbox = inbox
+	n.hand = hand
+	err := n.Cli.MakeSub(inbox, hand)
+	n.mut.Unlock()
+	if err != nil && n.connLost(err) {
+		// we'll subscribe once reconnected.
+		return mr, nil
+	}
 	//p("end of Listen(): subscription %v by %v on subject %v succeeded", n.Cli.Scrip.Subject, n.Cli.Cfg.NatsNodeName, inbox)
 	return mr, err
 }
@@ -57,15 +106,55 @@ func (n *NatsNet) Listen(inbox string) (chan *Packet, error) {
 // Send blocks until Send has started (but not until acked).
 func (n *NatsNet) Send(pack *Packet, why string) error {
 	//p("%s in NatsNet.Send(pack.SeqNum=%v / .AckNum=%v) why: '%s'", pack.From, pack.SeqNum, pack.AckNum, why)
-	bts, err := pack.MarshalMsg(nil)
+	if n.Reconnecting() {
+		return ErrReconnecting
+	}
+	bts, err := codecOrDefault(n.Codec).Marshal(pack)
 	if err != nil {
 		return err
 	}
-	err = n.Cli.Nc.Publish(pack.Dest, bts)
+	n.mut.Lock()
+	nc := n.Cli.Nc
+	n.mut.Unlock()
+	err = nc.Publish(pack.Dest, bts)
 	//p("%s in NatsNet.Send() about to Nc.Publish... err='%v'", pack.From, err)
+	if err != nil && n.connLost(err) {
+		return ErrReconnecting
+	}
 	return err
 }
 
+// SendBatch publishes all of packs while holding
+// our lock just once. It stops at the first error.
+func (n *NatsNet) SendBatch(packs []*Packet, why string) error {
+	if n.Reconnecting() {
+		return ErrReconnecting
+	}
+	n.mut.Lock()
+	defer n.mut.Unlock()
+	codec := codecOrDefault(n.Codec)
+	for _, pack := range packs {
+		bts, err := codec.Marshal(pack)
+		if err != nil {
+			return err
+		}
+		err = n.Cli.Nc.Publish(pack.Dest, bts)
+		if err != nil {
+			if n.connLost(err) {
+				return ErrReconnecting
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// SetCodec implements CodecNetwork. Call it
+// before Listen.
+func (n *NatsNet) SetCodec(c Codec) {
+	n.Codec = c
+}
+
 func (n *NatsNet) Stop() {
 	//p("NatsNet.Stop called!")
 	n.Halt.RequestStop()
@@ -73,5 +162,123 @@ func (n *NatsNet) Stop() {
 }
 
 func (n *NatsNet) Flush() {
-	n.Cli.Nc.Flush()
+	n.mut.Lock()
+	nc := n.Cli.Nc
+	n.mut.Unlock()
+	nc.Flush()
+}
+
+// SubscriptionStats describes our nats subscription,
+// from the client library's own counts: the messages
+// and bytes queued in the client now, the messages
+// dropped for exceeding the pending limits, and the
+// most messages ever queued. Pending counts near the
+// limits mean nats, not swp, is the bottleneck.
+type SubscriptionStats struct {
+	PendingMsgs  int64
+	PendingBytes int64
+	Dropped      int64
+	MaxPending   int64
+}
+
+// SubscriptionStats returns the state of our
+// subscription; all zero before Listen, or once
+// the subscription is closed.
+func (n *NatsNet) SubscriptionStats() SubscriptionStats {
+	n.mut.Lock()
+	defer n.mut.Unlock()
+	var st SubscriptionStats
+	if n.Cli == nil || n.Cli.Scrip == nil {
+		return st
+	}
+	s := n.Cli.Scrip
+	if msgs, bytes, err := s.Pending(); err == nil {
+		st.PendingMsgs, st.PendingBytes = int64(msgs), int64(bytes)
+	}
+	if dropped, err := s.Dropped(); err == nil {
+		st.Dropped = int64(dropped)
+	}
+	if msgs, _, err := s.MaxPending(); err == nil {
+		st.MaxPending = int64(msgs)
+	}
+	return st
+}
+
+// Reconnecting reports whether AutoReconnect is
+// re-establishing our connection. The sender
+// holds off sending while it is.
+func (n *NatsNet) Reconnecting() bool {
+	return atomic.LoadInt32(&n.reconnecting) == 1
+}
+
+// connLost reports whether err means our connection is
+// gone and AutoReconnect has taken over, starting the
+// reconnect loop if it isn't already running.
+func (n *NatsNet) connLost(err error) bool {
+	if !n.AutoReconnect || err != nats.ErrConnectionClosed {
+		return false
+	}
+	if atomic.CompareAndSwapInt32(&n.reconnecting, 0, 1) {
+		go n.reconnect()
+	}
+	return true
+}
+
+// reconnect retries n.redial with exponential
+// backoff until it succeeds or we are stopped.
+func (n *NatsNet) reconnect() {
+	max := n.MaxReconnectBackoff
+	if max <= 0 {
+		max = DefaultMaxReconnectBackoff
+	}
+	backoff := 100 * time.Millisecond
+	if backoff > max {
+		backoff = max
+	}
+	for {
+		select {
+		case <-time.After(backoff):
+		case <-n.Halt.ReqStop.Chan:
+			return
+		}
+		err := n.redial()
+		if err == nil {
+			atomic.AddInt64(&n.Reconnects, 1)
+			atomic.StoreInt32(&n.reconnecting, 0)
+			return
+		}
+		backoff *= 2
+		if backoff > max {
+			backoff = max
+		}
+		mylog.Printf("nats net reconnect failed, trying again in %v: '%s'", backoff, err)
+	}
+}
+
+// redialNats connects to the broker afresh and
+// renews our subscription, keeping its limits.
+func (n *NatsNet) redialNats() error {
+	nc, err := nats.Connect(n.Cli.Cfg.ServerList, n.Cli.Cfg.Opts...)
+	if err != nil {
+		return err
+	}
+	n.mut.Lock()
+	defer n.mut.Unlock()
+	old := n.Cli.Scrip
+	n.Cli.Nc = nc
+	if n.hand == nil {
+		return nil
+	}
+	err = n.Cli.MakeSub(n.inbox, n.hand)
+	if err != nil {
+		nc.Close()
+		return err
+	}
+	if old != nil {
+		msgLim, byteLim, err := old.PendingLimits()
+		if err == nil {
+			n.Cli.Scrip.SetPendingLimits(msgLim, byteLim)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,122 @@
+package swp
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+	"github.com/glycerine/nats"
+)
+
+func Test104NatsNetReconnectBacksOff(t *testing.T) {
+
+	n := NewNatsNet(NewNatsClient(&NatsClientConfig{}))
+	defer n.Stop()
+	n.AutoReconnect = true
+	n.MaxReconnectBackoff = 150 * time.Millisecond
+
+	var mut sync.Mutex
+	var attempts []time.Time
+	n.redial = func() error {
+		mut.Lock()
+		defer mut.Unlock()
+		attempts = append(attempts, time.Now())
+		if len(attempts) < 3 {
+			return fmt.Errorf("broker still down")
+		}
+		return nil
+	}
+
+	start := time.Now()
+	lost := n.connLost(nats.ErrConnectionClosed)
+	sendErr := n.Send(&Packet{From: "A", Dest: "B"}, "test")
+
+	for i := 0; i < 200 && atomic.LoadInt64(&n.Reconnects) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	off := NewNatsNet(NewNatsClient(&NatsClientConfig{}))
+
+	mut.Lock()
+	defer mut.Unlock()
+	cv.Convey("Given AutoReconnect, a closed connection should have Send return ErrReconnecting while redial is retried after 100 msec, then at the 150 msec MaxReconnectBackoff, until it succeeds.", t, func() {
+		cv.So(lost, cv.ShouldBeTrue)
+		cv.So(sendErr, cv.ShouldEqual, ErrReconnecting)
+		cv.So(atomic.LoadInt64(&n.Reconnects), cv.ShouldEqual, 1)
+		cv.So(n.Reconnecting(), cv.ShouldBeFalse)
+		cv.So(len(attempts), cv.ShouldEqual, 3)
+		cv.So(attempts[0].Sub(start), cv.ShouldBeGreaterThanOrEqualTo, 100*time.Millisecond)
+		cv.So(attempts[1].Sub(attempts[0]), cv.ShouldBeGreaterThanOrEqualTo, 150*time.Millisecond)
+		cv.So(attempts[2].Sub(attempts[1]), cv.ShouldBeGreaterThanOrEqualTo, 150*time.Millisecond)
+		cv.So(attempts[2].Sub(attempts[1]), cv.ShouldBeLessThan, 300*time.Millisecond)
+
+		cv.So(off.connLost(nats.ErrConnectionClosed), cv.ShouldBeFalse)
+	})
+}
+
+// pausableNet is a SimNet that can claim to be
+// reconnecting, as a NatsNet with AutoReconnect does.
+type pausableNet struct {
+	*SimNet
+	paused int32
+}
+
+func (n *pausableNet) Reconnecting() bool {
+	return atomic.LoadInt32(&n.paused) == 1
+}
+
+func Test105SenderPausesWhileNetReconnects(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := &pausableNet{SimNet: NewSimNet(lossProb, lat), paused: 1}
+	rtt := 2 * lat
+
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithTimeout(rtt), OnlyOn("A", func(cfg *SessionConfig) { cfg.MaxRetries = 3 }))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	n := 20
+	pushed := make(chan bool)
+	go func() {
+		for i := 0; i < n; i++ {
+			A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+		}
+		close(pushed)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	ackedWhilePaused := A.Swp.Sender.LargestAckedSeqno()
+
+	atomic.StoreInt32(&net.paused, 0)
+	<-pushed
+	time.Sleep(200 * time.Millisecond)
+
+	cleanup()
+
+	cv.Convey("Given a Network that reports it is reconnecting, the sender should send nothing, nor count retries against MaxRetries, until it is back; then all packets should get through.", t, func() {
+		cv.So(ackedWhilePaused, cv.ShouldEqual, -1)
+		cv.So(A.Swp.Sender.GetErr(), cv.ShouldBeNil)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, n)
+	})
+}
+
+func Test146NatsNetSubscriptionStats(t *testing.T) {
+
+	n := NewNatsNet(NewNatsClient(&NatsClientConfig{}))
+	defer n.Stop()
+	before := n.SubscriptionStats()
+
+	A, _, cleanup, err := SwpPipe()
+	panicOn(err)
+	defer cleanup()
+	sim := A.Stats().TransportStats
+
+	cv.Convey("Given a NatsNet not yet listening, SubscriptionStats should be all zero; and over a SimNet, SessionStats.TransportStats should be nil.", t, func() {
+		cv.So(before, cv.ShouldResemble, SubscriptionStats{})
+		cv.So(sim, cv.ShouldBeNil)
+	})
+}
@@ -15,3 +15,50 @@ type Network interface {
 	// for 60 seconds to elapse.
 	Flush()
 }
+
+// BatchNetwork is optionally implemented by a Network
+// whose transport can write several packets at
+// once more cheaply than one at a time. The sender
+// uses it to resend everything that timed out in
+// a single retry sweep.
+type BatchNetwork interface {
+	Network
+
+	// SendBatch transmits each of packs, as Send does.
+	SendBatch(packs []*Packet, why string) error
+}
+
+// RawNetwork is optionally implemented by a Network
+// that serializes packets, to let callers send and
+// receive the encoded bytes themselves. The sender
+// uses it to encode each data packet just once, keeping
+// the bytes in its TxqSlot for resends: a retry over a
+// RawNetwork goes just as it was first sent, rather
+// than restamped. UnixNet implements it.
+type RawNetwork interface {
+	Network
+
+	// SendRaw transmits data, a packet already
+	// encoded with RawCodec, to dest.
+	SendRaw(dest string, data []byte) error
+
+	// RecvRaw is Listen, but delivers the packets
+	// addressed to inbox still encoded.
+	RecvRaw(inbox string) (chan []byte, error)
+
+	// RawCodec returns the Codec that SendRaw and
+	// RecvRaw data is in.
+	RawCodec() Codec
+}
+
+// Sniffable is optionally implemented by a Network
+// that can show tests and debuggers the packets
+// arriving at an inbox, without disturbing their
+// delivery. SimNet implements it.
+type Sniffable interface {
+
+	// Sniff calls handler with each packet for inbox,
+	// just before it is delivered, replacing any earlier
+	// handler for inbox. handler must not change Data.
+	Sniff(inbox string, handler func(*Packet))
+}
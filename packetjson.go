@@ -0,0 +1,26 @@
+package swp
+
+import (
+	"encoding/json"
+)
+
+// JSON encoding of Packet, as a human readable
+// alternative to the msgp binary encoding; handy
+// for inspecting packets with jq. Times are in
+// RFC3339Nano format, and Data and Blake2bChecksum
+// are base64 encoded. CliAcked and Accounting are
+// local only, and are omitted, as with msgp.
+
+// jsonPacket has Packet's fields but none of its
+// methods, so encoding/json uses its defaults on it.
+type jsonPacket Packet
+
+// MarshalJSON implements json.Marshaler.
+func (z *Packet) MarshalJSON() ([]byte, error) {
+	return json.Marshal((*jsonPacket)(z))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (z *Packet) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, (*jsonPacket)(z))
+}
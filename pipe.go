@@ -0,0 +1,126 @@
+package swp
+
+import (
+	"io"
+	"math"
+	"sync/atomic"
+)
+
+// consumerPipe lets the RecvState hand delivered data
+// to an io.Writer, typically the write half of an
+// io.Pipe, rather than to ReadMessagesCh consumers.
+// Bytes count as consumed, and so reopen the byte
+// window, only once the consumer has read them back
+// through ConsumerReader(); data sitting in the pipe
+// still counts against RecvWindowSizeBytes.
+type consumerPipe struct {
+	w  io.Writer
+	lr *io.LimitedReader
+
+	// consumed is the number of bytes the consumer
+	// has read. Read with atomic.LoadInt64.
+	consumed int64
+
+	// readCh gets a non-blocking send after each
+	// Read, to wake the recvloop.
+	readCh chan struct{}
+}
+
+// SetConsumerPipe has the receiver write the Data of each
+// delivered packet, in order, to w, while the consumer
+// reads it back from rd by way of ConsumerReader(). The
+// usual pairing is pr, pw := io.Pipe(); SetConsumerPipe(pr, pw).
+// Until the consumer reads, LastByteConsumed does not
+// advance, so a full pipe advertises a zero byte window
+// to the sender.
+//
+// Call at most once. From then on the receiver consumes
+// ReadMessagesCh itself, so don't also use Session.Read
+// or ReadMessagesCh. If w is an io.Closer, it is closed
+// when the receiver stops.
+func (r *RecvState) SetConsumerPipe(rd io.Reader, w io.Writer) {
+	p := &consumerPipe{
+		w:      w,
+		lr:     &io.LimitedReader{R: rd, N: math.MaxInt64},
+		readCh: make(chan struct{}, 1),
+	}
+	r.mut.Lock()
+	r.pipeReader = p
+	r.mut.Unlock()
+
+	select {
+	case r.setConsumerPipe <- p:
+	case <-r.Halt.ReqStop.Chan:
+	}
+}
+
+// ConsumerReader returns the reader the consumer
+// must use after SetConsumerPipe, so that we see
+// its reads. It returns nil if no pipe was set.
+func (r *RecvState) ConsumerReader() io.Reader {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if r.pipeReader == nil {
+		return nil
+	}
+	return r.pipeReader
+}
+
+// Read implements io.Reader, counting the bytes
+// read through the wrapped io.LimitedReader.
+func (p *consumerPipe) Read(b []byte) (int, error) {
+	n, err := p.lr.Read(b)
+	if n > 0 {
+		atomic.StoreInt64(&p.consumed, math.MaxInt64-p.lr.N)
+		select {
+		case p.readCh <- struct{}{}:
+		default:
+		}
+	}
+	return n, err
+}
+
+// pump moves deliveries from r.ReadMessagesCh into
+// the pipe until the receiver stops or a write fails.
+func (p *consumerPipe) pump(r *RecvState) {
+	for {
+		select {
+		case seq := <-r.ReadMessagesCh:
+			for _, pack := range seq.Seq {
+				_, err := p.w.Write(pack.Data[pack.DataOffset:])
+				if err != nil {
+					mylog.Printf("%s consumer pipe write failed, no longer delivering: '%s'", r.Inbox, err)
+					return
+				}
+			}
+		case <-r.Halt.ReqStop.Chan:
+			return
+		}
+	}
+}
+
+// onRead is called from the recvloop after the consumer
+// has read from the pipe. It advances LastByteConsumed
+// and sends a window update to tell the sender.
+//
+// The update goes out in line with our acks, so a stale
+// ack can't overtake it, but with EventKeepAlive so that
+// the sender neither takes an RTT sample from it nor
+// counts it as a duplicate ack.
+func (p *consumerPipe) onRead(r *RecvState) {
+	consumed := atomic.LoadInt64(&p.consumed)
+	if consumed <= r.LastByteConsumed {
+		return
+	}
+	r.LastByteConsumed = consumed
+	r.UpdateControl(nil)
+	r.ack(r.LastFrameClientConsumed, nil, EventKeepAlive)
+}
+
+// close closes the writer, if it can be closed, to
+// unblock both a pending pump write and the consumer.
+func (p *consumerPipe) close() {
+	if c, ok := p.w.(io.Closer); ok {
+		c.Close()
+	}
+}
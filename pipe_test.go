@@ -0,0 +1,56 @@
+package swp
+
+import (
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test088ConsumerPipeHoldsByteWindowUntilRead(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	rtt := 2 * lat
+
+	// a 100 byte window holds ten 10-byte packets.
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithTimeout(rtt), func(cfg *SessionConfig) { cfg.WindowByteSz = 100 })
+	panicOn(err)
+	A.SelfConsumeForTesting()
+
+	pr, pw := io.Pipe()
+	B.Swp.Recver.SetConsumerPipe(pr, pw)
+	cr := B.Swp.Recver.ConsumerReader()
+
+	n := 30
+	pushed := make(chan bool)
+	go func() {
+		for i := 0; i < n; i++ {
+			A.Push(&Packet{From: "A", Dest: "B", Data: []byte("0123456789"), TcpEvent: EventData})
+		}
+		close(pushed)
+	}()
+
+	// nobody is reading the pipe yet, so the byte
+	// window should fill up and stop the sender.
+	time.Sleep(100 * time.Millisecond)
+	deliveredBeforeRead := atomic.LoadInt64(&B.Swp.Recver.CumulBytesDelivered)
+
+	got := make([]byte, n*10)
+	_, errRead := io.ReadFull(cr, got)
+	<-pushed
+
+	cleanup()
+
+	cv.Convey("Given a ConsumerPipe that nobody reads, the sender should stall within the byte window; once the consumer reads, everything should arrive in order through the pipe.", t, func() {
+		cv.So(deliveredBeforeRead, cv.ShouldBeGreaterThan, 0)
+		cv.So(deliveredBeforeRead, cv.ShouldBeLessThanOrEqualTo, 100)
+		cv.So(errRead, cv.ShouldBeNil)
+		for i := 0; i < n; i++ {
+			cv.So(string(got[i*10:(i+1)*10]), cv.ShouldEqual, "0123456789")
+		}
+	})
+}
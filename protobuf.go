@@ -0,0 +1,340 @@
+package swp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// ProtobufCodec encodes packets in the protobuf wire
+// format of packet.proto, for peers that speak protobuf
+// rather than msgp. It is written by hand, so as not to
+// need generated code or a protobuf dependency; a peer
+// may use code generated from packet.proto instead.
+//
+// As in proto3, fields at their zero value are left
+// out, so an empty Data, or Metadata, decodes as nil.
+// Unknown fields are skipped, which keeps adding fields
+// wire compatible, as it is for msgp.
+type ProtobufCodec struct{}
+
+// ErrProtobuf is returned by ProtobufCodec.Unmarshal
+// for bytes that are not a well formed protobuf Packet.
+var ErrProtobuf = fmt.Errorf("swp: malformed protobuf Packet")
+
+// protobuf wire types.
+const (
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+	pbFixed32 = 5
+)
+
+// Marshal implements Codec.
+func (ProtobufCodec) Marshal(p *Packet) ([]byte, error) {
+	var e pbEncoder
+	e.string(1, p.From)
+	e.string(2, p.Dest)
+	e.string(3, p.FromSessNonce)
+	e.string(4, p.DestSessNonce)
+	e.time(5, p.ArrivedAtDestTm)
+	e.time(6, p.DataSendTm)
+	e.sint(7, p.SeqNum)
+	e.sint(8, p.SeqRetry)
+	e.sint(9, p.AckNum)
+	e.sint(10, p.AckRetry)
+	e.time(11, p.AckReplyTm)
+	e.sint(12, p.NackNum)
+	e.bool(13, p.Nak)
+	e.sint(14, int64(p.TcpEvent))
+	e.sint(15, p.AvailReaderBytesCap)
+	e.sint(16, p.AvailReaderMsgCap)
+	e.sint(17, p.ProposeWindowSize)
+	e.sint(18, p.FromRttEstNsec)
+	e.sint(19, p.FromRttSdNsec)
+	e.sint(20, p.FromRttN)
+	e.sint(21, p.CumulBytesTransmitted)
+	e.bytes(22, p.Data)
+	e.sint(23, int64(p.DataOffset))
+	e.bytes(24, p.Blake2bChecksum)
+	e.bool(25, p.Parity)
+	e.bool(26, p.Control)
+	for k, v := range p.Metadata {
+		var entry pbEncoder
+		entry.string(1, k)
+		entry.string(2, v)
+		e.tag(27, pbBytes)
+		e.varint(uint64(len(entry.b)))
+		e.b = append(e.b, entry.b...)
+	}
+	e.uint(28, uint64(p.Version))
+	e.uint(29, uint64(p.StreamID))
+	e.sint(30, p.StreamSeq)
+	e.uint(31, uint64(p.Priority))
+	e.bool(32, p.KAReply)
+	e.sint(33, p.CompressedSize)
+	e.bool(34, p.CircuitOpen)
+	e.bool(35, p.EOF)
+	e.string(36, p.TraceParent)
+	e.bytes(37, p.Nonce)
+	e.bytes(38, p.AuthTag)
+	e.sint(39, p.CircuitResetNsec)
+	return e.b, nil
+}
+
+// Unmarshal implements Codec.
+func (ProtobufCodec) Unmarshal(b []byte, p *Packet) error {
+	d := pbDecoder{b: b}
+	for len(d.b) > 0 {
+		field, wt, ok := d.tag()
+		if !ok {
+			return ErrProtobuf
+		}
+		u, bts, ok := d.value(wt)
+		if !ok {
+			return ErrProtobuf
+		}
+		want := pbVarint
+		switch field {
+		case 1, 2, 3, 4, 22, 24, 27, 36, 37, 38:
+			want = pbBytes
+		case 5, 6, 11:
+			want = pbFixed64
+		}
+		if wt != want {
+			// not the field we know; skip it, as
+			// we would an unknown one.
+			continue
+		}
+		s := zigzag(u)
+		switch field {
+		case 1:
+			p.From = string(bts)
+		case 2:
+			p.Dest = string(bts)
+		case 3:
+			p.FromSessNonce = string(bts)
+		case 4:
+			p.DestSessNonce = string(bts)
+		case 5:
+			p.ArrivedAtDestTm = time.Unix(0, int64(u))
+		case 6:
+			p.DataSendTm = time.Unix(0, int64(u))
+		case 7:
+			p.SeqNum = s
+		case 8:
+			p.SeqRetry = s
+		case 9:
+			p.AckNum = s
+		case 10:
+			p.AckRetry = s
+		case 11:
+			p.AckReplyTm = time.Unix(0, int64(u))
+		case 12:
+			p.NackNum = s
+		case 13:
+			p.Nak = u != 0
+		case 14:
+			p.TcpEvent = TcpEvent(s)
+		case 15:
+			p.AvailReaderBytesCap = s
+		case 16:
+			p.AvailReaderMsgCap = s
+		case 17:
+			p.ProposeWindowSize = s
+		case 18:
+			p.FromRttEstNsec = s
+		case 19:
+			p.FromRttSdNsec = s
+		case 20:
+			p.FromRttN = s
+		case 21:
+			p.CumulBytesTransmitted = s
+		case 22:
+			p.Data = append([]byte(nil), bts...)
+		case 23:
+			p.DataOffset = int(s)
+		case 24:
+			p.Blake2bChecksum = append([]byte(nil), bts...)
+		case 25:
+			p.Parity = u != 0
+		case 26:
+			p.Control = u != 0
+		case 27:
+			k, v, ok := pbMapEntry(bts)
+			if !ok {
+				return ErrProtobuf
+			}
+			p.SetMeta(k, v)
+		case 28:
+			p.Version = uint8(u)
+		case 29:
+			p.StreamID = uint32(u)
+		case 30:
+			p.StreamSeq = s
+		case 31:
+			p.Priority = uint8(u)
+		case 32:
+			p.KAReply = u != 0
+		case 33:
+			p.CompressedSize = s
+		case 34:
+			p.CircuitOpen = u != 0
+		case 35:
+			p.EOF = u != 0
+		case 36:
+			p.TraceParent = string(bts)
+		case 37:
+			p.Nonce = append([]byte(nil), bts...)
+		case 38:
+			p.AuthTag = append([]byte(nil), bts...)
+		case 39:
+			p.CircuitResetNsec = s
+		}
+	}
+	return nil
+}
+
+// pbMapEntry decodes the key and value of one
+// Metadata entry.
+func pbMapEntry(b []byte) (k, v string, ok bool) {
+	d := pbDecoder{b: b}
+	for len(d.b) > 0 {
+		field, wt, ok := d.tag()
+		if !ok {
+			return "", "", false
+		}
+		_, bts, ok := d.value(wt)
+		if !ok {
+			return "", "", false
+		}
+		if wt != pbBytes {
+			continue
+		}
+		switch field {
+		case 1:
+			k = string(bts)
+		case 2:
+			v = string(bts)
+		}
+	}
+	return k, v, true
+}
+
+// pbEncoder appends protobuf fields to b, leaving
+// out those at their zero value.
+type pbEncoder struct {
+	b []byte
+}
+
+func (e *pbEncoder) varint(v uint64) {
+	for v >= 0x80 {
+		e.b = append(e.b, byte(v)|0x80)
+		v >>= 7
+	}
+	e.b = append(e.b, byte(v))
+}
+
+func (e *pbEncoder) tag(field int, wt int) {
+	e.varint(uint64(field)<<3 | uint64(wt))
+}
+
+func (e *pbEncoder) uint(field int, v uint64) {
+	if v != 0 {
+		e.tag(field, pbVarint)
+		e.varint(v)
+	}
+}
+
+func (e *pbEncoder) sint(field int, v int64) {
+	e.uint(field, uint64(v<<1)^uint64(v>>63))
+}
+
+func (e *pbEncoder) bool(field int, v bool) {
+	if v {
+		e.uint(field, 1)
+	}
+}
+
+func (e *pbEncoder) bytes(field int, v []byte) {
+	if len(v) > 0 {
+		e.tag(field, pbBytes)
+		e.varint(uint64(len(v)))
+		e.b = append(e.b, v...)
+	}
+}
+
+func (e *pbEncoder) string(field int, v string) {
+	if v != "" {
+		e.tag(field, pbBytes)
+		e.varint(uint64(len(v)))
+		e.b = append(e.b, v...)
+	}
+}
+
+func (e *pbEncoder) time(field int, t time.Time) {
+	if !t.IsZero() {
+		e.tag(field, pbFixed64)
+		var f [8]byte
+		binary.LittleEndian.PutUint64(f[:], uint64(t.UnixNano()))
+		e.b = append(e.b, f[:]...)
+	}
+}
+
+// pbDecoder reads protobuf fields off the front of b.
+type pbDecoder struct {
+	b []byte
+}
+
+func (d *pbDecoder) varint() (uint64, bool) {
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		return 0, false
+	}
+	d.b = d.b[n:]
+	return v, true
+}
+
+func (d *pbDecoder) tag() (field uint64, wt int, ok bool) {
+	key, ok := d.varint()
+	return key >> 3, int(key & 7), ok
+}
+
+// value reads a field of wire type wt, returning a
+// varint or fixed value in u, or a length delimited
+// one in bts.
+func (d *pbDecoder) value(wt int) (u uint64, bts []byte, ok bool) {
+	switch wt {
+	case pbVarint:
+		u, ok = d.varint()
+		return u, nil, ok
+	case pbFixed64:
+		if len(d.b) < 8 {
+			return 0, nil, false
+		}
+		u = binary.LittleEndian.Uint64(d.b)
+		d.b = d.b[8:]
+		return u, nil, true
+	case pbFixed32:
+		if len(d.b) < 4 {
+			return 0, nil, false
+		}
+		u = uint64(binary.LittleEndian.Uint32(d.b))
+		d.b = d.b[4:]
+		return u, nil, true
+	case pbBytes:
+		n, ok := d.varint()
+		if !ok || n > uint64(len(d.b)) {
+			return 0, nil, false
+		}
+		bts = d.b[:n]
+		d.b = d.b[n:]
+		return 0, bts, true
+	}
+	return 0, nil, false
+}
+
+// zigzag decodes a protobuf sint64.
+func zigzag(u uint64) int64 {
+	return int64(u>>1) ^ -int64(u&1)
+}
@@ -0,0 +1,270 @@
+package swp
+
+import (
+	"sync/atomic"
+)
+
+// ReadyRing holds the in-order packets waiting for
+// the consumer, oldest first. With a max of 0 or less
+// it grows as needed; otherwise it holds at most max,
+// and the recvloop leaves packets that don't fit in
+// Rxq, unacked, until the consumer makes room. See
+// RecvState.ReadyForDeliveryMaxLen.
+//
+// A ReadyRing is only touched by the recvloop.
+type ReadyRing struct {
+	buf []*Packet
+	beg int
+	n   int
+	max int
+
+	// gen changes whenever the contents do, so the
+	// recvloop knows when to rebuild its delivery.
+	gen int64
+}
+
+func newReadyRing(max int) *ReadyRing {
+	sz := 16
+	if max > 0 {
+		sz = max
+	}
+	return &ReadyRing{buf: make([]*Packet, sz), max: max}
+}
+
+// Len returns the number of packets held.
+func (q *ReadyRing) Len() int {
+	return q.n
+}
+
+// Full reports whether a bounded ring is at its max.
+func (q *ReadyRing) Full() bool {
+	return q.max > 0 && q.n >= q.max
+}
+
+// Push adds p at the back. The caller checks Full first.
+func (q *ReadyRing) Push(p *Packet) {
+	if q.n == len(q.buf) {
+		q.grow()
+	}
+	q.buf[(q.beg+q.n)%len(q.buf)] = p
+	q.n++
+	q.gen++
+}
+
+// PushByPriority adds p behind every packet of the same
+// or higher Priority (a lower number), and ahead of those
+// of lower Priority, so that the ring stays sorted by
+// Priority, and in arrival order within one. The caller
+// checks Full first.
+func (q *ReadyRing) PushByPriority(p *Packet) {
+	if q.n == len(q.buf) {
+		q.grow()
+	}
+	i := q.n
+	for i > 0 && q.buf[(q.beg+i-1)%len(q.buf)].Priority > p.Priority {
+		q.buf[(q.beg+i)%len(q.buf)] = q.buf[(q.beg+i-1)%len(q.buf)]
+		i--
+	}
+	q.buf[(q.beg+i)%len(q.buf)] = p
+	q.n++
+	q.gen++
+}
+
+// Front returns the oldest packet, or nil if empty.
+func (q *ReadyRing) Front() *Packet {
+	if q.n == 0 {
+		return nil
+	}
+	return q.buf[q.beg]
+}
+
+// PopFront removes and returns the oldest packet,
+// or nil if empty.
+func (q *ReadyRing) PopFront() *Packet {
+	if q.n == 0 {
+		return nil
+	}
+	p := q.buf[q.beg]
+	q.buf[q.beg] = nil
+	q.beg = (q.beg + 1) % len(q.buf)
+	q.n--
+	q.gen++
+	return p
+}
+
+// Slice returns a new slice of the packets held, oldest first.
+func (q *ReadyRing) Slice() []*Packet {
+	s := make([]*Packet, q.n)
+	for i := range s {
+		s[i] = q.buf[(q.beg+i)%len(q.buf)]
+	}
+	return s
+}
+
+// frontRun returns a new slice of the oldest packets
+// that share the front's StreamID, for one delivery.
+func (q *ReadyRing) frontRun() []*Packet {
+	if q.n == 0 {
+		return nil
+	}
+	id := q.buf[q.beg].StreamID
+	var s []*Packet
+	for i := 0; i < q.n; i++ {
+		p := q.buf[(q.beg+i)%len(q.buf)]
+		if p.StreamID != id {
+			break
+		}
+		s = append(s, p)
+	}
+	return s
+}
+
+// Reset empties the ring.
+func (q *ReadyRing) Reset() {
+	for i := range q.buf {
+		q.buf[i] = nil
+	}
+	q.beg = 0
+	q.n = 0
+	q.gen++
+}
+
+// grow doubles an unbounded ring, as append would.
+func (q *ReadyRing) grow() {
+	buf := make([]*Packet, 2*len(q.buf))
+	copy(buf, q.Slice())
+	q.buf = buf
+	q.beg = 0
+}
+
+// readyInOrder moves packets from Rxq to ReadyForDelivery
+// for as long as they are in order and there is room,
+// starting at NextFrameExpected. The recvloop calls it on
+// the arrival of NextFrameExpected, and again whenever the
+// consumer makes room.
+func (r *RecvState) readyInOrder() {
+	// ackFor is set when packets count as consumed
+	// without being delivered, so the sender hears of it.
+	var ackFor *Packet
+	// passed is the last packet given out ahead of a
+	// gap that we pass by; see stream.go.
+	var passed *Packet
+	slot := r.Rxq[r.NextFrameExpected%r.RecvWindowSize]
+	for slot.Received {
+
+		//p("%v actual in-order receive happening for SeqNum %v",
+		//	r.Inbox, slot.Pack.SeqNum)
+
+		if slot.Pack.early {
+			passed = slot.Pack
+			r.nfeCumulBytes = slot.Pack.CumulBytesTransmitted
+			slot.Received = false
+			slot.Pack = nil
+			r.NextFrameExpected++
+			slot = r.Rxq[r.NextFrameExpected%r.RecvWindowSize]
+			continue
+		}
+
+		dup := r.dedup != nil && r.dedup.has(slot.Pack.SeqNum)
+		if !dup && r.ReadyForDelivery.Full() {
+			if !r.DropOnReadyFull {
+				// backpressure: leave it in Rxq, unacked.
+				break
+			}
+			ackFor = r.dropOldestReady()
+		}
+
+		filtered := false
+		if !dup && r.PacketFilter != nil {
+			pk, keep := r.PacketFilter(slot.Pack)
+			if keep && pk != nil {
+				slot.Pack = pk
+				r.hold(pk)
+			} else {
+				atomic.AddInt64(&r.DiscardReasons.Filtered, 1)
+				filtered = true
+			}
+		}
+
+		if dup || filtered {
+			// already delivered once, or the filter
+			// said no; don't deliver it.
+			if dup {
+				atomic.AddInt64(&r.DuplicateDeliveryDropped, 1)
+			}
+			r.unhold(slot.Pack.SeqNum)
+			if r.ReadyForDelivery.Len() == 0 && len(r.uncommitted) == 0 {
+				// nothing ahead of it awaits the
+				// consumer, so it counts as consumed now.
+				r.LastMsgConsumed = slot.Pack.SeqNum
+				r.LastFrameClientConsumed = slot.Pack.SeqNum
+				ackFor = slot.Pack
+			} else {
+				r.dedupSkippedThrough = slot.Pack.SeqNum
+			}
+		} else {
+			if r.dedup != nil {
+				r.dedup.add(slot.Pack.SeqNum)
+			}
+			r.pushReady(slot.Pack)
+			r.RecvHistory = append(r.RecvHistory, slot.Pack)
+			//p("%v r.RecvHistory now has length %v", r.Inbox, len(r.RecvHistory))
+		}
+		if r.IndependentStreams {
+			r.streamPassed(slot.Pack)
+		}
+
+		r.nfeCumulBytes = slot.Pack.CumulBytesTransmitted
+		slot.Received = false
+		slot.Pack = nil
+		r.NextFrameExpected++
+		slot = r.Rxq[r.NextFrameExpected%r.RecvWindowSize]
+	}
+
+	if r.IndependentStreams {
+		r.drainStreams()
+		if passed != nil && r.advanceConsumed() {
+			ackFor = passed
+		}
+	}
+
+	// update senders view of NextFrameExpected, for keep-alives.
+	r.snd.SetRecvLastFrameClientConsumed(r.LastFrameClientConsumed)
+
+	if ackFor != nil {
+		r.dataAck(ackFor)
+	}
+}
+
+// pushReady adds pack to ReadyForDelivery, by
+// Priority under PriorityDelivery.
+func (r *RecvState) pushReady(pack *Packet) {
+	r.startDeliverySpan(pack)
+	if r.PriorityDelivery {
+		r.ReadyForDelivery.PushByPriority(pack)
+	} else {
+		r.ReadyForDelivery.Push(pack)
+	}
+	n := int64(r.ReadyForDelivery.Len())
+	atomic.StoreInt64(&r.CurrentReadyForDeliveryLen, n)
+	if n > atomic.LoadInt64(&r.MaxReadyForDeliveryLen) {
+		atomic.StoreInt64(&r.MaxReadyForDeliveryLen, n)
+	}
+}
+
+// dropOldestReady discards the oldest ready packet to
+// make room, treating it as consumed so that our next
+// ack lets the sender move on. It returns the packet
+// dropped.
+func (r *RecvState) dropOldestReady() *Packet {
+	pk := r.ReadyForDelivery.PopFront()
+	r.unhold(pk.SeqNum)
+	r.endDeliverySpan(pk.SeqNum)
+	r.LastMsgConsumed = pk.SeqNum
+	r.LastFrameClientConsumed = pk.SeqNum
+	if r.pipe == nil {
+		r.LastByteConsumed = pk.CumulBytesTransmitted
+	}
+	atomic.AddInt64(&r.ReadyQueueDropped, 1)
+	return pk
+}
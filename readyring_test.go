@@ -0,0 +1,169 @@
+package swp
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+// readyRingPair pushes n packets from A to B, with B's
+// ready queue bounded at maxLen and nobody reading B.
+func readyRingPair(n, maxLen int, dropOnFull bool) (A, B *Session) {
+	// the caller stops them.
+	A, B, _, err := SwpPipe(OnlyOn("B", WithConfig(func(cfg *SessionConfig) {
+		cfg.ReadyForDeliveryMaxLen = maxLen
+		cfg.DropOnReadyFull = dropOnFull
+	})))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+
+	go func() {
+		for i := 0; i < n; i++ {
+			A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+		}
+	}()
+	time.Sleep(200 * time.Millisecond)
+	return A, B
+}
+
+func Test106ReadyRingHoldsBackWhenFull(t *testing.T) {
+
+	n := 10
+	A, B := readyRingPair(n, 3, false)
+	ready := B.NumReadyPackets()
+	acked := A.Swp.Sender.LargestAckedSeqno()
+
+	var got []string
+	for len(got) < n {
+		seq, err := B.ReadCtx(context.Background())
+		panicOn(err)
+		for _, pack := range seq.Seq {
+			got = append(got, string(pack.Data))
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	ackedAfter := A.Swp.Sender.LargestAckedSeqno()
+
+	A.Stop()
+	B.Stop()
+
+	cv.Convey("Given ReadyForDeliveryMaxLen 3 and a consumer who isn't reading, only 3 packets should wait as ready and none be acked; once the consumer reads, every packet should arrive in order and be acked.", t, func() {
+		cv.So(ready, cv.ShouldEqual, 3)
+		cv.So(acked, cv.ShouldEqual, -1)
+		for i := range got {
+			cv.So(got[i], cv.ShouldEqual, fmt.Sprintf("%v", i))
+		}
+		cv.So(ackedAfter, cv.ShouldEqual, n-1)
+		cv.So(atomic.LoadInt64(&B.Swp.Recver.ReadyQueueDropped), cv.ShouldEqual, 0)
+	})
+}
+
+func Test107DropOnReadyFullKeepsTheNewest(t *testing.T) {
+
+	n := 20
+	A, B := readyRingPair(n, 3, true)
+	ready := B.NumReadyPackets()
+	dropped := atomic.LoadInt64(&B.Swp.Recver.ReadyQueueDropped)
+	acked := A.Swp.Sender.LargestAckedSeqno()
+
+	seq, err := B.ReadCtx(context.Background())
+
+	A.Stop()
+	B.Stop()
+
+	cv.Convey("Given DropOnReadyFull, a consumer who isn't reading should not stop the sender: the oldest ready packets are dropped and counted in ReadyQueueDropped, and the newest 3 are what the consumer gets.", t, func() {
+		cv.So(ready, cv.ShouldEqual, 3)
+		cv.So(dropped, cv.ShouldEqual, n-3)
+		cv.So(acked, cv.ShouldEqual, n-4)
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(len(seq.Seq), cv.ShouldEqual, 3)
+		for i, pack := range seq.Seq {
+			cv.So(string(pack.Data), cv.ShouldEqual, fmt.Sprintf("%v", n-3+i))
+		}
+	})
+}
+
+func TestReadyRingGrowsWhenUnbounded(t *testing.T) {
+
+	q := newReadyRing(0)
+	for i := 0; i < 40; i++ {
+		q.Push(&Packet{SeqNum: int64(i)})
+		if i%3 == 0 {
+			q.PopFront()
+		}
+	}
+
+	cv.Convey("Given no max, a ReadyRing should grow past its first size and keep its packets in order.", t, func() {
+		cv.So(q.Full(), cv.ShouldBeFalse)
+		s := q.Slice()
+		cv.So(len(s), cv.ShouldEqual, q.Len())
+		cv.So(len(s), cv.ShouldEqual, 26)
+		for i, p := range s {
+			cv.So(p.SeqNum, cv.ShouldEqual, int64(14+i))
+		}
+	})
+}
+
+func TestReadyRingPushByPriority(t *testing.T) {
+
+	q := newReadyRing(0)
+	// wrap the ring, so the insert must too.
+	for i := 0; i < 12; i++ {
+		q.Push(&Packet{SeqNum: int64(i), Priority: 0})
+	}
+	for i := 0; i < 12; i++ {
+		q.PopFront()
+	}
+	prio := []uint8{2, 1, 0, 1, 0, 2}
+	for i, pr := range prio {
+		q.PushByPriority(&Packet{SeqNum: int64(i), Priority: pr})
+	}
+
+	cv.Convey("Given packets pushed by priority, a ReadyRing should hold them sorted by Priority, and by SeqNum within one.", t, func() {
+		var got []int64
+		for _, p := range q.Slice() {
+			got = append(got, p.SeqNum)
+		}
+		cv.So(got, cv.ShouldResemble, []int64{2, 4, 1, 3, 0, 5})
+	})
+}
+
+func Test138PriorityDeliveryReordersReadyPackets(t *testing.T) {
+
+	prio := func(cfg *SessionConfig) { cfg.PriorityDelivery = true }
+	A, B, cleanup, err := SwpPipe(OnlyOn("B", prio))
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+
+	prios := []uint8{2, 1, 0, 1, 0}
+	for i, pr := range prios {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData, Priority: pr})
+	}
+	// let all arrive before reading any.
+	for i := 0; i < 100 && B.Swp.Recver.PeekNumReady() < int64(len(prios)); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	var got []string
+	for len(got) < len(prios) {
+		seq, err := B.ReadTimeout(time.Second)
+		if err != nil {
+			break
+		}
+		for _, pack := range seq.Seq {
+			got = append(got, string(pack.Data))
+		}
+	}
+	for i := 0; i < 100 && A.Swp.Sender.LargestAckedSeqno() < int64(len(prios)-1); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cv.Convey("Given PriorityDelivery, packets ready together should be delivered Priority 0 first, in SeqNum order within a Priority, and all still be acked.", t, func() {
+		cv.So(got, cv.ShouldResemble, []string{"2", "4", "1", "3", "0"})
+		cv.So(A.Swp.Sender.LargestAckedSeqno(), cv.ShouldEqual, len(prios)-1)
+	})
+}
@@ -0,0 +1,75 @@
+package swp
+
+import (
+	"context"
+)
+
+// Consumer receipts.
+//
+// Normally a delivery counts as consumed the moment the
+// consumer takes it from ReadMessagesCh: we ack it, and
+// the window moves past it. If the consumer then crashes
+// before it has processed the packets, they are lost.
+//
+// With SessionConfig.ManualAck, a delivery is only
+// consumed once the consumer calls the commit func that
+// ReadAndAck returned with it. Until then its packets stay
+// in RcvdButNotConsumed, are not acked, and hold the
+// window, so the sender keeps them, retries them, and will
+// resend them to a session restored from a Snapshot.
+// Commits may be made in any order, but a delivery only
+// counts as consumed once all before it are committed too.
+// WaitDelivered waits for the commit.
+
+// receipt is a delivery awaiting its commit.
+type receipt struct {
+	seq       []*Packet
+	committed bool
+}
+
+// last is the SeqNum that ends the delivery.
+func (rc *receipt) last() int64 {
+	return rc.seq[len(rc.seq)-1].SeqNum
+}
+
+// ReadAndAck is ReadCtx with context.Background(), also
+// returning the commit func to call once seq has been
+// durably processed. Without ManualAck the packets are
+// already consumed, and commit does nothing. commit may
+// be called from any goroutine, more than once.
+func (s *Session) ReadAndAck() (seq InOrderSeq, commit func(), err error) {
+	seq, err = s.ReadCtx(context.Background())
+	if err != nil {
+		return seq, nil, err
+	}
+	r := s.Swp.Recver
+	if !r.ManualAck {
+		return seq, func() {}, nil
+	}
+	last := seq.Seq[len(seq.Seq)-1].SeqNum
+	commit = func() {
+		select {
+		case r.commitCh <- last:
+		case <-r.Halt.ReqStop.Chan:
+		}
+	}
+	return seq, commit, nil
+}
+
+// commit marks the delivery ending at last committed,
+// and consumes every committed delivery at the front.
+// Only the recvloop calls it.
+func (r *RecvState) commit(last int64) {
+	for _, rc := range r.uncommitted {
+		if rc.last() == last {
+			rc.committed = true
+			break
+		}
+	}
+	for len(r.uncommitted) > 0 && r.uncommitted[0].committed {
+		rc := r.uncommitted[0]
+		r.uncommitted[0] = nil
+		r.uncommitted = r.uncommitted[1:]
+		r.markConsumed(rc.seq)
+	}
+}
@@ -0,0 +1,67 @@
+package swp
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test129ReadAndAckHoldsWindowUntilCommit(t *testing.T) {
+
+	manual := func(cfg *SessionConfig) { cfg.ManualAck = true }
+	A, B, cleanup, err := SwpPipe(WithWindowMsgCount(3), OnlyOn("B", manual))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+
+	win := 3
+	for i := 0; i < win; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+	}
+	var commits []func()
+	var got []string
+	for len(got) < win {
+		seq, commit, err := B.ReadAndAck()
+		panicOn(err)
+		for _, pack := range seq.Seq {
+			got = append(got, string(pack.Data))
+		}
+		commits = append(commits, commit)
+	}
+
+	// the window is full of uncommitted packets,
+	// so the next can't be sent.
+	go A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", win)), TcpEvent: EventData})
+	time.Sleep(50 * time.Millisecond)
+	ackedBefore := A.Swp.Sender.LargestAckedSeqno()
+	heldBefore := B.Swp.Recver.HeldBytes()
+	_, errBlocked := B.ReadTimeout(50 * time.Millisecond)
+
+	// commit newest first: nothing is consumed until
+	// the oldest is committed too.
+	for i := len(commits) - 1; i >= 0; i-- {
+		commits[i]()
+		commits[i]()
+	}
+	seq, commit, errNext := B.ReadAndAck()
+	commit()
+	for i := 0; i < 100 && A.Swp.Sender.LargestAckedSeqno() < int64(win); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	ackedAfter := A.Swp.Sender.LargestAckedSeqno()
+	heldAfter := B.Swp.Recver.HeldBytes()
+
+	cleanup()
+
+	cv.Convey("Given ManualAck and a window of 3, the 3 delivered packets should stay held and unacked, blocking a 4th, until committed; then all 4 should be acked.", t, func() {
+		cv.So(got, cv.ShouldResemble, []string{"0", "1", "2"})
+		cv.So(ackedBefore, cv.ShouldEqual, -1)
+		cv.So(heldBefore, cv.ShouldEqual, win)
+		cv.So(errBlocked, cv.ShouldNotBeNil)
+		cv.So(errNext, cv.ShouldBeNil)
+		cv.So(string(seq.Seq[0].Data), cv.ShouldEqual, fmt.Sprintf("%v", win))
+		cv.So(ackedAfter, cv.ShouldEqual, win)
+		cv.So(heldAfter, cv.ShouldEqual, 0)
+	})
+}
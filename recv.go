@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/glycerine/blake2b" // vendor https://github.com/dchest/blake2b
@@ -12,14 +13,58 @@ import (
 )
 
 var ErrShutdown = fmt.Errorf("shutdown in progress")
+
 var ErrConnectWhenNotListen = fmt.Errorf("connect request when receiver was not in Listen state")
 
+// DefaultMaxAckLookback is the RecvState.MaxAckLookback
+// of a new receiver.
+const DefaultMaxAckLookback = 4096
+
 // RxqSlot is the receiver's sliding window element.
 type RxqSlot struct {
 	Received bool
 	Pack     *Packet
 }
 
+// DiscardReasons breaks down the packets a RecvState
+// drops by cause. OutOfWindow is normal operation;
+// the rest point at trouble. Each field is read with
+// atomic.LoadInt64; see Session.Stats.
+type DiscardReasons struct {
+	// data outside the receive window, which we ack anyway.
+	OutOfWindow int64
+
+	// out-of-order data we held, then dropped
+	// when ProposeWindowSize shrank the window.
+	OOOLimit int64
+
+	// data that failed its Blake2bChecksum.
+	CorruptCRC int64
+
+	// packets from an inbox or session nonce
+	// other than our peer's.
+	AuthFail int64
+
+	// data that arrived while we held
+	// MaxBufferedBytes or more.
+	OverMemory int64
+
+	// in-order data the PacketFilter discarded.
+	Filtered int64
+}
+
+// load returns an atomic snapshot of d.
+func (d *DiscardReasons) load() DiscardReasons {
+	return DiscardReasons{
+		OutOfWindow: atomic.LoadInt64(&d.OutOfWindow),
+		OOOLimit:    atomic.LoadInt64(&d.OOOLimit),
+		CorruptCRC:  atomic.LoadInt64(&d.CorruptCRC),
+		AuthFail:    atomic.LoadInt64(&d.AuthFail),
+		OverMemory:  atomic.LoadInt64(&d.OverMemory),
+		Filtered:    atomic.LoadInt64(&d.Filtered),
+	}
+}
+
 // RecvState tracks the receiver's sliding window state.
 type RecvState struct {
 	Clk                     Clock
@@ -45,6 +90,144 @@ type RecvState struct {
 	RecvSz          int64
 	DiscardCount    int64
 
+	// DiscardReasons counts drops by cause.
+	DiscardReasons DiscardReasons
+
+	// NacksSent counts the negative acks we have sent
+	// after noticing a gap in the arriving SeqNum.
+	// Read with atomic.LoadInt64.
+	NacksSent   int64
+	lastNackNum int64
+
+	// forward error correction, see fec.go.
+	// Set before Start(). FECRecoveries is
+	// read with atomic.LoadInt64.
+	FECGroupSize  int
+	FECRecoveries int64
+	fecRcvd       map[int64]*Packet
+	fecPending    map[int64]*Packet
+
+	// DeduplicateWindow, if > 0, has us remember
+	// this many of the most recently delivered SeqNum,
+	// and drop (while still acking) any replay of
+	// them instead of delivering it twice. Set before
+	// Start(). DuplicateDeliveryDropped is read with
+	// atomic.LoadInt64.
+	DeduplicateWindow        int
+	DuplicateDeliveryDropped int64
+	dedup                    *dedupSet
+	dedupSkippedThrough      int64
+
+	// MinPeerVersion, if > 0, drops packets with an
+	// older Version. Set before Start(). OldVersionDropped
+	// is read with atomic.LoadInt64.
+	MinPeerVersion    uint8
+	OldVersionDropped int64
+
+	// CorruptedCount is the number of packets dropped
+	// because their Data did not match its Blake2bChecksum.
+	// Read with atomic.LoadInt64.
+	CorruptedCount int64
+
+	// OnDeliver, if non-nil, is called with each batch
+	// of in-order packets as it is handed to ReadMessagesCh.
+	// It runs on the receiver goroutine, so it must not
+	// block. Set before Start().
+	OnDeliver func(seq InOrderSeq)
+
+	// ConsumedCallback, if non-nil, is called with the
+	// SeqNum and len(Data) of each packet once it counts
+	// as consumed: as it is handed to ReadMessagesCh, or
+	// under ManualAck, once committed. Use it for per
+	// packet accounting, such as metering, or offsets in
+	// a durable log. It runs on the receiver goroutine,
+	// after LastMsgConsumed is updated, and holds up all
+	// receiving, so it must return within microseconds.
+	// Set before Start().
+	ConsumedCallback func(seqno int64, dataLen int)
+
+	// Telemetry, if set, traces the delivery of packets
+	// that carry a TraceParent; deliverySpans has the
+	// spans not yet ended, by SeqNum. See telemetry.go.
+	Telemetry     Telemetry
+	deliverySpans map[int64]Span
+
+	// LoopStart, if set, is called first thing on
+	// the recvloop goroutine; see SessionConfig.LoopStart.
+	LoopStart func()
+
+	// ReorderDistance measures how far ahead of
+	// NextFrameExpected data arrives; see reorder.go.
+	ReorderDistance ReorderStats
+
+	// cipher is nil unless the session has an
+	// EncryptionKey; see crypt.go. DecryptFailures
+	// counts the packets that failed authentication, or
+	// that it failed to open, which we drop; read it
+	// with atomic.LoadInt64.
+	cipher          *packetCipher
+	DecryptFailures int64
+
+	// decompress is set under SessionConfig.Compress.
+	// DecompressFailures counts the data packets that
+	// failed to inflate, which we drop; see compress.go.
+	// Read with atomic.LoadInt64.
+	decompress         bool
+	DecompressFailures int64
+
+	// MaxAckLookback: an AckNum more than this far
+	// below the sender's largest ack, or any past the
+	// last SeqNum it sent, is dropped as spoofed, and
+	// counted in SpoofedAckCount; read it with
+	// atomic.LoadInt64. See spoofedAck.
+	MaxAckLookback  int64
+	SpoofedAckCount int64
+
+	// ManualAck holds each delivery, unacked, until its
+	// ReadAndAck commit; see receipt.go. uncommitted are
+	// those delivered but not yet consumed, oldest first,
+	// and commitCh carries commits to the recvloop.
+	ManualAck   bool
+	uncommitted []*receipt
+	commitCh    chan int64
+
+	// IndependentStreams delivers each stream in
+	// StreamSeq order on its own; see stream.go. The
+	// recvloop sets it on the first packet it sees on
+	// a stream other than 0.
+	// perStreamNFE is the next StreamSeq to deliver on
+	// each stream, and perStreamRxq holds those that
+	// arrived ahead of the session's NextFrameExpected.
+	// MaxStreams bounds how many streams get them.
+	// streamsPending are the streams drainStreams visits.
+	// nfeCumulBytes is the CumulBytesTransmitted of
+	// the packet before NextFrameExpected.
+	IndependentStreams bool
+	MaxStreams         int
+	perStreamNFE       map[uint32]int64
+	perStreamRxq       map[uint32][]*RxqSlot
+	streamsPending     map[uint32]bool
+	nfeCumulBytes      int64
+
+	// PriorityDelivery hands the consumer ready packets
+	// by Priority, 0 first, and in SeqNum order within
+	// a Priority; see ReadyRing.PushByPriority.
+	PriorityDelivery bool
+
+	// heardPeer, if set, is called by the recvloop on
+	// the first packet it accepts from the peer, and then
+	// cleared. The Session uses it to become Established.
+	heardPeer func()
+
+	// PacketFilter, if non-nil, sees each packet once it
+	// is in order, before it is readied for the consumer,
+	// and returns the packet to deliver in its place, and
+	// true; or false to discard it, which still moves the
+	// window past it. It may change Data, but not SeqNum.
+	// It runs on the receiver goroutine, so it must not
+	// block. Set before Start().
+	PacketFilter func(p *Packet) (*Packet, bool)
+
 	snd *SenderState
 
 	LastMsgConsumed    int64
@@ -52,14 +235,105 @@ type RecvState struct {
 	MaxCumulBytesTrans int64
 	LastByteConsumed   int64
 
+	// CumulBytesDelivered counts the Data bytes
+	// handed to the consumer. Read with atomic.LoadInt64.
+	CumulBytesDelivered int64
+
 	LastAvailReaderBytesCap int64
 	LastAvailReaderMsgCap   int64
 
+	// ReservedBytesCap and ReservedMsgCap are held back
+	// from the AvailReaderBytesCap and AvailReaderMsgCap
+	// we advertise, so that the sender's data never
+	// fills the transport's buffer, such as a nats
+	// subscription's pending limits, and our acks,
+	// keepalives and control packets still get
+	// through. Unlike Flow.ReservedByteCap, which sizes
+	// those limits, these come out of our window. Set
+	// both before Start().
+	ReservedBytesCap int64
+	ReservedMsgCap   int64
+
 	RcvdButNotConsumed map[int64]*Packet
 
-	ReadyForDelivery []*Packet
-	ReadMessagesCh   chan InOrderSeq
-	NumHeldMessages  chan int64
+	// len(RcvdButNotConsumed) for BufferUtilization, updated
+	// atomically at the top of each pass through the recvloop.
+	numHeld int64
+
+	// ReadyForDelivery.Len() for PeekNumReady, updated
+	// in the same place as numHeld.
+	numReady int64
+
+	// heldBytes sums the Data in RcvdButNotConsumed, kept
+	// by hold and unhold as packets come and go. Only the
+	// recvloop writes it; read with atomic.LoadInt64.
+	heldBytes int64
+
+	// waiters are the WaitDelivered calls, by seqno, and
+	// consumedThrough is LastMsgConsumed as they last saw
+	// it; see waitdelivered.go. Both under waitMut.
+	waitMut         sync.Mutex
+	waiters         []*deliveryWaiter
+	consumedThrough int64
+
+	// MaxBufferedBytes, if > 0, bounds the Data bytes
+	// held in RcvdButNotConsumed. At or over it we
+	// advertise a zero window, and drop arriving data
+	// unacked, until the consumer drains us below it.
+	// Once the consumer has taken all before it, we still
+	// take NextFrameExpected, as only it can let the
+	// packets held past it drain, dropping the last of
+	// those to make room.
+	// Set before Start().
+	MaxBufferedBytes int64
+
+	// ReadyForDelivery holds in-order packets until the
+	// consumer takes them. ReadyForDeliveryMaxLen, if > 0,
+	// bounds it; in-order packets beyond that stay in
+	// Rxq, unacked, so the sender's window stops advancing
+	// until the consumer catches up. With DropOnReadyFull
+	// set we instead drop the oldest ready packet, as a
+	// real-time consumer would rather have fresh data,
+	// and count it in ReadyQueueDropped, which is read
+	// with atomic.LoadInt64. Set both before Start().
+	ReadyForDelivery       *ReadyRing
+	ReadyForDeliveryMaxLen int
+	DropOnReadyFull        bool
+	ReadyQueueDropped      int64
+
+	// MaxReadyForDeliveryLen is the longest ReadyForDelivery
+	// has been, and CurrentReadyForDeliveryLen its length
+	// now, to size ReadyForDeliveryMaxLen by, or to spot a
+	// slow consumer before the window fills. Read both
+	// with atomic.LoadInt64.
+	MaxReadyForDeliveryLen     int64
+	CurrentReadyForDeliveryLen int64
+
+	ReadMessagesCh  chan InOrderSeq
+	NumHeldMessages chan int64
+
+	// ControlCh receives out-of-band Control
+	// packets; see control.go. ControlDropped
+	// counts those dropped because ControlCh was
+	// full, and is read with atomic.LoadInt64.
+	ControlCh      chan *Packet
+	ControlDropped int64
+
+	// bp is nil unless a HighWaterMark was
+	// configured; see backpressure.go.
+	bp *backpressure
+
+	// pipe is nil unless SetConsumerPipe was
+	// called; see pipe.go. The recvloop owns pipe;
+	// pipeReader is the same, under mut, for
+	// ConsumerReader.
+	pipe            *consumerPipe
+	pipeReader      *consumerPipe
+	setConsumerPipe chan *consumerPipe
+
+	// proposeWindow carries ProposeWindowSize
+	// requests to the recvloop; see window.go.
+	proposeWindow chan int64
 
 	// If AsapOn is true the recevier will
 	// forward packets for delivery to a
@@ -67,7 +341,7 @@ type RecvState struct {
 	// but without ordering guarantees;
 	// and we may also drop packets if
 	// the receive doesn't happen within
-	// 100 msec.
+	// the AsapHelper.DropTimeout (100 msec by default).
 	//
 	// The client must have previously called
 	// Session.RegisterAsap and provided a
@@ -98,6 +372,43 @@ type RecvState struct {
 
 	KeepAliveInterval time.Duration
 	keepAlive         <-chan time.Time
+
+	// HalfDuplex HalfDuplexReceiver has us send no
+	// keepalives; see halfduplex.go.
+	HalfDuplex HalfDuplexRole
+
+	// AckStrategy, if set, decides when the acks for
+	// consumed data go out, and AckTimerInterval is how
+	// often its OnTimer runs; see ackstrategy.go. Set
+	// both before Start().
+	AckStrategy      AckStrategy
+	AckTimerInterval time.Duration
+	ackTimer         <-chan time.Time
+	heldAck          *Packet
+	heldAckSince     time.Time
+	ackedThrough     int64
+
+	// the circuit breaker; see circuit.go. Set the
+	// first three before Start(). CircuitOpens is read
+	// with atomic.LoadInt64.
+	CircuitBreakerThreshold int64
+	CircuitBreakerDuration  time.Duration
+	CircuitResetTimeout     time.Duration
+	CircuitOpens            int64
+	circuitOpen             int32
+	circuitTimer            <-chan time.Time
+	cbSecStart              time.Time
+	cbSecBase               int64
+	cbOverSince             time.Time
+
+	// for Session.Snapshot; see snapshot.go.
+	snapshotCh chan *snapshotReq
+
+	// for SeekTo once started; see seek.go.
+	seekCh chan *seekReq
+
+	// closed once the recvloop is running.
+	ready chan struct{}
 }
 
 // InOrderSeq represents ordered (and gapless)
@@ -106,6 +417,38 @@ type RecvState struct {
 // it by asking on the Session.ReadMessagesCh channel.
 type InOrderSeq struct {
 	Seq []*Packet
+
+	// StreamID is shared by every packet in Seq:
+	// a delivery never mixes streams. See OpenStream.
+	StreamID uint32
+
+	// Gaps are the runs of SeqNum in Seq that arrived
+	// after a later packet did, and so held that later
+	// packet, and those in between, back. If 1, 2 and 5
+	// arrive, then 3 and 4, the delivery of 3, 4, 5 has
+	// Gaps [{3, 4}].
+	Gaps []SeqRange
+}
+
+// SeqRange is the SeqNum from Low through High.
+type SeqRange struct {
+	Low  int64
+	High int64
+}
+
+// bridgedGaps returns the Gaps of seq.
+func bridgedGaps(seq []*Packet) (gaps []SeqRange) {
+	for _, pack := range seq {
+		if !pack.bridged {
+			continue
+		}
+		if n := len(gaps); n > 0 && gaps[n-1].High+1 == pack.SeqNum {
+			gaps[n-1].High = pack.SeqNum
+			continue
+		}
+		gaps = append(gaps, SeqRange{Low: pack.SeqNum, High: pack.SeqNum})
+	}
+	return
 }
 
 // NewRecvState makes a new RecvState manager.
@@ -138,19 +481,34 @@ func NewRecvState(
 		RecvSz:              recvSz,
 		snd:                 snd,
 		RcvdButNotConsumed:  make(map[int64]*Packet),
-		ReadyForDelivery:    make([]*Packet, 0),
+		fecRcvd:             make(map[int64]*Packet),
+		fecPending:          make(map[int64]*Packet),
+		ReadyForDelivery:    newReadyRing(0),
 		ReadMessagesCh:      make(chan InOrderSeq),
+		ControlCh:           make(chan *Packet, DefaultControlChSz),
 		DoSendClosingCh:     make(chan *closeReq),
 		LastMsgConsumed:     -1,
+		consumedThrough:     -1,
 		LargestSeqnoRcvd:    -1,
+		lastNackNum:         -1,
+		ackedThrough:        -1,
+		dedupSkippedThrough: -1,
 		MaxCumulBytesTrans:  0,
 		LastByteConsumed:    -1,
 		NumHeldMessages:     make(chan int64),
 		setAsapHelper:       make(chan *AsapHelper),
+		setConsumerPipe:     make(chan *consumerPipe),
+		proposeWindow:       make(chan int64),
 		TcpState:            Listen,
 		AcceptReadRequest:   make(chan *ReadRequest),
 		ConnectCh:           make(chan *ConnectReq),
 		tcpStateQueryCh:     make(chan TcpState),
+		snapshotCh:          make(chan *snapshotReq),
+		seekCh:              make(chan *seekReq),
+		commitCh:            make(chan int64),
+		MaxAckLookback:      DefaultMaxAckLookback,
+		MaxStreams:          DefaultMaxStreams,
+		ready:               make(chan struct{}),
 
 		// send keepalives (important especially for resuming flow from a
 		// stopped state) at least this often:
@@ -160,6 +518,8 @@ func NewRecvState(
 	for i := range r.Rxq {
 		r.Rxq[i] = &RxqSlot{}
 	}
+	// nothing consumed yet; 0 would ack SeqNum 0.
+	r.LastFrameClientConsumed = -1
 	return r
 }
 
@@ -171,6 +531,13 @@ func (r *RecvState) Start() error {
 	if err != nil {
 		return err
 	}
+	if r.DeduplicateWindow > 0 {
+		r.dedup = newDedupSet(r.DeduplicateWindow)
+		r.dedupSkippedThrough = -1
+	}
+	if r.ReadyForDelivery.Len() == 0 {
+		r.ReadyForDelivery = newReadyRing(r.ReadyForDeliveryMaxLen)
+	}
 
 	switch nn := r.Net.(type) {
 	case *NatsNet:
@@ -187,8 +554,14 @@ func (r *RecvState) Start() error {
 
 	var deliverToConsumer chan InOrderSeq
 	var delivery InOrderSeq
+	var deliveryGen int64
+
+	var pipeRead chan struct{}
 
 	go func() {
+		if r.LoopStart != nil {
+			r.LoopStart()
+		}
 		defer func() {
 			//mylog.Printf("%s RecvState defer/shutdown happening.", r.Inbox)
 			//mylog.Printf("full stack during RecvState defer:\n %s\n", fullStackTraceString())
@@ -203,16 +576,30 @@ func (r *RecvState) Start() error {
 
 		// send keepalives (for resuming flow from a
 		// stopped state) at least this often:
-		r.keepAlive = time.After(r.KeepAliveInterval)
+		if r.HalfDuplex != HalfDuplexReceiver {
+			r.keepAlive = time.After(r.KeepAliveInterval)
+		}
+		r.armAckTimer()
 
+		close(r.ready)
 	recvloop:
 		for {
 			//p("%v top of recvloop, receiver NFE: %v. TcpState=%s",
 			//	r.Inbox, r.NextFrameExpected, r.TcpState)
 
+			atomic.StoreInt64(&r.numHeld, int64(len(r.RcvdButNotConsumed)))
+			atomic.StoreInt64(&r.numReady, int64(r.ReadyForDelivery.Len()))
+			atomic.StoreInt64(&r.CurrentReadyForDeliveryLen, int64(r.ReadyForDelivery.Len()))
+			r.wakeDelivered()
+
 			deliverToConsumer = nil
-			if len(r.ReadyForDelivery) > 0 {
-				delivery.Seq = r.ReadyForDelivery
+			if r.ReadyForDelivery.Len() > 0 {
+				if delivery.Seq == nil || deliveryGen != r.ReadyForDelivery.gen {
+					delivery.Seq = r.ReadyForDelivery.frontRun()
+					delivery.StreamID = delivery.Seq[0].StreamID
+					delivery.Gaps = bridgedGaps(delivery.Seq)
+					deliveryGen = r.ReadyForDelivery.gen
+				}
 				deliverToConsumer = r.ReadMessagesCh
 
 				//deliveryLen := len(delivery.Seq)
@@ -245,6 +632,13 @@ func (r *RecvState) Start() error {
 			case <-r.retryTimerCh:
 				r.retryCheck()
 
+			case <-r.ackTimer:
+				r.AckStrategy.OnTimer(r)
+				r.armAckTimer()
+
+			case <-r.circuitTimer:
+				r.closeCircuit()
+
 			case cr := <-r.ConnectCh:
 				//
 				// Connect. Do an active open. Send syn to remote and
@@ -293,6 +687,7 @@ func (r *RecvState) Start() error {
 					SeqNum:        -98, // => syn flag
 					SeqRetry:      -98,
 					TcpEvent:      EventSyn,
+					Version:       ProtocolVersion,
 				}
 				cr.synPack = syn
 
@@ -314,13 +709,42 @@ func (r *RecvState) Start() error {
 					r.asapHelper.Stop()
 				}
 				r.asapHelper = helper
+				r.AsapOn = helper != nil
 				if helper != nil {
-					r.AsapOn = true
+					helper.Start()
 				}
 
+			case p := <-r.setConsumerPipe:
+				r.pipe = p
+				pipeRead = p.readCh
+				go p.pump(r)
+
+			case <-pipeRead:
+				r.pipe.onRead(r)
+
+			case n := <-r.proposeWindow:
+				r.resizeRxq(n)
+
 			case r.NumHeldMessages <- int64(len(r.RcvdButNotConsumed)):
 				//p("recvloop: got <-r.RcvdButNotConsumed")
 
+			case req := <-r.snapshotCh:
+				r.snapshot(req.snap)
+				close(req.done)
+				continue
+
+			case last := <-r.commitCh:
+				r.commit(last)
+
+			case req := <-r.seekCh:
+				req.err = r.seek(req.seqno)
+				if req.err == nil {
+					r.UpdateControl(nil)
+					r.ack(r.LastFrameClientConsumed, nil, EventDataAck)
+				}
+				close(req.done)
+				continue
+
 			case rr := <-r.AcceptReadRequest:
 				if len(delivery.Seq) == 0 {
 					// nothing to deliver
@@ -333,23 +757,25 @@ func (r *RecvState) Start() error {
 				continue
 
 			case deliverToConsumer <- delivery:
-				deliveryLen := len(delivery.Seq)
-				//p("%v made deliverToConsumer delivery of %v packets [%v, %v]", r.Inbox, deliveryLen, delivery.Seq[0].SeqNum, delivery.Seq[deliveryLen-1].SeqNum)
+				if r.OnDeliver != nil {
+					r.OnDeliver(delivery)
+				}
+				var nbytes int64
 				for _, pack := range delivery.Seq {
-					///p("%v after delivery, deleting from r.RcvdButNotConsumed pack.SeqNum=%v", r.Inbox, pack.SeqNum)
-					delete(r.RcvdButNotConsumed, pack.SeqNum)
-					r.LastMsgConsumed = pack.SeqNum
-				}
-				// this seems wrong:
-				//r.LastByteConsumed = delivery.Seq[0].CumulBytesTransmitted - int64(len(delivery.Seq[0].Data))
-				// this seems right:
-				r.LastByteConsumed = delivery.Seq[deliveryLen-1].CumulBytesTransmitted
-
-				r.ReadyForDelivery = make([]*Packet, 0)
-				lastPack := delivery.Seq[deliveryLen-1]
-				r.LastFrameClientConsumed = lastPack.SeqNum
-				r.ack(r.LastFrameClientConsumed, lastPack, EventDataAck)
+					nbytes += int64(len(pack.Data))
+				}
+				atomic.AddInt64(&r.CumulBytesDelivered, nbytes)
+				for range delivery.Seq {
+					r.ReadyForDelivery.PopFront()
+				}
+				if r.ManualAck {
+					// consumed once committed; see receipt.go.
+					r.uncommitted = append(r.uncommitted, &receipt{seq: delivery.Seq})
+				} else {
+					r.markConsumed(delivery.Seq)
+				}
 				delivery.Seq = nil
+				r.readyInOrder()
 
 			case <-r.Halt.ReqStop.Chan:
 				//p("%v recvloop sees ReqStop waiting on r.MsgRecv, shutting down. [2]", r.Inbox)
@@ -360,6 +786,18 @@ func (r *RecvState) Start() error {
 			case pack := <-r.MsgRecv:
 				//p("%v recvloop (in state '%s') sees packet.SeqNum '%v', event:'%s', AckNum:%v", r.Inbox, r.TcpState, pack.SeqNum, pack.TcpEvent, pack.AckNum)
 
+				if r.cipher != nil && !pack.recovered {
+					// nothing else may see a packet that
+					// fails authentication; see crypt.go.
+					err := r.cipher.verify(pack)
+					if err != nil {
+						atomic.AddInt64(&r.DecryptFailures, 1)
+						atomic.AddInt64(&r.DiscardReasons.AuthFail, 1)
+						mylog.Printf("%v dropping packet.SeqNum %v from '%s': %v", r.Inbox, pack.SeqNum, pack.From, err)
+						continue recvloop
+					}
+				}
+
 				if pack.TcpEvent == EventSyn &&
 					(r.TcpState == Fresh ||
 						r.TcpState == Listen) {
@@ -375,6 +813,7 @@ func (r *RecvState) Start() error {
 				if r.RemoteInbox != "" && pack.From != r.RemoteInbox {
 					// drop other remotes,
 					// also enforcing that we see Syn 1st.
+					atomic.AddInt64(&r.DiscardReasons.AuthFail, 1)
 					mylog.Printf("%s dropping pack that isn't from '%s'", r.Inbox, r.RemoteInbox)
 					continue
 				}
@@ -382,15 +821,28 @@ func (r *RecvState) Start() error {
 				// drop non-session packets: they are for other sessions
 				if (pack.DestSessNonce != "" || r.TcpState >= Established) &&
 					pack.DestSessNonce != r.LocalSessNonce {
+					atomic.AddInt64(&r.DiscardReasons.AuthFail, 1)
 					mylog.Printf("warning %v pack.DestSessNonce('%s') != r.LocalSessNonce('%s'): recvloop (in TcpState==%s) dropping packet.SeqNum '%v', event:'%s', AckNum:%v", r.Inbox, pack.DestSessNonce, r.LocalSessNonce, r.TcpState, pack.SeqNum, pack.TcpEvent, pack.AckNum)
 					continue // drop others
 				}
 				if r.RemoteSessNonce != "" &&
 					pack.FromSessNonce != r.RemoteSessNonce {
+					atomic.AddInt64(&r.DiscardReasons.AuthFail, 1)
 					mylog.Printf("warining %v pack.FromSessNonce('%s') != r.RemoteSessNonce('%s'): recvloop (in TcpState==%s) dropping packet.SeqNum '%v', event:'%s', AckNum:%v", r.Inbox, pack.FromSessNonce, r.RemoteSessNonce, pack.SeqNum, r.TcpState, pack.TcpEvent, pack.AckNum)
 					continue // drop others
 				}
 
+				if pack.Version < r.MinPeerVersion {
+					atomic.AddInt64(&r.OldVersionDropped, 1)
+					mylog.Printf("%s dropping packet from '%s' with Version %v older than MinPeerVersion %v", r.Inbox, pack.From, pack.Version, r.MinPeerVersion)
+					continue recvloop
+				}
+
+				if r.heardPeer != nil {
+					r.heardPeer()
+					r.heardPeer = nil
+				}
+
 				// test instrumentation, used e.g. in clock_test.go
 				if r.testing != nil && r.testing.incrementClockOnReceive {
 					r.Clk.(*SimClock).Advance(time.Second)
@@ -399,6 +851,8 @@ func (r *RecvState) Start() error {
 				if len(pack.Data) > 0 {
 					chk := Blake2bOfBytes(pack.Data)
 					if 0 != bytes.Compare(pack.Blake2bChecksum, chk) {
+						atomic.AddInt64(&r.CorruptedCount, 1)
+						atomic.AddInt64(&r.DiscardReasons.CorruptCRC, 1)
 						mylog.Printf("expected checksum to be '%x', but was '%x'. For pack.SeqNum %v",
 							pack.Blake2bChecksum, chk, pack.SeqNum)
 						//panic("data corruption detected by blake2b checksum")
@@ -409,22 +863,83 @@ func (r *RecvState) Start() error {
 					}
 				}
 
+				// parity covers Data as it came; see fec.go.
+				wire := pack.Data
+				if r.cipher != nil && len(pack.Data) > 0 && !pack.Parity {
+					err := r.cipher.open(pack)
+					if err != nil {
+						atomic.AddInt64(&r.DecryptFailures, 1)
+						atomic.AddInt64(&r.DiscardReasons.AuthFail, 1)
+						mylog.Printf("%v dropping packet.SeqNum %v from '%s': %v", r.Inbox, pack.SeqNum, pack.From, err)
+						continue recvloop
+					}
+				}
+				if pack.CompressedSize > 0 && !pack.Control && !pack.Parity {
+					err := ErrDecompress
+					if r.decompress {
+						err = decompress(pack, r.RecvWindowSizeBytes)
+					}
+					if err != nil {
+						atomic.AddInt64(&r.DecompressFailures, 1)
+						atomic.AddInt64(&r.DiscardReasons.CorruptCRC, 1)
+						mylog.Printf("%v dropping packet.SeqNum %v from '%s': %v", r.Inbox, pack.SeqNum, pack.From, err)
+						continue recvloop
+					}
+				}
+
 				now := r.Clk.Now()
-				pack.ArrivedAtDestTm = now
+				if pack.ArrivedAtDestTm.IsZero() {
+					// not already stamped by a SimNet
+					// simulating clock skew.
+					pack.ArrivedAtDestTm = now
+				}
+
+				if pack.TcpEvent == EventData && !pack.Control && !pack.Parity {
+					// a later packet beat this one here. Set
+					// before anything else can see pack.
+					pack.bridged = pack.SeqNum >= r.NextFrameExpected &&
+						pack.SeqNum < r.LargestSeqnoRcvd &&
+						r.RcvdButNotConsumed[pack.SeqNum] == nil
+				}
 
 				if r.testing != nil && r.testing.ackCb != nil {
 					r.testing.ackCb(pack)
 				}
 
+				if pack.Control {
+					if pack.CircuitOpen {
+						r.snd.circuitOpened(pack)
+						continue recvloop
+					}
+					r.deliverControl(pack)
+					continue recvloop
+				}
+
+				if pack.Parity {
+					if r.FECGroupSize > 0 {
+						r.fecGotParity(pack)
+					}
+					continue recvloop
+				}
+
 				// tell any ASAP clients about it
 				if r.AsapOn && r.asapHelper != nil {
-					select {
-					case r.asapHelper.enqueue <- pack:
-					case <-time.After(100 * time.Millisecond):
-						// drop packet; note there may be gaps in SeqNum on Asap b/c of this.
-					case <-r.Halt.ReqStop.Chan:
-						///p("r.Halt.ReqStop.Chan closed, returning.")
-						return
+					if r.asapHelper.DropTimeout <= 0 {
+						// non-dropping mode: wait for the client.
+						select {
+						case r.asapHelper.rcv <- pack:
+						case <-r.Halt.ReqStop.Chan:
+							return
+						}
+					} else {
+						select {
+						case r.asapHelper.enqueue <- pack:
+						case <-time.After(r.asapHelper.DropTimeout):
+							// drop packet; note there may be gaps in SeqNum on Asap b/c of this.
+						case <-r.Halt.ReqStop.Chan:
+							///p("r.Halt.ReqStop.Chan closed, returning.")
+							return
+						}
 					}
 				}
 
@@ -439,11 +954,21 @@ func (r *RecvState) Start() error {
 					panic("invariant that pack.CumulBytesTransmitted goes in packet SeqNum order failed.")
 				}
 
+				cp := CopyPacketSansData(pack)
+				if r.spoofedAck(pack) {
+					atomic.AddInt64(&r.SpoofedAckCount, 1)
+					mylog.Printf("warning %v dropping AckNum %v from '%s': we have sent through %v, and had acks through %v", r.Inbox, pack.AckNum, pack.From, r.snd.LastSeqSent(), r.snd.LargestAckedSeqno())
+					if pack.TcpEvent != EventData {
+						continue recvloop
+					}
+					// keep the data, lose the ack.
+					cp.AckNum = -1
+				}
+
 				// stuff has changed, so update
 				r.UpdateControl(pack)
 				// and tell snd about the new flow-control info
 				//p("%v tellng r.snd.GotAck <- pack: '%#v'", r.Inbox, pack)
-				cp := CopyPacketSansData(pack)
 				select {
 				case r.snd.GotPack <- cp:
 				case <-r.Halt.ReqStop.Chan:
@@ -489,9 +1014,41 @@ func (r *RecvState) Start() error {
 				}
 				// data: actual data received, receiver side stuff follows.
 
+				if r.FECGroupSize > 0 && pack.SeqNum >= r.NextFrameExpected {
+					r.fecGotData(pack, wire)
+				}
+
+				if r.overMemory() && r.RcvdButNotConsumed[pack.SeqNum] == nil {
+					if pack.SeqNum != r.NextFrameExpected || r.LastFrameClientConsumed < r.NextFrameExpected-1 {
+						// no room; the sender will retry it
+						// once our window reopens.
+						atomic.AddInt64(&r.DiscardReasons.OverMemory, 1)
+						r.snd.Events.emit(PacketDropped, pack.SeqNum, now, nil)
+						continue recvloop
+					}
+					// all we hold is past it, so only it
+					// can free us: make room.
+					r.evictPastNFE(now)
+				}
+
+				if pack.StreamID != 0 && !r.IndependentStreams {
+					// the peer uses streams, so order
+					// each on its own; see stream.go.
+					r.IndependentStreams = true
+				}
+				if r.IndependentStreams && r.deliveredEarly(pack.SeqNum) {
+					// a retry of one we gave the consumer
+					// ahead of a gap; see stream.go.
+					continue recvloop
+				}
+
+				if pack.SeqNum > r.NextFrameExpected {
+					r.ReorderDistance.add(pack.SeqNum - r.NextFrameExpected)
+				}
+
 				// if not old dup, add to hash of to-be-consumed
 				if pack.SeqNum >= r.NextFrameExpected {
-					r.RcvdButNotConsumed[pack.SeqNum] = pack
+					r.hold(pack)
 					//p("%v adding to r.RcvdButNotConsumed pack.SeqNum=%v   ... summary: %s",
 					//r.Inbox, pack.SeqNum, r.HeldAsString())
 				}
@@ -516,6 +1073,11 @@ func (r *RecvState) Start() error {
 					//	r.Inbox, pack.SeqNum, r.NextFrameExpected,
 					//	r.NextFrameExpected+r.RecvWindowSize-1)
 					r.DiscardCount++
+					atomic.AddInt64(&r.DiscardReasons.OutOfWindow, 1)
+					r.snd.Events.emit(PacketDropped, pack.SeqNum, now, nil)
+					if r.circuitCheck(now) {
+						continue recvloop
+					}
 					r.ack(r.LastFrameClientConsumed, pack, EventDataAck)
 					continue recvloop
 				}
@@ -523,35 +1085,35 @@ func (r *RecvState) Start() error {
 				slot.Pack = pack
 				//p("%v packet %#v queued for ordered delivery, checking to see if we can deliver now",
 				//	r.Inbox, slot.Pack)
+				if r.IndependentStreams && pack.SeqNum > r.NextFrameExpected {
+					r.streamArrived(pack)
+				}
 
 				if pack.SeqNum == r.NextFrameExpected {
 					// horray, we can deliver one or more frames in order
 
 					//p("%v packet.SeqNum %v matches r.NextFrameExpected",
 					//	r.Inbox, pack.SeqNum)
-					for slot.Received {
-
-						//p("%v actual in-order receive happening for SeqNum %v",
-						//	r.Inbox, slot.Pack.SeqNum)
-
-						r.ReadyForDelivery = append(r.ReadyForDelivery, slot.Pack)
-						r.RecvHistory = append(r.RecvHistory, slot.Pack)
-						//p("%v r.RecvHistory now has length %v", r.Inbox, len(r.RecvHistory))
-
-						slot.Received = false
-						slot.Pack = nil
-						r.NextFrameExpected++
-						slot = r.Rxq[r.NextFrameExpected%r.RecvWindowSize]
-					}
-
-					// update senders view of NextFrameExpected, for keep-alives.
-					r.snd.SetRecvLastFrameClientConsumed(r.LastFrameClientConsumed)
+					r.readyInOrder()
 
 					// not here, wait until delivered to consumer:
 					// r.ack(r.LastFrameClientConsumed, pack, EventDataAck)
 				} else {
 					//p("%v packet SeqNum %v was not NextFrameExpected %v; stored packet but not delivered.",
 					//	r.Inbox, pack.SeqNum, r.NextFrameExpected)
+
+					// we have a gap. Ask for the first missing
+					// packet now rather than waiting for the
+					// sender to time out. Only nak each gap once,
+					// so that a burst of out-of-order arrivals
+					// doesn't trigger a burst of retransmits.
+					// A NextFrameExpected already in Rxq is no
+					// gap, just held by a full ReadyForDelivery.
+					held := r.Rxq[r.NextFrameExpected%r.RecvWindowSize].Received
+					if !held && r.NextFrameExpected != r.lastNackNum {
+						r.lastNackNum = r.NextFrameExpected
+						r.nak(r.NextFrameExpected, pack)
+					}
 				}
 			}
 		}
@@ -559,6 +1121,73 @@ func (r *RecvState) Start() error {
 	return nil
 }
 
+// BufferUtilization returns the fraction, in [0, 1], of
+// the receive window holding packets that the consumer
+// has yet to read. It is safe to call from any goroutine.
+func (r *RecvState) BufferUtilization() float64 {
+	return utilization(atomic.LoadInt64(&r.numHeld), atomic.LoadInt64(&r.RecvWindowSize))
+}
+
+// HeldBytes returns the Data bytes in packets we have
+// received but the consumer has yet to take. It is safe
+// to call from any goroutine.
+func (r *RecvState) HeldBytes() int64 {
+	return atomic.LoadInt64(&r.heldBytes)
+}
+
+// hold adds pack to RcvdButNotConsumed, in place of
+// any packet held with its SeqNum. Only the recvloop
+// may call it.
+func (r *RecvState) hold(pack *Packet) {
+	r.unhold(pack.SeqNum)
+	r.RcvdButNotConsumed[pack.SeqNum] = pack
+	atomic.AddInt64(&r.heldBytes, int64(len(pack.Data)))
+}
+
+// unhold removes seqno from RcvdButNotConsumed. Only
+// the recvloop may call it.
+func (r *RecvState) unhold(seqno int64) {
+	if pack, ok := r.RcvdButNotConsumed[seqno]; ok {
+		atomic.AddInt64(&r.heldBytes, -int64(len(pack.Data)))
+		delete(r.RcvdButNotConsumed, seqno)
+	}
+}
+
+// overMemory reports whether we hold MaxBufferedBytes
+// or more. Only the recvloop may call it.
+func (r *RecvState) overMemory() bool {
+	return r.MaxBufferedBytes > 0 && atomic.LoadInt64(&r.heldBytes) >= r.MaxBufferedBytes
+}
+
+// evictPastNFE drops held packets past NextFrameExpected,
+// the last first, until we are under MaxBufferedBytes,
+// for the sender to retry. Packets a stream was
+// given early stay. Only the recvloop may call it.
+func (r *RecvState) evictPastNFE(now time.Time) {
+	for seqno := r.NextFrameExpected + r.RecvWindowSize - 1; seqno > r.NextFrameExpected && r.overMemory(); seqno-- {
+		slot := r.Rxq[seqno%r.RecvWindowSize]
+		if !slot.Received || slot.Pack.SeqNum != seqno || slot.Pack.early {
+			continue
+		}
+		if r.IndependentStreams {
+			r.streamEvicted(slot.Pack)
+		}
+		r.unhold(seqno)
+		slot.Received = false
+		slot.Pack = nil
+		atomic.AddInt64(&r.DiscardReasons.OverMemory, 1)
+		r.snd.Events.emit(PacketDropped, seqno, now, nil)
+	}
+}
+
+// PeekNumReady returns the number of packets that are
+// in order and ready for the consumer to read, without
+// blocking. Unlike NumHeldMessages, it leaves out packets
+// held behind a gap. It is safe to call from any goroutine.
+func (r *RecvState) PeekNumReady() int64 {
+	return atomic.LoadInt64(&r.numReady)
+}
+
 // UpdateFlowControl updates our flow control
 // parameters r.LastAvailReaderMsgCap and
 // r.LastAvailReaderBytesCap based on the
@@ -577,8 +1206,23 @@ func (r *RecvState) UpdateControl(pack *Packet) {
 	// advertisedWindow = maxRecvBuffer - (lastByteRcvd - nextByteRead)
 	r.LastAvailReaderMsgCap = r.RecvWindowSize - (r.LargestSeqnoRcvd - r.LastMsgConsumed)
 	r.LastAvailReaderBytesCap = r.RecvWindowSizeBytes - (r.MaxCumulBytesTrans - (r.LastByteConsumed + 1))
+	if r.ReservedMsgCap > 0 {
+		r.LastAvailReaderMsgCap = int64Max(0, r.LastAvailReaderMsgCap-r.ReservedMsgCap)
+	}
+	if r.ReservedBytesCap > 0 {
+		r.LastAvailReaderBytesCap = int64Max(0, r.LastAvailReaderBytesCap-r.ReservedBytesCap)
+	}
+	if r.overMemory() {
+		// zero window, until the consumer drains us.
+		r.LastAvailReaderMsgCap = 0
+		r.LastAvailReaderBytesCap = 0
+	}
 	r.snd.FlowCt.UpdateFlow(r.Inbox+":recver", r.Net, r.LastAvailReaderMsgCap, r.LastAvailReaderBytesCap, pack)
 
+	if r.bp != nil {
+		r.bp.update(r.LargestSeqnoRcvd - r.LastMsgConsumed)
+	}
+
 	//p("%v UpdateFlowControl in RecvState, bottom: "+
 	//	"r.LastAvailReaderMsgCap= %v -> %v",
 	//	r.Inbox, begVal, r.LastAvailReaderMsgCap)
@@ -589,9 +1233,29 @@ func (r *RecvState) UpdateControl(pack *Packet) {
 //
 // Allow pack to be nil for final death gasp EventReset.
 func (r *RecvState) ack(seqno int64, pack *Packet, event TcpEvent) {
+	r.ackOrNak(seqno, pack, event, -1)
+}
+
+// nak requests immediate retransmission of the missing
+// nackNum. Everything before nackNum has arrived, but
+// like any ack the nak only acks what the consumer has
+// taken, so that a slow consumer holds the sender back.
+func (r *RecvState) nak(nackNum int64, pack *Packet) {
+	atomic.AddInt64(&r.NacksSent, 1)
+	r.ackOrNak(r.LastFrameClientConsumed, pack, EventDataAck, nackNum)
+}
+
+// ackOrNak does the work for ack and nak. A negative
+// nackNum means a plain ack.
+func (r *RecvState) ackOrNak(seqno int64, pack *Packet, event TcpEvent, nackNum int64) {
 
 	// keepalives will have seqno negative, so don't freak out.
 
+	if atomic.LoadInt32(&r.circuitOpen) == 1 {
+		// we've stopped talking to this sender.
+		return
+	}
+
 	///p("%s RecvState.ack() is doing ack with event '%s' in state '%s', giving seqno=%v. LastFrameClientConsumed=%v", r.Inbox, event, r.TcpState, seqno, r.LastFrameClientConsumed)
 
 	if pack != nil {
@@ -621,6 +1285,24 @@ func (r *RecvState) ack(seqno int64, pack *Packet, event TcpEvent) {
 		AckRetry:            ackRetry,
 		AckReplyTm:          now,
 		DataSendTm:          dataSendTm,
+		Version:             ProtocolVersion,
+	}
+	if nackNum >= 0 {
+		ack.Nak = true
+		ack.NackNum = nackNum
+	}
+	if event == EventDataAck {
+		// covers any ack our AckStrategy held.
+		r.ackedThrough = seqno
+		r.heldAck = nil
+	}
+	if pack != nil && pack.TcpEvent == EventKeepAlive {
+		// answering a keepalive.
+		ack.KAReply = true
+	}
+	if event == EventKeepAlive {
+		// a window update; see window.go.
+		ack.ProposeWindowSize = atomic.LoadInt64(&r.snd.proposedWindowSize)
 	}
 	if len(r.snd.SendAck) == cap(r.snd.SendAck) {
 		mylog.Printf("warning: %s ack queue is at capacity, very bad!  dropping oldest ack packet so as to add this one AckNum:%v, with TcpEvent:%s.", r.Inbox, ack.AckNum, ack.TcpEvent)
@@ -636,6 +1318,74 @@ func (r *RecvState) ack(seqno int64, pack *Packet, event TcpEvent) {
 	}
 }
 
+// markConsumed records that the consumer has
+// taken seq, the packets of one delivery, and acks it.
+func (r *RecvState) markConsumed(seq []*Packet) {
+	for _, pack := range seq {
+		///p("%v after delivery, deleting from r.RcvdButNotConsumed pack.SeqNum=%v", r.Inbox, pack.SeqNum)
+		r.unhold(pack.SeqNum)
+	}
+	lastPack := seq[len(seq)-1]
+	if r.IndependentStreams || r.PriorityDelivery {
+		// seq may be ahead of a gap, or of packets
+		// of lower priority; see stream.go.
+		r.advanceConsumed()
+		r.consumedCallbacks(seq)
+		r.dataAck(lastPack)
+		return
+	}
+	r.LastMsgConsumed = lastPack.SeqNum
+	// this seems wrong:
+	//r.LastByteConsumed = seq[0].CumulBytesTransmitted - int64(len(seq[0].Data))
+	// this seems right:
+	if r.pipe == nil {
+		// with a pipe, we wait to see the consumer read.
+		r.LastByteConsumed = lastPack.CumulBytesTransmitted
+	}
+	r.LastFrameClientConsumed = lastPack.SeqNum
+	if r.ReadyForDelivery.Len() == 0 && len(r.uncommitted) == 0 &&
+		r.dedupSkippedThrough > r.LastFrameClientConsumed {
+		// dropped duplicates, or filtered packets,
+		// that followed lastPack.
+		r.LastFrameClientConsumed = r.dedupSkippedThrough
+	}
+	r.consumedCallbacks(seq)
+	r.dataAck(lastPack)
+}
+
+// consumedCallbacks calls any ConsumedCallback, and
+// ends any delivery span, for each packet of seq.
+func (r *RecvState) consumedCallbacks(seq []*Packet) {
+	if r.ConsumedCallback == nil && len(r.deliverySpans) == 0 {
+		return
+	}
+	for _, pack := range seq {
+		r.endDeliverySpan(pack.SeqNum)
+		if r.ConsumedCallback != nil {
+			r.ConsumedCallback(pack.SeqNum, len(pack.Data))
+		}
+	}
+}
+
+// spoofedAck reports whether pack's AckNum can't
+// be a real ack of ours: it is past the last SeqNum
+// we sent, or more than MaxAckLookback behind the
+// largest already acked. AckNum < 0, meaning none,
+// is always fine, as are the connection setup and
+// teardown events, whose AckNum isn't about our data.
+func (r *RecvState) spoofedAck(pack *Packet) bool {
+	if pack.AckNum < 0 {
+		return false
+	}
+	switch pack.TcpEvent {
+	case EventData, EventDataAck, EventKeepAlive:
+	default:
+		return false
+	}
+	return pack.AckNum > r.snd.LastSeqSent() ||
+		pack.AckNum < r.snd.LargestAckedSeqno()-r.MaxAckLookback
+}
+
 // Stop the RecvState componennt
 func (r *RecvState) Stop() {
 	//p("%v RecvState.Stop() called.", r.Inbox)
@@ -667,6 +1417,9 @@ func (r *RecvState) cleanupOnExit() {
 	if r.asapHelper != nil {
 		r.asapHelper.Stop()
 	}
+	if r.pipe != nil {
+		r.pipe.close()
+	}
 }
 
 // testModeOn idempotently turns
@@ -775,27 +1528,26 @@ func (r *RecvState) fillAsMuchAsPossible(rr *ReadRequest) {
 		return
 	}
 
-	// copy our slice to ready, so our changing r.ReadyForDelivery
-	// won't mess up the for range loop.
-	ready := r.ReadyForDelivery
-	//p("RecvState.fillAsMuchAsPossible(): len(ready)=%v", len(ready))
+	//p("RecvState.fillAsMuchAsPossible(): len(ready)=%v", r.ReadyForDelivery.Len())
 
 	// lastPack is the last completely consumed packet.
 	var lastPack *Packet
 
-	for _, pk := range ready {
+	for r.ReadyForDelivery.Len() > 0 {
+		pk := r.ReadyForDelivery.Front()
 		lendata := len(pk.Data) - pk.DataOffset
 		//p("fillAsMuch: next packet pk is of len %v", lendata)
 		m := copy(rr.P[rr.N:], pk.Data[pk.DataOffset:])
 		rr.N += m
 		pk.DataOffset += m
+		atomic.AddInt64(&r.CumulBytesDelivered, int64(m))
 
 		// how far did we get?
 		if m == lendata {
 			//p("consumed complete packet k=%v", k)
 			// consumed the complete pk Packet
-			r.ReadyForDelivery = r.ReadyForDelivery[1:]
-			delete(r.RcvdButNotConsumed, pk.SeqNum)
+			r.ReadyForDelivery.PopFront()
+			r.unhold(pk.SeqNum)
 			r.LastMsgConsumed = pk.SeqNum
 			r.LastFrameClientConsumed = pk.SeqNum
 			lastPack = pk
@@ -815,7 +1567,8 @@ func (r *RecvState) fillAsMuchAsPossible(rr *ReadRequest) {
 		// yep, there is space in rr.P, continue
 	}
 	if lastPack != nil {
-		r.ack(r.LastFrameClientConsumed, lastPack, EventDataAck)
+		r.dataAck(lastPack)
+		r.readyInOrder()
 	}
 }
 
@@ -1,6 +1,10 @@
 package swp
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	cv "github.com/glycerine/goconvey/convey"
@@ -11,18 +15,7 @@ func Test010ConsumerSideFlowControl(t *testing.T) {
 
 	cv.Convey("Given node A sending to node B, the downstream reader-consumer application reading from B, if slow, the B node should reflect the reader's rate. So with a minimal 1 message size of buffer, the sender is blocked until that first message is consumed from B. Here there is no auto-reading, so we should have one held message until we read manually.", t, func() {
 
-		lossProb := float64(0)
-		lat := time.Millisecond
-		net := NewSimNet(lossProb, lat)
-		rtt := 2 * lat
-
-		A, err := NewSession(SessionConfig{Net: net, LocalInbox: "A", DestInbox: "B",
-			WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk,
-		})
-		panicOn(err)
-		B, err := NewSession(SessionConfig{Net: net, LocalInbox: "B", DestInbox: "A",
-			WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk,
-		})
+		A, B, cleanup, err := SwpPipe(WithWindowMsgCount(3))
 		panicOn(err)
 
 		p1 := &Packet{
@@ -71,8 +64,7 @@ func Test010ConsumerSideFlowControl(t *testing.T) {
 		p("good: got second packet delivery")
 
 		held = <-B.Swp.Recver.NumHeldMessages
-		A.Stop()
-		B.Stop()
+		cleanup()
 
 		cv.So(packetsConsumed, cv.ShouldEqual, 2)
 		cv.So(held, cv.ShouldEqual, 0)
@@ -83,21 +75,11 @@ func Test020DetectOtherEndShutdown(t *testing.T) {
 
 	cv.Convey("When the other end of our session disappears, we should detect this and close up the session.", t, func() {
 
-		lossProb := float64(0)
-		lat := time.Millisecond
-		net := NewSimNet(lossProb, lat)
-		rtt := 2 * lat
-
-		A, err := NewSession(SessionConfig{Net: net, LocalInbox: "A", DestInbox: "B",
-			WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk,
-			NumFailedKeepAlivesBeforeClosing: 10,
-		})
-		panicOn(err)
-		B, err := NewSession(SessionConfig{Net: net, LocalInbox: "B", DestInbox: "A",
-			WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk,
-			NumFailedKeepAlivesBeforeClosing: 10,
-		})
+		A, B, cleanup, err := SwpPipe(WithWindowMsgCount(3), WithConfig(func(cfg *SessionConfig) {
+			cfg.NumFailedKeepAlivesBeforeClosing = 10
+		}))
 		panicOn(err)
+		defer cleanup()
 
 		p1 := &Packet{
 			From:     "A",
@@ -143,3 +125,551 @@ func Test020DetectOtherEndShutdown(t *testing.T) {
 		cv.So(true, cv.ShouldEqual, true)
 	})
 }
+
+func Test091PeekNumReady(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	A.SelfConsumeForTesting()
+
+	idle := B.NumReadyPackets()
+	for i := 0; i < 4; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("ready"), TcpEvent: EventData})
+	}
+	time.Sleep(100 * time.Millisecond)
+	ready := B.NumReadyPackets()
+
+	seq, errRead := B.ReadCtx(context.Background())
+	time.Sleep(20 * time.Millisecond)
+	afterRead := B.Swp.Recver.PeekNumReady()
+
+	cleanup()
+
+	cv.Convey("Given 4 in-order packets that B has not read, NumReadyPackets should report 4 without blocking, and 0 once they are read.", t, func() {
+		cv.So(idle, cv.ShouldEqual, 0)
+		cv.So(ready, cv.ShouldEqual, 4)
+		cv.So(errRead, cv.ShouldBeNil)
+		cv.So(len(seq.Seq), cv.ShouldEqual, 4)
+		cv.So(afterRead, cv.ShouldEqual, 0)
+	})
+}
+
+func Test116WaitDelivered(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	A.SelfConsumeForTesting()
+
+	waited := make(chan error, 1)
+	go func() {
+		waited <- B.WaitDelivered(2, context.Background())
+	}()
+
+	n := 5
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("hi"), TcpEvent: EventData})
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// nobody has read yet.
+	returnedEarly := false
+	select {
+	case <-waited:
+		returnedEarly = true
+	default:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	tooFar := B.WaitDelivered(int64(n), ctx)
+	cancel()
+
+	consumed := 0
+	for consumed < n {
+		seq, err := B.ReadCtx(context.Background())
+		panicOn(err)
+		consumed += len(seq.Seq)
+	}
+	var late error = context.DeadlineExceeded
+	select {
+	case late = <-waited:
+	case <-time.After(time.Second):
+	}
+	already := B.WaitDelivered(1, context.Background())
+
+	cleanup()
+	stopped := B.WaitDelivered(int64(n), context.Background())
+
+	cv.Convey("Given a WaitDelivered on seqno 2, it should block until the consumer reads that packet, a WaitDelivered past the end should give up with its ctx or return ErrShutdown once stopped, and one already passed should return at once.", t, func() {
+		cv.So(returnedEarly, cv.ShouldBeFalse)
+		cv.So(tooFar, cv.ShouldEqual, context.DeadlineExceeded)
+		cv.So(late, cv.ShouldBeNil)
+		cv.So(already, cv.ShouldBeNil)
+		cv.So(stopped, cv.ShouldEqual, ErrShutdown)
+		cv.So(len(B.Swp.Recver.waiters), cv.ShouldEqual, 0)
+	})
+}
+
+func Test118PacketFilterDropsAndModifies(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	A.SelfConsumeForTesting()
+
+	// drop the even ones, and shout the odd ones.
+	B.Swp.Recver.PacketFilter = func(p *Packet) (*Packet, bool) {
+		if p.SeqNum%2 == 0 {
+			return nil, false
+		}
+		cp := *p
+		cp.Data = []byte(strings.ToUpper(string(p.Data)))
+		return &cp, true
+	}
+
+	n := 10
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("pack%v", i)), TcpEvent: EventData})
+	}
+
+	var got []string
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for len(got) < n/2 {
+		seq, err := B.ReadCtx(ctx)
+		if err != nil {
+			break
+		}
+		for _, pack := range seq.Seq {
+			got = append(got, string(pack.Data))
+		}
+	}
+	for i := 0; i < 100 && A.Swp.Sender.LargestAckedSeqno() < int64(n-1); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	acked := A.Swp.Sender.LargestAckedSeqno()
+	filtered := B.Stats().DiscardsByReason.Filtered
+
+	cleanup()
+
+	cv.Convey("Given a PacketFilter that drops even SeqNum and upper-cases the rest, the consumer should see only the odd packets, modified, and the sender should still get every packet acked.", t, func() {
+		cv.So(got, cv.ShouldResemble, []string{"PACK1", "PACK3", "PACK5", "PACK7", "PACK9"})
+		cv.So(filtered, cv.ShouldEqual, n/2)
+		cv.So(acked, cv.ShouldEqual, n-1)
+	})
+}
+
+func Test121ReorderDistanceStats(t *testing.T) {
+
+	var s ReorderStats
+	for _, d := range []int64{1, 2, 3, 4, 5, 64, 65, 1000} {
+		s.add(d)
+	}
+	got := s.load()
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	net.DiscardOnce = 0
+	rtt := 2 * lat
+
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithTimeout(rtt))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	n := 5
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("data"), TcpEvent: EventData})
+	}
+	time.Sleep(100 * time.Millisecond)
+	sess := B.Stats().ReceiverReorderStats
+
+	cleanup()
+
+	cv.Convey("Given reorder distances, ReorderStats should bucket them by powers of two and keep min, max and mean; and with SeqNum 0 lost once, B should see the later packets arrive ahead of it.", t, func() {
+		cv.So(got.N, cv.ShouldEqual, 8)
+		cv.So(got.MinDist, cv.ShouldEqual, 1)
+		cv.So(got.MaxDist, cv.ShouldEqual, 1000)
+		cv.So(got.Mean(), cv.ShouldEqual, float64(1+2+3+4+5+64+65+1000)/8)
+		cv.So(got.Buckets, cv.ShouldResemble, [ReorderBuckets]int64{1, 1, 2, 1, 0, 0, 1, 2})
+		cv.So(ReorderStats{}.Mean(), cv.ShouldEqual, 0)
+		cv.So(sess.N, cv.ShouldBeGreaterThan, 0)
+		cv.So(sess.MinDist, cv.ShouldEqual, 1)
+		cv.So(sess.MaxDist, cv.ShouldBeLessThanOrEqualTo, n-1)
+	})
+}
+
+func Test125InOrderSeqReportsBridgedGaps(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	net := A.Net.(*SimNet)
+	A.SelfConsumeForTesting()
+
+	// lose the first sends of 0 and 1, so 2, 3, 4 wait for them.
+	lose := 2
+	net.mapMut.Lock()
+	net.FilterThisEvent[EventData] = &lose
+	net.mapMut.Unlock()
+
+	n := 5
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	var seqs []int64
+	var gaps []SeqRange
+	bridged := make(map[int64]bool)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for len(seqs) < n {
+		seq, err := B.ReadCtx(ctx)
+		if err != nil {
+			break
+		}
+		for _, pack := range seq.Seq {
+			seqs = append(seqs, pack.SeqNum)
+		}
+		for _, g := range seq.Gaps {
+			for k := g.Low; k <= g.High; k++ {
+				bridged[k] = true
+			}
+		}
+		gaps = append(gaps, seq.Gaps...)
+	}
+
+	cleanup()
+
+	cv.Convey("Given SeqNum 0 and 1 lost once, so that 2, 3 and 4 arrive first, the deliveries' Gaps should cover 0 and 1 but never 4; and bridgedGaps should merge only adjacent runs.", t, func() {
+		cv.So(seqs, cv.ShouldResemble, []int64{0, 1, 2, 3, 4})
+		// SimNet may itself reorder 2, 3 and 4, so they
+		// can be in Gaps too.
+		cv.So(bridged[0], cv.ShouldBeTrue)
+		cv.So(bridged[1], cv.ShouldBeTrue)
+		cv.So(bridged[4], cv.ShouldBeFalse)
+		for _, g := range gaps {
+			cv.So(g.Low, cv.ShouldBeLessThanOrEqualTo, g.High)
+		}
+		seq := []*Packet{{SeqNum: 3, bridged: true}, {SeqNum: 4, bridged: true}, {SeqNum: 5}, {SeqNum: 6, bridged: true}}
+		cv.So(bridgedGaps(seq), cv.ShouldResemble, []SeqRange{{Low: 3, High: 4}, {Low: 6, High: 6}})
+		cv.So(bridgedGaps(seq[2:3]), cv.ShouldBeEmpty)
+	})
+}
+
+func Test131SpoofedAckIsDropped(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+	net := A.Net.(*SimNet)
+
+	// keep one of B's real acks to A, to forge from.
+	acks := make(chan *Packet, 100)
+	net.Sniff("A", func(pack *Packet) {
+		if pack.TcpEvent == EventDataAck {
+			select {
+			case acks <- pack:
+			default:
+			}
+		}
+	})
+
+	n := 3
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+	}
+	for i := 0; i < 100 && A.Swp.Sender.LargestAckedSeqno() < int64(n-1); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	net.ClearSniff("A")
+	acked := A.Swp.Sender.LargestAckedSeqno()
+
+	forged := *<-acks
+	forged.AckNum = 1000
+	panicOn(net.Send(&forged, "forged"))
+	time.Sleep(50 * time.Millisecond)
+	spoofed := atomic.LoadInt64(&A.Swp.Recver.SpoofedAckCount)
+	afterForged := A.Swp.Sender.LargestAckedSeqno()
+
+	// real acks still count.
+	A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", n)), TcpEvent: EventData})
+	for i := 0; i < 100 && A.Swp.Sender.LargestAckedSeqno() < int64(n); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	afterReal := A.Swp.Sender.LargestAckedSeqno()
+
+	cv.Convey("Given an ack forged with an AckNum past anything A has sent, A should drop and count it, leaving its acked SeqNum alone, and still take the genuine acks that follow.", t, func() {
+		cv.So(acked, cv.ShouldEqual, n-1)
+		cv.So(spoofed, cv.ShouldBeGreaterThanOrEqualTo, 1)
+		cv.So(afterForged, cv.ShouldEqual, acked)
+		cv.So(afterReal, cv.ShouldEqual, n)
+	})
+}
+
+func Test149ReadAllUntilEOF(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+
+	n := 5
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+	}
+	panicOn(A.PushEOF())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	all, errAll := B.ReadAll(ctx)
+
+	// with nothing more coming, ReadAll gives back ctx's error.
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel2()
+	none, errNone := B.ReadAll(ctx2)
+
+	cv.Convey("Given 5 packets then PushEOF, ReadAll should return all 6 in order, ending with the empty EOF packet; and a ReadAll that sees no EOF should return ctx's error.", t, func() {
+		cv.So(errAll, cv.ShouldBeNil)
+		cv.So(len(all), cv.ShouldEqual, n+1)
+		for i := 0; i < n; i++ {
+			cv.So(string(all[i].Data), cv.ShouldEqual, fmt.Sprintf("%v", i))
+			cv.So(all[i].EOF, cv.ShouldBeFalse)
+		}
+		cv.So(all[n].EOF, cv.ShouldBeTrue)
+		cv.So(len(all[n].Data), cv.ShouldEqual, 0)
+		cv.So(errNone, cv.ShouldEqual, context.DeadlineExceeded)
+		cv.So(len(none), cv.ShouldEqual, 0)
+	})
+}
+
+func Test178ReadAllKeepsWhatFollowsEOF(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+
+	// two transfers back to back, in one batch.
+	var batch []*Packet
+	for _, s := range []string{"a0", "a1", "", "b0", "b1", ""} {
+		batch = append(batch, &Packet{From: "A", Dest: "B", Data: []byte(s), TcpEvent: EventData, EOF: s == ""})
+	}
+	panicOn(A.PushBatch(batch))
+
+	// let all six arrive, so they come in one delivery.
+	for i := 0; i < 1000 && B.Swp.Recver.PeekNumReady() < int64(len(batch)); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	ready := B.Swp.Recver.PeekNumReady()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	first, errFirst := B.ReadAll(ctx)
+	second, errSecond := B.ReadAll(ctx)
+
+	cv.Convey("Given two transfers pushed in one batch, each ending in EOF, two ReadAll calls should return one transfer each, losing nothing that followed the first EOF.", t, func() {
+		cv.So(ready, cv.ShouldEqual, len(batch))
+		cv.So(errFirst, cv.ShouldBeNil)
+		cv.So(errSecond, cv.ShouldBeNil)
+		cv.So(len(first), cv.ShouldEqual, 3)
+		cv.So(len(second), cv.ShouldEqual, 3)
+		cv.So(string(first[0].Data), cv.ShouldEqual, "a0")
+		cv.So(first[2].EOF, cv.ShouldBeTrue)
+		cv.So(string(second[0].Data), cv.ShouldEqual, "b0")
+		cv.So(string(second[1].Data), cv.ShouldEqual, "b1")
+		cv.So(second[2].EOF, cv.ShouldBeTrue)
+	})
+}
+
+// dataAcksTo counts the data acks, naks aside,
+// arriving at inbox, and the last AckNum among them.
+func dataAcksTo(net *SimNet, inbox string) (count, last *int64) {
+	count, last = new(int64), new(int64)
+	*last = -1
+	net.Sniff(inbox, func(pack *Packet) {
+		if pack.TcpEvent == EventDataAck && pack.AckNum >= 0 && !pack.Nak {
+			atomic.AddInt64(count, 1)
+			atomic.StoreInt64(last, pack.AckNum)
+		}
+	})
+	return
+}
+
+func Test151EveryNAckHoldsAcksUntilN(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe(func(cfg *SessionConfig) {
+		cfg.KeepAliveInterval = time.Hour
+	}, OnlyOn("B", func(cfg *SessionConfig) {
+		cfg.AckStrategy = EveryNAck(4)
+		cfg.AckTimerInterval = time.Hour
+	}))
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+	count, last := dataAcksTo(A.Net.(*SimNet), "A")
+
+	for i := 0; i < 9; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	acks := atomic.LoadInt64(count)
+	lastAck := atomic.LoadInt64(last)
+	acked := A.Swp.Sender.LargestAckedSeqno()
+
+	cv.Convey("Given EveryNAck(4) at B and 9 packets consumed one by one, B should ack only after the 4th and 8th, holding the 9th's ack for its timer.", t, func() {
+		cv.So(acks, cv.ShouldEqual, 2)
+		cv.So(lastAck, cv.ShouldEqual, 7)
+		cv.So(acked, cv.ShouldEqual, 7)
+	})
+}
+
+func Test152DelayedAckSendsOnTimer(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe(func(cfg *SessionConfig) {
+		cfg.KeepAliveInterval = time.Hour
+	}, OnlyOn("B", func(cfg *SessionConfig) {
+		cfg.AckStrategy = DelayedAck(100 * time.Millisecond)
+		cfg.AckTimerInterval = 10 * time.Millisecond
+	}))
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+	count, _ := dataAcksTo(A.Net.(*SimNet), "A")
+
+	// spaced out, so none arrive out of order: a nak, and
+	// the retry it brings, would be acked at once.
+	for i := 0; i < 3; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(25 * time.Millisecond)
+	ackedEarly := A.Swp.Sender.LargestAckedSeqno()
+	acksEarly := atomic.LoadInt64(count)
+	for i := 0; i < 100 && A.Swp.Sender.LargestAckedSeqno() < 2; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	acked := A.Swp.Sender.LargestAckedSeqno()
+	acks := atomic.LoadInt64(count)
+
+	cv.Convey("Given DelayedAck(100ms) at B, the 3 packets B consumes should go unacked for a while, then be covered by a single ack from B's timer.", t, func() {
+		cv.So(ackedEarly, cv.ShouldEqual, -1)
+		cv.So(acksEarly, cv.ShouldEqual, 0)
+		cv.So(acked, cv.ShouldEqual, 2)
+		cv.So(acks, cv.ShouldEqual, 1)
+	})
+}
+
+func Test154CircuitBreakerOpensOnOutOfWindowFlood(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe(OnlyOn("B", func(cfg *SessionConfig) {
+		cfg.CircuitBreakerThreshold = 20
+		cfg.CircuitBreakerDuration = 50 * time.Millisecond
+		cfg.CircuitResetTimeout = 300 * time.Millisecond
+	}))
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+	net := A.Net.(*SimNet)
+
+	read := func() string {
+		seq, err := B.ReadTimeout(2 * time.Second)
+		panicOn(err)
+		return string(seq.Seq[0].Data)
+	}
+	for i := 0; i < 3; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+		read()
+	}
+
+	// a sender stuck replaying SeqNum 0, long since delivered.
+	for i := 0; i < 60 && !B.Swp.Recver.CircuitOpen(); i++ {
+		panicOn(net.InjectPacket("B", &Packet{
+			From:          "A",
+			Dest:          "B",
+			FromSessNonce: A.LocalSessNonce,
+			DestSessNonce: B.LocalSessNonce,
+			SeqNum:        0,
+			AckNum:        -1,
+			TcpEvent:      EventData,
+			Version:       ProtocolVersion,
+		}))
+		time.Sleep(2 * time.Millisecond)
+	}
+	opened := B.Swp.Recver.CircuitOpen()
+	for i := 0; i < 100 && !A.Swp.Sender.CircuitWait(); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	waiting := A.Swp.Sender.CircuitWait()
+
+	// held back, Push and all, until the circuit closes.
+	go A.Push(&Packet{From: "A", Dest: "B", Data: []byte("3"), TcpEvent: EventData})
+	time.Sleep(50 * time.Millisecond)
+	sentWhileOpen := A.Swp.Sender.LastSeqSent()
+
+	after := read()
+	closed := !B.Swp.Recver.CircuitOpen()
+	for i := 0; i < 100 && A.Swp.Sender.CircuitWait(); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	resumed := !A.Swp.Sender.CircuitWait()
+
+	cv.Convey("Given a flood of out-of-window packets at B, over its CircuitBreakerThreshold for CircuitBreakerDuration, B should open its circuit and A should wait, sending nothing; once CircuitResetTimeout has passed, B should close it and A carry on.", t, func() {
+		cv.So(opened, cv.ShouldBeTrue)
+		cv.So(atomic.LoadInt64(&B.Swp.Recver.CircuitOpens), cv.ShouldEqual, 1)
+		cv.So(waiting, cv.ShouldBeTrue)
+		cv.So(sentWhileOpen, cv.ShouldEqual, 2)
+		cv.So(after, cv.ShouldEqual, "3")
+		cv.So(closed, cv.ShouldBeTrue)
+		cv.So(resumed, cv.ShouldBeTrue)
+	})
+}
+
+func Test174CircuitWaitIsBounded(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe(WithTimeout(20*time.Millisecond), func(cfg *SessionConfig) {
+		cfg.KeepAliveInterval = 50 * time.Millisecond
+	})
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+
+	// a CircuitOpen whose closing ack never comes: no
+	// ack made by B can look later than this one.
+	reset := 100 * time.Millisecond
+	panicOn(A.Net.(*SimNet).InjectPacket("A", &Packet{
+		From:             "B",
+		Dest:             "A",
+		FromSessNonce:    B.LocalSessNonce,
+		DestSessNonce:    A.LocalSessNonce,
+		SeqNum:           -1,
+		AckNum:           -1,
+		DataSendTm:       time.Now().Add(time.Hour),
+		Control:          true,
+		CircuitOpen:      true,
+		CircuitResetNsec: int64(reset),
+		Version:          ProtocolVersion,
+		Blake2bChecksum:  Blake2bOfBytes(nil),
+	}))
+	for i := 0; i < 100 && !A.Swp.Sender.CircuitWait(); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	waiting := A.Swp.Sender.CircuitWait()
+	t0 := time.Now()
+
+	go A.Push(&Packet{From: "A", Dest: "B", Data: []byte("after"), TcpEvent: EventData})
+	seq, errRead := B.ReadTimeout(5 * time.Second)
+	waited := time.Since(t0)
+
+	cv.Convey("Given a CircuitOpen from the peer and no ack after it, the sender should wait out the peer's CircuitResetTimeout, plus a KeepAliveInterval of slack, and then carry on without the ack.", t, func() {
+		cv.So(waiting, cv.ShouldBeTrue)
+		cv.So(errRead, cv.ShouldBeNil)
+		cv.So(string(seq.Seq[0].Data), cv.ShouldEqual, "after")
+		cv.So(waited, cv.ShouldBeGreaterThanOrEqualTo, reset)
+		cv.So(waited, cv.ShouldBeLessThan, 2*time.Second)
+		cv.So(A.Swp.Sender.CircuitWait(), cv.ShouldBeFalse)
+	})
+}
@@ -0,0 +1,71 @@
+package swp
+
+import (
+	"sync/atomic"
+)
+
+// ReorderBuckets is the number of ReorderStats.Buckets.
+// Bucket 0 counts a reorder distance of 1, bucket i
+// distances in (2^(i-1), 2^i], and the last bucket
+// anything over 64.
+const ReorderBuckets = 8
+
+// ReorderStats describes how far out of order data
+// arrives: each packet that arrives ahead of
+// NextFrameExpected counts its distance, SeqNum -
+// NextFrameExpected. A MaxDist near the receive
+// window size means packets past the window are being
+// dropped that a bigger window would have held.
+// The recvloop updates RecvState.ReorderDistance
+// atomically; SessionStats has a copy.
+type ReorderStats struct {
+	N       int64
+	SumDist int64
+	MinDist int64
+	MaxDist int64
+	Buckets [ReorderBuckets]int64
+}
+
+// Mean returns the mean reorder distance, or 0
+// if none has been seen.
+func (s ReorderStats) Mean() float64 {
+	if s.N == 0 {
+		return 0
+	}
+	return float64(s.SumDist) / float64(s.N)
+}
+
+// reorderBucket returns the bucket for distance d >= 1.
+func reorderBucket(d int64) int {
+	i := 0
+	for top := int64(1); d > top && i < ReorderBuckets-1; top <<= 1 {
+		i++
+	}
+	return i
+}
+
+// add counts distance d. Only the recvloop calls it.
+func (s *ReorderStats) add(d int64) {
+	if atomic.AddInt64(&s.N, 1) == 1 || d < atomic.LoadInt64(&s.MinDist) {
+		atomic.StoreInt64(&s.MinDist, d)
+	}
+	if d > atomic.LoadInt64(&s.MaxDist) {
+		atomic.StoreInt64(&s.MaxDist, d)
+	}
+	atomic.AddInt64(&s.SumDist, d)
+	atomic.AddInt64(&s.Buckets[reorderBucket(d)], 1)
+}
+
+// load returns an atomic snapshot of s.
+func (s *ReorderStats) load() ReorderStats {
+	r := ReorderStats{
+		N:       atomic.LoadInt64(&s.N),
+		SumDist: atomic.LoadInt64(&s.SumDist),
+		MinDist: atomic.LoadInt64(&s.MinDist),
+		MaxDist: atomic.LoadInt64(&s.MaxDist),
+	}
+	for i := range s.Buckets {
+		r.Buckets[i] = atomic.LoadInt64(&s.Buckets[i])
+	}
+	return r
+}
@@ -92,6 +92,33 @@ func (t *retree) deleteThroughSeqNum(seqnum int64, callme func(goner *TxqSlot))
 	}
 }
 
+// popThroughSeqNum deletes and returns the slot with
+// the smallest SeqNum, if that is <= seqnum, or returns
+// nil. Unlike deleteThroughSeqNum, it takes no
+// callback, so a caller looping on it needn't allocate.
+func (t *retree) popThroughSeqNum(seqnum int64) *TxqSlot {
+	it := t.tree.Min()
+	if it.Limit() {
+		return nil
+	}
+	cur := it.Item().(*TxqSlot)
+	if cur.Pack.SeqNum > seqnum {
+		return nil
+	}
+	t.tree.DeleteWithIterator(it)
+	return cur
+}
+
+// minSeqNum returns the smallest SeqNum in
+// the tree, or ok false if it is empty.
+func (t *retree) minSeqNum() (seqnum int64, ok bool) {
+	it := t.tree.Min()
+	if it.Limit() {
+		return -1, false
+	}
+	return it.Item().(*TxqSlot).Pack.SeqNum, true
+}
+
 func (t *retree) String() string {
 	s := ""
 	for it := t.tree.Min(); !it.Limit(); it = it.Next() {
@@ -1,6 +1,8 @@
 package swp
 
 import (
+	"fmt"
+	"sync/atomic"
 	"time"
 
 	cv "github.com/glycerine/goconvey/convey"
@@ -34,17 +36,12 @@ func Test015RetryOfSynSynAckAndFin(t *testing.T) {
 		// on getting notice from a keepalive that the
 		// client has transitioned to Established.
 
-		A, err := NewSession(SessionConfig{Net: net, LocalInbox: "A", DestInbox: "B",
-			WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk,
-			NumFailedKeepAlivesBeforeClosing: 20, KeepAliveInterval: time.Second,
-		})
-		panicOn(err)
-		B, err := NewSession(SessionConfig{Net: net, LocalInbox: "B", DestInbox: "A",
-			WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk,
-			NumFailedKeepAlivesBeforeClosing: 20, KeepAliveInterval: time.Second,
-		})
-		_ = B
+		A, B, cleanup, err := SwpPipe(WithNet(net), WithWindowMsgCount(3), WithTimeout(rtt), WithConfig(func(cfg *SessionConfig) {
+			cfg.NumFailedKeepAlivesBeforeClosing = 20
+			cfg.KeepAliveInterval = time.Second
+		}))
 		panicOn(err)
+		defer cleanup()
 
 		B.ConnectTimeout = time.Second
 		B.ConnectAttempts = 10
@@ -71,3 +68,233 @@ func Test015RetryOfSynSynAckAndFin(t *testing.T) {
 		cv.So(true, cv.ShouldEqual, true)
 	})
 }
+
+func Test068MaxRetriesClosesSession(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	// no B: everything A sends is lost.
+	net.AllowBlackHoleSends = true
+	rtt := 2 * lat
+
+	A, err := NewSession(SessionConfig{Net: net, LocalInbox: "A", DestInbox: "B", WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk, MaxRetries: 3})
+	panicOn(err)
+
+	A.Push(&Packet{
+		From:     "A",
+		Dest:     "B",
+		Data:     []byte("one"),
+		TcpEvent: EventData,
+	})
+
+	var fatal error
+	select {
+	case fatal = <-A.ErrCh:
+	case <-time.After(10 * time.Second):
+	}
+
+	var te TimeoutError
+	select {
+	case te = <-A.TimeoutErrors():
+	default:
+	}
+
+	done := false
+	select {
+	case <-A.Halt.Done.Chan:
+		done = true
+	case <-time.After(time.Second):
+	}
+	errPush := A.Push(&Packet{From: "A", Dest: "B", Data: []byte("two"), TcpEvent: EventData})
+
+	A.Stop()
+
+	cv.Convey("Given MaxRetries of 3 and a lost packet, the session should report ErrMaxRetriesExceeded on ErrCh, shut down, and refuse further Push calls.", t, func() {
+		cv.So(fatal, cv.ShouldEqual, ErrMaxRetriesExceeded)
+		cv.So(done, cv.ShouldBeTrue)
+		cv.So(errPush, cv.ShouldEqual, ErrMaxRetriesExceeded)
+		cv.So(atomic.LoadInt64(&A.Swp.Sender.TimedOutPackets), cv.ShouldEqual, 1)
+		cv.So(A.GetErr(), cv.ShouldEqual, ErrMaxRetriesExceeded)
+	})
+
+	cv.Convey("Given MaxRetries of 3, TimeoutErrors should name the packet that ran out of retries.", t, func() {
+		cv.So(te.SeqNum, cv.ShouldEqual, 0)
+		cv.So(te.Retries, cv.ShouldEqual, 3)
+		cv.So(te.Error(), cv.ShouldContainSubstring, "SeqNum 0")
+	})
+}
+
+// batchCountingNet counts SendBatch calls on the way to a SimNet.
+type batchCountingNet struct {
+	*SimNet
+	batches int64
+	packs   int64
+}
+
+func (n *batchCountingNet) SendBatch(packs []*Packet, why string) error {
+	atomic.AddInt64(&n.batches, 1)
+	atomic.AddInt64(&n.packs, int64(len(packs)))
+	return n.SimNet.SendBatch(packs, why)
+}
+
+func Test076RetriesUseSendBatch(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	sim := NewSimNet(lossProb, lat)
+	// no B: everything A sends is lost, so it all gets retried.
+	sim.AllowBlackHoleSends = true
+	net := &batchCountingNet{SimNet: sim}
+
+	A, err := NewSession(SessionConfig{Net: net, LocalInbox: "A", DestInbox: "B", WindowMsgCount: 3, WindowByteSz: -1, Timeout: 20 * lat, Clk: RealClk})
+	panicOn(err)
+
+	for i := 0; i < 3; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("hello"), TcpEvent: EventData})
+	}
+	// with no RTT samples, the first retry is 500 msec out.
+	time.Sleep(700 * time.Millisecond)
+	A.Stop()
+
+	cv.Convey("Given a BatchNetwork, a retry sweep with several timed-out packets should resend them with one SendBatch call.", t, func() {
+		cv.So(atomic.LoadInt64(&net.batches), cv.ShouldBeGreaterThan, 0)
+		cv.So(atomic.LoadInt64(&net.packs), cv.ShouldBeGreaterThan, atomic.LoadInt64(&net.batches))
+	})
+}
+
+// rawCountingNet is a RawNetwork over a SimNet that
+// counts the encodings the sender makes for it.
+type rawCountingNet struct {
+	*batchCountingNet
+	marshals int64
+	raws     int64
+}
+
+func (n *rawCountingNet) Marshal(p *Packet) ([]byte, error) {
+	atomic.AddInt64(&n.marshals, 1)
+	return MsgpackCodec{}.Marshal(p)
+}
+
+func (n *rawCountingNet) Unmarshal(b []byte, p *Packet) error {
+	return MsgpackCodec{}.Unmarshal(b, p)
+}
+
+func (n *rawCountingNet) RawCodec() Codec { return n }
+
+func (n *rawCountingNet) SendRaw(dest string, data []byte) error {
+	atomic.AddInt64(&n.raws, 1)
+	var pack Packet
+	panicOn(n.Unmarshal(data, &pack))
+	return n.SimNet.Send(&pack, "raw")
+}
+
+func (n *rawCountingNet) RecvRaw(inbox string) (chan []byte, error) {
+	return nil, fmt.Errorf("rawCountingNet: RecvRaw not supported")
+}
+
+func Test166RawRetriesReuseTheEncoding(t *testing.T) {
+
+	sim := NewSimNet(0, time.Millisecond)
+	n := 3
+	// lose the first send of each, so all go
+	// again in one retry sweep.
+	sim.DiscardRange(0, int64(n-1))
+	net := &rawCountingNet{batchCountingNet: &batchCountingNet{SimNet: sim}}
+
+	A, B, cleanup, err := SwpPipe(WithNet(net))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+	// learn B's nonce before the first send, or its
+	// retry must be encoded anew for the new nonce.
+	A.ConnectTimeout = time.Second
+	A.ConnectAttempts = 10
+	panicOn(A.Connect("B"))
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+	}
+	// with no RTT samples, the first retry is 500 msec out.
+	for i := 0; i < 200 && A.Swp.Sender.LargestAckedSeqno() < int64(n-1); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cleanup()
+
+	cv.Convey("Given a RawNetwork that is also a BatchNetwork, and the loss of every first send, the retries should go by SendRaw as the bytes first sent, each packet encoded just once.", t, func() {
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, n)
+		for i, pack := range B.Swp.Recver.RecvHistory {
+			cv.So(string(pack.Data), cv.ShouldEqual, fmt.Sprintf("%v", i))
+			cv.So(pack.SeqRetry, cv.ShouldEqual, 0)
+		}
+		cv.So(atomic.LoadInt64(&net.raws), cv.ShouldBeGreaterThanOrEqualTo, 2*n)
+		cv.So(atomic.LoadInt64(&net.marshals), cv.ShouldEqual, n)
+		cv.So(atomic.LoadInt64(&net.batches), cv.ShouldEqual, 0)
+	})
+}
+
+func Test096AdaptiveKeepAliveBacksOff(t *testing.T) {
+
+	count := func(adaptive bool) int64 {
+		A, _, cleanup, err := SwpPipe(WithWindowMsgCount(3), WithConfig(func(cfg *SessionConfig) {
+			cfg.KeepAliveInterval = 5 * time.Millisecond
+			cfg.AdaptiveKeepAlive = adaptive
+			cfg.MaxKeepAliveInterval = 80 * time.Millisecond
+		}))
+		panicOn(err)
+		A.ConnectTimeout = time.Second
+		A.ConnectAttempts = 10
+		panicOn(A.Connect("B"))
+
+		time.Sleep(time.Second)
+		n := atomic.LoadInt64(&A.Swp.Sender.KeepAlivesSent)
+		cleanup()
+		return n
+	}
+	fixed := count(false)
+	adaptive := count(true)
+
+	cv.Convey("Given an idle, connected session with a 5 msec KeepAliveInterval, AdaptiveKeepAlive backing off to 80 msec should send a small fraction of the keepalives that the fixed interval does over a second.", t, func() {
+		cv.So(adaptive, cv.ShouldBeGreaterThan, 0)
+		cv.So(adaptive, cv.ShouldBeLessThan, 40)
+		cv.So(fixed, cv.ShouldBeGreaterThan, 2*adaptive)
+	})
+}
+
+func Test139KeepAliveExpectReplyDetectsSilentPeer(t *testing.T) {
+
+	lat := time.Millisecond
+	A, _, cleanup, err := SwpPipe(WithWindowMsgCount(3), WithTimeout(20*lat), WithConfig(func(cfg *SessionConfig) {
+		cfg.KeepAliveInterval = 5 * time.Millisecond
+	}), OnlyOn("A", WithConfig(func(cfg *SessionConfig) {
+		cfg.KeepAliveExpectReply = true
+	})))
+	panicOn(err)
+	defer cleanup()
+	net := A.Net.(*SimNet)
+	A.ConnectTimeout = time.Second
+	A.ConnectAttempts = 10
+	panicOn(A.Connect("B"))
+
+	// idle, but answered.
+	time.Sleep(300 * time.Millisecond)
+	var idleErr error
+	select {
+	case idleErr = <-A.ErrCh:
+	default:
+	}
+	sent := atomic.LoadInt64(&A.Swp.Sender.KeepAlivesSent)
+
+	// B goes silent: nothing reaches A any more.
+	net.setInboxClosed("A", true)
+	var deadErr error
+	select {
+	case deadErr = <-A.ErrCh:
+	case <-time.After(2 * time.Second):
+	}
+
+	cv.Convey("Given KeepAliveExpectReply, an idle session whose keepalives are answered should stay up, and one whose peer goes silent should close with ErrKeepAliveNoReply.", t, func() {
+		cv.So(sent, cv.ShouldBeGreaterThan, 5)
+		cv.So(idleErr, cv.ShouldBeNil)
+		cv.So(deadErr, cv.ShouldEqual, ErrKeepAliveNoReply)
+	})
+}
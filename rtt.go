@@ -1,6 +1,7 @@
 package swp
 
 import (
+	"sync/atomic"
 	"time"
 )
 
@@ -53,3 +54,105 @@ func (r *RTT) AddSample(newSample time.Duration) {
 	}
 	r.Est = r.Alpha*cur + (1.0-r.Alpha)*r.Est
 }
+
+// RTTHistogramBuckets is the number of RTTHistogram
+// buckets. Bucket 0 holds samples under 2µs, and
+// bucket i those in [2^i, 2^(i+1)) µs; a 60 second
+// sample lands in bucket 25, and the rest are headroom.
+const RTTHistogramBuckets = 60
+
+// RTTHistogram counts RTT samples in power-of-two
+// buckets, for percentiles, keeping the exact min and
+// max too. Add and Percentile use atomics, so one
+// goroutine may Add while others read.
+type RTTHistogram struct {
+	Buckets [RTTHistogramBuckets]int64
+	N       int64
+	MinNsec int64
+	MaxNsec int64
+}
+
+// rttBucket returns the bucket for d.
+func rttBucket(d time.Duration) int {
+	us := int64(d / time.Microsecond)
+	i := 0
+	for us > 1 && i < RTTHistogramBuckets-1 {
+		us >>= 1
+		i++
+	}
+	return i
+}
+
+// Add counts sample d.
+func (h *RTTHistogram) Add(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	ns := int64(d)
+	if atomic.AddInt64(&h.N, 1) == 1 {
+		atomic.StoreInt64(&h.MinNsec, ns)
+		atomic.StoreInt64(&h.MaxNsec, ns)
+	} else {
+		if ns < atomic.LoadInt64(&h.MinNsec) {
+			atomic.StoreInt64(&h.MinNsec, ns)
+		}
+		if ns > atomic.LoadInt64(&h.MaxNsec) {
+			atomic.StoreInt64(&h.MaxNsec, ns)
+		}
+	}
+	atomic.AddInt64(&h.Buckets[rttBucket(d)], 1)
+}
+
+// Min returns the smallest sample, or 0 if none.
+func (h *RTTHistogram) Min() time.Duration {
+	return time.Duration(atomic.LoadInt64(&h.MinNsec))
+}
+
+// Max returns the largest sample, or 0 if none.
+func (h *RTTHistogram) Max() time.Duration {
+	return time.Duration(atomic.LoadInt64(&h.MaxNsec))
+}
+
+// Percentile returns the p-th percentile, for p in
+// [0, 1], such as 0.99 for p99: the top of the bucket
+// holding that sample, kept within [Min, Max]. It is
+// within a factor of two of the true value, save that
+// p <= 0 gives Min and p >= 1 Max exactly. With no
+// samples it returns 0.
+func (h *RTTHistogram) Percentile(p float64) time.Duration {
+	var counts [RTTHistogramBuckets]int64
+	var n int64
+	for i := range counts {
+		counts[i] = atomic.LoadInt64(&h.Buckets[i])
+		n += counts[i]
+	}
+	if n == 0 {
+		return 0
+	}
+	if p <= 0 {
+		return h.Min()
+	}
+	if p >= 1 {
+		return h.Max()
+	}
+	// rank is the 1-based sample we want.
+	rank := int64(p*float64(n) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var cum int64
+	for i, c := range counts {
+		cum += c
+		if cum >= rank {
+			top := time.Duration(int64(2)<<uint(i)) * time.Microsecond
+			if lo := h.Min(); top < lo {
+				return lo
+			}
+			if hi := h.Max(); top > hi {
+				return hi
+			}
+			return top
+		}
+	}
+	return h.Max()
+}
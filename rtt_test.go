@@ -1,7 +1,9 @@
 package swp
 
 import (
+	"fmt"
 	"math"
+	"sync"
 	"time"
 
 	cv "github.com/glycerine/goconvey/convey"
@@ -10,9 +12,6 @@ import (
 
 func Test011RTTfromPackets(t *testing.T) {
 
-	lossProb := float64(0)
-	lat := time.Millisecond
-	net := NewSimNet(lossProb, lat)
 	rtt := time.Hour
 
 	var simClk = &SimClock{}
@@ -21,11 +20,7 @@ func Test011RTTfromPackets(t *testing.T) {
 	t2 := t1.Add(time.Second)
 	simClk.Set(t0)
 
-	A, err := NewSession(SessionConfig{Net: net, LocalInbox: "A", DestInbox: "B",
-		WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: simClk})
-	panicOn(err)
-	B, err := NewSession(SessionConfig{Net: net, LocalInbox: "B", DestInbox: "A",
-		WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: simClk})
+	A, B, cleanup, err := SwpPipe(WithWindowMsgCount(3), WithTimeout(rtt), WithClock(simClk))
 	panicOn(err)
 
 	A.IncrementClockOnReceiveForTesting()
@@ -68,8 +63,7 @@ func Test011RTTfromPackets(t *testing.T) {
 		cv.So(ack1.ArrivedAtDestTm.Sub(ack1.DataSendTm), cv.ShouldResemble, rtt1)
 	})
 
-	A.Stop()
-	B.Stop()
+	cleanup()
 
 }
 
@@ -91,3 +85,77 @@ func Test012RTTestimation(t *testing.T) {
 		}
 	})
 }
+
+func Test013OnRTTSampleHook(t *testing.T) {
+
+	// SwpPipe's latency.
+	lat := time.Millisecond
+	A, B, cleanup, err := SwpPipe(WithWindowMsgCount(3))
+	panicOn(err)
+
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	var mut sync.Mutex
+	var samples []time.Duration
+	A.Swp.Sender.OnRTTSample = func(seqno int64, rtt time.Duration) {
+		mut.Lock()
+		samples = append(samples, rtt)
+		mut.Unlock()
+	}
+
+	numSamples := func() int {
+		mut.Lock()
+		defer mut.Unlock()
+		return len(samples)
+	}
+
+	for i := 0; i < 1000 && numSamples() < 100; i++ {
+		A.Push(&Packet{
+			From:     "A",
+			Dest:     "B",
+			Data:     []byte(fmt.Sprintf("%v", i)),
+			TcpEvent: EventData,
+		})
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	cleanup()
+
+	mut.Lock()
+	defer mut.Unlock()
+	cv.Convey("Given an OnRTTSample hook on A's sender, sending from A to B with a 1 msec one-way latency should yield at least 100 samples, each of at least 2 msec but well under a second.", t, func() {
+		cv.So(len(samples), cv.ShouldBeGreaterThanOrEqualTo, 100)
+		for _, s := range samples {
+			cv.So(s, cv.ShouldBeGreaterThanOrEqualTo, 2*lat)
+			cv.So(s, cv.ShouldBeLessThan, time.Second)
+		}
+	})
+}
+
+func Test117RTTHistogramPercentiles(t *testing.T) {
+
+	var empty, h RTTHistogram
+	for i := 1; i <= 100; i++ {
+		h.Add(time.Duration(i) * time.Millisecond)
+	}
+	h.Add(2 * time.Minute)
+
+	cv.Convey("Given RTT samples of 1 to 100 msec and one of 2 minutes, the histogram should keep the exact min and max, and give percentiles within a factor of two.", t, func() {
+		cv.So(empty.Percentile(0.99), cv.ShouldEqual, 0)
+		cv.So(h.N, cv.ShouldEqual, 101)
+		cv.So(h.Min(), cv.ShouldEqual, time.Millisecond)
+		cv.So(h.Max(), cv.ShouldEqual, 2*time.Minute)
+		cv.So(h.Percentile(0), cv.ShouldEqual, time.Millisecond)
+		cv.So(h.Percentile(1), cv.ShouldEqual, 2*time.Minute)
+		p50 := h.Percentile(0.5)
+		cv.So(p50, cv.ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+		cv.So(p50, cv.ShouldBeLessThan, 100*time.Millisecond)
+		p90 := h.Percentile(0.9)
+		cv.So(p90, cv.ShouldBeGreaterThanOrEqualTo, 90*time.Millisecond)
+		cv.So(p90, cv.ShouldBeLessThan, 180*time.Millisecond)
+		cv.So(h.Percentile(0.99), cv.ShouldBeGreaterThanOrEqualTo, p90)
+		cv.So(rttBucket(0), cv.ShouldEqual, 0)
+		cv.So(rttBucket(time.Minute), cv.ShouldEqual, 25)
+	})
+}
@@ -0,0 +1,101 @@
+package swp
+
+import (
+	"fmt"
+)
+
+// Seeking the receiver.
+//
+// A consumer restored from a Snapshot may already have
+// processed packets the snapshot still holds, or that the
+// sender will retry. SeekTo moves the receiver past them:
+// every SeqNum below seqno counts as consumed, and is
+// neither delivered nor waited for. Held packets at seqno
+// and above are kept. Before Start, SeekTo changes the
+// receiver directly; after, the recvloop does it between
+// passes, and acks so that the sender moves on too.
+//
+// SeekTo only moves forward, from NextFrameExpected on:
+// the packets before it are already readied for the
+// consumer, in order, and are not taken back.
+
+// ErrSeekBackward is returned by SeekTo for a seqno
+// below NextFrameExpected.
+var ErrSeekBackward = fmt.Errorf("swp: cannot SeekTo a SeqNum below NextFrameExpected")
+
+// seekReq asks the recvloop to seek to seqno, closing
+// done once err is set.
+type seekReq struct {
+	seqno int64
+	err   error
+	done  chan struct{}
+}
+
+// SeekTo makes seqno the next SeqNum the consumer will
+// see, treating all before it as consumed, and dropping
+// any packets before it still readied for the consumer.
+// It returns ErrSeekBackward if seqno is below
+// NextFrameExpected, and ErrSessDone if the receiver has
+// stopped.
+func (r *RecvState) SeekTo(seqno int64) error {
+	select {
+	case <-r.ready:
+	default:
+		// not started: nothing else touches our state.
+		return r.seek(seqno)
+	}
+	req := &seekReq{seqno: seqno, done: make(chan struct{})}
+	select {
+	case r.seekCh <- req:
+		<-req.done
+		return req.err
+	case <-r.Halt.ReqStop.Chan:
+		return ErrSessDone
+	}
+}
+
+// SeekTo is Swp.Recver.SeekTo.
+func (s *Session) SeekTo(seqno int64) error {
+	return s.Swp.Recver.SeekTo(seqno)
+}
+
+// seek does SeekTo. Only the recvloop may call it, once
+// started.
+func (r *RecvState) seek(seqno int64) error {
+	if seqno < r.NextFrameExpected {
+		return ErrSeekBackward
+	}
+	for len(r.uncommitted) > 0 && r.uncommitted[0].last() < seqno {
+		for _, pack := range r.uncommitted[0].seq {
+			r.unhold(pack.SeqNum)
+		}
+		r.uncommitted = r.uncommitted[1:]
+	}
+	for r.ReadyForDelivery.Len() > 0 && r.ReadyForDelivery.Front().SeqNum < seqno {
+		pack := r.ReadyForDelivery.PopFront()
+		r.unhold(pack.SeqNum)
+	}
+	if seqno > r.NextFrameExpected {
+		for seq := range r.RcvdButNotConsumed {
+			if seq < seqno {
+				r.unhold(seq)
+			}
+		}
+		for _, slot := range r.Rxq {
+			if slot.Received && slot.Pack.SeqNum < seqno {
+				slot.Received = false
+				slot.Pack = nil
+			}
+		}
+		r.NextFrameExpected = seqno
+		if r.LargestSeqnoRcvd < seqno-1 {
+			r.LargestSeqnoRcvd = seqno - 1
+		}
+	}
+	r.LastMsgConsumed = seqno - 1
+	r.LastFrameClientConsumed = seqno - 1
+
+	// held packets from seqno on may now be in order.
+	r.readyInOrder()
+	return nil
+}
@@ -3,6 +3,7 @@ package swp
 import (
 	"fmt"
 	"math"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -10,12 +11,59 @@ import (
 	"github.com/glycerine/idem"
 )
 
+var ErrMaxRetriesExceeded = fmt.Errorf("packet retried more than MaxRetries times, session closed")
+
+// ErrKeepAliveNoReply is the session's error when, under
+// KeepAliveExpectReply, a keepalive went unanswered.
+var ErrKeepAliveNoReply = fmt.Errorf("keepalive got no reply within 2 * Timeout, session closed")
+
+// TimeoutError reports that one packet ran out of
+// retries, as distinct from the session-level error
+// that follows it. See Session.TimeoutErrors.
+type TimeoutError struct {
+	SeqNum  int64
+	Retries int
+}
+
+func (e TimeoutError) Error() string {
+	return fmt.Sprintf("swp: packet SeqNum %v timed out after %v retries", e.SeqNum, e.Retries)
+}
+
+// AckStatus is what OnAck is told of an arriving ack.
+type AckStatus struct {
+	AckNum              int64
+	Nak                 bool
+	NackNum             int64
+	AvailReaderMsgCap   int64
+	AvailReaderBytesCap int64
+	ArrivedAtDestTm     time.Time
+}
+
 // TxqSlot is the sender's sliding window element.
 type TxqSlot struct {
 	OrigSendTime  time.Time
 	RetryDeadline time.Time
 	RetryDur      time.Duration
+	RetryCount    int
 	Pack          *Packet
+
+	// PushTime is when Pack was pushed, for the
+	// ack latency; see acklatency.go.
+	PushTime time.Time
+
+	// span is Pack's send span, under Telemetry.
+	span Span
+
+	// serialized is Pack as encoded for a RawNetwork,
+	// made at its first send and reused by later ones,
+	// retries too: they resend Pack as it was, unless
+	// our session nonces have changed. Whatever changes
+	// Pack must nil it. See sendSlot and resendAsIs.
+	// resent is set once a retry reuses serialized, as
+	// the ack of one echoes the DataSendTm of the first
+	// send, and so is no RTT sample.
+	serialized []byte
+	resent     bool
 }
 
 func (s *TxqSlot) String() string {
@@ -47,15 +95,97 @@ type SenderState struct {
 	// sending a packet:
 	BlockingSend chan *Packet
 
+	// paused is 1 between Pause and Resume; read with
+	// atomic.LoadInt32. pauseCh wakes the sendloop to
+	// see a change.
+	paused  int32
+	pauseCh chan struct{}
+
+	// circuitWait is 1 while the peer's circuit breaker
+	// is open, since circuitOpenedAt, in UnixNano on the
+	// peer's clock, and until circuitWaitUntil at the
+	// latest, in UnixNano on ours; see circuit.go. Read
+	// all three with atomics.
+	circuitWait      int32
+	circuitOpenedAt  int64
+	circuitWaitUntil int64
+
 	GotPack chan *Packet
 
-	Halt         *idem.Halter
-	SendHistory  []*Packet
-	SendSz       int64
-	SendAck      chan *Packet
-	sendSynCh    chan *ConnectReq
+	Halt        *idem.Halter
+	SendHistory []*Packet
+	SendSz      int64
+	SendAck     chan *Packet
+	SendControl chan *Packet
+	sendSynCh   chan *ConnectReq
+
+	// DiscardCount counts the acks we drop for being
+	// past LastFrameSent. Read with atomic.LoadInt64.
 	DiscardCount int64
 
+	// NacksActedOn counts the naks from the receiver
+	// that caused us to retransmit early.
+	// Read with atomic.LoadInt64.
+	NacksActedOn int64
+
+	// forward error correction, see fec.go.
+	// Set before Start().
+	FECGroupSize int
+	fecParity    []byte
+	fecFirst     int64
+
+	// OnRTTSample, if non-nil, is called from the
+	// ack-processing path with each RTT sample taken
+	// from an ack of a never-retransmitted packet.
+	// It runs on the sender goroutine, so it should
+	// be quick. Set it before the first Push.
+	OnRTTSample func(seqno int64, rtt time.Duration)
+
+	// OnAck, if non-nil, is called with each ack or
+	// nak as it arrives, before the sender acts on it.
+	// Duplicates are included, but not acks of what we
+	// have yet to send, which the sender drops. Like
+	// OnRTTSample it runs on the sender goroutine, so
+	// it must not block. Set it before the first Push.
+	OnAck func(ack AckStatus)
+
+	// Cong is nil unless congestion control was
+	// requested in the SessionConfig.
+	Cong *CongCtrl
+
+	// Events, if not nil, gets protocol lifecycle
+	// events; see eventbus.go.
+	Events *EventBus
+
+	// Tune is nil unless window auto-tuning was
+	// requested in the SessionConfig; see autotune.go.
+	Tune *AutoTune
+
+	// MaxRetries: if > 0, after this many retries
+	// of any one packet we give up and shut down
+	// with ErrMaxRetriesExceeded. Set before Start().
+	MaxRetries int
+
+	// TimedOutPackets counts packets that we gave
+	// up on after MaxRetries. Read with atomic.LoadInt64.
+	TimedOutPackets int64
+
+	// TimeoutErrors gets a TimeoutError for each
+	// packet given up on. Buffered; if no one is
+	// reading, further TimeoutErrors are dropped.
+	TimeoutErrors chan TimeoutError
+
+	// PiggybackWindow: if > 0, hold data acks for up
+	// to this long, hoping to carry them on an outgoing
+	// data packet instead of in a packet of their own.
+	// Set before Start(). The two counters are read
+	// with atomic.LoadInt64.
+	PiggybackWindow   time.Duration
+	PiggybackedAcks   int64
+	StandaloneAcks    int64
+	pendingAck        *Packet
+	pendingAckTimeout <-chan time.Time
+
 	LastSendTime            time.Time
 	LastHeardFromDownstream time.Time
 	KeepAliveInterval       time.Duration
@@ -65,6 +195,28 @@ type SenderState struct {
 	// to disable the auto-close.
 	NumFailedKeepAlivesBeforeClosing int
 
+	// AdaptiveKeepAlive doubles the keepalive interval
+	// after each keepalive we send, up to
+	// MaxKeepAliveInterval, and drops it back to
+	// KeepAliveInterval whenever an ack acks new data.
+	// Set before Start(). KeepAlivesSent is read with
+	// atomic.LoadInt64.
+	AdaptiveKeepAlive    bool
+	MaxKeepAliveInterval time.Duration
+	KeepAlivesSent       int64
+
+	// KeepAliveExpectReply has us close the session
+	// with ErrKeepAliveNoReply if no KAReply comes
+	// back within 2 * Timeout of a keepalive. Set
+	// before Start(). pendingKACount counts the
+	// keepalives sent since the last KAReply, and
+	// kaReplyDeadline is when the oldest of them
+	// must be answered by.
+	KeepAliveExpectReply bool
+	pendingKACount       int
+	kaReplyDeadline      time.Time
+	keepAliveBackoff     time.Duration
+
 	SentButNotAckedByDeadline *retree
 	SentButNotAckedBySeqNum   *retree
 
@@ -75,6 +227,37 @@ type SenderState struct {
 	LastSeenAvailReaderBytesCap int64
 	LastSeenAvailReaderMsgCap   int64
 
+	// snapshot for WindowUtilization, updated atomically
+	// at the top of each pass through the sendloop.
+	msgInflight int64
+
+	// for WindowOpened/WindowClosed events.
+	windowClosed bool
+
+	// WindowShrinks counts the times the receiver's
+	// window shrank below what we had in flight.
+	// Read with atomic.LoadInt64.
+	WindowShrinks int64
+	windowShrunk  bool
+
+	// WindowResizes counts the times we resized Txq
+	// to a window proposed by the receiver; see
+	// window.go. Read with atomic.LoadInt64.
+	WindowResizes     int64
+	pendingWindowSize int64
+
+	// proposedWindowSize is our own receiver's window
+	// after a ProposeWindowSize, for our keepalives
+	// to carry. Read with atomic.LoadInt64.
+	proposedWindowSize int64
+
+	// snapshot for OldestUnackedSeqno, updated
+	// with msgInflight.
+	oldestUnacked int64
+
+	// snapshot for HeldBytes, updated with msgInflight.
+	bytesInflight int64
+
 	// do synchronized access via GetFlow()
 	// and UpdateFlow(s.Net)
 	FlowCt                 *FlowCtrl
@@ -82,6 +265,38 @@ type SenderState struct {
 	TotalBytesSentAndAcked int64
 	rtt                    *RTT
 
+	// RTTHist counts the samples given to rtt, for
+	// RTTPercentile and SessionStats.
+	RTTHist RTTHistogram
+
+	// OnPacketAcked, if non-nil, is called with each
+	// packet's SeqNum as it is first acked, and the time
+	// since it was pushed. It runs on the sender
+	// goroutine, so it must not block. Set before Start().
+	// ackLatency keeps the latest of those times.
+	OnPacketAcked func(seqno int64, latency time.Duration)
+	ackLatency    latencyWindow
+
+	// Telemetry, if set, traces the packets we send;
+	// see telemetry.go. Set before Start().
+	Telemetry Telemetry
+
+	// LoopStart, if set, is called first thing on
+	// the sendloop goroutine; see SessionConfig.LoopStart.
+	LoopStart func()
+
+	// cipher is nil unless the session has an
+	// EncryptionKey; see crypt.go.
+	cipher *packetCipher
+
+	// compressor is nil unless the session has
+	// Compress set; see compress.go.
+	// TotalBytesUncompressed and TotalBytesCompressed
+	// are read with atomic.LoadInt64.
+	compressor             *packetCompressor
+	TotalBytesUncompressed int64
+	TotalBytesCompressed   int64
+
 	// nil after Stop() unless we terminated the session
 	// due to too many outstanding acks
 	exitErr error
@@ -96,6 +311,22 @@ type SenderState struct {
 	RemoteSessNonce             string
 
 	keepAliveWithState chan TcpState
+
+	// for Session.Snapshot; see snapshot.go.
+	snapshotCh chan *snapshotReq
+
+	// for DrainWindow; see drain.go.
+	drainCh     chan *drainReq
+	drainNotify chan struct{}
+
+	// for TxqDump; see txqdump.go.
+	txqDumpCh chan *txqDumpReq
+
+	// closed once the sendloop is running.
+	ready chan struct{}
+
+	// the next StreamSeq to give on each stream.
+	streamSeq map[uint32]int64
 }
 
 func (s *SenderState) GetRecvLastFrameClientConsumed() int64 {
@@ -131,14 +362,25 @@ func NewSenderState(
 		Halt:                      idem.NewHalter(),
 		SendHistory:               make([]*Packet, 0),
 		BlockingSend:              make(chan *Packet),
+		pauseCh:                   make(chan struct{}, 1),
 		SendSz:                    sendSz,
 		GotPack:                   make(chan *Packet),
 		SendAck:                   make(chan *Packet, 5), // buffered so we don't deadlock
+		SendControl:               make(chan *Packet),
+		TimeoutErrors:             make(chan TimeoutError, 16),
 		sendSynCh:                 make(chan *ConnectReq),
 		SentButNotAckedByDeadline: newRetree(compareRetryDeadline),
 		SentButNotAckedBySeqNum:   newRetree(compareSeqNum),
 
 		keepAliveWithState: make(chan TcpState),
+		snapshotCh:         make(chan *snapshotReq),
+		drainCh:            make(chan *drainReq),
+		txqDumpCh:          make(chan *txqDumpReq),
+		ready:              make(chan struct{}),
+
+		// nothing consumed yet, so our keepalives
+		// don't ack SeqNum 0.
+		recvLastFrameClientConsumed: -1,
 
 		SenderShutdown:    make(chan bool),
 		DoSendClosingCh:   make(chan *closeReq),
@@ -181,6 +423,53 @@ func NewSenderState(
 	return s
 }
 
+// WindowUtilization returns the fraction, in [0, 1], of
+// the send window occupied by packets sent but not yet
+// acked. It is safe to call from any goroutine.
+func (s *SenderState) WindowUtilization() float64 {
+	return utilization(atomic.LoadInt64(&s.msgInflight), atomic.LoadInt64(&s.SenderWindowSize))
+}
+
+// LargestAckedSeqno returns the largest SeqNum
+// the receiver has acked, or -1 if none yet.
+// It is safe to call from any goroutine.
+func (s *SenderState) LargestAckedSeqno() int64 {
+	return atomic.LoadInt64(&s.LastAckRec)
+}
+
+// LastSeqSent returns the largest SeqNum sent,
+// or -1 if none yet. It is safe to call from any
+// goroutine.
+func (s *SenderState) LastSeqSent() int64 {
+	return atomic.LoadInt64(&s.LastFrameSent)
+}
+
+// OldestUnackedSeqno returns the smallest SeqNum
+// sent but not yet acked. With nothing in flight, it
+// is the SeqNum the next packet sent will get.
+// It is safe to call from any goroutine.
+func (s *SenderState) OldestUnackedSeqno() int64 {
+	return atomic.LoadInt64(&s.oldestUnacked)
+}
+
+// HeldBytes returns the Data bytes in packets sent
+// but not yet acked, which we hold for retry, as of the
+// sendloop's last pass. It is safe to call from any goroutine.
+func (s *SenderState) HeldBytes() int64 {
+	return atomic.LoadInt64(&s.bytesInflight)
+}
+
+// utilization returns n/capacity clamped to [0, 1].
+func utilization(n, capacity int64) float64 {
+	if capacity <= 0 || n <= 0 {
+		return 0
+	}
+	if n >= capacity {
+		return 1
+	}
+	return float64(n) / float64(capacity)
+}
+
 // ComputeInflight returns the number of bytes and messages
 // that are in-flight: they have been sent but not yet acked.
 func (s *SenderState) ComputeInflight() (bytesInflight int64, msgInflight int64) {
@@ -197,6 +486,9 @@ func (s *SenderState) ComputeInflight() (bytesInflight int64, msgInflight int64)
 func (s *SenderState) Start(sess *Session) {
 
 	go func() {
+		if s.LoopStart != nil {
+			s.LoopStart()
+		}
 
 		var acceptSend chan *Packet
 
@@ -214,6 +506,7 @@ func (s *SenderState) Start(sess *Session) {
 			sess.Halt.Done.Close() // lets clients detect shutdown
 		}()
 
+		close(s.ready)
 	sendloop:
 		for {
 			//p("%v top of sendloop, sender LAR: %v, LFS: %v \n",
@@ -230,28 +523,102 @@ func (s *SenderState) Start(sess *Session) {
 			// from the receiver allows it.
 			//
 			bytesInflight, msgInflight := s.ComputeInflight()
+			atomic.StoreInt64(&s.msgInflight, msgInflight)
+			atomic.StoreInt64(&s.bytesInflight, bytesInflight)
+			s.noteInflight(msgInflight)
+			oldest, ok := s.SentButNotAckedBySeqNum.minSeqNum()
+			if !ok {
+				oldest = s.LastFrameSent + 1
+			}
+			atomic.StoreInt64(&s.oldestUnacked, oldest)
+			if s.pendingWindowSize > 0 {
+				s.resizeTxq(oldest)
+			}
 			//p("%v bytesInflight = %v", s.Inbox, bytesInflight)
 			//p("%v msgInflight = %v", s.Inbox, msgInflight)
 
-			if s.LastSeenAvailReaderMsgCap-msgInflight > 0 &&
+			// never more in flight than Txq has slots.
+			msgCap := min(s.LastSeenAvailReaderMsgCap, s.SenderWindowSize)
+			if s.Cong != nil {
+				msgCap = min(msgCap, s.Cong.Window())
+			}
+			if s.Tune != nil {
+				msgCap = min(msgCap, s.Tune.Window)
+			}
+
+			// the receiver may have shrunk its window out
+			// from under packets we already have in flight.
+			// We then send nothing new until in-flight is
+			// back inside the window, and limit retries below.
+			if msgCap < msgInflight {
+				if !s.windowShrunk {
+					s.windowShrunk = true
+					atomic.AddInt64(&s.WindowShrinks, 1)
+					//p("%v window shrank to %v, below the %v in flight", s.Inbox, msgCap, msgInflight)
+				}
+			} else {
+				s.windowShrunk = false
+			}
+			retryCap := msgCap
+			if retryCap < 1 {
+				// keep probing a closed window.
+				retryCap = 1
+			}
+			// while the network reconnects, or the peer's
+			// circuit breaker is open, send nothing, and
+			// hold retries without counting them.
+			s.circuitTimedOut(s.Clk.Now())
+			paused := s.netReconnecting() || s.CircuitWait()
+			if paused {
+				retryCap = 0
+			}
+
+			if msgCap-msgInflight > 0 &&
 				s.LastSeenAvailReaderBytesCap-bytesInflight > 0 {
 				//p("%v flow-control: okay to send. s.LastSeenAvailReaderMsgCap: %v > msgInflight: %v",
 				//	s.Inbox, s.LastSeenAvailReaderMsgCap, msgInflight)
 				acceptSend = s.BlockingSend
+				if s.windowClosed {
+					s.windowClosed = false
+					s.Events.emit(WindowOpened, -1, s.Clk.Now(), nil)
+				}
 			} else {
+				if !s.windowClosed {
+					s.windowClosed = true
+					s.Events.emit(WindowClosed, -1, s.Clk.Now(), nil)
+				}
 				//p("%v flow-control kicked in: not sending. s.LastSeenAvailReaderMsgCap = %v,"+
 				//	" msgInflight=%v, s.LastSeenAvailReaderBytesCap=%v bytesInflight=%v",
 				//	s.Inbox, s.LastSeenAvailReaderMsgCap, msgInflight,
 				//	s.LastSeenAvailReaderBytesCap, bytesInflight)
 			}
+			if paused || atomic.LoadInt32(&s.paused) == 1 {
+				acceptSend = nil
+			}
 
 			//p("%v top of sender select loop", s.Inbox)
 			select {
+			case <-s.pauseCh:
+				// Pause or Resume; acceptSend is
+				// set anew at the top.
+
 			case zr := <-s.DoSendClosingCh:
 				//p("%v sender got DoSendClosingCh message.", s.Inbox)
 				s.doSendClosing()
 				close(zr.done)
 
+			case req := <-s.snapshotCh:
+				s.snapshot(req.snap)
+				close(req.done)
+
+			case req := <-s.drainCh:
+				req.drained = s.drainWaiter()
+				close(req.done)
+
+			case req := <-s.txqDumpCh:
+				req.slots = s.txqDump()
+				close(req.done)
+
 			case st := <-s.keepAliveWithState:
 				// receiver keeps the timer going, because
 				// receiver needs to send us the TcpState.
@@ -262,6 +629,17 @@ func (s *SenderState) Start(sess *Session) {
 				now := s.Clk.Now()
 				//p("%v regularIntervalWakeup at %v", s.Inbox, now)
 
+				if s.pendingKACount > 0 && now.After(s.kaReplyDeadline) {
+					mylog.Printf("%s no reply to %v keepalive(s) within %v, declaring session dead and closing it.", s.Inbox, s.pendingKACount, 2*s.Timeout)
+					s.Events.emit(SessionError, -1, now, ErrKeepAliveNoReply)
+					s.SetErr(ErrKeepAliveNoReply)
+					select {
+					case sess.ErrCh <- ErrKeepAliveNoReply:
+					default:
+					}
+					return
+				}
+
 				if s.NumFailedKeepAlivesBeforeClosing > 0 {
 					thresh := s.KeepAliveInterval * time.Duration(s.NumFailedKeepAlivesBeforeClosing)
 					//p("at regularInterval (every %v) doing check: SenderState.NumFailedKeepAlivesBeforeClosing=%v, checking for close after thresh %v (== %v * %v)", wakeFreq, s.NumFailedKeepAlivesBeforeClosing, thresh, s.KeepAliveInterval, s.NumFailedKeepAlivesBeforeClosing)
@@ -288,36 +666,79 @@ func (s *SenderState) Start(sess *Session) {
 					})
 				if len(retry) > 0 {
 					///p("%v sender retry list is len %v", s.Inbox, len(retry))
+					if s.Cong != nil {
+						s.Cong.OnTimeout()
+					}
 				}
 
+				if int64(len(retry)) > retryCap {
+					// retry the oldest first: the receiver
+					// can't deliver anything past a gap until
+					// it is filled, so that one must not wait.
+					sort.Slice(retry, func(i, j int) bool {
+						return retry[i].Pack.SeqNum < retry[j].Pack.SeqNum
+					})
+				}
+				resend := make([]*TxqSlot, 0, len(retry))
 				for _, slot := range retry {
 
+					if int64(len(resend)) >= retryCap {
+						// over the (shrunken) window: put
+						// it back, to retry later.
+						slot.RetryDeadline = s.Clk.Now().Add(slot.RetryDur)
+						s.SentButNotAckedByDeadline.insert(slot)
+						s.SentButNotAckedBySeqNum.insert(slot)
+						continue
+					}
+
+					slot.RetryCount++
+					if s.MaxRetries > 0 && slot.RetryCount > s.MaxRetries {
+						atomic.AddInt64(&s.TimedOutPackets, 1)
+						s.Events.emit(PacketDropped, slot.Pack.SeqNum, now, nil)
+						s.Events.emit(SessionError, -1, now, ErrMaxRetriesExceeded)
+						select {
+						case s.TimeoutErrors <- TimeoutError{SeqNum: slot.Pack.SeqNum, Retries: s.MaxRetries}:
+						default:
+						}
+						mylog.Printf("%s giving up on SeqNum %v after %v retries, closing session.", s.Inbox, slot.Pack.SeqNum, s.MaxRetries)
+						s.SetErr(ErrMaxRetriesExceeded)
+						select {
+						case sess.ErrCh <- ErrMaxRetriesExceeded:
+						default:
+						}
+						return
+					}
+
 					// reset deadline and resend
 					now := s.Clk.Now()
 					flow := s.FlowCt.UpdateFlow(s.Inbox, s.Net, -1, -1, nil)
 					slot.RetryDur = s.GetDeadlineDur(flow)
 					slot.RetryDeadline = now.Add(slot.RetryDur)
-					slot.Pack.SeqRetry++
-					slot.Pack.DataSendTm = now
-
-					slot.Pack.AvailReaderBytesCap = flow.AvailReaderBytesCap
-					slot.Pack.AvailReaderMsgCap = flow.AvailReaderMsgCap
-					slot.Pack.FromRttEstNsec = int64(s.rtt.GetEstimate())
-					slot.Pack.FromRttSdNsec = int64(s.rtt.GetSd())
-					slot.Pack.FromRttN = s.rtt.N
-
 					s.SentButNotAckedByDeadline.insert(slot)
 					s.SentButNotAckedBySeqNum.insert(slot)
 
 					///p("%v doing retry Net.Send() for pack.SeqNum = '%v' of paydirt len %v", s.Inbox, slot.Pack.SeqNum, len(slot.Pack.Data))
-					slot.Pack.FromSessNonce = s.LocalSessNonce
-					slot.Pack.DestSessNonce = s.RemoteSessNonce
-
-					err := s.Net.Send(slot.Pack, "retry")
-					if err != nil {
-						//ignore errors; nats net might be down.
+					if s.resendAsIs(slot) {
+						slot.resent = true
+					} else {
+						slot.Pack.SeqRetry++
+						slot.Pack.DataSendTm = now
+
+						slot.Pack.AvailReaderBytesCap = flow.AvailReaderBytesCap
+						slot.Pack.AvailReaderMsgCap = flow.AvailReaderMsgCap
+						slot.Pack.FromRttEstNsec = int64(s.rtt.GetEstimate())
+						slot.Pack.FromRttSdNsec = int64(s.rtt.GetSd())
+						slot.Pack.FromRttN = s.rtt.N
+
+						slot.Pack.FromSessNonce = s.LocalSessNonce
+						slot.Pack.DestSessNonce = s.RemoteSessNonce
+						slot.serialized = nil
 					}
+
+					resend = append(resend, slot)
+					s.Events.emit(PacketRetransmitted, slot.Pack.SeqNum, now, nil)
 				}
+				s.sendRetries(resend)
 				regularIntervalWakeup = time.After(wakeFreq)
 
 			case <-s.Halt.ReqStop.Chan:
@@ -330,79 +751,23 @@ func (s *SenderState) Start(sess *Session) {
 				// for data already in place.
 
 			case a := <-s.GotPack:
-				s.LastHeardFromDownstream = a.ArrivedAtDestTm
-
-				// ack/keepalive/data packet received in 'a' -
-				// do sender side stuff
-				//
-				//p("%v sender GotPack a: %#v", s.Inbox, a)
-				//
-				// flow control: respect a.AvailReaderBytesCap
-				// and a.AvailReaderMsgCap info that we have
-				// received from this ack
-				//
-				//p("%v sender GotPack, updating s.LastSeenAvailReaderMsgCap %v -> %v",
-				//	s.Inbox, s.LastSeenAvailReaderMsgCap, a.AvailReaderMsgCap)
-				s.LastSeenAvailReaderBytesCap = a.AvailReaderBytesCap
-				s.LastSeenAvailReaderMsgCap = a.AvailReaderMsgCap
-
-				s.UpdateRTT(a)
-
-				// need to update our SentButNotAcked* trees
-				// and remove everything before AckNum, which is cumulative.
-				numDel := 0
-				s.SentButNotAckedBySeqNum.deleteThroughSeqNum(
-					a.AckNum, func(slot *TxqSlot) {
-						s.SentButNotAckedByDeadline.deleteSlot(slot)
-						numDel++
-						if slot.Pack.CliAcked != nil {
-							///p("got ack for packet that has CliAcked on it; a.AckNum=%v. len(Data)=%v. event=%s. clearing slot.Pack.SeqNum=%v", a.AckNum, len(slot.Pack.Data), a.TcpEvent, slot.Pack.SeqNum)
-							if slot.Pack.CliAcked != nil {
-								slot.Pack.CliAcked.Bcast(slot.Pack.SeqNum)
-							}
-						}
-						///p("%s deleting slot.Pack.SeqNum=%v <= a.AckNum=%v from s.SentButNotAcked", s.Inbox, slot.Pack.SeqNum, a.AckNum)
-						//s.TotalBytesSentAndAcked += int64(len(slot.Pack.Data))
-						if slot.Pack.Accounting != nil {
-							nba := atomic.LoadInt64(&slot.Pack.Accounting.NumBytesAcked)
-							nba += int64(len(slot.Pack.Data))
-							atomic.StoreInt64(&slot.Pack.Accounting.NumBytesAcked, nba)
-						}
-					})
-				///p("%v after numDel %v through a.AckNum=%v, s.SentButNotAckedBySeqNum=\n%s\n, and s.SentButNotAckedByDeadline=\n%s\n", s.Inbox, numDel, a.AckNum, s.SentButNotAckedBySeqNum, s.SentButNotAckedByDeadline)
-
-				// we were having problems with delete ByDeadline not
-				// happening, so assert a sanity check here.
-				lenBySeq := s.SentButNotAckedBySeqNum.tree.Len()
-				lenByDeadline := s.SentButNotAckedByDeadline.tree.Len()
-				if lenBySeq != lenByDeadline {
-					panic(fmt.Sprintf("lenBySeq=%v, while lenByDeadline=%v", lenBySeq, lenByDeadline))
-				}
-
-				if a.TcpEvent != EventDataAck || a.AckNum < 0 {
-					// it wasn't an Ack, just updated flow info
-					// from a received data message; or a keepalive (a.AckNum < 0).
-					//p("%s sender Gotack: just updated flow control, continuing sendloop", s.Inbox)
-					continue sendloop
-				}
-				// INVAR: a.TcpEvent == EventDataAck
-
-				//p("%s sender has EventDataAck(%v) or a.AckNum(%v) < 0 ...", s.Inbox, a.TcpEvent == EventDataAck, a.AckNum)
-				if !InWindow(a.AckNum, s.LastAckRec+1, s.LastFrameSent) {
-					///p("%v a.AckNum = %v outside sender's window [%v, %v], dropping it.", s.Inbox, a.AckNum, s.LastAckRec+1, s.LastFrameSent)
-					s.DiscardCount++
-					continue sendloop
-				}
-			//p("%v packet.AckNum = %v inside sender's window, keeping it.", s.Inbox, a.AckNum)
+				s.gotPack(a)
 
 			case cr := <-s.sendSynCh:
-				err := s.Net.Send(cr.synPack, "sendSyn")
+				err := s.netSend(cr.synPack, "sendSyn")
 				if err != nil {
 					cr.Err = err
 					close(cr.Done)
 				}
 				//p("%s sender sent SYN", s.Inbox)
 
+			case pack := <-s.SendControl:
+				// out-of-band, so no flow control; see control.go.
+				err := s.doControlSend(pack)
+				if err != nil {
+					mylog.Printf("%s s.Net.Send(control pack) got err='%v'", s.Inbox, err)
+				}
+
 			case ackPack := <-s.SendAck:
 				// request to send an ack:
 				// don't go though the BlockingSend protocol; since
@@ -418,17 +783,143 @@ func (s *SenderState) Start(sess *Session) {
 					s.RemoteSessNonce = ackPack.DestSessNonce
 				}
 
-				err := s.Net.Send(ackPack, "SendAck/ackPack")
-				if err != nil {
+				// hold plain data acks for a little while, in
+				// the hope of piggybacking them on our own data.
+				// Naks are urgent, so they always go right away.
+				if s.PiggybackWindow > 0 && ackPack.TcpEvent == EventDataAck && !ackPack.Nak && !ackPack.KAReply {
+					// acks are cumulative, so a newer one replaces any held one.
+					s.pendingAck = ackPack
+					if s.pendingAckTimeout == nil {
+						s.pendingAckTimeout = time.After(s.PiggybackWindow)
+					}
+					continue sendloop
+				}
+
+				err := s.sendStandaloneAck(ackPack)
+				if err != nil && err != ErrReconnecting {
 					// "nats: connection closed"
 					mylog.Printf("%s s.Net.Send(ackPack) got err='%v', returning", s.Inbox, err)
 					return
 				}
+
+			case <-s.pendingAckTimeout:
+				// no data came along to carry it.
+				s.pendingAckTimeout = nil
+				ackPack := s.pendingAck
+				s.pendingAck = nil
+				if ackPack != nil {
+					err := s.sendStandaloneAck(ackPack)
+					if err != nil && err != ErrReconnecting {
+						mylog.Printf("%s s.Net.Send(ackPack) got err='%v', returning", s.Inbox, err)
+						return
+					}
+				}
 			}
 		}
 	}()
 }
 
+// netReconnecting reports whether our Network
+// is re-establishing a lost connection; see
+// NatsNet.AutoReconnect. A lost ack then does
+// no harm, as later acks are cumulative.
+func (s *SenderState) netReconnecting() bool {
+	rn, ok := s.Net.(interface{ Reconnecting() bool })
+	return ok && rn.Reconnecting()
+}
+
+// resendAsIs reports whether a retry of slot can go
+// as the bytes of its last send: over a RawNetwork, so
+// long as our session nonces are unchanged. Otherwise
+// the retry restamps Pack, and encodes it anew.
+func (s *SenderState) resendAsIs(slot *TxqSlot) bool {
+	_, raw := s.Net.(RawNetwork)
+	return raw && slot.serialized != nil &&
+		slot.Pack.FromSessNonce == s.LocalSessNonce &&
+		slot.Pack.DestSessNonce == s.RemoteSessNonce
+}
+
+// sendRetries resends the packets of slots, in one
+// SendBatch call if our Network supports it. A
+// RawNetwork gets each by sendSlot instead, to reuse
+// its encoding.
+func (s *SenderState) sendRetries(slots []*TxqSlot) {
+	var err error
+	_, raw := s.Net.(RawNetwork)
+	if b, ok := s.Net.(BatchNetwork); ok && !raw && len(slots) > 1 {
+		packs := make([]*Packet, len(slots))
+		for i, slot := range slots {
+			s.sign(slot.Pack)
+			packs[i] = slot.Pack
+		}
+		err = b.SendBatch(packs, "retry")
+	} else {
+		for _, slot := range slots {
+			err = s.sendSlot(slot, "retry")
+		}
+	}
+	if err != nil {
+		//ignore errors; nats net might be down.
+	}
+}
+
+// sendSlot sends slot.Pack. Over a RawNetwork it sends
+// slot.serialized, encoding Pack into it first if need be.
+func (s *SenderState) sendSlot(slot *TxqSlot, why string) error {
+	raw, ok := s.Net.(RawNetwork)
+	if !ok {
+		return s.netSend(slot.Pack, why)
+	}
+	if slot.serialized == nil {
+		s.sign(slot.Pack)
+		bts, err := raw.RawCodec().Marshal(slot.Pack)
+		if err != nil {
+			return err
+		}
+		slot.serialized = bts
+	}
+	return raw.SendRaw(slot.Pack.Dest, slot.serialized)
+}
+
+func (s *SenderState) sendStandaloneAck(ackPack *Packet) error {
+	atomic.AddInt64(&s.StandaloneAcks, 1)
+	return s.netSend(ackPack, "SendAck/ackPack")
+}
+
+// netSend sends pack, signing it first under
+// an EncryptionKey; see crypt.go.
+func (s *SenderState) netSend(pack *Packet, why string) error {
+	s.sign(pack)
+	return s.Net.Send(pack, why)
+}
+
+// sign sets pack.AuthTag, under an EncryptionKey.
+// pack's header must be final.
+func (s *SenderState) sign(pack *Packet) {
+	if s.cipher != nil {
+		// only fails as crypto/aes would.
+		panicOn(s.cipher.sign(pack))
+	}
+}
+
+// piggybackAck moves any held ack onto pack, an
+// original data send, saving a standalone ack packet.
+func (s *SenderState) piggybackAck(pack *Packet) {
+	ack := s.pendingAck
+	if s.PiggybackWindow <= 0 || ack == nil {
+		// don't let the zero AckNum of a data
+		// packet look like an ack of SeqNum 0.
+		pack.AckNum = -1
+		return
+	}
+	pack.AckNum = ack.AckNum
+	pack.AckRetry = ack.AckRetry
+	pack.AckReplyTm = ack.AckReplyTm
+	s.pendingAck = nil
+	s.pendingAckTimeout = nil
+	atomic.AddInt64(&s.PiggybackedAcks, 1)
+}
+
 // Stop the SenderState componennt
 func (s *SenderState) Stop() {
 	//p("%s Stop() called.", s.Inbox)
@@ -436,6 +927,35 @@ func (s *SenderState) Stop() {
 	<-s.Halt.Done.Chan
 }
 
+// Pause stops the sender taking new packets from
+// BlockingSend, so Push blocks, until Resume. The session
+// stays up: packets already sent are still retried,
+// and acks and keepalives still flow.
+func (s *SenderState) Pause() {
+	atomic.StoreInt32(&s.paused, 1)
+	s.wakeForPause()
+}
+
+// Resume undoes Pause.
+func (s *SenderState) Resume() {
+	atomic.StoreInt32(&s.paused, 0)
+	s.wakeForPause()
+}
+
+// Paused reports whether the sender is paused.
+func (s *SenderState) Paused() bool {
+	return atomic.LoadInt32(&s.paused) == 1
+}
+
+// wakeForPause nudges the sendloop, if it isn't
+// already due to wake.
+func (s *SenderState) wakeForPause() {
+	select {
+	case s.pauseCh <- struct{}{}:
+	default:
+	}
+}
+
 // doOrigDataSend() is for first time sends of data, not retries or acks.
 // If getAck is true, then we will call Flush on the
 // nats connection. This will wait for an ack from the
@@ -444,33 +964,54 @@ func (s *SenderState) Stop() {
 // the LastFrameSent counter.
 func (s *SenderState) doOrigDataSend(pack *Packet) (int64, error) {
 
-	s.LastFrameSent++
+	// atomic, for LastSeqSent.
+	atomic.AddInt64(&s.LastFrameSent, 1)
 	//p("%v doOrigDataSend(): LastFrameSent is now %v", s.Inbox, s.LastFrameSent)
 
-	s.TotalBytesSent += int64(len(pack.Data))
-	pack.CumulBytesTransmitted = s.TotalBytesSent
+	// atomic, since Session.Stats reads it.
+	pack.CumulBytesTransmitted = atomic.AddInt64(&s.TotalBytesSent, int64(len(pack.Data)))
 
 	lfs := s.LastFrameSent
 	pos := lfs % s.SenderWindowSize
 	slot := s.Txq[pos]
 
+	pack.SeqNum = lfs
+	if s.streamSeq == nil {
+		s.streamSeq = make(map[uint32]int64)
+	}
+	pack.StreamSeq = s.streamSeq[pack.StreamID]
+	s.streamSeq[pack.StreamID]++
+
+	if s.compressor != nil && len(pack.Data) > 0 {
+		s.compress(pack)
+	}
+	if s.cipher != nil && len(pack.Data) > 0 {
+		// only fails if crypto/rand does.
+		panicOn(s.cipher.seal(pack, s.LocalSessNonce))
+	}
 	if len(pack.Data) > 0 {
 		pack.Blake2bChecksum = Blake2bOfBytes(pack.Data)
 		//p("%v SenderState.send() added blake2b '%x' of len(pack.Data)=%v", s.Inbox, pack.Blake2bChecksum, len(pack.Data))
 	}
-
-	pack.SeqNum = lfs
 	///p("%v sender in acceptSend, pack.SeqNum='%v'", s.Inbox, pack.SeqNum)
 
+	s.piggybackAck(pack)
+
 	if pack.From != s.Inbox {
 		pack.From = s.Inbox
 	}
 	pack.From = s.Inbox
 	slot.Pack = pack
+	s.startSendSpan(slot)
 
 	now := s.Clk.Now()
 	s.SendHistory = append(s.SendHistory, pack)
 	slot.OrigSendTime = now
+	slot.PushTime = pack.pushTime
+	if slot.PushTime.IsZero() {
+		// not from Push.
+		slot.PushTime = now
+	}
 
 	flow := s.FlowCt.UpdateFlow(s.Inbox+":sender", s.Net, -1, -1, nil)
 	slot.RetryDur = s.GetDeadlineDur(flow)
@@ -501,15 +1042,191 @@ func (s *SenderState) doOrigDataSend(pack *Packet) (int64, error) {
 
 	slot.Pack.FromSessNonce = s.LocalSessNonce
 	slot.Pack.DestSessNonce = s.RemoteSessNonce
-	err := s.Net.Send(slot.Pack, fmt.Sprintf("doOrigDataSend() for %v", s.Inbox))
+	slot.Pack.Version = ProtocolVersion
+	slot.serialized = nil
+	err := s.sendSlot(slot, fmt.Sprintf("doOrigDataSend() for %v", s.Inbox))
 	if err != nil {
 		mylog.Printf("doOrigSend failed for lfs=%v, with err='%s'", lfs, err)
 		return -1, err
 	}
+	s.Events.emit(PacketSent, lfs, now, nil)
+	s.fecAccumulate(slot.Pack)
 
 	return lfs, nil
 }
 
+// actOnNak handles a negative ack from the receiver by
+// moving the RetryDeadline of the missing packet up to
+// now, so the next regularIntervalWakeup retransmits it.
+// (We avoid the zero time.Time, as compareRetryDeadline
+// works in UnixNano, which it would overflow.)
+func (s *SenderState) actOnNak(nackNum int64) {
+	for it := s.SentButNotAckedBySeqNum.tree.Min(); !it.Limit(); it = it.Next() {
+		slot := it.Item().(*TxqSlot)
+		if slot.Pack.SeqNum < nackNum {
+			continue
+		}
+		if slot.Pack.SeqNum == nackNum {
+			// must delete before changing RetryDeadline,
+			// since the tree is sorted on it.
+			s.SentButNotAckedByDeadline.deleteSlot(slot)
+			slot.RetryDeadline = s.Clk.Now()
+			s.SentButNotAckedByDeadline.insert(slot)
+			atomic.AddInt64(&s.NacksActedOn, 1)
+			//p("%v acting on nak for SeqNum %v", s.Inbox, nackNum)
+		}
+		return
+	}
+}
+
+// gotPack does the sender's side of a packet the
+// receiver got from our peer: an ack, a keepalive, or
+// data with fresh flow-control info. Only the sendloop
+// calls it.
+func (s *SenderState) gotPack(a *Packet) {
+	if a.TcpEvent == EventDataAck && a.AckNum > atomic.LoadInt64(&s.LastFrameSent) {
+		// acks what we have yet to send, so drop it
+		// before it touches our window. An AckNum at
+		// or below LastAckRec is a duplicate, and still
+		// brings flow control news, so it goes on.
+		///p("%v a.AckNum = %v past sender's window [%v, %v], dropping it.", s.Inbox, a.AckNum, atomic.LoadInt64(&s.LastAckRec)+1, s.LastFrameSent)
+		atomic.AddInt64(&s.DiscardCount, 1)
+		return
+	}
+	if s.OnAck != nil && a.TcpEvent == EventDataAck {
+		s.OnAck(AckStatus{
+			AckNum:              a.AckNum,
+			Nak:                 a.Nak,
+			NackNum:             a.NackNum,
+			AvailReaderMsgCap:   a.AvailReaderMsgCap,
+			AvailReaderBytesCap: a.AvailReaderBytesCap,
+			ArrivedAtDestTm:     a.ArrivedAtDestTm,
+		})
+	}
+	s.LastHeardFromDownstream = a.ArrivedAtDestTm
+	if s.RemoteSessNonce == "" && a.FromSessNonce != "" {
+		// learn the remote sess nonce, if we have no
+		// acks of our own to learn it from, as on a
+		// HalfDuplexSender.
+		s.RemoteSessNonce = a.FromSessNonce
+	}
+	if a.KAReply {
+		s.pendingKACount = 0
+	}
+
+	// ack/keepalive/data packet received in 'a' -
+	// do sender side stuff
+	//
+	//p("%v sender GotPack a: %#v", s.Inbox, a)
+	//
+	// flow control: respect a.AvailReaderBytesCap
+	// and a.AvailReaderMsgCap info that we have
+	// received from this ack
+	//
+	//p("%v sender GotPack, updating s.LastSeenAvailReaderMsgCap %v -> %v",
+	//	s.Inbox, s.LastSeenAvailReaderMsgCap, a.AvailReaderMsgCap)
+	s.LastSeenAvailReaderBytesCap = a.AvailReaderBytesCap
+	s.LastSeenAvailReaderMsgCap = a.AvailReaderMsgCap
+
+	// need to update our SentButNotAcked* trees
+	// and remove everything before AckNum, which is cumulative.
+	numDel := 0
+	ambiguous := false
+	ackTm := s.Clk.Now()
+	for {
+		slot := s.SentButNotAckedBySeqNum.popThroughSeqNum(a.AckNum)
+		if slot == nil {
+			break
+		}
+		numDel++
+		if s.slotAcked(slot, a, ackTm) {
+			ambiguous = true
+		}
+	}
+	///p("%v after numDel %v through a.AckNum=%v, s.SentButNotAckedBySeqNum=\n%s\n, and s.SentButNotAckedByDeadline=\n%s\n", s.Inbox, numDel, a.AckNum, s.SentButNotAckedBySeqNum, s.SentButNotAckedByDeadline)
+
+	if !ambiguous {
+		s.UpdateRTT(a)
+	}
+
+	// we were having problems with delete ByDeadline not
+	// happening, so assert a sanity check here.
+	lenBySeq := s.SentButNotAckedBySeqNum.tree.Len()
+	lenByDeadline := s.SentButNotAckedByDeadline.tree.Len()
+	if lenBySeq != lenByDeadline {
+		panic(fmt.Sprintf("lenBySeq=%v, while lenByDeadline=%v", lenBySeq, lenByDeadline))
+	}
+
+	if a.Nak {
+		s.actOnNak(a.NackNum)
+	}
+
+	if a.TcpEvent == EventKeepAlive && a.ProposeWindowSize > 0 &&
+		a.ProposeWindowSize != s.SenderWindowSize {
+		s.pendingWindowSize = a.ProposeWindowSize
+	}
+
+	if a.TcpEvent == EventDataAck {
+		// the peer acks again, so its circuit is closed.
+		s.circuitClosed(a)
+	}
+
+	if a.TcpEvent != EventDataAck || a.AckNum < 0 {
+		// it wasn't an Ack, just updated flow info
+		// from a received data message; or a keepalive (a.AckNum < 0).
+		//p("%s sender Gotack: just updated flow control, continuing sendloop", s.Inbox)
+		return
+	}
+	// INVAR: a.TcpEvent == EventDataAck
+
+	if numDel > 0 {
+		// the peer is responsive, so no
+		// need to back off.
+		s.keepAliveBackoff = s.KeepAliveInterval
+	}
+
+	if s.Cong != nil {
+		s.Cong.OnAck(a.AckNum, numDel)
+	}
+	if s.Tune != nil && s.Tune.OnAck(s.Clk.Now(), numDel, s.rtt) {
+		mylog.Printf("%v auto-tune resized send window to %v packets, with rtt estimate %v",
+			s.Inbox, s.Tune.Window, s.rtt.GetEstimate())
+	}
+}
+
+// slotAcked finishes with slot, just deleted from
+// SentButNotAckedBySeqNum as acked by a, which arrived
+// at ackTm. It reports whether a is ambiguous, acking
+// either the first send of slot or a retry, so that it
+// makes no RTT sample.
+func (s *SenderState) slotAcked(slot *TxqSlot, a *Packet, ackTm time.Time) (ambiguous bool) {
+	s.SentButNotAckedByDeadline.deleteSlot(slot)
+	if slot.resent && slot.Pack.DataSendTm.Equal(a.DataSendTm) {
+		// the first send or a retry; we can't
+		// tell which was acked.
+		ambiguous = true
+	}
+	s.ackedAfter(slot, ackTm.Sub(slot.PushTime))
+	s.endSendSpan(slot)
+	if slot.Pack.SeqNum > s.LastAckRec {
+		// atomic, for LargestAckedSeqno.
+		atomic.StoreInt64(&s.LastAckRec, slot.Pack.SeqNum)
+	}
+	s.Events.emit(PacketAcked, slot.Pack.SeqNum, a.ArrivedAtDestTm, nil)
+	if slot.Pack.CliAcked != nil {
+		///p("got ack for packet that has CliAcked on it; a.AckNum=%v. len(Data)=%v. event=%s. clearing slot.Pack.SeqNum=%v", a.AckNum, len(slot.Pack.Data), a.TcpEvent, slot.Pack.SeqNum)
+		slot.Pack.CliAcked.Bcast(slot.Pack.SeqNum)
+	}
+	///p("%s deleting slot.Pack.SeqNum=%v <= a.AckNum=%v from s.SentButNotAcked", s.Inbox, slot.Pack.SeqNum, a.AckNum)
+	//s.TotalBytesSentAndAcked += int64(len(slot.Pack.Data))
+	if slot.Pack.Accounting != nil {
+		nba := atomic.LoadInt64(&slot.Pack.Accounting.NumBytesAcked)
+		nba += int64(len(slot.Pack.Data))
+		atomic.StoreInt64(&slot.Pack.Accounting.NumBytesAcked, nba)
+	}
+	return ambiguous
+}
+
 func (s *SenderState) doKeepAlive(state TcpState) {
 
 	if s.Dest == "" || s.RemoteSessNonce == "" {
@@ -517,7 +1234,11 @@ func (s *SenderState) doKeepAlive(state TcpState) {
 		// don't have a destintion.
 		return
 	}
-	if time.Since(s.LastSendTime) < s.KeepAliveInterval {
+	interval := s.KeepAliveInterval
+	if s.AdaptiveKeepAlive && s.keepAliveBackoff > interval {
+		interval = s.keepAliveBackoff
+	}
+	if time.Since(s.LastSendTime) < interval {
 		return
 	}
 	flow := s.FlowCt.UpdateFlow(s.Inbox+":sender", s.Net, -1, -1, nil)
@@ -542,6 +1263,8 @@ func (s *SenderState) doKeepAlive(state TcpState) {
 		FromTcpState:        state,
 		AvailReaderBytesCap: flow.AvailReaderBytesCap,
 		AvailReaderMsgCap:   flow.AvailReaderMsgCap,
+		ProposeWindowSize:   atomic.LoadInt64(&s.proposedWindowSize),
+		Version:             ProtocolVersion,
 
 		FromRttEstNsec: int64(s.rtt.GetEstimate()),
 		FromRttSdNsec:  int64(s.rtt.GetSd()),
@@ -551,12 +1274,25 @@ func (s *SenderState) doKeepAlive(state TcpState) {
 	kap.FromSessNonce = s.LocalSessNonce
 	kap.DestSessNonce = s.RemoteSessNonce
 
-	err := s.Net.Send(kap, fmt.Sprintf("keepalive from %v", s.Inbox))
+	err := s.netSend(kap, fmt.Sprintf("keepalive from %v", s.Inbox))
 	if err != nil {
 		// very common, don't bother complaining:
 		// on send Keepalive attempt, got err = 'nats: connection closed'
 		// fmt.Fprintf(os.Stderr, "on send Keepalive attempt, got err = '%v'\n", err)
 	}
+	atomic.AddInt64(&s.KeepAlivesSent, 1)
+	if s.KeepAliveExpectReply {
+		if s.pendingKACount == 0 {
+			s.kaReplyDeadline = now.Add(2 * s.Timeout)
+		}
+		s.pendingKACount++
+	}
+	if s.AdaptiveKeepAlive {
+		s.keepAliveBackoff = 2 * interval
+		if s.keepAliveBackoff > s.MaxKeepAliveInterval {
+			s.keepAliveBackoff = s.MaxKeepAliveInterval
+		}
+	}
 }
 
 func (s *SenderState) doSendClosing() {
@@ -574,6 +1310,7 @@ func (s *SenderState) doSendClosing() {
 		TcpEvent:            EventFin,
 		AvailReaderBytesCap: flow.AvailReaderBytesCap,
 		AvailReaderMsgCap:   flow.AvailReaderMsgCap,
+		Version:             ProtocolVersion,
 
 		FromRttEstNsec: int64(s.rtt.GetEstimate()),
 		FromRttSdNsec:  int64(s.rtt.GetSd()),
@@ -583,7 +1320,7 @@ func (s *SenderState) doSendClosing() {
 	kap.FromSessNonce = s.LocalSessNonce
 	kap.DestSessNonce = s.RemoteSessNonce
 
-	err := s.Net.Send(kap, fmt.Sprintf("endpoint is closing, from %v", s.Inbox))
+	err := s.netSend(kap, fmt.Sprintf("endpoint is closing, from %v", s.Inbox))
 	if err != nil {
 		// ignore errors, the other end is most like already down.
 		//
@@ -602,6 +1339,13 @@ func min(a, b int64) int64 {
 	return b
 }
 
+// RTTPercentile returns the p-th percentile of the RTT
+// samples so far, as RTTHistogram.Percentile. It is safe
+// to call from any goroutine.
+func (s *SenderState) RTTPercentile(p float64) time.Duration {
+	return s.RTTHist.Percentile(p)
+}
+
 func (s *SenderState) UpdateRTT(pack *Packet) {
 	// avoid clock skew between machines by
 	// not sampling one-way elapsed times.
@@ -630,6 +1374,11 @@ func (s *SenderState) UpdateRTT(pack *Packet) {
 
 	//p("%v pack.DataSendTm = %v", s.Inbox, pack.DataSendTm)
 	s.rtt.AddSample(obs)
+	s.RTTHist.Add(obs)
+
+	if s.OnRTTSample != nil && pack.AckRetry == 0 {
+		s.OnRTTSample(pack.AckNum, obs)
+	}
 
 	//sd := s.rtt.GetSd()
 	//p("%v UpdateRTT: observed rtt was %v. new smoothed estimate after %v samples is %v. sd = %v", s.Inbox, obs, s.rtt.N, s.rtt.GetEstimate(), sd)
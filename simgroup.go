@@ -0,0 +1,95 @@
+package swp
+
+import (
+	"time"
+)
+
+// Shared bottlenecks.
+//
+// GroupDelay puts a set of nodes behind one shared link,
+// so that concurrent sessions among them compete for its
+// bandwidth. Every packet between two members goes
+// through the link's token bucket: tokens, in bytes,
+// refill at bottleneckBPS up to groupBurst worth of
+// traffic, and a packet takes its encoded size in tokens.
+// When they run out the packet waits in the link's queue
+// for the tokens it lacks, and the wait is added to its
+// latency, along with the link's baseDelay. Packets
+// to or from anyone outside the group are unaffected.
+
+// groupBurst is how much traffic, at the bottleneck
+// rate, a group's token bucket holds when full.
+const groupBurst = 10 * time.Millisecond
+
+// simGroup is one shared link, from GroupDelay.
+type simGroup struct {
+	nodes     map[string]bool
+	baseDelay time.Duration
+	bps       int64
+
+	// tokens goes negative as the queue builds:
+	// -tokens bytes are waiting to cross the link.
+	tokens   float64
+	lastFill time.Time
+}
+
+// GroupDelay installs a shared bottleneck link among
+// nodes, of baseDelay latency and bottleneckBPS bytes
+// per second. Each call adds another link; a packet
+// between two nodes that share several goes through
+// each of them.
+func (sim *SimNet) GroupDelay(nodes []string, baseDelay time.Duration, bottleneckBPS int64) {
+	g := &simGroup{
+		nodes:     make(map[string]bool),
+		baseDelay: baseDelay,
+		bps:       bottleneckBPS,
+		lastFill:  time.Now(),
+	}
+	for _, n := range nodes {
+		g.nodes[n] = true
+	}
+	g.tokens = g.burst()
+
+	sim.mapMut.Lock()
+	defer sim.mapMut.Unlock()
+	sim.groups = append(sim.groups, g)
+}
+
+// burst is the bucket's capacity, in bytes.
+func (g *simGroup) burst() float64 {
+	return float64(g.bps) * groupBurst.Seconds()
+}
+
+// take charges n bytes sent at now to the bucket,
+// returning how long they queue for.
+func (g *simGroup) take(now time.Time, n int) time.Duration {
+	if g.bps <= 0 {
+		return 0
+	}
+	g.tokens += float64(g.bps) * now.Sub(g.lastFill).Seconds()
+	if full := g.burst(); g.tokens > full {
+		g.tokens = full
+	}
+	g.lastFill = now
+	g.tokens -= float64(n)
+	if g.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-g.tokens / float64(g.bps) * float64(time.Second))
+}
+
+// groupDelay returns the delay, beyond the path's
+// latency, that the shared links add to pack. Call
+// with mapMut held.
+func (sim *SimNet) groupDelay(pack *Packet) (delay time.Duration) {
+	if len(sim.groups) == 0 {
+		return 0
+	}
+	now := time.Now()
+	for _, g := range sim.groups {
+		if g.nodes[pack.From] && g.nodes[pack.Dest] {
+			delay += g.baseDelay + g.take(now, pack.Msgsize())
+		}
+	}
+	return delay
+}
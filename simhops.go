@@ -0,0 +1,158 @@
+package swp
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Multi-hop paths.
+//
+// By default a SimNet is one link between every pair of
+// nodes, with the same Latency and LossProb. AddHop instead
+// describes a directed graph of links, as between routers.
+// A packet takes the path with the fewest hops from its
+// From to its Dest; each hop adds its own latency and gets
+// its own chance to lose the packet, so the delivery
+// probability is the product of (1 - LossProb) over the
+// hops. Pairs with no path, such as the reverse direction
+// if only A->B hops were added, keep using Latency and
+// LossProb.
+
+// SimHop is one directed link added with AddHop. ByteCap
+// and MsgCap are -1, for unlimited, unless SetHopCaps
+// says otherwise.
+type SimHop struct {
+	Latency  time.Duration
+	LossProb float64
+	ByteCap  int64
+	MsgCap   int64
+}
+
+// ErrNoSuchHop is returned by SetHopCaps when
+// AddHop was never called for the link.
+var ErrNoSuchHop = fmt.Errorf("swp: no such SimNet hop")
+
+// AddHop adds (or replaces) the directed link from->to.
+// The nodes are just names; only the ends of a path
+// need to Listen.
+func (sim *SimNet) AddHop(from, to string, latency time.Duration, lossProb float64) {
+	sim.mapMut.Lock()
+	defer sim.mapMut.Unlock()
+	if sim.hops == nil {
+		sim.hops = make(map[string]map[string]*SimHop)
+	}
+	if sim.hops[from] == nil {
+		sim.hops[from] = make(map[string]*SimHop)
+	}
+	sim.hops[from][to] = &SimHop{Latency: latency, LossProb: lossProb, ByteCap: -1, MsgCap: -1}
+}
+
+// SetHopCaps sets the buffer capacity of the
+// link from->to, for BufferCaps and PathBufferCaps.
+func (sim *SimNet) SetHopCaps(from, to string, bytecap, msgcap int64) error {
+	sim.mapMut.Lock()
+	defer sim.mapMut.Unlock()
+	h := sim.hops[from][to]
+	if h == nil {
+		return ErrNoSuchHop
+	}
+	h.ByteCap = bytecap
+	h.MsgCap = msgcap
+	return nil
+}
+
+// path returns the hops from from to dest, fewest first
+// found by breadth-first search, or nil if there is no
+// path. Ties go to the alphabetically first next hop, so
+// a given graph always gives the same path. Call with
+// mapMut held.
+func (sim *SimNet) path(from, dest string) []*SimHop {
+	if len(sim.hops) == 0 || from == dest {
+		return nil
+	}
+	prev := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		var next []string
+		for to := range sim.hops[node] {
+			next = append(next, to)
+		}
+		sort.Strings(next)
+		for _, to := range next {
+			if _, seen := prev[to]; seen {
+				continue
+			}
+			prev[to] = node
+			if to == dest {
+				var hops []*SimHop
+				for n := dest; n != from; n = prev[n] {
+					hops = append([]*SimHop{sim.hops[prev[n]][n]}, hops...)
+				}
+				return hops
+			}
+			queue = append(queue, to)
+		}
+	}
+	return nil
+}
+
+// linkFate decides, for one packet from->dest, the
+// latency it will see and whether it is lost. Call
+// with mapMut held.
+func (sim *SimNet) linkFate(from, dest string) (lat time.Duration, lost bool) {
+	if step, ok := sim.nextReplay(); ok {
+		return step.delay, step.lost
+	}
+	hops := sim.path(from, dest)
+	if hops == nil {
+		return sim.Latency, sim.LossProb > 0 && cryptoProb() <= sim.LossProb
+	}
+	for _, h := range hops {
+		lat += h.Latency
+		if h.LossProb > 0 && cryptoProb() <= h.LossProb {
+			lost = true
+		}
+	}
+	return lat, lost
+}
+
+// PathBufferCaps returns the smallest ByteCap and MsgCap
+// along the path from->dest, each -1 if no hop on it is
+// limited, or if there is no path.
+func (sim *SimNet) PathBufferCaps(from, dest string) (bytecap int64, msgcap int64) {
+	sim.mapMut.Lock()
+	defer sim.mapMut.Unlock()
+	return minCaps(sim.path(from, dest))
+}
+
+// BufferCaps returns the smallest ByteCap and MsgCap of
+// any hop, which bounds every path; -1 means unlimited.
+// Use PathBufferCaps for one path.
+func (sim *SimNet) BufferCaps() (bytecap int64, msgcap int64) {
+	sim.mapMut.Lock()
+	defer sim.mapMut.Unlock()
+	var all []*SimHop
+	for _, tos := range sim.hops {
+		for _, h := range tos {
+			all = append(all, h)
+		}
+	}
+	return minCaps(all)
+}
+
+// minCaps returns the smallest non-negative caps in hops.
+func minCaps(hops []*SimHop) (bytecap int64, msgcap int64) {
+	bytecap, msgcap = -1, -1
+	for _, h := range hops {
+		if h.ByteCap >= 0 && (bytecap < 0 || h.ByteCap < bytecap) {
+			bytecap = h.ByteCap
+		}
+		if h.MsgCap >= 0 && (msgcap < 0 || h.MsgCap < msgcap) {
+			msgcap = h.MsgCap
+		}
+	}
+	return
+}
@@ -4,6 +4,7 @@ import (
 	cryptorand "crypto/rand"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -24,16 +25,51 @@ type SimNet struct {
 	TotalRcvd map[string]int64
 	mapMut    sync.Mutex
 
+	// per "From->Dest" counts; see Stats.
+	perDir map[string]*DirectionStats
+
 	// simulate loss of the first packets
 	DiscardOnce int64
 
+	// DiscardList loses the first send of each SeqNum
+	// in it, for bursts of loss that DiscardOnce can't
+	// make; each is removed once discarded. Set it
+	// before sending, or use DiscardRange.
+	DiscardList map[int64]bool
+
 	// simulate re-ordering of packets by setting this to 1
 	SimulateReorderNext int
 	heldBack            *Packet
 
+	// ReorderProb is the probability that a packet is
+	// held back an extra random delay, uniform on
+	// [0, MaxReorderDelay), letting later packets
+	// overtake it. Reordered counts those held back,
+	// and is read with atomic.LoadInt64.
+	ReorderProb     float64
+	MaxReorderDelay time.Duration
+	Reordered       int64
+
 	// simulate duplicating the next packet
 	DuplicateNext uint32
 
+	// DuplicateProb is the probability that a packet is
+	// delivered twice, the copy 1-10 msec after the
+	// original. Duplicated counts the copies, and is
+	// read with atomic.LoadInt64.
+	DuplicateProb float64
+	Duplicated    int64
+
+	// CorruptProb is the probability that a packet with
+	// Data arrives with CorruptBytes (default 1) of its
+	// Data bytes flipped. The receiver's checksum check
+	// should catch and drop every one; compare
+	// RecvState.CorruptedCount. Corrupted counts them, and
+	// is read with atomic.LoadInt64.
+	CorruptProb  float64
+	CorruptBytes int
+	Corrupted    int64
+
 	// enforce that advertised windows are never
 	// violated by having more messages in flight
 	// than have been advertised.
@@ -44,6 +80,126 @@ type SimNet struct {
 	Done    chan bool
 
 	AllowBlackHoleSends bool
+
+	// QueueServiceRate, if > 0, models each destination
+	// as an M/D/1 queue serving this many packets per
+	// second. The mean queuing delay for the observed
+	// arrival rate is added to Latency, so delay grows
+	// as utilization approaches 100%. When zero, we use
+	// the fixed Latency alone.
+	QueueServiceRate float64
+	arrivals         map[string]*arrivalRate
+
+	// ClockSkewPerNode and ClockDriftRatePerNode, keyed by
+	// inbox, make a node's clock disagree with ours. A
+	// packet delivered to a listed node arrives already
+	// stamped with that node's idea of the time in
+	// ArrivedAtDestTm: time.Now() plus its skew, plus its
+	// drift rate (in nanoseconds per real nanosecond) times
+	// the real time elapsed since NewSimNet. Set before
+	// sending.
+	ClockSkewPerNode      map[string]time.Duration
+	ClockDriftRatePerNode map[string]float64
+	start                 time.Time
+
+	// hops, keyed by from then to, replace Latency and
+	// LossProb for nodes with a path; see simhops.go.
+	hops map[string]map[string]*SimHop
+
+	// with clk set, packets wait in scheduled for a
+	// TimeTravel; see simtime.go.
+	clk        *SimClock
+	scheduled  simArrivals
+	scheduledN int64
+
+	// trace, if set, gets a line per packet event; see
+	// simtrace.go.
+	trace io.Writer
+
+	// sniff has the handlers from Sniff, by inbox.
+	sniff map[string]func(*Packet)
+
+	// closedInbox drops everything sent to an inbox
+	// while set; see chaos.go.
+	closedInbox map[string]bool
+
+	// replay is what remains of the trace from
+	// ReplayPCAP; see simpcap.go.
+	replay []replayStep
+
+	// groups are the shared bottleneck links from
+	// GroupDelay; see simgroup.go.
+	groups []*simGroup
+}
+
+// arrivalRate tracks packet arrivals to one destination
+// with an exponentially weighted moving average of the
+// gaps between them.
+type arrivalRate struct {
+	last   time.Time
+	gapEst float64 // seconds
+	n      int64
+}
+
+// arrivalAlpha weights the most recent gap in arrivalRate.
+const arrivalAlpha = 0.1
+
+// add records an arrival at now, and returns
+// the estimated arrival rate in packets per second.
+func (a *arrivalRate) add(now time.Time) float64 {
+	a.n++
+	if a.n > 1 {
+		gap := now.Sub(a.last).Seconds()
+		if a.n == 2 {
+			a.gapEst = gap
+		} else {
+			a.gapEst = arrivalAlpha*gap + (1-arrivalAlpha)*a.gapEst
+		}
+	}
+	a.last = now
+	if a.gapEst <= 0 {
+		return 0
+	}
+	return 1 / a.gapEst
+}
+
+// maxUtilization caps rho, since the M/D/1 wait
+// is unbounded as rho goes to 1.
+const maxUtilization = 0.99
+
+// MD1Wait returns the mean time spent waiting in an M/D/1
+// queue with arrival rate lambda and service rate mu
+// (both in packets per second): rho/(2*mu*(1-rho)),
+// where rho = lambda/mu.
+func MD1Wait(lambda, mu float64) time.Duration {
+	if mu <= 0 || lambda <= 0 {
+		return 0
+	}
+	rho := lambda / mu
+	if rho > maxUtilization {
+		rho = maxUtilization
+	}
+	w := rho / (2 * mu * (1 - rho))
+	return time.Duration(w * float64(time.Second))
+}
+
+// queueDelay returns the M/D/1 queuing delay, beyond
+// Latency, for a packet sent now to dest. Call with
+// mapMut held.
+func (sim *SimNet) queueDelay(dest string) time.Duration {
+	if sim.QueueServiceRate <= 0 {
+		return 0
+	}
+	if sim.arrivals == nil {
+		sim.arrivals = make(map[string]*arrivalRate)
+	}
+	a := sim.arrivals[dest]
+	if a == nil {
+		a = &arrivalRate{}
+		sim.arrivals[dest] = a
+	}
+	lambda := a.add(time.Now())
+	return MD1Wait(lambda, sim.QueueServiceRate)
 }
 
 // NewSimNet makes a network simulator. The
@@ -55,13 +211,104 @@ func NewSimNet(lossProb float64, latency time.Duration) *SimNet {
 		LossProb:        lossProb,
 		Latency:         latency,
 		DiscardOnce:     -1,
+		DiscardList:     make(map[int64]bool),
 		TotalSent:       make(map[string]int64),
 		TotalRcvd:       make(map[string]int64),
+		perDir:          make(map[string]*DirectionStats),
 		Advertised:      make(map[string]int64),
 		Inflight:        make(map[string]int64),
 		ReqStop:         make(chan bool),
 		Done:            make(chan bool),
 		FilterThisEvent: make(map[TcpEvent]*int),
+
+		ClockSkewPerNode:      make(map[string]time.Duration),
+		ClockDriftRatePerNode: make(map[string]float64),
+		start:                 time.Now(),
+	}
+	return s
+}
+
+// DiscardRange adds SeqNum low through high, inclusive,
+// to DiscardList.
+func (sim *SimNet) DiscardRange(low, high int64) {
+	sim.mapMut.Lock()
+	defer sim.mapMut.Unlock()
+	if sim.DiscardList == nil {
+		sim.DiscardList = make(map[int64]bool)
+	}
+	for seqno := low; seqno <= high; seqno++ {
+		sim.DiscardList[seqno] = true
+	}
+}
+
+// nodeClock returns what node's clock reads at our
+// time now, and false if node's clock is not skewed
+// or drifting. Call with mapMut held.
+func (sim *SimNet) nodeClock(node string, now time.Time) (time.Time, bool) {
+	skew, hasSkew := sim.ClockSkewPerNode[node]
+	rate, hasDrift := sim.ClockDriftRatePerNode[node]
+	if !hasSkew && !hasDrift {
+		return now, false
+	}
+	drift := time.Duration(rate * float64(now.Sub(sim.start)))
+	return now.Add(skew + drift), true
+}
+
+// Clone returns a new SimNet with the same loss, latency,
+// hops, shared links, and filtering configuration as sim,
+// but with its own empty Net map and independent
+// TotalSent/TotalRcvd counts. Handy for giving each sub-test its own network.
+func (sim *SimNet) Clone() *SimNet {
+	s := NewSimNet(sim.LossProb, sim.Latency)
+
+	sim.mapMut.Lock()
+	defer sim.mapMut.Unlock()
+
+	s.FilterCount = sim.FilterCount
+	for ev, pCount := range sim.FilterThisEvent {
+		if pCount == nil {
+			s.FilterThisEvent[ev] = nil
+			continue
+		}
+		n := *pCount
+		s.FilterThisEvent[ev] = &n
+	}
+	s.DiscardOnce = sim.DiscardOnce
+	for seqno := range sim.DiscardList {
+		s.DiscardList[seqno] = true
+	}
+	s.SimulateReorderNext = sim.SimulateReorderNext
+	s.DuplicateNext = atomic.LoadUint32(&sim.DuplicateNext)
+	s.AllowBlackHoleSends = sim.AllowBlackHoleSends
+	s.QueueServiceRate = sim.QueueServiceRate
+	for _, g := range sim.groups {
+		cp := *g
+		cp.tokens = cp.burst()
+		cp.lastFill = time.Now()
+		s.groups = append(s.groups, &cp)
+	}
+	s.ReorderProb = sim.ReorderProb
+	s.MaxReorderDelay = sim.MaxReorderDelay
+	s.DuplicateProb = sim.DuplicateProb
+	s.CorruptProb = sim.CorruptProb
+	s.CorruptBytes = sim.CorruptBytes
+	for node, skew := range sim.ClockSkewPerNode {
+		s.ClockSkewPerNode[node] = skew
+	}
+	for node, rate := range sim.ClockDriftRatePerNode {
+		s.ClockDriftRatePerNode[node] = rate
+	}
+	for from, tos := range sim.hops {
+		for to, h := range tos {
+			if s.hops == nil {
+				s.hops = make(map[string]map[string]*SimHop)
+			}
+			if s.hops[from] == nil {
+				s.hops[from] = make(map[string]*SimHop)
+			}
+			cp := *h
+			s.hops[from][to] = &cp
+		}
 	}
 	return s
 }
@@ -88,14 +335,24 @@ func (sim *SimNet) Send(pack *Packet, why string) error {
 	sim.mapMut.Lock()
 	sim.TotalSent[pack2.From]++
 	defer sim.mapMut.Unlock()
+	dir := sim.direction(pack2.From, pack2.Dest)
+	dir.Sent++
+	sim.traceLocked(pack2, "sent")
 
 	ch, ok := sim.Net[pack2.Dest]
 	if !ok {
 		if sim.AllowBlackHoleSends {
+			dir.Dropped++
+			sim.traceLocked(pack2, "discard:BlackHole")
 			return nil
 		}
 		return fmt.Errorf("sim sees packet for unknown node '%s'", pack2.Dest)
 	}
+	if sim.closedInbox[pack2.Dest] {
+		dir.Dropped++
+		sim.traceLocked(pack2, "discard:InboxClosed")
+		return nil
+	}
 
 	switch sim.SimulateReorderNext {
 	case 0:
@@ -113,6 +370,15 @@ func (sim *SimNet) Send(pack *Packet, why string) error {
 	if 0 <= pack2.SeqNum && pack2.SeqNum <= sim.DiscardOnce {
 		p("sim: packet lost/dropped because %v SeqNum <= DiscardOnce (%v)", pack2.SeqNum, sim.DiscardOnce)
 		sim.DiscardOnce = -1
+		dir.Dropped++
+		sim.traceLocked(pack2, "discard:DiscardOnce")
+		return nil
+	}
+
+	if pack2.SeqNum >= 0 && sim.DiscardList[pack2.SeqNum] {
+		delete(sim.DiscardList, pack2.SeqNum)
+		dir.Dropped++
+		sim.traceLocked(pack2, "discard:DiscardList")
 		return nil
 	}
 
@@ -121,52 +387,212 @@ func (sim *SimNet) Send(pack *Packet, why string) error {
 			if *pCount > 0 {
 				p("sim: packet lost/dropped because FilterThisEvent == '%s' has count remaining %v", pack2.TcpEvent, *pCount)
 				(*pCount)--
+				dir.Dropped++
+				sim.traceLocked(pack2, "discard:FilterThisEvent")
 				return nil
 			}
 		}
 	}
 
-	pr := cryptoProb()
-	isLost := pr <= sim.LossProb
-	if sim.LossProb > 0 && isLost {
+	lat, isLost := sim.linkFate(pack2.From, pack2.Dest)
+	if isLost {
 		//q("sim: bam! packet-lost! %v to %v", pack2.SeqNum, pack2.Dest)
+		dir.Dropped++
+		sim.traceLocked(pack2, "loss")
 	} else {
 		//q("sim: %v to %v: not lost. packet will arrive after %v", pack2.SeqNum, pack2.Dest, sim.Latency)
-		// start a goroutine per packet sent, to simulate arrival time with a timer.
-		go sim.sendWithLatency(ch, pack2, sim.Latency)
+		// schedule starts a goroutine per packet sent, to simulate arrival time with a timer.
+		if sim.CorruptProb > 0 && len(pack2.Data) > 0 && cryptoProb() <= sim.CorruptProb {
+			atomic.AddInt64(&sim.Corrupted, 1)
+			sim.corrupt(pack2)
+		}
+		lat += sim.queueDelay(pack2.Dest)
+		lat += sim.groupDelay(pack2)
+		if sim.ReorderProb > 0 && sim.MaxReorderDelay > 0 && cryptoProb() < sim.ReorderProb {
+			atomic.AddInt64(&sim.Reordered, 1)
+			extra := time.Duration(cryptoProb() * float64(sim.MaxReorderDelay))
+			sim.schedule(ch, pack2, lat+extra)
+		} else {
+			sim.schedule(ch, pack2, lat)
+		}
 		if sim.heldBack != nil {
 			//q("sim: reordering now -- sending along heldBack packet %v to %v",
 			//	sim.heldBack.SeqNum, sim.heldBack.Dest)
-			go sim.sendWithLatency(ch, sim.heldBack, sim.Latency+20*time.Millisecond)
+			sim.schedule(ch, sim.heldBack, lat+20*time.Millisecond)
 			sim.heldBack = nil
 		}
 
 		if atomic.CompareAndSwapUint32(&sim.DuplicateNext, 1, 0) {
-			go sim.sendWithLatency(ch, pack2, sim.Latency)
+			sim.schedule(ch, pack2, lat)
+		}
+
+		if sim.DuplicateProb > 0 && cryptoProb() < sim.DuplicateProb {
+			atomic.AddInt64(&sim.Duplicated, 1)
+			dup := *pack2
+			jitter := time.Millisecond + time.Duration(cryptoProb()*float64(9*time.Millisecond))
+			sim.schedule(ch, &dup, lat+jitter)
+		}
+
+	}
+	return nil
+}
+
+// corrupt flips CorruptBytes distinct bytes of
+// pack.Data. It works on a copy of Data, since
+// the sender still holds the original for retries.
+func (sim *SimNet) corrupt(pack *Packet) {
+	n := sim.CorruptBytes
+	if n < 1 {
+		n = 1
+	}
+	if n > len(pack.Data) {
+		n = len(pack.Data)
+	}
+	data := make([]byte, len(pack.Data))
+	copy(data, pack.Data)
+	idx := make([]int, len(data))
+	for i := range idx {
+		idx[i] = i
+	}
+	// the first n of a shuffle, so that any byte,
+	// the last too, may be picked, and none twice.
+	for i := 0; i < n; i++ {
+		j := i + int(cryptoProb()*float64(len(idx)-i))
+		if j >= len(idx) {
+			j = len(idx) - 1
 		}
+		idx[i], idx[j] = idx[j], idx[i]
+		data[idx[i]] ^= 0xff
+	}
+	pack.Data = data
+}
 
+// SendBatch sends each of packs in turn, just as Send would.
+func (sim *SimNet) SendBatch(packs []*Packet, why string) error {
+	for _, pack := range packs {
+		err := sim.Send(pack, why)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// ErrNoSuchInbox is returned by InjectPacket for
+// an inbox that no one Listens on.
+var ErrNoSuchInbox = fmt.Errorf("swp: no such SimNet inbox")
+
+// ErrInjectTimeout is returned by InjectPacket when
+// the inbox doesn't take the packet within InjectTimeout.
+var ErrInjectTimeout = fmt.Errorf("swp: SimNet inbox did not take the injected packet")
+
+// InjectTimeout bounds InjectPacket's wait on the inbox.
+const InjectTimeout = time.Second
+
+// InjectPacket hands a copy of pack straight to inbox, as
+// if it had just arrived, for tests that need a packet
+// that Send would never make: an impossible SeqNum, say,
+// or an ack advertising a zero window. It skips loss,
+// latency, sniffing, and the counts; the packet is
+// traced as "injected". The caller fills in From and the
+// session nonces the receiver expects.
+func (sim *SimNet) InjectPacket(inbox string, pack *Packet) error {
+	cp := *pack
+	sim.mapMut.Lock()
+	ch, ok := sim.Net[inbox]
+	if ok {
+		sim.traceLocked(&cp, "injected")
+	}
+	sim.mapMut.Unlock()
+	if !ok {
+		return ErrNoSuchInbox
+	}
+	select {
+	case ch <- &cp:
+		return nil
+	case <-time.After(InjectTimeout):
+		return ErrInjectTimeout
+	}
+}
+
 // helper for Send
 func (sim *SimNet) sendWithLatency(ch chan *Packet, pack *Packet, lat time.Duration) {
 	<-time.After(lat)
 	//q("sim: packet %v, after latency %v, ready to deliver to node %v, trying...",
 	//	pack.SeqNum, lat, pack.Dest)
+	sim.deliver(ch, pack)
+}
+
+// deliver hands pack to its receiver on ch, once
+// its latency has passed.
+func (sim *SimNet) deliver(ch chan *Packet, pack *Packet) {
 
 	//	sim.preCheckFlowControlNotViolated(pack)
 
+	sim.mapMut.Lock()
+	if tm, skewed := sim.nodeClock(pack.Dest, time.Now()); skewed {
+		pack.ArrivedAtDestTm = tm
+	}
+	sniff := sim.sniff[pack.Dest]
+	sim.mapMut.Unlock()
+
+	if sniff != nil {
+		cp := *pack
+		sniff(&cp)
+	}
+
+	// the receiver owns pack once we hand it over.
+	from, dest := pack.From, pack.Dest
 	ch <- pack
-	//p("sim: packet (SeqNum: %v) delivered to node %v", pack.SeqNum, pack.Dest)
+	//p("sim: packet (SeqNum: %v) delivered to node %v", pack.SeqNum, dest)
 
 	//	sim.postCheckFlowControlNotViolated(pack)
 
 	sim.mapMut.Lock()
-	sim.TotalRcvd[pack.Dest]++
+	sim.TotalRcvd[dest]++
+	sim.direction(from, dest).Rcvd++
+	sim.traceLocked(pack, "delivered")
 	sim.mapMut.Unlock()
 }
 
+// DirectionStats counts the packets sent one way,
+// From->Dest, over a SimNet.
+type DirectionStats struct {
+	Sent    int64
+	Rcvd    int64
+	Dropped int64
+}
+
+// direction returns the counts for from->dest,
+// making them if need be. Call with mapMut held.
+func (sim *SimNet) direction(from, dest string) *DirectionStats {
+	key := from + "->" + dest
+	d := sim.perDir[key]
+	if d == nil {
+		d = &DirectionStats{}
+		sim.perDir[key] = d
+	}
+	return d
+}
+
+// Stats returns a copy of the per-direction counts,
+// keyed by "From->Dest", such as "A->B". Dropped counts
+// simulated losses and filtering; a packet still in
+// flight is in Sent but not yet in Rcvd or Dropped.
+func (sim *SimNet) Stats() map[string]DirectionStats {
+	sim.mapMut.Lock()
+	defer sim.mapMut.Unlock()
+	return sim.statsLocked()
+}
+
+func (sim *SimNet) statsLocked() map[string]DirectionStats {
+	m := make(map[string]DirectionStats, len(sim.perDir))
+	for key, d := range sim.perDir {
+		m[key] = *d
+	}
+	return m
+}
+
 // resolution controls the floating point
 // resolution in the cryptoProb routine.
 const resolution = 1 << 20
@@ -195,6 +621,10 @@ type Sum struct {
 	tra              int64
 	tsb              int64
 	trb              int64
+
+	// PerDirection has the counts for each
+	// "From->Dest" pair; see SimNet.Stats.
+	PerDirection map[string]DirectionStats
 }
 
 // Summary summarizes the packet drops in a Sum report.
@@ -209,6 +639,7 @@ func (net *SimNet) Summary() *Sum {
 		tra:              net.TotalRcvd["A"],
 		tsb:              net.TotalSent["B"],
 		trb:              net.TotalRcvd["B"],
+		PerDirection:     net.statsLocked(),
 	}
 	return s
 }
@@ -240,6 +671,95 @@ func HistoryEqual(a, b []*Packet) bool {
 	return true
 }
 
+// Kinds of HistoryMismatch.
+const (
+	HistoryMissing    = "Missing"
+	HistoryExtra      = "Extra"
+	HistoryOutOfOrder = "OutOfOrder"
+	HistoryDuplicate  = "Duplicate"
+)
+
+// HistoryMismatch describes one disagreement
+// between a send and a recv history. SentSeq or
+// RcvdSeq is -1 when it doesn't apply.
+type HistoryMismatch struct {
+	// Index is into sent for Missing, and
+	// into rcvd for the other Kinds.
+	Index   int
+	SentSeq int64
+	RcvdSeq int64
+	Kind    string
+}
+
+// HistoryDiff lists how rcvd differs from sent, by SeqNum:
+// packets Missing from rcvd, Extra ones that were never
+// sent, Duplicate deliveries, and those received
+// OutOfOrder. An empty result means the histories agree.
+func HistoryDiff(sent, rcvd []*Packet) []HistoryMismatch {
+	var diffs []HistoryMismatch
+
+	isSent := make(map[int64]bool)
+	for _, pack := range sent {
+		isSent[pack.SeqNum] = true
+	}
+
+	// first sighting of each sent SeqNum in rcvd, in order.
+	seen := make(map[int64]bool)
+	var got []int64
+	var gotIndex []int
+	for i, pack := range rcvd {
+		seq := pack.SeqNum
+		switch {
+		case !isSent[seq]:
+			diffs = append(diffs, HistoryMismatch{Index: i, SentSeq: -1, RcvdSeq: seq, Kind: HistoryExtra})
+		case seen[seq]:
+			diffs = append(diffs, HistoryMismatch{Index: i, SentSeq: seq, RcvdSeq: seq, Kind: HistoryDuplicate})
+		default:
+			seen[seq] = true
+			got = append(got, seq)
+			gotIndex = append(gotIndex, i)
+		}
+	}
+
+	// what got should have been: sent, less anything missing.
+	var want []int64
+	for i, pack := range sent {
+		if !seen[pack.SeqNum] {
+			diffs = append(diffs, HistoryMismatch{Index: i, SentSeq: pack.SeqNum, RcvdSeq: -1, Kind: HistoryMissing})
+			continue
+		}
+		want = append(want, pack.SeqNum)
+	}
+	for j := range got {
+		if got[j] != want[j] {
+			diffs = append(diffs, HistoryMismatch{Index: gotIndex[j], SentSeq: want[j], RcvdSeq: got[j], Kind: HistoryOutOfOrder})
+		}
+	}
+	return diffs
+}
+
+// HistoryDiffString formats HistoryDiff(sent, rcvd)
+// compactly, one mismatch per line, for test failure
+// output. It returns "" when the histories agree.
+func HistoryDiffString(sent, rcvd []*Packet) string {
+	diffs := HistoryDiff(sent, rcvd)
+	if len(diffs) == 0 {
+		return ""
+	}
+	s := fmt.Sprintf("%v history mismatches (sent %v, rcvd %v):\n", len(diffs), len(sent), len(rcvd))
+	for _, d := range diffs {
+		switch d.Kind {
+		case HistoryMissing:
+			s += fmt.Sprintf("  %s: sent[%v] SeqNum %v\n", d.Kind, d.Index, d.SentSeq)
+		case HistoryExtra, HistoryDuplicate:
+			s += fmt.Sprintf("  %s: rcvd[%v] SeqNum %v\n", d.Kind, d.Index, d.RcvdSeq)
+		default:
+			s += fmt.Sprintf("  %s: rcvd[%v] SeqNum %v, expected %v\n", d.Kind, d.Index, d.RcvdSeq, d.SentSeq)
+		}
+	}
+	return s
+}
+
 func (net *SimNet) Flush() {
 
 }
@@ -0,0 +1,700 @@
+package swp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test075SimNetQueueDelayGrowsWithLoad(t *testing.T) {
+
+	cv.Convey("Given an M/D/1 queue serving 100 packets/sec, the mean wait should be rho/(2*mu*(1-rho)), growing sharply as utilization nears 100%.", t, func() {
+		cv.So(MD1Wait(0, 100), cv.ShouldEqual, 0)
+		cv.So(MD1Wait(50, 100), cv.ShouldEqual, 5*time.Millisecond)
+		cv.So(MD1Wait(90, 100), cv.ShouldAlmostEqual, 45*time.Millisecond, float64(time.Microsecond))
+		cv.So(MD1Wait(200, 100), cv.ShouldEqual, MD1Wait(99, 100))
+		cv.So(MD1Wait(99, 100), cv.ShouldBeGreaterThan, MD1Wait(90, 100))
+	})
+
+	cv.Convey("Given arrivals every 10 msec, the arrivalRate tracker should estimate 100 packets/sec.", t, func() {
+		var a arrivalRate
+		t0 := time.Now()
+		var rate float64
+		for i := 0; i < 20; i++ {
+			rate = a.add(t0.Add(time.Duration(i) * 10 * time.Millisecond))
+		}
+		cv.So(rate, cv.ShouldAlmostEqual, 100, 0.001)
+	})
+}
+
+func seqs(nums ...int64) []*Packet {
+	var packs []*Packet
+	for _, n := range nums {
+		packs = append(packs, &Packet{SeqNum: n})
+	}
+	return packs
+}
+
+func Test079HistoryDiffClassifiesMismatches(t *testing.T) {
+
+	cv.Convey("Given matching histories, HistoryDiff should be empty.", t, func() {
+		cv.So(HistoryDiff(seqs(0, 1, 2), seqs(0, 1, 2)), cv.ShouldBeEmpty)
+		cv.So(HistoryDiffString(seqs(0, 1, 2), seqs(0, 1, 2)), cv.ShouldEqual, "")
+	})
+
+	cv.Convey("Given a lost, an extra, a duplicate, and a swapped pair, HistoryDiff should report each one.", t, func() {
+		sent := seqs(0, 1, 2, 3, 4)
+		rcvd := seqs(0, 3, 2, 2, 9, 4)
+		diffs := HistoryDiff(sent, rcvd)
+		kinds := make(map[string][]HistoryMismatch)
+		for _, d := range diffs {
+			kinds[d.Kind] = append(kinds[d.Kind], d)
+		}
+		cv.So(kinds[HistoryMissing], cv.ShouldResemble, []HistoryMismatch{{Index: 1, SentSeq: 1, RcvdSeq: -1, Kind: HistoryMissing}})
+		cv.So(kinds[HistoryExtra], cv.ShouldResemble, []HistoryMismatch{{Index: 4, SentSeq: -1, RcvdSeq: 9, Kind: HistoryExtra}})
+		cv.So(kinds[HistoryDuplicate], cv.ShouldResemble, []HistoryMismatch{{Index: 3, SentSeq: 2, RcvdSeq: 2, Kind: HistoryDuplicate}})
+		cv.So(len(kinds[HistoryOutOfOrder]), cv.ShouldEqual, 2)
+		cv.So(HistoryDiffString(sent, rcvd), cv.ShouldContainSubstring, "5 history mismatches")
+	})
+}
+
+func Test082StochasticReorderingStillDeliversInOrder(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	net.ReorderProb = 0.3
+	net.MaxReorderDelay = 10 * time.Millisecond
+	rtt := 2 * lat
+
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithTimeout(rtt))
+	panicOn(err)
+
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	n := 30
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("data"), TcpEvent: EventData})
+	}
+	time.Sleep(time.Second)
+
+	cleanup()
+
+	cv.Convey("Given a ReorderProb of 0.3, some packets should be reordered in flight, yet B should still deliver all of them in order.", t, func() {
+		cv.So(atomic.LoadInt64(&net.Reordered), cv.ShouldBeGreaterThan, 0)
+		cv.So(HistoryDiffString(A.Swp.Sender.SendHistory, B.Swp.Recver.RecvHistory), cv.ShouldEqual, "")
+	})
+}
+
+func Test089SimNetClockSkewStampsArrivals(t *testing.T) {
+
+	cv.Convey("Given SimNet ClockDriftRatePerNode, a node's clock should drift linearly from ours, on top of any ClockSkewPerNode.", t, func() {
+		sim := NewSimNet(0, time.Millisecond)
+		_, skewed := sim.nodeClock("A", time.Now())
+		cv.So(skewed, cv.ShouldBeFalse)
+
+		sim.ClockSkewPerNode["A"] = time.Second
+		sim.ClockDriftRatePerNode["A"] = 0.5
+		now := sim.start.Add(10 * time.Second)
+		tm, skewed := sim.nodeClock("A", now)
+		cv.So(skewed, cv.ShouldBeTrue)
+		cv.So(tm.Sub(now), cv.ShouldEqual, 6*time.Second)
+
+		cl := sim.Clone()
+		cv.So(cl.ClockSkewPerNode["A"], cv.ShouldEqual, time.Second)
+		cv.So(cl.ClockDriftRatePerNode["A"], cv.ShouldEqual, 0.5)
+	})
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	net.ClockSkewPerNode["B"] = time.Hour
+	rtt := 2 * lat
+
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithTimeout(rtt))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	n := 10
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("skewed"), TcpEvent: EventData})
+	}
+	time.Sleep(100 * time.Millisecond)
+	cleanup()
+
+	cv.Convey("Given SimNet ClockSkewPerNode for B of an hour, B's arrival stamps should be an hour ahead, while the data still gets through.", t, func() {
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, n)
+		for _, pack := range B.Swp.Recver.RecvHistory {
+			ahead := pack.ArrivedAtDestTm.Sub(time.Now())
+			cv.So(ahead, cv.ShouldBeGreaterThan, 59*time.Minute)
+			cv.So(ahead, cv.ShouldBeLessThan, time.Hour)
+		}
+	})
+}
+
+func Test092SimNetPerDirectionStats(t *testing.T) {
+
+	net := NewSimNet(0, time.Millisecond)
+	net.DiscardOnce = 0
+	for _, node := range []string{"A", "B", "C"} {
+		ch, err := net.Listen(node)
+		panicOn(err)
+		go func() {
+			for range ch {
+			}
+		}()
+	}
+
+	send := func(from, dest string, seqno int64) {
+		panicOn(net.Send(&Packet{From: from, Dest: dest, SeqNum: seqno, TcpEvent: EventData}, "test"))
+	}
+	for i := int64(1); i <= 3; i++ {
+		send("A", "B", i)
+	}
+	send("B", "C", 1)
+	send("B", "C", 2)
+	send("C", "A", 0) // lost to DiscardOnce
+	send("C", "A", 0)
+	time.Sleep(50 * time.Millisecond)
+
+	stats := net.Stats()
+	smy := net.Summary()
+
+	cv.Convey("Given three nodes on one SimNet, Stats and Summary should break the counts down by From->Dest direction.", t, func() {
+		cv.So(len(stats), cv.ShouldEqual, 3)
+		cv.So(stats["A->B"], cv.ShouldResemble, DirectionStats{Sent: 3, Rcvd: 3})
+		cv.So(stats["B->C"], cv.ShouldResemble, DirectionStats{Sent: 2, Rcvd: 2})
+		cv.So(stats["C->A"], cv.ShouldResemble, DirectionStats{Sent: 2, Rcvd: 1, Dropped: 1})
+		cv.So(smy.PerDirection, cv.ShouldResemble, stats)
+	})
+}
+
+func Test094SimNetDuplicateProb(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	net.DuplicateProb = 0.5
+	rtt := 2 * lat
+
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithTimeout(rtt))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	n := 50
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+	}
+	time.Sleep(300 * time.Millisecond)
+	cleanup()
+
+	cv.Convey("Given a SimNet that duplicates half of all packets, the receiver should still deliver each packet exactly once, in order.", t, func() {
+		cv.So(atomic.LoadInt64(&net.Duplicated), cv.ShouldBeGreaterThan, 0)
+		cv.So(HistoryDiff(A.Swp.Sender.SendHistory, B.Swp.Recver.RecvHistory), cv.ShouldBeEmpty)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, n)
+		for i, pack := range B.Swp.Recver.RecvHistory {
+			cv.So(string(pack.Data), cv.ShouldEqual, fmt.Sprintf("%v", i))
+		}
+		cv.So(net.Clone().DuplicateProb, cv.ShouldEqual, 0.5)
+	})
+}
+
+func Test097SimNetCorruptProbCaughtByChecksum(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	net.CorruptProb = 0.2
+	net.CorruptBytes = 3
+	rtt := 2 * lat
+
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithTimeout(rtt))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	n := 50
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("packet number %v", i)), TcpEvent: EventData})
+	}
+	// corrupted packets back off the retry timer, so
+	// give the last of them time to get through.
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if A.Swp.Sender.LargestAckedSeqno() == int64(n-1) {
+			break
+		}
+	}
+	cleanup()
+
+	cv.Convey("Given a SimNet that corrupts 20% of packets, the receiver's checksum should catch every corrupted packet, and retries should still deliver each packet intact and in order.", t, func() {
+		corrupted := atomic.LoadInt64(&net.Corrupted)
+		cv.So(corrupted, cv.ShouldBeGreaterThan, 0)
+		cv.So(atomic.LoadInt64(&B.Swp.Recver.CorruptedCount), cv.ShouldEqual, corrupted)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, n)
+		for i, pack := range B.Swp.Recver.RecvHistory {
+			cv.So(string(pack.Data), cv.ShouldEqual, fmt.Sprintf("packet number %v", i))
+		}
+	})
+}
+
+func Test110SimNetMultiHopPaths(t *testing.T) {
+
+	net := NewSimNet(0, time.Millisecond)
+	// two hops, slow...
+	net.AddHop("A", "R1", 5*time.Millisecond, 0)
+	net.AddHop("R1", "B", 10*time.Millisecond, 0)
+	// ...beats three, fast.
+	net.AddHop("A", "X", time.Millisecond, 0)
+	net.AddHop("X", "Y", time.Millisecond, 0)
+	net.AddHop("Y", "B", time.Millisecond, 0)
+	// a lossy path, 0.5 per hop.
+	net.AddHop("A", "R2", 0, 0.5)
+	net.AddHop("R2", "C", 0, 0.5)
+
+	panicOn(net.SetHopCaps("A", "R1", 1000, 10))
+	panicOn(net.SetHopCaps("R1", "B", 500, 20))
+	panicOn(net.SetHopCaps("A", "X", 100, 5))
+	noHop := net.SetHopCaps("B", "A", 1, 1)
+
+	chB, err := net.Listen("B")
+	panicOn(err)
+	chC, err := net.Listen("C")
+	panicOn(err)
+	chA, err := net.Listen("A")
+	panicOn(err)
+
+	t0 := time.Now()
+	panicOn(net.Send(&Packet{From: "A", Dest: "B"}, "test"))
+	<-chB
+	pathLat := time.Since(t0)
+
+	// B->A has no hops, so uses the flat Latency.
+	t0 = time.Now()
+	panicOn(net.Send(&Packet{From: "B", Dest: "A"}, "test"))
+	<-chA
+	flatLat := time.Since(t0)
+
+	n := 2000
+	for i := 0; i < n; i++ {
+		panicOn(net.Send(&Packet{From: "A", Dest: "C", SeqNum: int64(i)}, "test"))
+	}
+	got := 0
+	for timeout := time.After(time.Second); ; {
+		select {
+		case <-chC:
+			got++
+			continue
+		case <-timeout:
+		}
+		break
+	}
+	keep := float64(got) / float64(n)
+
+	bytecap, msgcap := net.PathBufferCaps("A", "B")
+	allBytes, allMsgs := net.BufferCaps()
+	noBytes, noMsgs := net.PathBufferCaps("A", "C")
+
+	cv.Convey("Given SimNet hops, a packet should take the path of fewest hops and see the sum of their latencies, each hop should lose packets independently, and the buffer caps should be those of the smallest link.", t, func() {
+		cv.So(pathLat, cv.ShouldBeGreaterThanOrEqualTo, 15*time.Millisecond)
+		cv.So(pathLat, cv.ShouldBeLessThan, 100*time.Millisecond)
+		cv.So(flatLat, cv.ShouldBeLessThan, pathLat)
+		cv.So(keep, cv.ShouldBeGreaterThan, 0.2)
+		cv.So(keep, cv.ShouldBeLessThan, 0.3)
+		cv.So(bytecap, cv.ShouldEqual, 500)
+		cv.So(msgcap, cv.ShouldEqual, 10)
+		cv.So(allBytes, cv.ShouldEqual, 100)
+		cv.So(allMsgs, cv.ShouldEqual, 5)
+		cv.So(noBytes, cv.ShouldEqual, -1)
+		cv.So(noMsgs, cv.ShouldEqual, -1)
+		cv.So(noHop, cv.ShouldEqual, ErrNoSuchHop)
+	})
+}
+
+func Test113SimNetTimeTravel(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := 10 * time.Second
+	net := NewSimNet(lossProb, lat)
+	simClk := &SimClock{}
+	simClk.Set(time.Now())
+	net.UseSimClock(simClk)
+	rtt := 2 * time.Millisecond
+
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithTimeout(rtt), func(cfg *SessionConfig) { cfg.Clk = simClk })
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	n := 5
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+	}
+	time.Sleep(50 * time.Millisecond)
+	pending := net.PendingArrivals()
+	early := net.TimeTravel(9 * time.Second)
+	deliveredEarly := atomic.LoadInt64(&B.Swp.Recver.CumulBytesDelivered)
+
+	start := time.Now()
+	due := net.TimeTravel(time.Second)
+	for i := 0; i < 100 && A.Swp.Sender.LargestAckedSeqno() < int64(n-1); i++ {
+		time.Sleep(10 * time.Millisecond)
+		net.TimeTravel(lat)
+	}
+	elapsed := time.Since(start)
+	acked := A.Swp.Sender.LargestAckedSeqno()
+
+	cleanup()
+
+	cv.Convey("Given a SimNet on a SimClock with a 10 second Latency, nothing should arrive until TimeTravel moves the clock 10 seconds on, and then the transfer should complete in well under a second of real time.", t, func() {
+		cv.So(pending, cv.ShouldBeGreaterThanOrEqualTo, n)
+		cv.So(early, cv.ShouldEqual, 0)
+		cv.So(deliveredEarly, cv.ShouldEqual, 0)
+		cv.So(due, cv.ShouldBeGreaterThanOrEqualTo, n)
+		cv.So(acked, cv.ShouldEqual, n-1)
+		cv.So(elapsed, cv.ShouldBeLessThan, time.Second)
+		cv.So(atomic.LoadInt64(&B.Swp.Recver.CumulBytesDelivered), cv.ShouldEqual, n)
+	})
+}
+
+func Test115SimNetTraceLines(t *testing.T) {
+
+	net := NewSimNet(0, time.Second)
+	simClk := &SimClock{}
+	simClk.Set(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	net.UseSimClock(simClk)
+	var buf bytes.Buffer
+	net.EnableTrace(&buf)
+	net.DiscardOnce = 0
+
+	ch, err := net.Listen("B")
+	panicOn(err)
+	go func() {
+		for range ch {
+		}
+	}()
+
+	panicOn(net.Send(&Packet{From: "A", Dest: "B", SeqNum: 0, AckNum: -1, Data: []byte("lost"), TcpEvent: EventData}, "data"))
+	panicOn(net.Send(&Packet{From: "A", Dest: "B", SeqNum: 5, AckNum: 3, Data: make([]byte, 100), TcpEvent: EventData}, "data"))
+	panicOn(net.Send(&Packet{From: "A", Dest: "B", SeqNum: -1, AckNum: 4, TcpEvent: EventDataAck}, "ack"))
+	net.TimeTravel(time.Second)
+
+	want := []string{
+		"2024-01-01T00:00:00.000 A→B seq=0 ack=-1 len=4 [sent]",
+		"2024-01-01T00:00:00.000 A→B seq=0 ack=-1 len=4 [discard:DiscardOnce]",
+		"2024-01-01T00:00:00.000 A→B seq=5 ack=3 len=100 [sent]",
+		"2024-01-01T00:00:00.000 A→B seq=-1 ack=4 len=0 ackonly [sent]",
+		"2024-01-01T00:00:01.000 A→B seq=5 ack=3 len=100 [delivered]",
+		"2024-01-01T00:00:01.000 A→B seq=-1 ack=4 len=0 ackonly [delivered]",
+	}
+	got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+	cv.Convey("Given EnableTrace on a SimNet, each send, discard, and delivery should get one tcpdump style line, stamped with the SimClock.", t, func() {
+		cv.So(got, cv.ShouldResemble, want)
+	})
+}
+
+func Test130SniffSeesRetryOfLostPacket(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	net := A.Net.(*SimNet)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	var mut sync.Mutex
+	retries := make(map[int64]int64)
+	var sniffer Sniffable = net
+	sniffer.Sniff("B", func(pack *Packet) {
+		if pack.TcpEvent != EventData {
+			return
+		}
+		mut.Lock()
+		retries[pack.SeqNum] = pack.SeqRetry
+		mut.Unlock()
+	})
+
+	// lose SeqNum 0 once.
+	net.mapMut.Lock()
+	net.DiscardOnce = 0
+	net.mapMut.Unlock()
+
+	n := 3
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+	}
+	for i := 0; i < 100 && A.Swp.Sender.LargestAckedSeqno() < int64(n-1); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	net.ClearSniff("B")
+	mut.Lock()
+	seen := len(retries)
+	mut.Unlock()
+	A.Push(&Packet{From: "A", Dest: "B", Data: []byte("after"), TcpEvent: EventData})
+	time.Sleep(50 * time.Millisecond)
+
+	cleanup()
+
+	mut.Lock()
+	defer mut.Unlock()
+	cv.Convey("Given SeqNum 0 lost once, a Sniff of B should see it arrive with SeqRetry > 0; after ClearSniff it should see nothing more.", t, func() {
+		cv.So(seen, cv.ShouldEqual, n)
+		cv.So(retries[0], cv.ShouldBeGreaterThan, 0)
+		cv.So(len(retries), cv.ShouldEqual, n)
+	})
+}
+
+// writeTestPCAP writes a little-endian, microsecond
+// libpcap capture of raw IPv4 TCP segments, one per
+// seq, each carrying 100 bytes, at times ats.
+func writeTestPCAP(path string, seqs []uint32, ats []time.Duration) {
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	hdr := make([]byte, 24)
+	le.PutUint32(hdr[0:4], 0xa1b2c3d4)
+	le.PutUint16(hdr[4:6], 2)
+	le.PutUint16(hdr[6:8], 4)
+	le.PutUint32(hdr[16:20], 65535)
+	le.PutUint32(hdr[20:24], pcapLinkRaw)
+	buf.Write(hdr)
+	for i, seq := range seqs {
+		ip := make([]byte, 20+20+100)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:4], uint16(len(ip)))
+		ip[9] = 6
+		copy(ip[12:20], []byte{10, 0, 0, 1, 10, 0, 0, 2})
+		tcp := ip[20:]
+		binary.BigEndian.PutUint16(tcp[0:2], 1234)
+		binary.BigEndian.PutUint16(tcp[2:4], 80)
+		binary.BigEndian.PutUint32(tcp[4:8], seq)
+		tcp[12] = 5 << 4
+		rec := make([]byte, 16)
+		le.PutUint32(rec[0:4], uint32(ats[i]/time.Second))
+		le.PutUint32(rec[4:8], uint32(ats[i]%time.Second/time.Microsecond))
+		le.PutUint32(rec[8:12], uint32(len(ip)))
+		le.PutUint32(rec[12:16], uint32(len(ip)))
+		buf.Write(rec)
+		buf.Write(ip)
+	}
+	panicOn(ioutil.WriteFile(path, buf.Bytes(), 0600))
+}
+
+func Test135ReplayPCAPFollowsCapturedTimingAndLoss(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "swp-pcap")
+	panicOn(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "trace.pcap")
+	// the segment at seq 200 was lost.
+	writeTestPCAP(path, []uint32{0, 100, 300}, []time.Duration{0, 20 * time.Millisecond, 50 * time.Millisecond})
+	bogus := filepath.Join(dir, "bogus.pcap")
+	panicOn(ioutil.WriteFile(bogus, []byte("not a capture"), 0600))
+
+	net := NewSimNet(0, time.Millisecond)
+	errReplay := net.ReplayPCAP(path)
+	errBogus := net.ReplayPCAP(bogus)
+	ch, err := net.Listen("B")
+	panicOn(err)
+
+	var took []time.Duration
+	var got []int64
+	for i := int64(0); i < 5; i++ {
+		t0 := time.Now()
+		panicOn(net.Send(&Packet{From: "A", Dest: "B", SeqNum: i, TcpEvent: EventData}, "test"))
+		select {
+		case pack := <-ch:
+			got = append(got, pack.SeqNum)
+			took = append(took, time.Since(t0))
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+
+	cv.Convey("Given a capture with a 20ms then a 30ms gap, and a TCP sequence gap before its last segment, ReplayPCAP should deliver the first packet at once, the second after 20ms, lose the third, delay the fourth 30ms, then go back to Latency; and refuse a file that is no capture.", t, func() {
+		cv.So(errReplay, cv.ShouldBeNil)
+		cv.So(errBogus, cv.ShouldEqual, ErrPCAPFormat)
+		cv.So(got, cv.ShouldResemble, []int64{0, 1, 3, 4})
+		cv.So(took[0], cv.ShouldBeLessThan, 15*time.Millisecond)
+		cv.So(took[1], cv.ShouldBeGreaterThanOrEqualTo, 20*time.Millisecond)
+		cv.So(took[2], cv.ShouldBeGreaterThanOrEqualTo, 30*time.Millisecond)
+		cv.So(took[3], cv.ShouldBeLessThan, 15*time.Millisecond)
+	})
+}
+
+func Test140DiscardRangeLosesABurstThatIsRetried(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	defer cleanup()
+	net := A.Net.(*SimNet)
+	net.DiscardRange(2, 6)
+	A.SelfConsumeForTesting()
+
+	n := 10
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+	}
+	var got []int64
+	var data []string
+	for len(got) < n {
+		seq, err := B.ReadTimeout(5 * time.Second)
+		if err != nil {
+			break
+		}
+		for _, pack := range seq.Seq {
+			got = append(got, pack.SeqNum)
+			data = append(data, string(pack.Data))
+		}
+	}
+	net.mapMut.Lock()
+	left := len(net.DiscardList)
+	net.mapMut.Unlock()
+
+	cv.Convey("Given DiscardRange(2, 6), the first sends of five consecutive packets should be lost, and all be retried and delivered in order.", t, func() {
+		cv.So(left, cv.ShouldEqual, 0)
+		cv.So(got, cv.ShouldResemble, []int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+		cv.So(data, cv.ShouldResemble, []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"})
+	})
+}
+
+func Test145GroupDelaySharesABottleneck(t *testing.T) {
+
+	// charge the bucket directly first.
+	sim := NewSimNet(0, time.Millisecond)
+	sim.GroupDelay([]string{"A", "B"}, 5*time.Millisecond, 1000000)
+	pack := &Packet{From: "A", Dest: "B", Data: make([]byte, 1000)}
+	other := &Packet{From: "A", Dest: "X", Data: make([]byte, 1000)}
+	sim.mapMut.Lock()
+	first := sim.groupDelay(pack)
+	var last time.Duration
+	for i := 0; i < 20; i++ {
+		last = sim.groupDelay(pack)
+	}
+	outside := sim.groupDelay(other)
+	sim.mapMut.Unlock()
+
+	// two transfers at once over one shared link.
+	lat := time.Millisecond
+	net := NewSimNet(0, lat)
+	net.GroupDelay([]string{"A", "B", "C", "D"}, lat, 100000)
+	pipe := func(a, b string) (*Session, *Session) {
+		// stopped below.
+		A, B, _, err := SwpPipe(WithInboxes(a, b), WithNet(net), WithTimeout(20*lat))
+		panicOn(err)
+		A.SelfConsumeForTesting()
+		B.SelfConsumeForTesting()
+		return A, B
+	}
+	A, B := pipe("A", "B")
+	defer B.Stop()
+	defer A.Stop()
+	C, D := pipe("C", "D")
+	defer D.Stop()
+	defer C.Stop()
+
+	n := 20
+	t0 := time.Now()
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: make([]byte, 1000), TcpEvent: EventData})
+		C.Push(&Packet{From: "C", Dest: "D", Data: make([]byte, 1000), TcpEvent: EventData})
+	}
+	for i := 0; i < 500 && (A.Swp.Sender.LargestAckedSeqno() < int64(n-1) ||
+		C.Swp.Sender.LargestAckedSeqno() < int64(n-1)); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	elap := time.Since(t0)
+
+	// 2*n*1000 bytes can't cross at 100 KB/sec in
+	// under 400 msec, less the one burst.
+	cv.Convey("Given GroupDelay, packets among the group should queue for the shared link once its burst is used up, and two transfers across it should finish no faster than its rate allows.", t, func() {
+		cv.So(first, cv.ShouldEqual, 5*time.Millisecond)
+		cv.So(last, cv.ShouldBeGreaterThan, 5*time.Millisecond+10*time.Millisecond)
+		cv.So(outside, cv.ShouldEqual, 0)
+		cv.So(A.Swp.Sender.LargestAckedSeqno(), cv.ShouldEqual, n-1)
+		cv.So(C.Swp.Sender.LargestAckedSeqno(), cv.ShouldEqual, n-1)
+		cv.So(elap, cv.ShouldBeGreaterThan, 350*time.Millisecond)
+	})
+}
+
+func Test147InjectPacketReachesTheInbox(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+	net := A.Net.(*SimNet)
+	var trace bytes.Buffer
+	net.EnableTrace(&trace)
+
+	// an ack of data A never sent.
+	ack := &Packet{
+		From:          "B",
+		Dest:          "A",
+		FromSessNonce: B.LocalSessNonce,
+		DestSessNonce: A.LocalSessNonce,
+		SeqNum:        -99,
+		AckNum:        1000,
+		TcpEvent:      EventDataAck,
+		Version:       ProtocolVersion,
+	}
+	errInject := net.InjectPacket("A", ack)
+	for i := 0; i < 100 && atomic.LoadInt64(&A.Swp.Recver.SpoofedAckCount) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	net.EnableTrace(nil)
+	errNoInbox := net.InjectPacket("nobody", ack)
+
+	cv.Convey("Given InjectPacket, a packet Send would never make should reach the inbox directly, and be traced; an inbox no one listens on is an error.", t, func() {
+		cv.So(errInject, cv.ShouldBeNil)
+		cv.So(atomic.LoadInt64(&A.Swp.Recver.SpoofedAckCount), cv.ShouldEqual, 1)
+		cv.So(A.Swp.Sender.LargestAckedSeqno(), cv.ShouldEqual, -1)
+		cv.So(trace.String(), cv.ShouldContainSubstring, "B→A seq=-99 ack=1000 len=0 ackonly [injected]")
+		cv.So(errNoInbox, cv.ShouldEqual, ErrNoSuchInbox)
+	})
+}
+
+func Test165SimNetCorruptCanPickEveryByte(t *testing.T) {
+
+	net := NewSimNet(0, time.Millisecond)
+	flip := func(data string, n int) []byte {
+		net.CorruptBytes = n
+		pack := &Packet{Data: []byte(data)}
+		net.corrupt(pack)
+		return pack.Data
+	}
+	inverse := func(data string) []byte {
+		b := []byte(data)
+		for i := range b {
+			b[i] ^= 0xff
+		}
+		return b
+	}
+
+	all := flip("abcdef", 6)
+	over := flip("abc", 10)
+	one := flip("x", 1)
+	lastPicked := false
+	for i := 0; i < 200 && !lastPicked; i++ {
+		lastPicked = flip("ab", 1)[1] != 'b'
+	}
+
+	cv.Convey("Given CorruptBytes of len(Data) or more, SimNet.corrupt should flip every byte, a 1-byte payload included, and return; and any byte, the last too, may be picked.", t, func() {
+		cv.So(all, cv.ShouldResemble, inverse("abcdef"))
+		cv.So(over, cv.ShouldResemble, inverse("abc"))
+		cv.So(one, cv.ShouldResemble, inverse("x"))
+		cv.So(lastPicked, cv.ShouldBeTrue)
+	})
+}
@@ -0,0 +1,189 @@
+package swp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// PCAP replay.
+//
+// ReplayPCAP has a SimNet follow a captured network
+// trace, a libpcap file, in place of its Latency and
+// LossProb. Each packet sent takes the next step of the
+// trace: it is delayed by the interarrival time of the
+// next captured packet, or lost, where the capture shows
+// a TCP sequence gap. Once the trace is used up, Latency
+// and LossProb (or hops) apply again.
+//
+// We read the classic libpcap format, with microsecond
+// or nanosecond timestamps in either byte order, and
+// Ethernet or raw IPv4 link types, ourselves rather than
+// depend on gopacket. Packets we can't parse give their
+// timing only. pcapng is not supported.
+
+// ErrPCAPFormat is returned by ReplayPCAP for
+// a file it can't read as a libpcap capture.
+var ErrPCAPFormat = fmt.Errorf("swp: not a libpcap capture file")
+
+// replayStep is the fate of one packet sent.
+type replayStep struct {
+	delay time.Duration
+	lost  bool
+}
+
+// libpcap link types we parse.
+const (
+	pcapLinkEthernet = 1
+	pcapLinkRaw      = 101
+	pcapLinkIPv4     = 228
+)
+
+// pcapMaxSnapLen bounds a captured frame, as tcpdump does.
+const pcapMaxSnapLen = 262144
+
+// ReplayPCAP loads the capture in pcapFile, replacing
+// any trace being replayed.
+func (sim *SimNet) ReplayPCAP(pcapFile string) error {
+	f, err := os.Open(pcapFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	steps, err := readPCAP(f)
+	if err != nil {
+		return err
+	}
+	sim.mapMut.Lock()
+	sim.replay = steps
+	sim.mapMut.Unlock()
+	return nil
+}
+
+// nextReplay takes the next step of the trace, if
+// any remain. Call with mapMut held.
+func (sim *SimNet) nextReplay() (step replayStep, ok bool) {
+	if len(sim.replay) == 0 {
+		return step, false
+	}
+	step = sim.replay[0]
+	sim.replay = sim.replay[1:]
+	return step, true
+}
+
+// readPCAP turns a capture into replay steps.
+func readPCAP(r io.Reader) ([]replayStep, error) {
+	var hdr [24]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, ErrPCAPFormat
+	}
+	var order binary.ByteOrder
+	var nano bool
+	switch {
+	case binary.LittleEndian.Uint32(hdr[:4]) == 0xa1b2c3d4:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr[:4]) == 0xa1b2c3d4:
+		order = binary.BigEndian
+	case binary.LittleEndian.Uint32(hdr[:4]) == 0xa1b23c4d:
+		order, nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(hdr[:4]) == 0xa1b23c4d:
+		order, nano = binary.BigEndian, true
+	default:
+		return nil, ErrPCAPFormat
+	}
+	link := order.Uint32(hdr[20:24])
+
+	var steps []replayStep
+	var last time.Time
+	flows := make(map[string]uint32)
+	var rec [16]byte
+	for {
+		_, err := io.ReadFull(r, rec[:])
+		if err == io.EOF {
+			return steps, nil
+		}
+		if err != nil {
+			return nil, ErrPCAPFormat
+		}
+		frac := time.Duration(order.Uint32(rec[4:8]))
+		if !nano {
+			frac *= time.Microsecond
+		}
+		tm := time.Unix(int64(order.Uint32(rec[:4])), int64(frac))
+		n := order.Uint32(rec[8:12])
+		if n > pcapMaxSnapLen {
+			return nil, ErrPCAPFormat
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, ErrPCAPFormat
+		}
+
+		if pcapGap(link, data, flows) {
+			steps = append(steps, replayStep{lost: true})
+		}
+		var delay time.Duration
+		if !last.IsZero() {
+			delay = tm.Sub(last)
+		}
+		last = tm
+		steps = append(steps, replayStep{delay: delay})
+	}
+}
+
+// pcapGap reports whether the captured frame is a TCP
+// segment past the next sequence number its flow
+// expected, so one or more were lost before it.
+// flows holds each flow's next expected sequence number.
+func pcapGap(link uint32, frame []byte, flows map[string]uint32) bool {
+	ip := frame
+	switch link {
+	case pcapLinkEthernet:
+		if len(frame) < 14 {
+			return false
+		}
+		etype := binary.BigEndian.Uint16(frame[12:14])
+		ip = frame[14:]
+		if etype == 0x8100 && len(frame) >= 18 {
+			// 802.1Q VLAN tag.
+			etype = binary.BigEndian.Uint16(frame[16:18])
+			ip = frame[18:]
+		}
+		if etype != 0x0800 {
+			return false
+		}
+	case pcapLinkRaw, pcapLinkIPv4:
+	default:
+		return false
+	}
+	if len(ip) < 20 || ip[0]>>4 != 4 || ip[9] != 6 {
+		// not IPv4 TCP.
+		return false
+	}
+	ihl := int(ip[0]&0x0f) * 4
+	total := int(binary.BigEndian.Uint16(ip[2:4]))
+	if ihl < 20 || total < ihl+20 || len(ip) < ihl+20 {
+		return false
+	}
+	tcp := ip[ihl:]
+	seq := binary.BigEndian.Uint32(tcp[4:8])
+	off := int(tcp[12]>>4) * 4
+	if off < 20 || ihl+off > total {
+		return false
+	}
+	flags := tcp[13]
+	n := uint32(total - ihl - off)
+	if flags&0x03 != 0 {
+		// SYN or FIN takes a sequence number.
+		n++
+	}
+	flow := string(ip[12:20]) + string(tcp[:4])
+	next, seen := flows[flow]
+	gap := seen && int32(seq-next) > 0
+	if !seen || int32(seq+n-next) > 0 {
+		flows[flow] = seq + n
+	}
+	return gap
+}
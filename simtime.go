@@ -0,0 +1,118 @@
+package swp
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Simulated time.
+//
+// By default a SimNet delays each packet with a real
+// timer, so a test with a 30 second Latency takes 30
+// seconds. After UseSimClock, nothing arrives on its own:
+// each packet sent is given an arrival time on the
+// SimClock and waits in a heap, and TimeTravel moves the
+// clock forward and hands over every packet then due, in
+// arrival order. Give the sessions the same SimClock, and
+// their retry deadlines move with it too.
+//
+// The sendloop's and recvloop's own wakeups, from
+// Timeout/2 and KeepAliveInterval, still use real timers.
+// A session that hears nothing for KeepAliveInterval times
+// NumFailedKeepAlivesBeforeClosing of SimClock time closes,
+// so travel in steps shorter than that. TimeTravel blocks
+// until each receiver takes its packet, so don't travel
+// once a receiver has stopped.
+
+// simArrival is a packet waiting in the heap for its
+// arrival time. n breaks ties in the order sent.
+type simArrival struct {
+	at   time.Time
+	n    int64
+	ch   chan *Packet
+	pack *Packet
+}
+
+// simArrivals is a min-heap of simArrival, by at then n.
+type simArrivals []*simArrival
+
+func (h simArrivals) Len() int { return len(h) }
+func (h simArrivals) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].n < h[j].n
+	}
+	return h[i].at.Before(h[j].at)
+}
+func (h simArrivals) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *simArrivals) Push(x interface{}) { *h = append(*h, x.(*simArrival)) }
+func (h *simArrivals) Pop() interface{} {
+	old := *h
+	a := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return a
+}
+
+// UseSimClock makes sim schedule packets on clk, to
+// be delivered by TimeTravel, rather than on real timers.
+// Call it before sending.
+func (sim *SimNet) UseSimClock(clk *SimClock) {
+	sim.mapMut.Lock()
+	sim.clk = clk
+	sim.mapMut.Unlock()
+}
+
+// TimeTravel advances the SimClock given to UseSimClock
+// by delta, and delivers every packet whose arrival time
+// is now past, oldest first. It returns once each has been
+// taken by its receiver, with the number delivered.
+// Packets sent during delivery that are due at once are
+// delivered too.
+func (sim *SimNet) TimeTravel(delta time.Duration) int {
+	sim.mapMut.Lock()
+	clk := sim.clk
+	sim.mapMut.Unlock()
+	if clk == nil {
+		panic("SimNet.TimeTravel called without UseSimClock")
+	}
+	now := clk.Advance(delta)
+
+	n := 0
+	for {
+		sim.mapMut.Lock()
+		if len(sim.scheduled) == 0 || sim.scheduled[0].at.After(now) {
+			sim.mapMut.Unlock()
+			return n
+		}
+		a := heap.Pop(&sim.scheduled).(*simArrival)
+		sim.mapMut.Unlock()
+
+		sim.deliver(a.ch, a.pack)
+		n++
+	}
+}
+
+// PendingArrivals returns the number of packets waiting
+// for a TimeTravel.
+func (sim *SimNet) PendingArrivals() int {
+	sim.mapMut.Lock()
+	defer sim.mapMut.Unlock()
+	return len(sim.scheduled)
+}
+
+// schedule has pack arrive on ch after lat: on a real
+// timer, or with UseSimClock, at the next TimeTravel past
+// it. Call with mapMut held.
+func (sim *SimNet) schedule(ch chan *Packet, pack *Packet, lat time.Duration) {
+	if sim.clk == nil {
+		go sim.sendWithLatency(ch, pack, lat)
+		return
+	}
+	sim.scheduledN++
+	heap.Push(&sim.scheduled, &simArrival{
+		at:   sim.clk.Now().Add(lat),
+		n:    sim.scheduledN,
+		ch:   ch,
+		pack: pack,
+	})
+}
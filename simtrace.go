@@ -0,0 +1,86 @@
+package swp
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Packet tracing.
+//
+// EnableTrace has a SimNet write one line per packet
+// event, in the manner of a minimal tcpdump:
+//
+//	2024-01-01T00:00:01.000 A→B seq=5 ack=3 len=100 [delivered]
+//
+// A packet is traced when sent, when dropped by the
+// network, when handed to its receiver, and when given
+// to InjectPacket ("injected"). Drops say why: "loss",
+// "discard:DiscardOnce", "discard:DiscardList",
+// "discard:FilterThisEvent", "discard:InboxClosed", or
+// "discard:BlackHole". Packets with TcpEvent
+// EventDataAck or EventKeepAlive carry an "ackonly" or
+// "keepalive" flag before the reason.
+//
+// Sniff gives a test the packets themselves, as they
+// arrive at an inbox.
+
+// traceTimeFormat is the timestamp in each trace line.
+const traceTimeFormat = "2006-01-02T15:04:05.000"
+
+// EnableTrace makes sim write a trace line to w for each
+// packet sent, dropped, and delivered. Lines are written
+// one at a time, with the SimNet locked, so w need not be
+// safe for concurrent use. They are stamped with the
+// SimClock given to UseSimClock, when there is one. A nil
+// w turns tracing off.
+func (sim *SimNet) EnableTrace(w io.Writer) {
+	sim.mapMut.Lock()
+	sim.trace = w
+	sim.mapMut.Unlock()
+}
+
+// traceLocked writes pack's line with reason to the
+// trace writer, if any. Call with mapMut held.
+func (sim *SimNet) traceLocked(pack *Packet, reason string) {
+	if sim.trace == nil {
+		return
+	}
+	var now time.Time
+	if sim.clk != nil {
+		now = sim.clk.Now()
+	} else {
+		now = time.Now()
+	}
+	flags := ""
+	if pack.TcpEvent == EventDataAck {
+		flags += " ackonly"
+	}
+	if pack.TcpEvent == EventKeepAlive {
+		flags += " keepalive"
+	}
+	fmt.Fprintf(sim.trace, "%s %s→%s seq=%d ack=%d len=%d%s [%s]\n",
+		now.Format(traceTimeFormat), pack.From, pack.Dest,
+		pack.SeqNum, pack.AckNum, len(pack.Data), flags, reason)
+}
+
+// Sniff has sim call handler, on the delivering
+// goroutine, with a copy of each packet arriving at
+// inbox, just before the receiver gets it. It replaces
+// any handler already set for inbox. handler must not
+// change the copy's Data, which is shared.
+func (sim *SimNet) Sniff(inbox string, handler func(*Packet)) {
+	sim.mapMut.Lock()
+	if sim.sniff == nil {
+		sim.sniff = make(map[string]func(*Packet))
+	}
+	sim.sniff[inbox] = handler
+	sim.mapMut.Unlock()
+}
+
+// ClearSniff removes the Sniff handler for inbox.
+func (sim *SimNet) ClearSniff(inbox string) {
+	sim.mapMut.Lock()
+	delete(sim.sniff, inbox)
+	sim.mapMut.Unlock()
+}
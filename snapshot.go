@@ -0,0 +1,259 @@
+package swp
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+//go:generate msgp
+
+//msgp:ignore snapshotReq
+
+// Session snapshots.
+//
+// To move a live session to another process, take a
+// Snapshot of it, ship the msgp encoding, and Stop it;
+// then start the replacement with the snapshot in
+// SessionConfig.Restore, on the same inboxes. The new
+// session keeps the old session nonces, so the peer
+// carries on as if nothing happened: packets that were
+// in flight are retried at once, and packets the consumer
+// had yet to read are delivered by the new session.
+//
+// Only protocol state is kept. Options such as
+// FECGroupSize come from the new SessionConfig, and
+// counters start again from zero.
+
+// ErrSessionStarted is returned by Restore once the
+// session's goroutines are running.
+var ErrSessionStarted = fmt.Errorf("swp: Restore must come before the session starts; use SessionConfig.Restore")
+
+// ErrSnapshotMismatch is returned by Restore for a
+// snapshot taken of a session on other inboxes.
+var ErrSnapshotMismatch = fmt.Errorf("swp: snapshot is of a session between other inboxes")
+
+// SessionSnapshot is the state of a Session as taken by
+// Session.Snapshot.
+type SessionSnapshot struct {
+	LocalInbox      string
+	DestInbox       string
+	LocalSessNonce  string
+	RemoteSessNonce string
+	TcpState        TcpState
+
+	// sender: Unacked holds copies of the packets sent
+	// but not yet acked, oldest first.
+	LastFrameSent               int64
+	LastAckRec                  int64
+	SenderWindowSize            int64
+	TotalBytesSent              int64
+	LastSeenAvailReaderBytesCap int64
+	LastSeenAvailReaderMsgCap   int64
+	RttEst                      float64
+	RttN                        int64
+	Unacked                     []*Packet
+
+	// receiver: Held holds copies of the packets received
+	// but not yet consumed, oldest first; those before
+	// NextFrameExpected were ready for delivery.
+	NextFrameExpected       int64
+	LastFrameClientConsumed int64
+	LastMsgConsumed         int64
+	LargestSeqnoRcvd        int64
+	MaxCumulBytesTrans      int64
+	LastByteConsumed        int64
+	RecvWindowSize          int64
+	RecvWindowSizeBytes     int64
+	Held                    []*Packet
+}
+
+// snapshotReq asks a loop to fill in its half of snap,
+// closing done when it has.
+type snapshotReq struct {
+	snap *SessionSnapshot
+	done chan struct{}
+}
+
+// Snapshot returns the session's current state. The
+// sendloop and recvloop each pause just long enough to
+// copy theirs, so a Snapshot may be taken in the middle
+// of a transfer. It is safe to call from any goroutine,
+// and after Stop.
+func (s *Session) Snapshot() SessionSnapshot {
+	snap := SessionSnapshot{
+		LocalInbox: s.MyInbox,
+		DestInbox:  s.Destination,
+	}
+	snd := s.Swp.Sender
+	req := &snapshotReq{snap: &snap, done: make(chan struct{})}
+	select {
+	case snd.snapshotCh <- req:
+		<-req.done
+	case <-snd.Halt.Done.Chan:
+		// stopped, so nothing else touches its state.
+		snd.snapshot(&snap)
+	}
+	rcv := s.Swp.Recver
+	req = &snapshotReq{snap: &snap, done: make(chan struct{})}
+	select {
+	case rcv.snapshotCh <- req:
+		<-req.done
+	case <-rcv.Halt.Done.Chan:
+		rcv.snapshot(&snap)
+	}
+	return snap
+}
+
+// Restore sets the session to snap. NewSession calls
+// it with SessionConfig.Restore before starting the
+// session; at any later time it returns ErrSessionStarted.
+func (s *Session) Restore(snap SessionSnapshot) error {
+	select {
+	case <-s.Swp.Recver.ready:
+		return ErrSessionStarted
+	default:
+	}
+	if snap.LocalInbox != s.MyInbox || snap.DestInbox != s.Destination {
+		return ErrSnapshotMismatch
+	}
+	s.LocalSessNonce = snap.LocalSessNonce
+	s.Swp.Sender.restore(&snap)
+	s.Swp.Recver.restore(&snap)
+	return nil
+}
+
+// Migrate moves the session onto new goroutines: it
+// stops s, takes a Snapshot of the stopped session, so
+// nothing can change after it is taken, and restores it
+// in a new session started from s.Cfg. Set s.Cfg.LoopStart
+// first to choose where the new loops run. The peer
+// sees no more than a pause, retrying whatever was in
+// flight. As with Restore, only protocol state moves:
+// the caller registers its consumer (ReadMessagesCh,
+// RegisterAsap) and any Subscribe handlers again on the
+// new session. If the new session can't be made, s
+// stays stopped and the error is returned.
+func (s *Session) Migrate() (*Session, error) {
+	s.Stop()
+	snap := s.Snapshot()
+	cfg := *s.Cfg
+	cfg.Restore = &snap
+	return NewSession(cfg)
+}
+
+// snapshot copies the sender's half of snap. Only the
+// sendloop may call it, unless it has exited.
+func (s *SenderState) snapshot(snap *SessionSnapshot) {
+	snap.LastFrameSent = s.LastFrameSent
+	snap.LastAckRec = s.LastAckRec
+	snap.SenderWindowSize = s.SenderWindowSize
+	snap.TotalBytesSent = s.TotalBytesSent
+	snap.LastSeenAvailReaderBytesCap = s.LastSeenAvailReaderBytesCap
+	snap.LastSeenAvailReaderMsgCap = s.LastSeenAvailReaderMsgCap
+	snap.RttEst = s.rtt.Est
+	snap.RttN = s.rtt.N
+	snap.Unacked = nil
+	for it := s.SentButNotAckedBySeqNum.tree.Min(); !it.Limit(); it = it.Next() {
+		cp := *it.Item().(*TxqSlot).Pack
+		snap.Unacked = append(snap.Unacked, &cp)
+	}
+}
+
+// restore sets the sender to snap, before Start. Each
+// packet in flight gets a RetryDeadline of now, so the
+// first regularIntervalWakeup retries it.
+func (s *SenderState) restore(snap *SessionSnapshot) {
+	s.LocalSessNonce = snap.LocalSessNonce
+	s.RemoteSessNonce = snap.RemoteSessNonce
+	s.LastFrameSent = snap.LastFrameSent
+	s.LastAckRec = snap.LastAckRec
+	s.TotalBytesSent = snap.TotalBytesSent
+	s.LastSeenAvailReaderBytesCap = snap.LastSeenAvailReaderBytesCap
+	s.LastSeenAvailReaderMsgCap = snap.LastSeenAvailReaderMsgCap
+	s.rtt.Est = snap.RttEst
+	s.rtt.N = snap.RttN
+
+	n := snap.SenderWindowSize
+	s.SenderWindowSize = n
+	s.Txq = make([]*TxqSlot, n)
+	for i := range s.Txq {
+		s.Txq[i] = &TxqSlot{}
+	}
+	s.SentButNotAckedByDeadline = newRetree(compareRetryDeadline)
+	s.SentButNotAckedBySeqNum = newRetree(compareSeqNum)
+
+	now := s.Clk.Now()
+	for _, pack := range snap.Unacked {
+		slot := s.Txq[pack.SeqNum%n]
+		slot.Pack = pack
+		slot.OrigSendTime = pack.DataSendTm
+		slot.RetryCount = int(pack.SeqRetry)
+		slot.RetryDur = s.Timeout
+		slot.RetryDeadline = now
+		s.SentButNotAckedByDeadline.insert(slot)
+		s.SentButNotAckedBySeqNum.insert(slot)
+	}
+	s.LastHeardFromDownstream = now
+	s.LastSendTime = now
+}
+
+// snapshot copies the receiver's half of snap. Only
+// the recvloop may call it, unless it has exited.
+func (r *RecvState) snapshot(snap *SessionSnapshot) {
+	snap.LocalSessNonce = r.LocalSessNonce
+	snap.RemoteSessNonce = r.RemoteSessNonce
+	snap.TcpState = r.TcpState
+	snap.NextFrameExpected = r.NextFrameExpected
+	snap.LastFrameClientConsumed = r.LastFrameClientConsumed
+	snap.LastMsgConsumed = r.LastMsgConsumed
+	snap.LargestSeqnoRcvd = r.LargestSeqnoRcvd
+	snap.MaxCumulBytesTrans = r.MaxCumulBytesTrans
+	snap.LastByteConsumed = r.LastByteConsumed
+	snap.RecvWindowSize = r.RecvWindowSize
+	snap.RecvWindowSizeBytes = r.RecvWindowSizeBytes
+	snap.Held = nil
+	for _, pack := range r.RcvdButNotConsumed {
+		cp := *pack
+		snap.Held = append(snap.Held, &cp)
+	}
+	sort.Slice(snap.Held, func(i, j int) bool {
+		return snap.Held[i].SeqNum < snap.Held[j].SeqNum
+	})
+}
+
+// restore sets the receiver to snap, before Start.
+func (r *RecvState) restore(snap *SessionSnapshot) {
+	r.LocalSessNonce = snap.LocalSessNonce
+	r.RemoteSessNonce = snap.RemoteSessNonce
+	r.TcpState = snap.TcpState
+	r.NextFrameExpected = snap.NextFrameExpected
+	r.LastFrameClientConsumed = snap.LastFrameClientConsumed
+	r.LastMsgConsumed = snap.LastMsgConsumed
+	r.LargestSeqnoRcvd = snap.LargestSeqnoRcvd
+	r.MaxCumulBytesTrans = snap.MaxCumulBytesTrans
+	r.LastByteConsumed = snap.LastByteConsumed
+	r.RecvWindowSizeBytes = snap.RecvWindowSizeBytes
+
+	n := snap.RecvWindowSize
+	r.RecvWindowSize = n
+	r.Rxq = make([]*RxqSlot, n)
+	for i := range r.Rxq {
+		r.Rxq[i] = &RxqSlot{}
+	}
+	r.RcvdButNotConsumed = make(map[int64]*Packet)
+	atomic.StoreInt64(&r.heldBytes, 0)
+	r.ReadyForDelivery = newReadyRing(r.ReadyForDeliveryMaxLen)
+	for _, pack := range snap.Held {
+		r.hold(pack)
+		if pack.SeqNum < r.NextFrameExpected {
+			r.pushReady(pack)
+			continue
+		}
+		slot := r.Rxq[pack.SeqNum%n]
+		slot.Received = true
+		slot.Pack = pack
+	}
+	r.snd.SetRecvLastFrameClientConsumed(r.LastFrameClientConsumed)
+	r.UpdateControl(nil)
+}
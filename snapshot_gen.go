@@ -0,0 +1,743 @@
+package swp
+
+// NOTE: THIS FILE WAS PRODUCED BY THE
+// MSGP CODE GENERATION TOOL (github.com/tinylib/msgp)
+// DO NOT EDIT
+
+import (
+	"github.com/tinylib/msgp/msgp"
+)
+
+// DecodeMsg implements msgp.Decodable
+func (z *SessionSnapshot) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zvqy uint32
+	zvqy, err = dc.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	for zvqy > 0 {
+		zvqy--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "LocalInbox":
+			z.LocalInbox, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "DestInbox":
+			z.DestInbox, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "LocalSessNonce":
+			z.LocalSessNonce, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "RemoteSessNonce":
+			z.RemoteSessNonce, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "TcpState":
+			err = z.TcpState.DecodeMsg(dc)
+			if err != nil {
+				return
+			}
+		case "LastFrameSent":
+			z.LastFrameSent, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "LastAckRec":
+			z.LastAckRec, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "SenderWindowSize":
+			z.SenderWindowSize, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "TotalBytesSent":
+			z.TotalBytesSent, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "LastSeenAvailReaderBytesCap":
+			z.LastSeenAvailReaderBytesCap, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "LastSeenAvailReaderMsgCap":
+			z.LastSeenAvailReaderMsgCap, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "RttEst":
+			z.RttEst, err = dc.ReadFloat64()
+			if err != nil {
+				return
+			}
+		case "RttN":
+			z.RttN, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "Unacked":
+			var znqr uint32
+			znqr, err = dc.ReadArrayHeader()
+			if err != nil {
+				return
+			}
+			if cap(z.Unacked) >= int(znqr) {
+				z.Unacked = (z.Unacked)[:znqr]
+			} else {
+				z.Unacked = make([]*Packet, znqr)
+			}
+			for zotg := range z.Unacked {
+				if dc.IsNil() {
+					err = dc.ReadNil()
+					if err != nil {
+						return
+					}
+					z.Unacked[zotg] = nil
+				} else {
+					if z.Unacked[zotg] == nil {
+						z.Unacked[zotg] = new(Packet)
+					}
+					err = z.Unacked[zotg].DecodeMsg(dc)
+					if err != nil {
+						return
+					}
+				}
+			}
+		case "NextFrameExpected":
+			z.NextFrameExpected, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "LastFrameClientConsumed":
+			z.LastFrameClientConsumed, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "LastMsgConsumed":
+			z.LastMsgConsumed, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "LargestSeqnoRcvd":
+			z.LargestSeqnoRcvd, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "MaxCumulBytesTrans":
+			z.MaxCumulBytesTrans, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "LastByteConsumed":
+			z.LastByteConsumed, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "RecvWindowSize":
+			z.RecvWindowSize, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "RecvWindowSizeBytes":
+			z.RecvWindowSizeBytes, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "Held":
+			var zudg uint32
+			zudg, err = dc.ReadArrayHeader()
+			if err != nil {
+				return
+			}
+			if cap(z.Held) >= int(zudg) {
+				z.Held = (z.Held)[:zudg]
+			} else {
+				z.Held = make([]*Packet, zudg)
+			}
+			for zxdq := range z.Held {
+				if dc.IsNil() {
+					err = dc.ReadNil()
+					if err != nil {
+						return
+					}
+					z.Held[zxdq] = nil
+				} else {
+					if z.Held[zxdq] == nil {
+						z.Held[zxdq] = new(Packet)
+					}
+					err = z.Held[zxdq].DecodeMsg(dc)
+					if err != nil {
+						return
+					}
+				}
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *SessionSnapshot) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 23
+	// write "LocalInbox"
+	err = en.Append(0xde, 0x0, 0x17, 0xaa, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x49, 0x6e, 0x62, 0x6f, 0x78)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.LocalInbox)
+	if err != nil {
+		return
+	}
+	// write "DestInbox"
+	err = en.Append(0xa9, 0x44, 0x65, 0x73, 0x74, 0x49, 0x6e, 0x62, 0x6f, 0x78)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.DestInbox)
+	if err != nil {
+		return
+	}
+	// write "LocalSessNonce"
+	err = en.Append(0xae, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x53, 0x65, 0x73, 0x73, 0x4e, 0x6f, 0x6e, 0x63, 0x65)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.LocalSessNonce)
+	if err != nil {
+		return
+	}
+	// write "RemoteSessNonce"
+	err = en.Append(0xaf, 0x52, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x53, 0x65, 0x73, 0x73, 0x4e, 0x6f, 0x6e, 0x63, 0x65)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.RemoteSessNonce)
+	if err != nil {
+		return
+	}
+	// write "TcpState"
+	err = en.Append(0xa8, 0x54, 0x63, 0x70, 0x53, 0x74, 0x61, 0x74, 0x65)
+	if err != nil {
+		return err
+	}
+	err = z.TcpState.EncodeMsg(en)
+	if err != nil {
+		return
+	}
+	// write "LastFrameSent"
+	err = en.Append(0xad, 0x4c, 0x61, 0x73, 0x74, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x53, 0x65, 0x6e, 0x74)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.LastFrameSent)
+	if err != nil {
+		return
+	}
+	// write "LastAckRec"
+	err = en.Append(0xaa, 0x4c, 0x61, 0x73, 0x74, 0x41, 0x63, 0x6b, 0x52, 0x65, 0x63)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.LastAckRec)
+	if err != nil {
+		return
+	}
+	// write "SenderWindowSize"
+	err = en.Append(0xb0, 0x53, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x57, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x53, 0x69, 0x7a, 0x65)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.SenderWindowSize)
+	if err != nil {
+		return
+	}
+	// write "TotalBytesSent"
+	err = en.Append(0xae, 0x54, 0x6f, 0x74, 0x61, 0x6c, 0x42, 0x79, 0x74, 0x65, 0x73, 0x53, 0x65, 0x6e, 0x74)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.TotalBytesSent)
+	if err != nil {
+		return
+	}
+	// write "LastSeenAvailReaderBytesCap"
+	err = en.Append(0xbb, 0x4c, 0x61, 0x73, 0x74, 0x53, 0x65, 0x65, 0x6e, 0x41, 0x76, 0x61, 0x69, 0x6c, 0x52, 0x65, 0x61, 0x64, 0x65, 0x72, 0x42, 0x79, 0x74, 0x65, 0x73, 0x43, 0x61, 0x70)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.LastSeenAvailReaderBytesCap)
+	if err != nil {
+		return
+	}
+	// write "LastSeenAvailReaderMsgCap"
+	err = en.Append(0xb9, 0x4c, 0x61, 0x73, 0x74, 0x53, 0x65, 0x65, 0x6e, 0x41, 0x76, 0x61, 0x69, 0x6c, 0x52, 0x65, 0x61, 0x64, 0x65, 0x72, 0x4d, 0x73, 0x67, 0x43, 0x61, 0x70)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.LastSeenAvailReaderMsgCap)
+	if err != nil {
+		return
+	}
+	// write "RttEst"
+	err = en.Append(0xa6, 0x52, 0x74, 0x74, 0x45, 0x73, 0x74)
+	if err != nil {
+		return err
+	}
+	err = en.WriteFloat64(z.RttEst)
+	if err != nil {
+		return
+	}
+	// write "RttN"
+	err = en.Append(0xa4, 0x52, 0x74, 0x74, 0x4e)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.RttN)
+	if err != nil {
+		return
+	}
+	// write "Unacked"
+	err = en.Append(0xa7, 0x55, 0x6e, 0x61, 0x63, 0x6b, 0x65, 0x64)
+	if err != nil {
+		return err
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Unacked)))
+	if err != nil {
+		return
+	}
+	for zqyq := range z.Unacked {
+		if z.Unacked[zqyq] == nil {
+			err = en.WriteNil()
+			if err != nil {
+				return
+			}
+		} else {
+			err = z.Unacked[zqyq].EncodeMsg(en)
+			if err != nil {
+				return
+			}
+		}
+	}
+	// write "NextFrameExpected"
+	err = en.Append(0xb1, 0x4e, 0x65, 0x78, 0x74, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x45, 0x78, 0x70, 0x65, 0x63, 0x74, 0x65, 0x64)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.NextFrameExpected)
+	if err != nil {
+		return
+	}
+	// write "LastFrameClientConsumed"
+	err = en.Append(0xb7, 0x4c, 0x61, 0x73, 0x74, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x6e, 0x73, 0x75, 0x6d, 0x65, 0x64)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.LastFrameClientConsumed)
+	if err != nil {
+		return
+	}
+	// write "LastMsgConsumed"
+	err = en.Append(0xaf, 0x4c, 0x61, 0x73, 0x74, 0x4d, 0x73, 0x67, 0x43, 0x6f, 0x6e, 0x73, 0x75, 0x6d, 0x65, 0x64)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.LastMsgConsumed)
+	if err != nil {
+		return
+	}
+	// write "LargestSeqnoRcvd"
+	err = en.Append(0xb0, 0x4c, 0x61, 0x72, 0x67, 0x65, 0x73, 0x74, 0x53, 0x65, 0x71, 0x6e, 0x6f, 0x52, 0x63, 0x76, 0x64)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.LargestSeqnoRcvd)
+	if err != nil {
+		return
+	}
+	// write "MaxCumulBytesTrans"
+	err = en.Append(0xb2, 0x4d, 0x61, 0x78, 0x43, 0x75, 0x6d, 0x75, 0x6c, 0x42, 0x79, 0x74, 0x65, 0x73, 0x54, 0x72, 0x61, 0x6e, 0x73)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.MaxCumulBytesTrans)
+	if err != nil {
+		return
+	}
+	// write "LastByteConsumed"
+	err = en.Append(0xb0, 0x4c, 0x61, 0x73, 0x74, 0x42, 0x79, 0x74, 0x65, 0x43, 0x6f, 0x6e, 0x73, 0x75, 0x6d, 0x65, 0x64)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.LastByteConsumed)
+	if err != nil {
+		return
+	}
+	// write "RecvWindowSize"
+	err = en.Append(0xae, 0x52, 0x65, 0x63, 0x76, 0x57, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x53, 0x69, 0x7a, 0x65)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.RecvWindowSize)
+	if err != nil {
+		return
+	}
+	// write "RecvWindowSizeBytes"
+	err = en.Append(0xb3, 0x52, 0x65, 0x63, 0x76, 0x57, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x53, 0x69, 0x7a, 0x65, 0x42, 0x79, 0x74, 0x65, 0x73)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.RecvWindowSizeBytes)
+	if err != nil {
+		return
+	}
+	// write "Held"
+	err = en.Append(0xa4, 0x48, 0x65, 0x6c, 0x64)
+	if err != nil {
+		return err
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Held)))
+	if err != nil {
+		return
+	}
+	for zqdj := range z.Held {
+		if z.Held[zqdj] == nil {
+			err = en.WriteNil()
+			if err != nil {
+				return
+			}
+		} else {
+			err = z.Held[zqdj].EncodeMsg(en)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *SessionSnapshot) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 23
+	// string "LocalInbox"
+	o = append(o, 0xde, 0x0, 0x17, 0xaa, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x49, 0x6e, 0x62, 0x6f, 0x78)
+	o = msgp.AppendString(o, z.LocalInbox)
+	// string "DestInbox"
+	o = append(o, 0xa9, 0x44, 0x65, 0x73, 0x74, 0x49, 0x6e, 0x62, 0x6f, 0x78)
+	o = msgp.AppendString(o, z.DestInbox)
+	// string "LocalSessNonce"
+	o = append(o, 0xae, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x53, 0x65, 0x73, 0x73, 0x4e, 0x6f, 0x6e, 0x63, 0x65)
+	o = msgp.AppendString(o, z.LocalSessNonce)
+	// string "RemoteSessNonce"
+	o = append(o, 0xaf, 0x52, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x53, 0x65, 0x73, 0x73, 0x4e, 0x6f, 0x6e, 0x63, 0x65)
+	o = msgp.AppendString(o, z.RemoteSessNonce)
+	// string "TcpState"
+	o = append(o, 0xa8, 0x54, 0x63, 0x70, 0x53, 0x74, 0x61, 0x74, 0x65)
+	o, err = z.TcpState.MarshalMsg(o)
+	if err != nil {
+		return
+	}
+	// string "LastFrameSent"
+	o = append(o, 0xad, 0x4c, 0x61, 0x73, 0x74, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x53, 0x65, 0x6e, 0x74)
+	o = msgp.AppendInt64(o, z.LastFrameSent)
+	// string "LastAckRec"
+	o = append(o, 0xaa, 0x4c, 0x61, 0x73, 0x74, 0x41, 0x63, 0x6b, 0x52, 0x65, 0x63)
+	o = msgp.AppendInt64(o, z.LastAckRec)
+	// string "SenderWindowSize"
+	o = append(o, 0xb0, 0x53, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x57, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x53, 0x69, 0x7a, 0x65)
+	o = msgp.AppendInt64(o, z.SenderWindowSize)
+	// string "TotalBytesSent"
+	o = append(o, 0xae, 0x54, 0x6f, 0x74, 0x61, 0x6c, 0x42, 0x79, 0x74, 0x65, 0x73, 0x53, 0x65, 0x6e, 0x74)
+	o = msgp.AppendInt64(o, z.TotalBytesSent)
+	// string "LastSeenAvailReaderBytesCap"
+	o = append(o, 0xbb, 0x4c, 0x61, 0x73, 0x74, 0x53, 0x65, 0x65, 0x6e, 0x41, 0x76, 0x61, 0x69, 0x6c, 0x52, 0x65, 0x61, 0x64, 0x65, 0x72, 0x42, 0x79, 0x74, 0x65, 0x73, 0x43, 0x61, 0x70)
+	o = msgp.AppendInt64(o, z.LastSeenAvailReaderBytesCap)
+	// string "LastSeenAvailReaderMsgCap"
+	o = append(o, 0xb9, 0x4c, 0x61, 0x73, 0x74, 0x53, 0x65, 0x65, 0x6e, 0x41, 0x76, 0x61, 0x69, 0x6c, 0x52, 0x65, 0x61, 0x64, 0x65, 0x72, 0x4d, 0x73, 0x67, 0x43, 0x61, 0x70)
+	o = msgp.AppendInt64(o, z.LastSeenAvailReaderMsgCap)
+	// string "RttEst"
+	o = append(o, 0xa6, 0x52, 0x74, 0x74, 0x45, 0x73, 0x74)
+	o = msgp.AppendFloat64(o, z.RttEst)
+	// string "RttN"
+	o = append(o, 0xa4, 0x52, 0x74, 0x74, 0x4e)
+	o = msgp.AppendInt64(o, z.RttN)
+	// string "Unacked"
+	o = append(o, 0xa7, 0x55, 0x6e, 0x61, 0x63, 0x6b, 0x65, 0x64)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Unacked)))
+	for zspu := range z.Unacked {
+		if z.Unacked[zspu] == nil {
+			o = msgp.AppendNil(o)
+		} else {
+			o, err = z.Unacked[zspu].MarshalMsg(o)
+			if err != nil {
+				return
+			}
+		}
+	}
+	// string "NextFrameExpected"
+	o = append(o, 0xb1, 0x4e, 0x65, 0x78, 0x74, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x45, 0x78, 0x70, 0x65, 0x63, 0x74, 0x65, 0x64)
+	o = msgp.AppendInt64(o, z.NextFrameExpected)
+	// string "LastFrameClientConsumed"
+	o = append(o, 0xb7, 0x4c, 0x61, 0x73, 0x74, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x6e, 0x73, 0x75, 0x6d, 0x65, 0x64)
+	o = msgp.AppendInt64(o, z.LastFrameClientConsumed)
+	// string "LastMsgConsumed"
+	o = append(o, 0xaf, 0x4c, 0x61, 0x73, 0x74, 0x4d, 0x73, 0x67, 0x43, 0x6f, 0x6e, 0x73, 0x75, 0x6d, 0x65, 0x64)
+	o = msgp.AppendInt64(o, z.LastMsgConsumed)
+	// string "LargestSeqnoRcvd"
+	o = append(o, 0xb0, 0x4c, 0x61, 0x72, 0x67, 0x65, 0x73, 0x74, 0x53, 0x65, 0x71, 0x6e, 0x6f, 0x52, 0x63, 0x76, 0x64)
+	o = msgp.AppendInt64(o, z.LargestSeqnoRcvd)
+	// string "MaxCumulBytesTrans"
+	o = append(o, 0xb2, 0x4d, 0x61, 0x78, 0x43, 0x75, 0x6d, 0x75, 0x6c, 0x42, 0x79, 0x74, 0x65, 0x73, 0x54, 0x72, 0x61, 0x6e, 0x73)
+	o = msgp.AppendInt64(o, z.MaxCumulBytesTrans)
+	// string "LastByteConsumed"
+	o = append(o, 0xb0, 0x4c, 0x61, 0x73, 0x74, 0x42, 0x79, 0x74, 0x65, 0x43, 0x6f, 0x6e, 0x73, 0x75, 0x6d, 0x65, 0x64)
+	o = msgp.AppendInt64(o, z.LastByteConsumed)
+	// string "RecvWindowSize"
+	o = append(o, 0xae, 0x52, 0x65, 0x63, 0x76, 0x57, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x53, 0x69, 0x7a, 0x65)
+	o = msgp.AppendInt64(o, z.RecvWindowSize)
+	// string "RecvWindowSizeBytes"
+	o = append(o, 0xb3, 0x52, 0x65, 0x63, 0x76, 0x57, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x53, 0x69, 0x7a, 0x65, 0x42, 0x79, 0x74, 0x65, 0x73)
+	o = msgp.AppendInt64(o, z.RecvWindowSizeBytes)
+	// string "Held"
+	o = append(o, 0xa4, 0x48, 0x65, 0x6c, 0x64)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Held)))
+	for zpop := range z.Held {
+		if z.Held[zpop] == nil {
+			o = msgp.AppendNil(o)
+		} else {
+			o, err = z.Held[zpop].MarshalMsg(o)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *SessionSnapshot) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zdiw uint32
+	zdiw, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		return
+	}
+	for zdiw > 0 {
+		zdiw--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "LocalInbox":
+			z.LocalInbox, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "DestInbox":
+			z.DestInbox, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "LocalSessNonce":
+			z.LocalSessNonce, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "RemoteSessNonce":
+			z.RemoteSessNonce, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "TcpState":
+			bts, err = z.TcpState.UnmarshalMsg(bts)
+			if err != nil {
+				return
+			}
+		case "LastFrameSent":
+			z.LastFrameSent, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "LastAckRec":
+			z.LastAckRec, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "SenderWindowSize":
+			z.SenderWindowSize, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "TotalBytesSent":
+			z.TotalBytesSent, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "LastSeenAvailReaderBytesCap":
+			z.LastSeenAvailReaderBytesCap, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "LastSeenAvailReaderMsgCap":
+			z.LastSeenAvailReaderMsgCap, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "RttEst":
+			z.RttEst, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "RttN":
+			z.RttN, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "Unacked":
+			var znqe uint32
+			znqe, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				return
+			}
+			if cap(z.Unacked) >= int(znqe) {
+				z.Unacked = (z.Unacked)[:znqe]
+			} else {
+				z.Unacked = make([]*Packet, znqe)
+			}
+			for zudo := range z.Unacked {
+				if msgp.IsNil(bts) {
+					bts, err = msgp.ReadNilBytes(bts)
+					if err != nil {
+						return
+					}
+					z.Unacked[zudo] = nil
+				} else {
+					if z.Unacked[zudo] == nil {
+						z.Unacked[zudo] = new(Packet)
+					}
+					bts, err = z.Unacked[zudo].UnmarshalMsg(bts)
+					if err != nil {
+						return
+					}
+				}
+			}
+		case "NextFrameExpected":
+			z.NextFrameExpected, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "LastFrameClientConsumed":
+			z.LastFrameClientConsumed, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "LastMsgConsumed":
+			z.LastMsgConsumed, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "LargestSeqnoRcvd":
+			z.LargestSeqnoRcvd, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "MaxCumulBytesTrans":
+			z.MaxCumulBytesTrans, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "LastByteConsumed":
+			z.LastByteConsumed, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "RecvWindowSize":
+			z.RecvWindowSize, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "RecvWindowSizeBytes":
+			z.RecvWindowSizeBytes, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "Held":
+			var zibw uint32
+			zibw, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				return
+			}
+			if cap(z.Held) >= int(zibw) {
+				z.Held = (z.Held)[:zibw]
+			} else {
+				z.Held = make([]*Packet, zibw)
+			}
+			for zkfz := range z.Held {
+				if msgp.IsNil(bts) {
+					bts, err = msgp.ReadNilBytes(bts)
+					if err != nil {
+						return
+					}
+					z.Held[zkfz] = nil
+				} else {
+					if z.Held[zkfz] == nil {
+						z.Held[zkfz] = new(Packet)
+					}
+					bts, err = z.Held[zkfz].UnmarshalMsg(bts)
+					if err != nil {
+						return
+					}
+				}
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *SessionSnapshot) Msgsize() (s int) {
+	s = 3 + 11 + msgp.StringPrefixSize + len(z.LocalInbox) + 10 + msgp.StringPrefixSize + len(z.DestInbox) + 15 + msgp.StringPrefixSize + len(z.LocalSessNonce) + 16 + msgp.StringPrefixSize + len(z.RemoteSessNonce) + 9 + z.TcpState.Msgsize() + 14 + msgp.Int64Size + 11 + msgp.Int64Size + 17 + msgp.Int64Size + 15 + msgp.Int64Size + 28 + msgp.Int64Size + 26 + msgp.Int64Size + 7 + msgp.Float64Size + 5 + msgp.Int64Size + 8 + msgp.ArrayHeaderSize
+	for zcno := range z.Unacked {
+		if z.Unacked[zcno] == nil {
+			s += msgp.NilSize
+		} else {
+			s += z.Unacked[zcno].Msgsize()
+		}
+	}
+	s += 18 + msgp.Int64Size + 24 + msgp.Int64Size + 16 + msgp.Int64Size + 17 + msgp.Int64Size + 19 + msgp.Int64Size + 17 + msgp.Int64Size + 15 + msgp.Int64Size + 20 + msgp.Int64Size + 5 + msgp.ArrayHeaderSize
+	for zqvu := range z.Held {
+		if z.Held[zqvu] == nil {
+			s += msgp.NilSize
+		} else {
+			s += z.Held[zqvu].Msgsize()
+		}
+	}
+	return
+}
@@ -0,0 +1,255 @@
+package swp
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test114SnapshotRestoreMidTransfer(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	net := A.Net.(*SimNet)
+	A.SelfConsumeForTesting()
+
+	// nobody reads B, so all 10 stay unacked at A
+	// and unconsumed at B.
+	n := 20
+	for i := 0; i < n/2; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	snapA, snapB := A.Snapshot(), B.Snapshot()
+	cleanup()
+
+	// ship them, as to another process.
+	btsA, err := snapA.MarshalMsg(nil)
+	panicOn(err)
+	btsB, err := snapB.MarshalMsg(nil)
+	panicOn(err)
+	var gotA, gotB SessionSnapshot
+	_, err = gotA.UnmarshalMsg(btsA)
+	panicOn(err)
+	_, err = gotB.UnmarshalMsg(btsB)
+	panicOn(err)
+
+	A2, B2, cleanup2, err := SwpPipe(WithNet(net),
+		OnlyOn("A", WithConfig(func(cfg *SessionConfig) { cfg.Restore = &gotA })),
+		OnlyOn("B", WithConfig(func(cfg *SessionConfig) { cfg.Restore = &gotB })))
+	panicOn(err)
+	A2.SelfConsumeForTesting()
+	lateErr := A2.Restore(gotA)
+
+	go func() {
+		for i := n / 2; i < n; i++ {
+			A2.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+		}
+	}()
+	var got []string
+	var seqs []int64
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for len(got) < n {
+		seq, err := B2.ReadCtx(ctx)
+		if err != nil {
+			break
+		}
+		for _, pack := range seq.Seq {
+			got = append(got, string(pack.Data))
+			seqs = append(seqs, pack.SeqNum)
+		}
+	}
+	for i := 0; i < 100 && A2.Swp.Sender.LargestAckedSeqno() < int64(n-1); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	acked := A2.Swp.Sender.LargestAckedSeqno()
+
+	cleanup2()
+
+	cv.Convey("Given a Snapshot of both ends taken mid-transfer, with 10 packets unacked and unconsumed, sessions restored from its msgp encoding should deliver those 10 and the next 10 in order, and ack them all.", t, func() {
+		cv.So(len(snapA.Unacked), cv.ShouldEqual, n/2)
+		cv.So(len(snapB.Held), cv.ShouldEqual, n/2)
+		cv.So(gotA.LastFrameSent, cv.ShouldEqual, n/2-1)
+		cv.So(gotB.LocalSessNonce, cv.ShouldEqual, B.LocalSessNonce)
+		cv.So(lateErr, cv.ShouldEqual, ErrSessionStarted)
+		cv.So(len(got), cv.ShouldEqual, n)
+		for i := range got {
+			cv.So(got[i], cv.ShouldEqual, fmt.Sprintf("%v", i))
+			cv.So(seqs[i], cv.ShouldEqual, int64(i))
+		}
+		cv.So(acked, cv.ShouldEqual, n-1)
+	})
+}
+
+func Test128SeekToSkipsProcessedAfterRestore(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	net := A.Net.(*SimNet)
+	A.SelfConsumeForTesting()
+
+	// nobody reads B, so all 10 are held at B.
+	n := 20
+	for i := 0; i < n/2; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	snapA, snapB := A.Snapshot(), B.Snapshot()
+	cleanup()
+
+	A2, B2, cleanup2, err := SwpPipe(WithNet(net),
+		OnlyOn("A", WithConfig(func(cfg *SessionConfig) { cfg.Restore = &snapA })),
+		OnlyOn("B", WithConfig(func(cfg *SessionConfig) { cfg.Restore = &snapB })))
+	panicOn(err)
+	A2.SelfConsumeForTesting()
+
+	// the consumer had already processed 0 through 9;
+	// 5 is below NextFrameExpected.
+	errBack := B2.SeekTo(5)
+	seek := 10
+	errSeek := B2.SeekTo(int64(seek))
+
+	go func() {
+		for i := n / 2; i < n; i++ {
+			A2.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+		}
+	}()
+	var seqs []int64
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for len(seqs) < n-seek {
+		seq, err := B2.ReadCtx(ctx)
+		if err != nil {
+			break
+		}
+		for _, pack := range seq.Seq {
+			seqs = append(seqs, pack.SeqNum)
+		}
+	}
+	for i := 0; i < 100 && A2.Swp.Sender.LargestAckedSeqno() < int64(n-1); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	acked := A2.Swp.Sender.LargestAckedSeqno()
+
+	cleanup2()
+
+	cv.Convey("Given a restored receiver holding 0 through 9, SeekTo(5) should be refused, being below NextFrameExpected, and SeekTo(10) should deliver only 10 through 19, with all acked.", t, func() {
+		cv.So(errSeek, cv.ShouldBeNil)
+		cv.So(errBack, cv.ShouldEqual, ErrSeekBackward)
+		cv.So(len(seqs), cv.ShouldEqual, n-seek)
+		for i := range seqs {
+			cv.So(seqs[i], cv.ShouldEqual, int64(seek+i))
+		}
+		cv.So(acked, cv.ShouldEqual, n-1)
+	})
+}
+
+func Test143MigrateMovesALiveSessionToNewGoroutines(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+
+	// nobody reads B, so the first half waits there.
+	n := 20
+	for i := 0; i < n/2; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+	}
+	for i := 0; i < 100 && B.Swp.Recver.PeekNumReady() < int64(n/2); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var pinned int64
+	B.Cfg.LoopStart = func() {
+		runtime.LockOSThread()
+		atomic.AddInt64(&pinned, 1)
+	}
+	B2, err := B.Migrate()
+	panicOn(err)
+	defer B2.Stop()
+
+	go func() {
+		for i := n / 2; i < n; i++ {
+			A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+		}
+	}()
+	var got []string
+	for len(got) < n {
+		seq, err := B2.ReadTimeout(5 * time.Second)
+		if err != nil {
+			break
+		}
+		for _, pack := range seq.Seq {
+			got = append(got, string(pack.Data))
+		}
+	}
+	for i := 0; i < 100 && A.Swp.Sender.LargestAckedSeqno() < int64(n-1); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	var want []string
+	for i := 0; i < n; i++ {
+		want = append(want, fmt.Sprintf("%v", i))
+	}
+
+	cv.Convey("Given a live session, Migrate should stop it and carry on in a new one, whose loops start through LoopStart, with the peer none the wiser.", t, func() {
+		cv.So(B.State(), cv.ShouldEqual, StateClosed)
+		cv.So(atomic.LoadInt64(&pinned), cv.ShouldEqual, 2)
+		cv.So(got, cv.ShouldResemble, want)
+		cv.So(A.Swp.Sender.LargestAckedSeqno(), cv.ShouldEqual, n-1)
+	})
+}
+
+func Test157TxqDumpListsPacketsInFlight(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	defer cleanup()
+
+	// B doesn't read yet, so nothing is acked.
+	n := 3
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: make([]byte, i+1), TcpEvent: EventData})
+	}
+	time.Sleep(50 * time.Millisecond)
+	inFlight := A.TxqDump()
+
+	got := 0
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for got < n {
+		seq, err := B.ReadCtx(ctx)
+		if err != nil {
+			break
+		}
+		got += len(seq.Seq)
+	}
+	drainErr := A.Drain(ctx)
+	drained := A.TxqDump()
+
+	A.Stop()
+	stopped := A.TxqDump()
+
+	cv.Convey("Given packets sent but not acked, TxqDump should list each, oldest SeqNum first, with its retry deadline and Data length; once all are acked, and after Stop, it should list none.", t, func() {
+		cv.So(len(inFlight), cv.ShouldEqual, n)
+		for i, info := range inFlight {
+			if i > 0 {
+				cv.So(info.SeqNum, cv.ShouldEqual, inFlight[i-1].SeqNum+1)
+			}
+			cv.So(info.DataLen, cv.ShouldEqual, i+1)
+			cv.So(info.RetryDeadline.IsZero(), cv.ShouldBeFalse)
+		}
+		cv.So(got, cv.ShouldEqual, n)
+		cv.So(drainErr, cv.ShouldBeNil)
+		cv.So(drained, cv.ShouldBeEmpty)
+		cv.So(stopped, cv.ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,115 @@
+package swp
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// Session lifecycle.
+//
+// A Session starts Connecting, becomes Established once
+// its receiver accepts a first packet from the peer,
+// Closing when Close or Stop is called, and ends Closed,
+// or in Error if it was torn down by a failure such as
+// ErrMaxRetriesExceeded or failed keep-alives. States
+// only move forward: Closing may follow Connecting
+// directly, but nothing follows Closed or Error. Each
+// transition is logged with the old and new state.
+
+// SessionState is where a Session is in its lifecycle.
+type SessionState uint8
+
+const (
+	StateConnecting  SessionState = 0
+	StateEstablished SessionState = 1
+	StateClosing     SessionState = 2
+	StateClosed      SessionState = 3
+	StateError       SessionState = 4
+)
+
+func (st SessionState) String() string {
+	switch st {
+	case StateConnecting:
+		return "Connecting"
+	case StateEstablished:
+		return "Established"
+	case StateClosing:
+		return "Closing"
+	case StateClosed:
+		return "Closed"
+	case StateError:
+		return "Error"
+	}
+	return fmt.Sprintf("SessionState(%d)", int(st))
+}
+
+// ErrStateUnreachable is returned by WaitState when the
+// session has ended without reaching the target state.
+var ErrStateUnreachable = fmt.Errorf("swp: session ended without reaching the state waited for")
+
+// State returns the session's current state. It is safe
+// to call from any goroutine.
+func (s *Session) State() SessionState {
+	return SessionState(atomic.LoadInt32(&s.state))
+}
+
+// WaitState blocks until the session has reached target,
+// returning nil at once if it already has, even if it has
+// since moved on. It returns ErrStateUnreachable if the
+// session ends in Closed or Error without reaching
+// target, and ctx.Err() if ctx is done first.
+func (s *Session) WaitState(target SessionState, ctx context.Context) error {
+	for {
+		s.stateMut.Lock()
+		reached := s.stateReached&(1<<target) != 0
+		cur := SessionState(s.state)
+		changed := s.stateChanged
+		s.stateMut.Unlock()
+
+		if reached {
+			return nil
+		}
+		if cur == StateClosed || cur == StateError {
+			return ErrStateUnreachable
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// setState moves the session to st, if that is forward
+// of where it is, and wakes any WaitState.
+func (s *Session) setState(st SessionState) {
+	s.stateMut.Lock()
+	defer s.stateMut.Unlock()
+	old := SessionState(s.state)
+	if st <= old || old == StateClosed || old == StateError {
+		return
+	}
+	atomic.StoreInt32(&s.state, int32(st))
+	s.stateReached |= 1 << st
+	close(s.stateChanged)
+	s.stateChanged = make(chan struct{})
+	mylog.Printf("%s session state %s -> %s", s.MyInbox, old, st)
+}
+
+// endState sets Closed, or Error if the sender
+// terminated the session with an error.
+func (s *Session) endState() {
+	if s.Swp.Sender.GetErr() != nil {
+		s.setState(StateError)
+	} else {
+		s.setState(StateClosed)
+	}
+}
+
+// watchState ends the state when the session is halted
+// from within, as after ErrMaxRetriesExceeded.
+func (s *Session) watchState() {
+	<-s.Halt.Done.Chan
+	s.endState()
+}
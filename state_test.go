@@ -0,0 +1,83 @@
+package swp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test126SessionStateTransitions(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	before := B.State()
+	A.Push(&Packet{From: "A", Dest: "B", Data: []byte("one"), TcpEvent: EventData})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errEstB := B.WaitState(StateEstablished, ctx)
+	errEstA := A.WaitState(StateEstablished, ctx)
+	established := B.State()
+
+	closed := make(chan error, 1)
+	go func() { closed <- B.WaitState(StateClosed, ctx) }()
+	B.Stop()
+	errClosed := <-closed
+	final := B.State()
+
+	// Established has long passed, but was reached;
+	// Error never will be.
+	errPassed := B.WaitState(StateEstablished, ctx)
+	errNever := B.WaitState(StateError, ctx)
+	A.Stop()
+
+	cv.Convey("Given two sessions, B should go Connecting -> Established on A's first packet, then Closed on Stop, with WaitState seeing each, and reporting ErrStateUnreachable for a state it can now never reach.", t, func() {
+		cv.So(before, cv.ShouldEqual, StateConnecting)
+		cv.So(errEstB, cv.ShouldBeNil)
+		cv.So(errEstA, cv.ShouldBeNil)
+		cv.So(established, cv.ShouldEqual, StateEstablished)
+		cv.So(errClosed, cv.ShouldBeNil)
+		cv.So(final, cv.ShouldEqual, StateClosed)
+		cv.So(errPassed, cv.ShouldBeNil)
+		cv.So(errNever, cv.ShouldEqual, ErrStateUnreachable)
+	})
+}
+
+func Test127SessionStateErrorOnMaxRetries(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	// no B: everything A sends is lost.
+	net.AllowBlackHoleSends = true
+	rtt := 2 * lat
+
+	A, err := NewSession(SessionConfig{Net: net, LocalInbox: "A", DestInbox: "B", WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk, MaxRetries: 3})
+	panicOn(err)
+
+	A.Push(&Packet{From: "A", Dest: "B", Data: []byte("one"), TcpEvent: EventData})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	errWait := A.WaitState(StateError, ctx)
+	st := A.State()
+
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer shortCancel()
+	errEst := A.WaitState(StateEstablished, shortCtx)
+	A.Stop()
+	after := A.State()
+
+	cv.Convey("Given a session that never hears its peer and runs out of retries, it should end in Error without ever being Established, and stay there after Stop.", t, func() {
+		cv.So(errWait, cv.ShouldBeNil)
+		cv.So(st, cv.ShouldEqual, StateError)
+		cv.So(errEst, cv.ShouldEqual, ErrStateUnreachable)
+		cv.So(after, cv.ShouldEqual, StateError)
+	})
+}
@@ -0,0 +1,184 @@
+package swp
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SessionStats is a point-in-time snapshot of a
+// Session's counters, as returned by Session.Stats.
+type SessionStats struct {
+	PacketsSent     int64
+	PacketsConsumed int64
+
+	// CumulBytesTransmitted counts the Data bytes our
+	// sender has sent, and CumulBytesDelivered the Data
+	// bytes our receiver has handed to the consumer.
+	// With no loss, the remote end's CumulBytesDelivered
+	// converges to our CumulBytesTransmitted.
+	CumulBytesTransmitted int64
+	CumulBytesDelivered   int64
+
+	NacksSent                int64
+	NacksActedOn             int64
+	FECRecoveries            int64
+	PiggybackedAcks          int64
+	StandaloneAcks           int64
+	TimedOutPackets          int64
+	DuplicateDeliveryDropped int64
+	ControlDropped           int64
+
+	// fraction of the send window in flight, and of
+	// the receive window awaiting the consumer.
+	WindowUtilization float64
+	BufferUtilization float64
+
+	// LargestSeqnoAcked is the last ack received, or -1,
+	// and SmallestUnackedSeqno the oldest packet still in
+	// flight; the gap between them shows a stall.
+	LargestSeqnoAcked    int64
+	SmallestUnackedSeqno int64
+
+	// HeldBytes is the Data bytes buffered by our sender
+	// awaiting acks plus by our receiver awaiting the
+	// consumer; see Session.HeldBytes.
+	HeldBytes int64
+
+	// DiscardsByReason is our receiver's drop counts.
+	DiscardsByReason DiscardReasons
+
+	// ReceiverReorderStats is our receiver's
+	// ReorderDistance.
+	ReceiverReorderStats ReorderStats
+
+	// RTT percentiles from our sender's RTTHist; all
+	// zero until the first ack. See RTTHistogram for
+	// their accuracy.
+	RTTMin time.Duration
+	RTTP50 time.Duration
+	RTTP90 time.Duration
+	RTTP99 time.Duration
+	RTTMax time.Duration
+
+	// AckLatencyP50 and AckLatencyP99 are percentiles of
+	// the time from Push to ack of our sender's latest
+	// AckLatencyWindow packets; zero until the first ack.
+	AckLatencyP50 time.Duration
+	AckLatencyP99 time.Duration
+
+	// PeakDeliveryQueueLen and CurrentDeliveryQueueLen
+	// are the longest our receiver's ReadyForDelivery has
+	// been, and its length now.
+	PeakDeliveryQueueLen    int64
+	CurrentDeliveryQueueLen int64
+
+	// CompressionRatio is the Data bytes our sender sent
+	// over those it was given, across its latest
+	// packets, with Compress; 0 without. See compress.go.
+	CompressionRatio float64
+
+	// TransportStats has what the Network knows of
+	// itself: a SubscriptionStats over a NatsNet, and
+	// nil otherwise.
+	TransportStats interface{}
+}
+
+// Stats returns a snapshot of the session's counters.
+// It is safe to call from any goroutine.
+func (s *Session) Stats() SessionStats {
+	snd := s.Swp.Sender
+	rcv := s.Swp.Recver
+	var transport interface{}
+	if nn, ok := s.Net.(*NatsNet); ok {
+		transport = nn.SubscriptionStats()
+	}
+	return SessionStats{
+		PacketsSent:     s.CountPacketsSentForTransfer(),
+		PacketsConsumed: s.CountPacketsReadConsumed(),
+
+		CumulBytesTransmitted: atomic.LoadInt64(&snd.TotalBytesSent),
+		CumulBytesDelivered:   atomic.LoadInt64(&rcv.CumulBytesDelivered),
+
+		NacksSent:                atomic.LoadInt64(&rcv.NacksSent),
+		NacksActedOn:             atomic.LoadInt64(&snd.NacksActedOn),
+		FECRecoveries:            atomic.LoadInt64(&rcv.FECRecoveries),
+		PiggybackedAcks:          atomic.LoadInt64(&snd.PiggybackedAcks),
+		StandaloneAcks:           atomic.LoadInt64(&snd.StandaloneAcks),
+		TimedOutPackets:          atomic.LoadInt64(&snd.TimedOutPackets),
+		DuplicateDeliveryDropped: atomic.LoadInt64(&rcv.DuplicateDeliveryDropped),
+		ControlDropped:           atomic.LoadInt64(&rcv.ControlDropped),
+
+		WindowUtilization: snd.WindowUtilization(),
+		BufferUtilization: rcv.BufferUtilization(),
+
+		LargestSeqnoAcked:    snd.LargestAckedSeqno(),
+		SmallestUnackedSeqno: snd.OldestUnackedSeqno(),
+
+		HeldBytes: s.HeldBytes(),
+
+		DiscardsByReason: rcv.DiscardReasons.load(),
+
+		ReceiverReorderStats: rcv.ReorderDistance.load(),
+
+		RTTMin: snd.RTTHist.Min(),
+		RTTP50: snd.RTTPercentile(0.50),
+		RTTP90: snd.RTTPercentile(0.90),
+		RTTP99: snd.RTTPercentile(0.99),
+		RTTMax: snd.RTTHist.Max(),
+
+		AckLatencyP50: snd.AckLatencyPercentile(0.50),
+		AckLatencyP99: snd.AckLatencyPercentile(0.99),
+
+		PeakDeliveryQueueLen:    atomic.LoadInt64(&rcv.MaxReadyForDeliveryLen),
+		CurrentDeliveryQueueLen: atomic.LoadInt64(&rcv.CurrentReadyForDeliveryLen),
+
+		CompressionRatio: snd.CompressionRatio(),
+
+		TransportStats: transport,
+	}
+}
+
+// HeldBytes returns the Data bytes the session holds in
+// memory: sent but unacked, and received but not yet
+// consumed. It is safe to call from any goroutine.
+func (s *Session) HeldBytes() int64 {
+	return s.Swp.Sender.HeldBytes() + s.Swp.Recver.HeldBytes()
+}
+
+// SubscribeStats pushes a fresh Stats snapshot on the
+// returned channel every interval, until cancel is
+// called or the session stops, when the channel is
+// closed. The channel holds one snapshot; if the last
+// one hasn't been taken, the new one is dropped rather
+// than wait on a slow reader. cancel does not block,
+// and may be called more than once.
+func (s *Session) SubscribeStats(interval time.Duration) (<-chan SessionStats, func()) {
+	ch := make(chan SessionStats, 1)
+	done := make(chan struct{})
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() { close(done) })
+	}
+
+	go func() {
+		defer close(ch)
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				select {
+				case ch <- s.Stats():
+				default:
+					// reader is behind; drop this one.
+				}
+			case <-done:
+				return
+			case <-s.Halt.ReqStop.Chan:
+				return
+			}
+		}
+	}()
+	return ch, cancel
+}
@@ -0,0 +1,302 @@
+package swp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test080CumulBytesDeliveredConverges(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	n := 20
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("twelve bytes"), TcpEvent: EventData})
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	cleanup()
+
+	sa := A.Stats()
+	sb := B.Stats()
+
+	cv.Convey("Given no loss, the bytes B delivered to its consumer should equal the bytes A transmitted.", t, func() {
+		cv.So(sa.PacketsSent, cv.ShouldEqual, n)
+		cv.So(sa.CumulBytesTransmitted, cv.ShouldEqual, 12*n)
+		cv.So(sb.CumulBytesDelivered, cv.ShouldEqual, sa.CumulBytesTransmitted)
+		cv.So(sb.PacketsConsumed, cv.ShouldEqual, n)
+	})
+}
+
+func Test081WindowAndBufferUtilization(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	A.SelfConsumeForTesting()
+
+	idleA := A.Stats()
+
+	// B doesn't read, so nothing gets acked.
+	for i := 0; i < 4; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("data"), TcpEvent: EventData})
+	}
+	time.Sleep(100 * time.Millisecond)
+	busyA := A.Stats()
+	busyB := B.Stats()
+
+	cleanup()
+
+	cv.Convey("Given 4 unread packets and windows of 10, B's receive buffer should be 40% full, and A's send window should be no more than that.", t, func() {
+		cv.So(idleA.WindowUtilization, cv.ShouldEqual, 0)
+		cv.So(busyA.WindowUtilization, cv.ShouldBeGreaterThan, 0)
+		cv.So(busyA.WindowUtilization, cv.ShouldBeLessThanOrEqualTo, 0.4)
+		cv.So(busyB.BufferUtilization, cv.ShouldEqual, 0.4)
+		cv.So(utilization(20, 10), cv.ShouldEqual, 1)
+	})
+}
+
+func Test085LargestAckedAndOldestUnacked(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	A.SelfConsumeForTesting()
+
+	lar0 := A.Swp.Sender.LargestAckedSeqno()
+	old0 := A.Swp.Sender.OldestUnackedSeqno()
+
+	n := 5
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("data"), TcpEvent: EventData})
+	}
+	time.Sleep(50 * time.Millisecond)
+	// B hasn't read anything.
+	old1 := A.Swp.Sender.OldestUnackedSeqno()
+
+	B.SelfConsumeForTesting()
+	time.Sleep(100 * time.Millisecond)
+	lar2 := A.Swp.Sender.LargestAckedSeqno()
+	old2 := A.Swp.Sender.OldestUnackedSeqno()
+
+	cleanup()
+
+	cv.Convey("Given 5 packets sent, LargestAckedSeqno should reach 4 once B reads them all, and OldestUnackedSeqno should then be 5, the next SeqNum.", t, func() {
+		cv.So(lar0, cv.ShouldEqual, -1)
+		cv.So(old0, cv.ShouldEqual, 0)
+		cv.So(old1, cv.ShouldBeLessThan, n)
+		cv.So(lar2, cv.ShouldEqual, n-1)
+		cv.So(old2, cv.ShouldEqual, n)
+	})
+}
+
+func Test102StatsSmallestUnackedAdvancesMonotonically(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	// sample A's stats while the pushes go on.
+	var samples []SessionStats
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+				samples = append(samples, A.Stats())
+			}
+		}
+	}()
+
+	n := 50
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("data"), TcpEvent: EventData})
+	}
+	time.Sleep(200 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	final := A.Stats()
+
+	cleanup()
+
+	cv.Convey("Given 50 packets pushed, SessionStats.SmallestUnackedSeqno and LargestSeqnoAcked should never go backwards, and should end at 50 and 49.", t, func() {
+		cv.So(len(samples), cv.ShouldBeGreaterThan, 0)
+		for i, st := range samples {
+			if i > 0 {
+				cv.So(st.SmallestUnackedSeqno, cv.ShouldBeGreaterThanOrEqualTo, samples[i-1].SmallestUnackedSeqno)
+				cv.So(st.LargestSeqnoAcked, cv.ShouldBeGreaterThanOrEqualTo, samples[i-1].LargestSeqnoAcked)
+			}
+		}
+		cv.So(final.LargestSeqnoAcked, cv.ShouldEqual, n-1)
+		cv.So(final.SmallestUnackedSeqno, cv.ShouldEqual, n)
+	})
+}
+
+func Test103StatsDiscardsByReason(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	net.CorruptProb = 0.2
+	rtt := 2 * lat
+
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithTimeout(rtt))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	n := 30
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("packet %v", i)), TcpEvent: EventData})
+	}
+	// a stranger, not B's peer.
+	strangers := 3
+	for i := 0; i < strangers; i++ {
+		panicOn(net.Send(&Packet{From: "C", Dest: "B", SeqNum: int64(i), TcpEvent: EventData}, "stranger"))
+	}
+	time.Sleep(500 * time.Millisecond)
+	cleanup()
+
+	d := B.Stats().DiscardsByReason
+
+	cv.Convey("Given a SimNet that corrupts packets, and packets from an inbox other than A, B's DiscardsByReason should count each corrupted packet under CorruptCRC and each stranger's under AuthFail.", t, func() {
+		cv.So(d.CorruptCRC, cv.ShouldBeGreaterThan, 0)
+		cv.So(d.CorruptCRC, cv.ShouldEqual, atomic.LoadInt64(&net.Corrupted))
+		cv.So(d.AuthFail, cv.ShouldEqual, strangers)
+		cv.So(d.OOOLimit, cv.ShouldEqual, 0)
+	})
+}
+
+func Test109SubscribeStats(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	ch, cancel := A.SubscribeStats(10 * time.Millisecond)
+
+	n := 20
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("data"), TcpEvent: EventData})
+	}
+	// a reader that doesn't read must not stall anything.
+	time.Sleep(200 * time.Millisecond)
+
+	var got []SessionStats
+	for len(got) < 3 {
+		got = append(got, <-ch)
+	}
+
+	t0 := time.Now()
+	cancel()
+	cancelDur := time.Since(t0)
+	cancel()
+	_, open := <-ch
+	for open {
+		// at most the one buffered snapshot remains.
+		_, open = <-ch
+	}
+
+	// a session's Stop also ends a subscription.
+	ch2, _ := B.SubscribeStats(10 * time.Millisecond)
+	cleanup()
+	for range ch2 {
+	}
+
+	cv.Convey("Given SubscribeStats, snapshots should keep arriving every interval without a slow reader holding anything up, and cancel should return at once and close the channel.", t, func() {
+		cv.So(got[len(got)-1].PacketsSent, cv.ShouldEqual, n)
+		cv.So(got[len(got)-1].LargestSeqnoAcked, cv.ShouldEqual, n-1)
+		cv.So(cancelDur, cv.ShouldBeLessThan, 10*time.Millisecond)
+		cv.So(open, cv.ShouldBeFalse)
+	})
+}
+
+func Test144StatsDeliveryQueueLen(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+
+	// nobody reads B yet, so all queue up there.
+	n := 7
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("data"), TcpEvent: EventData})
+	}
+	for i := 0; i < 100 && B.Swp.Recver.PeekNumReady() < int64(n); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	full := B.Stats()
+
+	got := 0
+	for got < n {
+		seq, err := B.ReadTimeout(5 * time.Second)
+		if err != nil {
+			break
+		}
+		got += len(seq.Seq)
+	}
+	for i := 0; i < 100 && B.Stats().CurrentDeliveryQueueLen > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	drained := B.Stats()
+
+	cv.Convey("Given a consumer that reads only after all have arrived, PeakDeliveryQueueLen should reach all of them and stay there, while CurrentDeliveryQueueLen falls back to 0.", t, func() {
+		cv.So(got, cv.ShouldEqual, n)
+		cv.So(full.PeakDeliveryQueueLen, cv.ShouldEqual, n)
+		cv.So(full.CurrentDeliveryQueueLen, cv.ShouldEqual, n)
+		cv.So(drained.PeakDeliveryQueueLen, cv.ShouldEqual, n)
+		cv.So(drained.CurrentDeliveryQueueLen, cv.ShouldEqual, 0)
+	})
+}
+
+func Test158CleanTransferDiscardsNoAcks(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	n := 30
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte("data"), TcpEvent: EventData})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	drainErr := A.Drain(ctx)
+	clean := atomic.LoadInt64(&A.Swp.Sender.DiscardCount)
+	lar := A.Swp.Sender.LargestAckedSeqno()
+
+	// an ack for a SeqNum we never sent.
+	A.Swp.Sender.GotPack <- &Packet{From: "B", Dest: "A", AckNum: 1000, TcpEvent: EventDataAck}
+	for i := 0; i < 100 && atomic.LoadInt64(&A.Swp.Sender.DiscardCount) == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	bogus := atomic.LoadInt64(&A.Swp.Sender.DiscardCount)
+	larAfter := A.Swp.Sender.LargestAckedSeqno()
+
+	cleanup()
+
+	cv.Convey("Given a clean transfer, every ack should be in the sender's window, so DiscardCount should stay 0; an ack past LastFrameSent should be discarded, leaving LargestAckedSeqno alone.", t, func() {
+		cv.So(drainErr, cv.ShouldBeNil)
+		cv.So(clean, cv.ShouldEqual, 0)
+		cv.So(lar, cv.ShouldEqual, n-1)
+		cv.So(bogus, cv.ShouldEqual, 1)
+		cv.So(larAfter, cv.ShouldEqual, n-1)
+	})
+}
@@ -0,0 +1,305 @@
+package swp
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Streams.
+//
+// A session can carry several logical streams, such as
+// separate file transfers, told apart by Packet.StreamID.
+// Stream.Push tags each packet with the stream's ID, and
+// the receiver never mixes streams in one InOrderSeq, so a
+// demultiplexer started by the first OpenStream can hand
+// each delivery to its own Stream. Each stream sees its
+// packets in the order they were pushed.
+//
+// Each stream is ordered on its own, SCTP style. The
+// sender numbers each stream's packets in StreamSeq, and
+// the receiver keeps a NextFrameExpected and an Rxq per
+// stream, delivering a stream's packets as soon as they
+// are in StreamSeq order, even while a gap in SeqNum,
+// from a packet lost on another stream, remains. The
+// receiver does so from the first packet it sees on a
+// stream other than 0, or from the start with
+// SessionConfig.IndependentStreams. Acks, and flow
+// control, stay per session: the window only moves once
+// the gap is filled, so a stream whose reader falls more
+// than DefaultStreamChSz deliveries behind still holds up
+// the others. The per-stream counters are not kept in a
+// Snapshot. Only the first RecvState.MaxStreams streams
+// seen are ordered on their own; the rest are delivered
+// in SeqNum order. For streams that are independent end
+// to end, give each its own session, over a MuxNet if
+// they must share one NATS subject.
+//
+// A peer can't make us keep streams without bound:
+// past RecvState.MaxStreams Streams, deliveries for a
+// stream we haven't opened are dropped, and counted in
+// Session.StreamDropped. Streams we open ourselves are
+// not limited.
+
+// DefaultStreamChSz is how many deliveries a Stream
+// holds for its reader.
+const DefaultStreamChSz = 16
+
+// DefaultMaxStreams is the RecvState.MaxStreams of a
+// new receiver.
+const DefaultMaxStreams = 64
+
+// Stream is one logical stream within a Session;
+// see OpenStream.
+type Stream struct {
+	ID   uint32
+	sess *Session
+	ch   chan InOrderSeq
+}
+
+// OpenStream returns the Stream with id, making it
+// if need be. Packets that arrive for a stream before
+// it is opened wait for it, while there are fewer than
+// RecvState.MaxStreams Streams.
+//
+// Once any stream is open, every delivery goes to a
+// Stream, so read stream 0 in place of ReadMessagesCh
+// for packets pushed without a StreamID.
+func (s *Session) OpenStream(id uint32) *Stream {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.streams == nil {
+		s.streams = make(map[uint32]*Stream)
+		go s.demuxStreams()
+	}
+	return s.streamLocked(id)
+}
+
+// streamLocked returns the Stream with id, making
+// it if need be. Call with s.mut held.
+func (s *Session) streamLocked(id uint32) *Stream {
+	st, ok := s.streams[id]
+	if !ok {
+		st = &Stream{ID: id, sess: s, ch: make(chan InOrderSeq, DefaultStreamChSz)}
+		s.streams[id] = st
+	}
+	return st
+}
+
+// demuxStreams hands each delivery to its Stream.
+func (s *Session) demuxStreams() {
+	for {
+		select {
+		case seq := <-s.ReadMessagesCh:
+			s.IncrPacketsReadConsumed(int64(len(seq.Seq)))
+			s.mut.Lock()
+			st, ok := s.streams[seq.StreamID]
+			if !ok && len(s.streams) < s.Swp.Recver.MaxStreams {
+				st = s.streamLocked(seq.StreamID)
+			}
+			s.mut.Unlock()
+			if st == nil {
+				// the peer opened more streams than we
+				// will hold for it.
+				atomic.AddInt64(&s.StreamDropped, int64(len(seq.Seq)))
+				continue
+			}
+			select {
+			case st.ch <- seq:
+			case <-s.Halt.ReqStop.Chan:
+				return
+			}
+		case <-s.Halt.ReqStop.Chan:
+			return
+		}
+	}
+}
+
+// Push sends pack on the stream, setting its StreamID.
+func (st *Stream) Push(pack *Packet) error {
+	pack.StreamID = st.ID
+	return st.sess.Push(pack)
+}
+
+// Read blocks until the stream's next in-order
+// packets arrive, ctx is done, or the session stops.
+func (st *Stream) Read(ctx context.Context) (InOrderSeq, error) {
+	select {
+	case seq := <-st.ch:
+		return seq, nil
+	case <-ctx.Done():
+		return InOrderSeq{}, ctx.Err()
+	case <-st.sess.Halt.ReqStop.Chan:
+		return InOrderSeq{}, ErrSessDone
+	}
+}
+
+// deliveredEarly reports whether seqno was given
+// to the consumer ahead of NextFrameExpected.
+func (r *RecvState) deliveredEarly(seqno int64) bool {
+	if seqno <= r.NextFrameExpected || seqno >= r.NextFrameExpected+r.RecvWindowSize {
+		return false
+	}
+	slot := r.Rxq[seqno%r.RecvWindowSize]
+	return slot.Received && slot.Pack.SeqNum == seqno && slot.Pack.early
+}
+
+// streamRxq returns the Rxq of stream id, sized to
+// the receive window, or nil if we already order
+// MaxStreams others on their own; such a stream is
+// delivered in SeqNum order only. A stream has no more
+// than the window's worth of packets ahead of its own
+// NextFrameExpected, so StreamSeq modulo the window
+// picks a slot.
+func (r *RecvState) streamRxq(id uint32) []*RxqSlot {
+	if r.perStreamRxq == nil {
+		r.perStreamRxq = make(map[uint32][]*RxqSlot)
+		r.perStreamNFE = make(map[uint32]int64)
+		r.streamsPending = make(map[uint32]bool)
+	}
+	q, ok := r.perStreamRxq[id]
+	if !ok && len(r.perStreamRxq) >= r.MaxStreams {
+		return nil
+	}
+	if int64(len(q)) == r.RecvWindowSize {
+		return q
+	}
+	// new, or the window was resized.
+	old := q
+	q = make([]*RxqSlot, r.RecvWindowSize)
+	for i := range q {
+		q[i] = &RxqSlot{}
+	}
+	for _, slot := range old {
+		if slot.Received && r.inStreamWindow(slot.Pack) {
+			*q[slot.Pack.StreamSeq%r.RecvWindowSize] = *slot
+		}
+	}
+	r.perStreamRxq[id] = q
+	return q
+}
+
+// inStreamWindow reports whether the StreamSeq of pack
+// is within the window starting at its stream's
+// NextFrameExpected, and so may be held in its Rxq.
+func (r *RecvState) inStreamWindow(pack *Packet) bool {
+	nfe := r.perStreamNFE[pack.StreamID]
+	return pack.StreamSeq >= nfe && pack.StreamSeq < nfe+r.RecvWindowSize
+}
+
+// streamArrived holds pack, which arrived ahead of
+// NextFrameExpected, in its stream's Rxq, and delivers
+// what that lets us. A pack out of its stream's window
+// is not held, and waits for SeqNum order; so does one
+// on a stream we don't order on its own.
+func (r *RecvState) streamArrived(pack *Packet) {
+	q := r.streamRxq(pack.StreamID)
+	if q == nil || !r.inStreamWindow(pack) {
+		return
+	}
+	slot := q[pack.StreamSeq%int64(len(q))]
+	slot.Received = true
+	slot.Pack = pack
+	r.drainStream(pack.StreamID)
+}
+
+// drainStream moves the packets of stream id that are
+// next in StreamSeq order, but held behind a gap in
+// SeqNum, to ReadyForDelivery, for as long as there is
+// room. readyInOrder passes over them later. A stream
+// left waiting only on room stays in streamsPending.
+func (r *RecvState) drainStream(id uint32) {
+	q := r.streamRxq(id)
+	for {
+		nfe := r.perStreamNFE[id]
+		slot := q[nfe%int64(len(q))]
+		if !slot.Received || slot.Pack.StreamSeq != nfe ||
+			slot.Pack.SeqNum <= r.NextFrameExpected {
+			// not here yet, or for readyInOrder.
+			delete(r.streamsPending, id)
+			return
+		}
+		if r.ReadyForDelivery.Full() {
+			r.streamsPending[id] = true
+			return
+		}
+		pack := slot.Pack
+		slot.Received = false
+		slot.Pack = nil
+		r.perStreamNFE[id] = nfe + 1
+		pack.early = true
+		r.pushReady(pack)
+		r.RecvHistory = append(r.RecvHistory, pack)
+	}
+}
+
+// drainStreams is drainStream on every stream in
+// streamsPending: those that readyInOrder has moved
+// along, or that wait on room in ReadyForDelivery.
+// Other streams can't have moved since their last
+// arrival.
+func (r *RecvState) drainStreams() {
+	for id := range r.streamsPending {
+		r.drainStream(id)
+	}
+}
+
+// streamPassed notes that readyInOrder has reached
+// pack, in SeqNum order.
+func (r *RecvState) streamPassed(pack *Packet) {
+	q := r.streamRxq(pack.StreamID)
+	if q == nil {
+		return
+	}
+	if r.inStreamWindow(pack) {
+		slot := q[pack.StreamSeq%int64(len(q))]
+		if slot.Received && slot.Pack.SeqNum == pack.SeqNum {
+			slot.Received = false
+			slot.Pack = nil
+		}
+	}
+	if pack.StreamSeq >= r.perStreamNFE[pack.StreamID] {
+		r.perStreamNFE[pack.StreamID] = pack.StreamSeq + 1
+		r.streamsPending[pack.StreamID] = true
+	}
+}
+
+// streamEvicted forgets pack, dropped from Rxq
+// before it was delivered, in its stream's Rxq.
+func (r *RecvState) streamEvicted(pack *Packet) {
+	q := r.perStreamRxq[pack.StreamID]
+	if q == nil || !r.inStreamWindow(pack) {
+		return
+	}
+	slot := q[pack.StreamSeq%int64(len(q))]
+	if slot.Received && slot.Pack.SeqNum == pack.SeqNum {
+		slot.Received = false
+		slot.Pack = nil
+	}
+}
+
+// advanceConsumed moves LastFrameClientConsumed up
+// through every SeqNum the consumer has taken, which
+// with early deliveries need not be the last taken.
+// It reports whether it moved. It steps from
+// LastFrameClientConsumed to the first SeqNum still
+// held, so each SeqNum is stepped over once.
+func (r *RecvState) advanceConsumed() bool {
+	through := r.LastFrameClientConsumed
+	for through+1 < r.NextFrameExpected && r.RcvdButNotConsumed[through+1] == nil {
+		through++
+	}
+	if through <= r.LastFrameClientConsumed {
+		return false
+	}
+	bytes := r.nfeCumulBytes
+	if pack := r.RcvdButNotConsumed[through+1]; pack != nil {
+		bytes = pack.CumulBytesTransmitted - int64(len(pack.Data))
+	}
+	r.LastMsgConsumed = through
+	r.LastFrameClientConsumed = through
+	if r.pipe == nil {
+		// with a pipe, we wait to see the consumer read.
+		r.LastByteConsumed = bytes
+	}
+	return true
+}
@@ -0,0 +1,285 @@
+package swp
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test111StreamsWithinOneSession(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	A.SelfConsumeForTesting()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	readAll := func(st *Stream, want int) (got []string, mixed bool) {
+		for len(got) < want {
+			seq, err := st.Read(ctx)
+			if err != nil {
+				return
+			}
+			for _, pack := range seq.Seq {
+				if pack.StreamID != seq.StreamID || seq.StreamID != st.ID {
+					mixed = true
+				}
+				got = append(got, string(pack.Data))
+			}
+		}
+		return
+	}
+	n := 20
+	b2 := B.OpenStream(2)
+	done := make(chan bool)
+	var got2 []string
+	var mixed2 bool
+	go func() {
+		got2, mixed2 = readAll(b2, n)
+		close(done)
+	}()
+
+	a1, a2 := A.OpenStream(1), A.OpenStream(2)
+	go func() {
+		for i := 0; i < n; i++ {
+			panicOn(a1.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("one %v", i)), TcpEvent: EventData}))
+			panicOn(a2.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("two %v", i)), TcpEvent: EventData}))
+		}
+		panicOn(A.Push(&Packet{From: "A", Dest: "B", Data: []byte("default"), TcpEvent: EventData}))
+	}()
+
+	// stream 1's packets wait for it to open.
+	time.Sleep(50 * time.Millisecond)
+	b1 := B.OpenStream(1)
+	got1, mixed1 := readAll(b1, n)
+	<-done
+	got0, mixed0 := readAll(B.OpenStream(0), 1)
+
+	cleanup()
+
+	cv.Convey("Given two streams pushed interleaved over one session, each Stream should read only its own packets, in order, and packets pushed without a stream should go to stream 0.", t, func() {
+		cv.So(mixed0 || mixed1 || mixed2, cv.ShouldBeFalse)
+		cv.So(len(got1), cv.ShouldEqual, n)
+		cv.So(len(got2), cv.ShouldEqual, n)
+		for i := 0; i < n; i++ {
+			cv.So(got1[i], cv.ShouldEqual, fmt.Sprintf("one %v", i))
+			cv.So(got2[i], cv.ShouldEqual, fmt.Sprintf("two %v", i))
+		}
+		cv.So(got0, cv.ShouldResemble, []string{"default"})
+		cv.So(B.CountPacketsReadConsumed(), cv.ShouldEqual, 2*n+1)
+	})
+}
+
+// holdNet loses every send of SeqNum 0 while hold is set,
+// batched retries included.
+type holdNet struct {
+	*SimNet
+	hold int32
+}
+
+func (n *holdNet) held(pack *Packet) bool {
+	return pack.TcpEvent == EventData && pack.SeqNum == 0 && atomic.LoadInt32(&n.hold) == 1
+}
+
+func (n *holdNet) Send(pack *Packet, why string) error {
+	if n.held(pack) {
+		return nil
+	}
+	return n.SimNet.Send(pack, why)
+}
+
+func (n *holdNet) SendBatch(packs []*Packet, why string) error {
+	var keep []*Packet
+	for _, pack := range packs {
+		if !n.held(pack) {
+			keep = append(keep, pack)
+		}
+	}
+	return n.SimNet.SendBatch(keep, why)
+}
+
+func Test134IndependentStreamsDeliverPastAGap(t *testing.T) {
+
+	net := &holdNet{SimNet: NewSimNet(0, time.Millisecond), hold: 1}
+	indep := func(cfg *SessionConfig) { cfg.IndependentStreams = true }
+	A, B, cleanup, err := SwpPipe(WithNet(net), OnlyOn("B", indep))
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+
+	one := B.OpenStream(1)
+	two := B.OpenStream(2)
+	panicOn(A.OpenStream(1).Push(&Packet{From: "A", Dest: "B", Data: []byte("one"), TcpEvent: EventData}))
+	n := 4
+	for i := 0; i < n; i++ {
+		panicOn(A.OpenStream(2).Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var gotTwo []string
+	for len(gotTwo) < n {
+		seq, err := two.Read(ctx)
+		if err != nil {
+			break
+		}
+		for _, pack := range seq.Seq {
+			gotTwo = append(gotTwo, string(pack.Data))
+		}
+	}
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer shortCancel()
+	_, errHeld := one.Read(shortCtx)
+	ackedHeld := A.Swp.Sender.LargestAckedSeqno()
+
+	atomic.StoreInt32(&net.hold, 0)
+	seq, errOne := one.Read(ctx)
+	for i := 0; i < 100 && A.Swp.Sender.LargestAckedSeqno() < int64(n); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	acked := A.Swp.Sender.LargestAckedSeqno()
+
+	cv.Convey("Given IndependentStreams and the first packet, on stream 1, lost, stream 2 should still be delivered in order, with nothing acked past the gap; once the loss ends, stream 1 should follow, and everything be acked.", t, func() {
+		cv.So(gotTwo, cv.ShouldResemble, []string{"0", "1", "2", "3"})
+		cv.So(errHeld, cv.ShouldNotBeNil)
+		cv.So(ackedHeld, cv.ShouldEqual, -1)
+		cv.So(errOne, cv.ShouldBeNil)
+		cv.So(string(seq.Seq[0].Data), cv.ShouldEqual, "one")
+		cv.So(acked, cv.ShouldEqual, n)
+	})
+}
+
+func Test164IndependentStreamsAreBounded(t *testing.T) {
+
+	indep := func(cfg *SessionConfig) { cfg.IndependentStreams = true }
+	waitConsumed := func(s *Session, want int64) int64 {
+		for i := 0; i < 500 && s.CountPacketsReadConsumed() < want; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return s.CountPacketsReadConsumed()
+	}
+
+	// one packet on each of more streams than MaxStreams,
+	// all behind the loss of the first, in a window
+	// wide enough that none waits on an ack.
+	net := &holdNet{SimNet: NewSimNet(0, time.Millisecond), hold: 1}
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithWindowMsgCount(200), OnlyOn("B", indep))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+	n := DefaultMaxStreams + 10
+	for i := 0; i < n; i++ {
+		panicOn(A.Push(&Packet{From: "A", Dest: "B", StreamID: uint32(i), Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData}))
+	}
+	early := waitConsumed(B, DefaultMaxStreams)
+	time.Sleep(50 * time.Millisecond)
+	earlyAfter := B.CountPacketsReadConsumed()
+	atomic.StoreInt32(&net.hold, 0)
+	all := waitConsumed(B, int64(n))
+	cleanup()
+	tracked := len(B.Swp.Recver.perStreamRxq)
+
+	// StreamSeqs out of their stream's window.
+	A, B, cleanup, err = SwpPipe(OnlyOn("B", indep))
+	panicOn(err)
+	B.SelfConsumeForTesting()
+	inject := func(seqno, streamSeq int64) {
+		data := []byte(fmt.Sprintf("%v", seqno))
+		panicOn(A.Net.(*SimNet).InjectPacket("B", &Packet{
+			From:            "A",
+			Dest:            "B",
+			FromSessNonce:   A.LocalSessNonce,
+			DestSessNonce:   B.LocalSessNonce,
+			SeqNum:          seqno,
+			AckNum:          -1,
+			TcpEvent:        EventData,
+			Version:         ProtocolVersion,
+			StreamID:        7,
+			StreamSeq:       streamSeq,
+			Data:            data,
+			Blake2bChecksum: Blake2bOfBytes(data),
+		}))
+	}
+	inject(1, -1)
+	inject(2, 1<<40)
+	time.Sleep(20 * time.Millisecond)
+	heldEarly := B.CountPacketsReadConsumed()
+	inject(0, 0)
+	bad := waitConsumed(B, 3)
+	cleanup()
+	var order []string
+	for _, pack := range B.Swp.Recver.RecvHistory {
+		order = append(order, string(pack.Data))
+	}
+
+	cv.Convey("Given IndependentStreams, only the first MaxStreams streams should be ordered on their own, the rest waiting for SeqNum order; and a packet whose StreamSeq is out of its stream's window should not be held for its stream, but delivered in SeqNum order.", t, func() {
+		cv.So(early, cv.ShouldEqual, DefaultMaxStreams)
+		cv.So(earlyAfter, cv.ShouldEqual, DefaultMaxStreams)
+		cv.So(all, cv.ShouldEqual, n)
+		cv.So(tracked, cv.ShouldEqual, DefaultMaxStreams)
+
+		cv.So(heldEarly, cv.ShouldEqual, 0)
+		cv.So(bad, cv.ShouldEqual, 3)
+		cv.So(order, cv.ShouldResemble, []string{"0", "1", "2"})
+	})
+}
+
+func Test170StreamsAreOrderedOnTheirOwnAndBounded(t *testing.T) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// without IndependentStreams, stream 2 still gets
+	// past the loss of stream 1's first packet.
+	net := &holdNet{SimNet: NewSimNet(0, time.Millisecond), hold: 1}
+	A, B, cleanup, err := SwpPipe(WithNet(net))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	one := B.OpenStream(1)
+	two := B.OpenStream(2)
+	panicOn(A.OpenStream(1).Push(&Packet{From: "A", Dest: "B", Data: []byte("one"), TcpEvent: EventData}))
+	panicOn(A.OpenStream(2).Push(&Packet{From: "A", Dest: "B", Data: []byte("two"), TcpEvent: EventData}))
+	seqTwo, errTwo := two.Read(ctx)
+	atomic.StoreInt32(&net.hold, 0)
+	seqOne, errOne := one.Read(ctx)
+	cleanup()
+
+	// a peer's streams past MaxStreams are dropped,
+	// but not those we open.
+	A, B, cleanup, err = SwpPipe()
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+	B.Swp.Recver.MaxStreams = 2
+	first := B.OpenStream(0)
+	mine := B.OpenStream(9)
+	for id := uint32(1); id <= 5; id++ {
+		panicOn(A.OpenStream(id).Push(&Packet{From: "A", Dest: "B", Data: []byte("peer"), TcpEvent: EventData}))
+	}
+	panicOn(A.Push(&Packet{From: "A", Dest: "B", Data: []byte("zero"), TcpEvent: EventData}))
+	panicOn(A.OpenStream(9).Push(&Packet{From: "A", Dest: "B", Data: []byte("nine"), TcpEvent: EventData}))
+	seqZero, errZero := first.Read(ctx)
+	seqNine, errNine := mine.Read(ctx)
+	B.mut.Lock()
+	nStreams := len(B.streams)
+	B.mut.Unlock()
+	dropped := atomic.LoadInt64(&B.StreamDropped)
+
+	cv.Convey("Given streams, the receiver should order each on its own even without IndependentStreams, so one stream gets past a loss on another; and, past MaxStreams, deliveries for streams the peer opened but we didn't should be dropped and counted, while those we opened still arrive.", t, func() {
+		cv.So(errTwo, cv.ShouldBeNil)
+		cv.So(string(seqTwo.Seq[0].Data), cv.ShouldEqual, "two")
+		cv.So(errOne, cv.ShouldBeNil)
+		cv.So(string(seqOne.Seq[0].Data), cv.ShouldEqual, "one")
+
+		cv.So(errZero, cv.ShouldBeNil)
+		cv.So(string(seqZero.Seq[0].Data), cv.ShouldEqual, "zero")
+		cv.So(errNine, cv.ShouldBeNil)
+		cv.So(string(seqNine.Seq[0].Data), cv.ShouldEqual, "nine")
+		cv.So(nStreams, cv.ShouldEqual, 2)
+		cv.So(dropped, cv.ShouldEqual, 5)
+	})
+}
@@ -41,6 +41,7 @@ package swp
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -101,7 +102,9 @@ type Packet struct {
 
 	// ArrivedAtDestTm is timestamped by
 	// the receiver immediately when the
-	// packet arrives at the Dest receiver.
+	// packet arrives at the Dest receiver,
+	// unless a SimNet simulating clock skew
+	// stamped it first.
 	ArrivedAtDestTm time.Time
 
 	// DataSendTm is stamped anew on each data send and retry
@@ -139,6 +142,13 @@ type Packet struct {
 	AckRetry   int64
 	AckReplyTm time.Time
 
+	// Nak is set by a receiver that has detected a gap;
+	// NackNum is then the first missing SeqNum, which the
+	// sender should retransmit right away rather than
+	// waiting for its retry timeout to fire.
+	NackNum int64
+	Nak     bool
+
 	// things like Fin, FinAck, DataAck, KeepAlive are
 	// all TcpEvents.
 	TcpEvent TcpEvent
@@ -146,8 +156,9 @@ type Packet struct {
 	// Convey the state in keepalives in place of
 	// retry for the estabAck. Otherwise if estabAck
 	// is lost, the client doing Connect() can get stuck
-	// in SynSent.
-	FromTcpState TcpState
+	// in SynSent. Not on the wire: only networks that
+	// hand over the *Packet itself carry it.
+	FromTcpState TcpState `msg:"-"`
 
 	// like the byte count AdvertisedWindow in TCP, but
 	// since nats has both byte and message count
@@ -155,6 +166,11 @@ type Packet struct {
 	AvailReaderBytesCap int64
 	AvailReaderMsgCap   int64
 
+	// ProposeWindowSize, when not 0, is the receive
+	// window, in packets, that the sender of a keepalive
+	// has resized to; see RecvState.ProposeWindowSize.
+	ProposeWindowSize int64
+
 	// Estimate of the round-trip-time (RTT) from
 	// the senders point of view. In nanoseconds.
 	// Allows mostly passive recievers to have
@@ -192,19 +208,134 @@ type Packet struct {
 	// checksum of Data
 	Blake2bChecksum []byte
 
+	// Parity marks a forward error correction packet;
+	// see fec.go.
+	Parity bool
+
+	// Control marks an out-of-band control message,
+	// outside the sequenced data stream; see control.go.
+	Control bool
+
+	// Metadata holds application-defined headers, such
+	// as trace IDs or content types. The protocol itself
+	// never inspects it. See SetMeta and GetMeta.
+	Metadata map[string]string
+
+	// Version is the ProtocolVersion of the sender.
+	// Zero means a peer from before versioning.
+	Version uint8
+
+	// StreamID names the logical stream, within the
+	// session, that a data packet belongs to; see
+	// OpenStream. Zero is the default stream.
+	StreamID uint32
+
+	// StreamSeq numbers the data packets of StreamID,
+	// from 0, so that a receiver with IndependentStreams
+	// can put each stream in order on its own.
+	StreamSeq int64
+
+	// Priority orders delivery, 0 first, at a receiver
+	// with PriorityDelivery. Only packets ready together
+	// are reordered: a packet is never delivered ahead
+	// of a gap.
+	Priority uint8
+
+	// KAReply marks the ack that answers an
+	// EventKeepAlive; see KeepAliveExpectReply.
+	KAReply bool
+
+	// CompressedSize is the length of Data as sent,
+	// deflated, or 0 if it went uncompressed; see
+	// compress.go.
+	CompressedSize int64
+
+	// CircuitOpen marks the control packet a receiver
+	// sends as its circuit breaker opens; see circuit.go.
+	// CircuitResetNsec says how long it will stay open,
+	// its CircuitResetTimeout.
+	CircuitOpen      bool
+	CircuitResetNsec int64
+
+	// EOF marks the last packet of a transfer, as
+	// sent by PushEOF; see ReadAll.
+	EOF bool
+
+	// TraceParent is the W3C traceparent of the
+	// packet's send span, when the sending session
+	// has a Telemetry provider; see telemetry.go.
+	TraceParent string
+
+	// Nonce is the AES-GCM nonce that Data was sealed
+	// under, when the session has an EncryptionKey;
+	// see crypt.go.
+	Nonce []byte
+
+	// AuthTag authenticates the whole packet, when the
+	// session has an EncryptionKey; see crypt.go.
+	AuthTag []byte
+
 	// those waiting for when this particular
 	// Packet is acked by the
 	// recipient can allocate a bchan.New(1) here and wait for a
 	// channel receive on <-CliAcked.Ch
-	CliAcked *bchan.Bchan `msg:"-"` // omit from serialization
+	CliAcked *bchan.Bchan `msg:"-" json:"-"` // omit from serialization
+
+	// bridged is set by the receiver for a packet that
+	// arrived after a later one; see InOrderSeq.Gaps.
+	bridged bool `msg:"-"`
+
+	// early is set by the receiver for a packet it
+	// delivered ahead of a gap on another stream.
+	early bool `msg:"-"`
+
+	// recovered is set on a packet the receiver
+	// rebuilt from FEC parity; see fec.go.
+	recovered bool `msg:"-"`
+
+	// pushTime is set by Push; see acklatency.go.
+	pushTime time.Time `msg:"-"`
+
+	Accounting *ByteAccount `msg:"-" json:"-"` // omit from serialization
+}
 
-	Accounting *ByteAccount `msg:"-"` // omit from serialization
+// ProtocolVersion is stamped into the Version of
+// every Packet we send.
+//
+// Packets are msgp maps keyed by field name, so a
+// decoder skips fields it doesn't know and leaves
+// fields the sender didn't know at their zero value.
+// Adding fields therefore stays wire compatible in
+// both directions, and a new field's zero value should
+// mean "the old behavior". Bump ProtocolVersion when
+// the meaning of the wire format changes, so that
+// SessionConfig.MinPeerVersion can reject old peers.
+const ProtocolVersion uint8 = 1
+
+// SetMeta sets key to val in pack.Metadata,
+// allocating the map if need be.
+func (pack *Packet) SetMeta(key, val string) {
+	if pack.Metadata == nil {
+		pack.Metadata = make(map[string]string)
+	}
+	pack.Metadata[key] = val
+}
+
+// GetMeta returns the Metadata value for key,
+// and whether it was present.
+func (pack *Packet) GetMeta(key string) (string, bool) {
+	val, ok := pack.Metadata[key]
+	return val, ok
 }
 
 // SWP holds the Sliding Window Protocol state
 type SWP struct {
 	Sender *SenderState
 	Recver *RecvState
+
+	// Ready is closed once both the Sender and
+	// Recver goroutines are up and running.
+	Ready chan struct{}
 }
 
 // NewSWP makes a new sliding window protocol manager, holding
@@ -212,11 +343,25 @@ type SWP struct {
 func NewSWP(net Network, windowMsgCount int64, windowByteCount int64,
 	timeout time.Duration, inbox string, destInbox string, clk Clock, keepAliveInterval time.Duration, nonce string) *SWP {
 
-	snd := NewSenderState(net, windowMsgCount, timeout, inbox, destInbox, clk, keepAliveInterval, nonce)
-	rcv := NewRecvState(net, windowMsgCount, windowByteCount, timeout, inbox, snd, clk, nonce, destInbox, keepAliveInterval)
+	return newSWP(net, windowMsgCount, windowMsgCount, windowByteCount,
+		timeout, inbox, destInbox, clk, keepAliveInterval, nonce)
+}
+
+// newSWP allows the sender and receiver windows to differ
+// in size, for half-duplex sessions.
+func newSWP(net Network, sendMsgCount int64, recvMsgCount int64, windowByteCount int64,
+	timeout time.Duration, inbox string, destInbox string, clk Clock, keepAliveInterval time.Duration, nonce string) *SWP {
+
+	snd := NewSenderState(net, sendMsgCount, timeout, inbox, destInbox, clk, keepAliveInterval, nonce)
+	rcv := NewRecvState(net, recvMsgCount, windowByteCount, timeout, inbox, snd, clk, nonce, destInbox, keepAliveInterval)
+	// seed the flow info our data packets advertise, so a
+	// peer that gets our data before any ack from us isn't
+	// told that our reader has zero capacity.
+	rcv.UpdateControl(nil)
 	swp := &SWP{
 		Sender: snd,
 		Recver: rcv,
+		Ready:  make(chan struct{}),
 	}
 
 	return swp
@@ -242,11 +387,29 @@ type Session struct {
 	ReadMessagesCh    chan InOrderSeq
 	AcceptReadRequest chan *ReadRequest
 
+	// unread holds what ReadAll read past its EOF,
+	// for the next ReadCtx or ReadAll.
+	unreadMut sync.Mutex
+	unread    InOrderSeq
+
+	// ControlCh receives out-of-band control
+	// packets from the remote SendControl.
+	ControlCh chan *Packet
+
+	// Events dispatches to Subscribe handlers.
+	Events *EventBus
+
 	// if terminated with error,
 	// that error will live here. Retreive
 	// with GetErr()
 	exitErr error
 
+	// ErrCh receives any fatal error that
+	// terminates the session, such as
+	// ErrMaxRetriesExceeded. It is buffered,
+	// so nobody need be listening.
+	ErrCh chan error
+
 	// Halt.Done.Chan is closed if session is terminated.
 	// This will happen if the remote session stops
 	// responding and is thus declared dead, as well
@@ -262,9 +425,45 @@ type Session struct {
 	mut                sync.Mutex
 	RemoteSenderClosed chan bool
 
+	// net.Conn style deadlines, protected by mut, and
+	// the channel closed when they next change.
+	// See deadline.go.
+	readDeadline    time.Time
+	writeDeadline   time.Time
+	deadlineChanged chan struct{}
+
+	// per-key locks for PushOrdered, protected by mut.
+	// An entry lives only while some call holds or
+	// waits on it.
+	orderMut map[string]*orderLock
+
+	// streams from OpenStream, protected by mut.
+	// StreamDropped counts the deliveries demuxStreams
+	// threw away, for streams the peer used but we
+	// never opened, once we held MaxStreams. Read with
+	// atomic.LoadInt64. See stream.go.
+	streams       map[uint32]*Stream
+	StreamDropped int64
+
+	// Push holds batchMut for reading, and PushBatch
+	// for writing, so that no Push lands mid-batch.
+	batchMut sync.RWMutex
+
+	// lifecycle state; see state.go. state is read
+	// with atomic.LoadInt32, and changed, with
+	// stateReached and stateChanged, under stateMut.
+	state        int32
+	stateMut     sync.Mutex
+	stateReached uint8
+	stateChanged chan struct{}
+
 	LocalSessNonce  string
 	RemoteSessNonce string
 
+	// ChaosFaults counts the faults injected under
+	// ChaosMode; read it with atomic.LoadInt64.
+	ChaosFaults int64
+
 	// testing only
 	simulateLostSynCount int
 }
@@ -299,9 +498,190 @@ type SessionConfig struct {
 	// with no remote contact, we close the session).
 	NumFailedKeepAlivesBeforeClosing int
 
+	// AdaptiveKeepAlive backs the keepalive interval off,
+	// doubling it after each keepalive up to
+	// MaxKeepAliveInterval, while the session is idle;
+	// an ack of new data resets it to KeepAliveInterval.
+	// MaxKeepAliveInterval defaults to 8 * KeepAliveInterval,
+	// and should stay well under the auto-close limit of
+	// KeepAliveInterval * NumFailedKeepAlivesBeforeClosing.
+	AdaptiveKeepAlive    bool
+	MaxKeepAliveInterval time.Duration
+
 	// the clock (real or simulated) to use
 	Clk Clock
 
+	// FECGroupSize, if > 0, has the sender follow
+	// every FECGroupSize data packets with an XOR
+	// parity packet, and lets the receiver rebuild a
+	// single lost packet per group from it. Set it
+	// on both ends. 0 means disabled.
+	FECGroupSize int
+
+	// CongestionControl turns on loss-based congestion
+	// control in the sender; see cong.go. Off by default,
+	// leaving flow control as the only limit on sending.
+	CongestionControl bool
+
+	// CongestionAlgorithm picks the congestion control:
+	// CongAlgoAIMD, the default, or CongAlgoCUBIC, which
+	// turns congestion control on by itself.
+	CongestionAlgorithm CongAlgo
+
+	// HalfDuplex restricts the session to sending
+	// or to receiving data; see halfduplex.go.
+	// The default, FullDuplex, does both.
+	HalfDuplex HalfDuplexRole
+
+	// MaxRetries: give up and close the session
+	// once any packet has been retried this many
+	// times. 0 means retry forever.
+	MaxRetries int
+
+	// Codec, if not nil, is handed to Net when Net is
+	// a CodecNetwork, to replace msgp as the wire
+	// format; see codec.go. It then applies to every
+	// session on Net.
+	Codec Codec
+
+	// PiggybackWindow: if > 0, acks wait up to this
+	// long to ride along on our next data packet,
+	// rather than being sent on their own.
+	PiggybackWindow time.Duration
+
+	// DeduplicateWindow: if > 0, the receiver remembers
+	// the last DeduplicateWindow SeqNum delivered, and
+	// acks but does not re-deliver any replay of them,
+	// as can happen when a sender resends after a reconnect.
+	DeduplicateWindow int
+
+	// WindowAutoTune sizes the send window, up to
+	// WindowMsgCount, to the bandwidth-delay product
+	// of the path, once AutoTuneMinSamples RTT samples
+	// are in (0 means DefaultAutoTuneMinSamples).
+	// See autotune.go.
+	WindowAutoTune     bool
+	AutoTuneMinSamples int
+
+	// HighWaterMark and LowWaterMark, as fractions of
+	// the receive window, control Session.BackpressureCh;
+	// see backpressure.go. HighWaterMark 0 means off.
+	// LowWaterMark 0 means HighWaterMark/2.
+	HighWaterMark float64
+	LowWaterMark  float64
+
+	// EventBusCap sets how many Events may queue for
+	// Subscribe handlers before more are dropped.
+	// 0 means DefaultEventBusCap. See eventbus.go.
+	EventBusCap int
+
+	// MinPeerVersion, if > 0, has the receiver drop any
+	// packet whose Version is older than this. Since
+	// peers from before versioning send Version 0,
+	// MinPeerVersion 1 rejects them. See ProtocolVersion.
+	MinPeerVersion uint8
+
+	// ReadyForDeliveryMaxLen, if > 0, bounds how many
+	// in-order packets wait for the consumer; past it
+	// we stop acking, and so the sender stops, until
+	// the consumer catches up. DropOnReadyFull instead
+	// drops the oldest waiting packet. See RecvState.
+	ReadyForDeliveryMaxLen int
+	DropOnReadyFull        bool
+
+	// MaxBufferedBytes, if > 0, bounds the Data bytes our
+	// receiver holds for the consumer; at it, we advertise
+	// a zero window until the consumer drains. See
+	// RecvState.MaxBufferedBytes and Session.HeldBytes.
+	MaxBufferedBytes int64
+
+	// ManualAck: a delivery is not consumed, acked, or
+	// let out of the window until the consumer commits
+	// it; see ReadAndAck. Off by default, when taking a
+	// delivery consumes it.
+	ManualAck bool
+
+	// ChaosMode turns on fault injection, for resilience
+	// and soak testing; see chaos.go. ChaosSeed seeds the
+	// choice and timing of the faults.
+	ChaosMode bool
+	ChaosSeed int64
+
+	// IndependentStreams orders each stream on its own,
+	// so a packet lost on one stream holds up only that
+	// stream; see stream.go. Only the receiving end
+	// needs it, and it turns on by itself once a packet
+	// arrives on a stream other than 0; set it to do so
+	// from the start.
+	IndependentStreams bool
+
+	// PriorityDelivery has the receiver deliver ready
+	// packets by their Priority, 0 first; see
+	// RecvState.PriorityDelivery.
+	PriorityDelivery bool
+
+	// KeepAliveExpectReply declares the session dead
+	// when a keepalive goes unanswered for 2 * Timeout,
+	// closing it with ErrKeepAliveNoReply. Unlike
+	// NumFailedKeepAlivesBeforeClosing, this notices a
+	// silent peer within a few Timeouts, even on an
+	// idle session.
+	KeepAliveExpectReply bool
+
+	// ReservedBytesCap and ReservedMsgCap are held back
+	// from the window the receiver advertises, as
+	// headroom for acks and other control traffic;
+	// see RecvState.ReservedBytesCap. Each must be
+	// less than the window.
+	ReservedBytesCap int64
+	ReservedMsgCap   int64
+
+	// CircuitBreakerThreshold, if > 0, has the receiver
+	// stop acking a sender that keeps sending outside
+	// our window: more than CircuitBreakerThreshold such
+	// packets a second, for CircuitBreakerDuration, opens
+	// the circuit for CircuitResetTimeout, by default
+	// DefaultCircuitResetTimeout. See circuit.go.
+	CircuitBreakerThreshold int64
+	CircuitBreakerDuration  time.Duration
+	CircuitResetTimeout     time.Duration
+
+	// AckStrategy, if set, decides when the receiver
+	// acks consumed data, in place of acking each
+	// delivery at once; see ackstrategy.go. Only the
+	// receiving end needs it. AckTimerInterval is how
+	// often the strategy's OnTimer runs, by default
+	// DefaultAckTimerInterval.
+	AckStrategy      AckStrategy
+	AckTimerInterval time.Duration
+
+	// Telemetry, if set, traces each data packet's
+	// send and delivery; see telemetry.go.
+	Telemetry Telemetry
+
+	// LoopStart, if set, is called first thing on each
+	// of the session's sendloop and recvloop goroutines,
+	// so the caller can place them: runtime.LockOSThread
+	// and a CPU affinity call, for example, pin a loop to
+	// a core. See also Session.Migrate.
+	LoopStart func()
+
+	// Restore, if set, starts the session from a
+	// Snapshot of another; see snapshot.go.
+	Restore *SessionSnapshot
+
+	// Compress has the sender deflate each data packet's
+	// Data, when that makes it smaller, and the receiver
+	// inflate those it gets; see compress.go. Set it at
+	// both ends.
+	Compress bool
+
+	// EncryptionKey, if set, must be EncryptionKeySz
+	// bytes, the same at both ends; data packets are
+	// then encrypted with AES-256-GCM. See crypt.go
+	// and GenerateKey.
+	EncryptionKey []byte
+
 	TermCfg TermConfig
 }
 
@@ -343,11 +723,28 @@ func NewSession(cfg SessionConfig) (*Session, error) {
 		return nil, fmt.Errorf("windowMsgSz must be 1 or more")
 	}
 
+	if cfg.Codec != nil {
+		cn, ok := cfg.Net.(CodecNetwork)
+		if !ok {
+			return nil, fmt.Errorf("SessionConfig.Codec set, but Net %T does not take a Codec", cfg.Net)
+		}
+		cn.SetCodec(cfg.Codec)
+	}
+
 	if cfg.WindowByteSz < cfg.WindowMsgCount {
 		// guestimate
 		cfg.WindowByteSz = cfg.WindowMsgCount * 10 * 1024
 	}
 
+	// a reservation of the whole window would
+	// leave the sender nothing to send.
+	if cfg.ReservedMsgCap > 0 && cfg.ReservedMsgCap >= cfg.WindowMsgCount {
+		return nil, fmt.Errorf("ReservedMsgCap must be less than WindowMsgCount")
+	}
+	if cfg.ReservedBytesCap > 0 && cfg.ReservedBytesCap >= cfg.WindowByteSz {
+		return nil, fmt.Errorf("ReservedBytesCap must be less than WindowByteSz")
+	}
+
 	// set default; user can set to -1 to deactivate auto-close.
 	if cfg.NumFailedKeepAlivesBeforeClosing == 0 {
 		cfg.NumFailedKeepAlivesBeforeClosing = 50
@@ -356,11 +753,24 @@ func NewSession(cfg SessionConfig) (*Session, error) {
 	if cfg.KeepAliveInterval == 0 {
 		cfg.KeepAliveInterval = time.Millisecond * 500
 	}
+	if cfg.MaxKeepAliveInterval < cfg.KeepAliveInterval {
+		cfg.MaxKeepAliveInterval = 8 * cfg.KeepAliveInterval
+	}
 	nonce := NewSessionNonce()
 
+	// a half-duplex session only needs a full
+	// sized window on its active side.
+	sendSz, recvSz := cfg.WindowMsgCount, cfg.WindowMsgCount
+	switch cfg.HalfDuplex {
+	case HalfDuplexSender:
+		recvSz = 1
+	case HalfDuplexReceiver:
+		sendSz = 1
+	}
+
 	sess := &Session{
 		Cfg: &cfg,
-		Swp: NewSWP(cfg.Net, cfg.WindowMsgCount, cfg.WindowByteSz,
+		Swp: newSWP(cfg.Net, sendSz, recvSz, cfg.WindowByteSz,
 			cfg.Timeout, cfg.LocalInbox, cfg.DestInbox, cfg.Clk,
 			cfg.KeepAliveInterval, nonce),
 		MyInbox:     cfg.LocalInbox,
@@ -370,12 +780,95 @@ func NewSession(cfg SessionConfig) (*Session, error) {
 		NumFailedKeepAlivesBeforeClosing: cfg.NumFailedKeepAlivesBeforeClosing,
 		RemoteSenderClosed:               make(chan bool),
 		LocalSessNonce:                   nonce,
+		ErrCh:                            make(chan error, 1),
+		stateReached:                     1 << StateConnecting,
+		stateChanged:                     make(chan struct{}),
 	}
 	sess.Swp.Sender.NumFailedKeepAlivesBeforeClosing = cfg.NumFailedKeepAlivesBeforeClosing
+	sess.Swp.Sender.FECGroupSize = cfg.FECGroupSize
+	sess.Swp.Sender.MaxRetries = cfg.MaxRetries
+	sess.Swp.Sender.AdaptiveKeepAlive = cfg.AdaptiveKeepAlive
+	sess.Swp.Sender.MaxKeepAliveInterval = cfg.MaxKeepAliveInterval
+	sess.Swp.Sender.PiggybackWindow = cfg.PiggybackWindow
+	sess.Swp.Sender.KeepAliveExpectReply = cfg.KeepAliveExpectReply
+	sess.Swp.Sender.Telemetry = cfg.Telemetry
+	sess.Swp.Sender.LoopStart = cfg.LoopStart
+	sess.Events = NewEventBus(cfg.EventBusCap)
+	sess.Swp.Sender.Events = sess.Events
+	sess.Swp.Recver.FECGroupSize = cfg.FECGroupSize
+	sess.Swp.Recver.DeduplicateWindow = cfg.DeduplicateWindow
+	sess.Swp.Recver.MinPeerVersion = cfg.MinPeerVersion
+	sess.Swp.Recver.ReadyForDeliveryMaxLen = cfg.ReadyForDeliveryMaxLen
+	sess.Swp.Recver.DropOnReadyFull = cfg.DropOnReadyFull
+	sess.Swp.Recver.MaxBufferedBytes = cfg.MaxBufferedBytes
+	sess.Swp.Recver.ManualAck = cfg.ManualAck
+	sess.Swp.Recver.IndependentStreams = cfg.IndependentStreams
+	sess.Swp.Recver.HalfDuplex = cfg.HalfDuplex
+	sess.Swp.Recver.PriorityDelivery = cfg.PriorityDelivery
+	sess.Swp.Recver.Telemetry = cfg.Telemetry
+	sess.Swp.Recver.AckStrategy = cfg.AckStrategy
+	sess.Swp.Recver.ReservedBytesCap = cfg.ReservedBytesCap
+	sess.Swp.Recver.ReservedMsgCap = cfg.ReservedMsgCap
+	sess.Swp.Recver.CircuitBreakerThreshold = cfg.CircuitBreakerThreshold
+	sess.Swp.Recver.CircuitBreakerDuration = cfg.CircuitBreakerDuration
+	sess.Swp.Recver.CircuitResetTimeout = cfg.CircuitResetTimeout
+	sess.Swp.Recver.AckTimerInterval = cfg.AckTimerInterval
+	sess.Swp.Recver.LoopStart = cfg.LoopStart
+	sess.Swp.Recver.heardPeer = func() { sess.setState(StateEstablished) }
+	if cfg.HighWaterMark > 0 {
+		low := cfg.LowWaterMark
+		if low <= 0 {
+			low = cfg.HighWaterMark / 2
+		}
+		sess.Swp.Recver.bp = newBackpressure(
+			int64(cfg.HighWaterMark*float64(recvSz)),
+			int64(low*float64(recvSz)))
+	}
+	if cfg.Compress {
+		sess.Swp.Sender.compressor = newPacketCompressor()
+		sess.Swp.Recver.decompress = true
+	}
+	if len(cfg.EncryptionKey) > 0 {
+		var err error
+		sess.Swp.Sender.cipher, err = newPacketCipher(cfg.EncryptionKey, cfg.LocalInbox+"->"+cfg.DestInbox)
+		if err != nil {
+			return nil, err
+		}
+		sess.Swp.Recver.cipher, err = newPacketCipher(cfg.EncryptionKey, cfg.DestInbox+"->"+cfg.LocalInbox)
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case cfg.CongestionAlgorithm == CongAlgoCUBIC:
+		sess.Swp.Sender.Cong = NewCubicCongCtrl(cfg.WindowMsgCount, sess.Swp.Sender.Clk)
+	case cfg.CongestionControl:
+		sess.Swp.Sender.Cong = NewCongCtrl(cfg.WindowMsgCount)
+	}
+	if cfg.WindowAutoTune {
+		sess.Swp.Sender.Tune = NewAutoTune(sendSz, cfg.AutoTuneMinSamples)
+	}
+	if cfg.Restore != nil {
+		err := sess.Restore(*cfg.Restore)
+		if err != nil {
+			return nil, err
+		}
+	}
 	sess.Swp.Start(sess)
+	go sess.watchState()
+	if cfg.ChaosMode {
+		go sess.chaosMonkey(cfg.ChaosSeed)
+	}
 	sess.ReadMessagesCh = sess.Swp.Recver.ReadMessagesCh
+	sess.ControlCh = sess.Swp.Recver.ControlCh
 	sess.AcceptReadRequest = sess.Swp.Recver.AcceptReadRequest
 
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := sess.WaitForReady(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("swp session '%s' did not start: %v", cfg.LocalInbox, err)
+	}
 	return sess, nil
 }
 
@@ -395,14 +888,126 @@ func NewSession(cfg SessionConfig) (*Session, error) {
 //
 // You can use s.CountPacketsSentForTransfer() to get
 // the total count of packets Push()-ed so far.
-func (s *Session) Push(pack *Packet) {
-	select {
-	case s.Swp.Sender.BlockingSend <- pack:
-		//p("%v Push succeeded on payload '%s' into BlockingSend", s.MyInbox, string(pack.Data))
-		s.IncrPacketsSentForTransfer(1)
-	case <-s.Swp.Sender.Halt.ReqStop.Chan:
-		// give up, Sender is shutting down.
+//
+// Push returns ErrDeadlineExceeded if the write deadline
+// (see SetWriteDeadline) passes first, and ErrSessDone
+// if the session is shutting down.
+//
+// The SeqNum is given by the sendloop as it takes pack
+// from BlockingSend, not here. No lock is involved: the
+// sendloop owns LastFrameSent, and concurrent Push calls
+// only meet at the channel. Numbering here would let a
+// Push that loses the race to the channel, or times out,
+// leave its SeqNum out of order or missing for good.
+func (s *Session) Push(pack *Packet) error {
+	s.batchMut.RLock()
+	defer s.batchMut.RUnlock()
+	return s.push(pack)
+}
+
+// PushBatch pushes all of packs, in order, with no
+// other Push in between, so that they get consecutive
+// SeqNum. It returns an error if the session shuts down
+// (or the write deadline passes) before all are taken;
+// those before the failure will have been sent.
+func (s *Session) PushBatch(packs []*Packet) error {
+	s.batchMut.Lock()
+	defer s.batchMut.Unlock()
+	for _, pack := range packs {
+		err := s.push(pack)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Session) push(pack *Packet) error {
+	if s.Cfg.HalfDuplex == HalfDuplexReceiver {
+		return ErrHalfDuplexReceiver
+	}
+	var w deadlineWait
+	defer w.stop()
+
+	pack.pushTime = s.Swp.Sender.Clk.Now()
+	for {
+		dl, changed := s.getWriteDeadline()
+		if pastDeadline(dl) {
+			return ErrDeadlineExceeded
+		}
+		w.arm(dl, changed)
+		select {
+		case s.Swp.Sender.BlockingSend <- pack:
+			//p("%v Push succeeded on payload '%s' into BlockingSend", s.MyInbox, string(pack.Data))
+			s.IncrPacketsSentForTransfer(1)
+			return nil
+		case <-w.expired:
+			return ErrDeadlineExceeded
+		case <-w.changed:
+			// look again.
+		case <-s.Swp.Sender.Halt.ReqStop.Chan:
+			// give up, Sender is shutting down.
+			if err := s.Swp.Sender.GetErr(); err != nil {
+				return err
+			}
+			return ErrSessDone
+		}
+	}
+}
+
+// PushOrdered is Push, but serialized with every other
+// PushOrdered call that uses the same orderKey, so
+// that packets pushed under one key get increasing
+// SeqNum in the order their PushOrdered calls were
+// made. Pushes under different keys interleave freely.
+// This suits sharded producers, where each shard
+// pushes from several goroutines but must keep
+// its own order.
+func (s *Session) PushOrdered(pack *Packet, orderKey string) error {
+	s.mut.Lock()
+	if s.orderMut == nil {
+		s.orderMut = make(map[string]*orderLock)
 	}
+	km, ok := s.orderMut[orderKey]
+	if !ok {
+		km = &orderLock{}
+		s.orderMut[orderKey] = km
+	}
+	km.refs++
+	s.mut.Unlock()
+
+	km.Lock()
+	defer func() {
+		km.Unlock()
+		s.mut.Lock()
+		km.refs--
+		if km.refs == 0 {
+			delete(s.orderMut, orderKey)
+		}
+		s.mut.Unlock()
+	}()
+	// Push returns only once the sender has taken
+	// pack and given it the next SeqNum.
+	return s.Push(pack)
+}
+
+// orderLock is a PushOrdered key's lock. refs counts
+// the calls holding or waiting on it, under
+// Session.mut, so the last one out can delete it.
+type orderLock struct {
+	sync.Mutex
+	refs int
+}
+
+// PushEOF pushes an EOF packet, with no Data, to tell
+// a peer in ReadAll that the transfer is complete.
+func (s *Session) PushEOF() error {
+	return s.Push(&Packet{
+		From:     s.MyInbox,
+		Dest:     s.Destination,
+		TcpEvent: EventData,
+		EOF:      true,
+	})
 }
 
 // SelfConsumeForTesting sets up a reader to read all produced
@@ -446,10 +1051,13 @@ func InWindow(seqno, min, max int64) bool {
 // Stop shutsdown the session
 func (s *Session) Stop() {
 	//p("%v Session.Stop called.", s.MyInbox)
+	s.setState(StateClosing)
 	s.Swp.Stop()
+	s.Events.Stop()
 	s.SetErr(s.Swp.Sender.GetErr())
 	s.Halt.RequestStop()
 	s.Halt.Done.Close()
+	s.endState()
 }
 
 // Stop the sliding window protocol
@@ -463,6 +1071,31 @@ func (s *SWP) Start(sess *Session) {
 	//q("SWP Start() called")
 	s.Recver.Start()
 	s.Sender.Start(sess)
+	go func() {
+		select {
+		case <-s.Recver.ready:
+		case <-s.Recver.Halt.ReqStop.Chan:
+			return
+		}
+		select {
+		case <-s.Sender.ready:
+		case <-s.Sender.Halt.ReqStop.Chan:
+			return
+		}
+		close(s.Ready)
+	}()
+}
+
+// WaitForReady blocks until the session's goroutines
+// are running, or ctx is done. NewSession already
+// waits for this, so callers rarely need to.
+func (s *Session) WaitForReady(ctx context.Context) error {
+	select {
+	case <-s.Swp.Ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // CountPacketsReadConsumed reports on how many packets
@@ -500,9 +1133,43 @@ func (s *Session) IncrPacketsSentForTransfer(n int64) int64 {
 // on the rcvUnordered channel.
 // The limit argument sets how many messages are queued before
 // we drop the oldest.
+//
+// Packets are dropped if the queue cannot accept them
+// within DefaultAsapDropTimeout; see RegisterAsapWithDeadline
+// to change that.
 func (s *Session) RegisterAsap(rcvUnordered chan *Packet, limit int64) error {
-	s.Swp.Recver.setAsapHelper <- NewAsapHelper(rcvUnordered, limit)
-	return nil
+	return s.registerAsap(rcvUnordered, limit, DefaultAsapDropTimeout)
+}
+
+// RegisterAsapWithDeadline is like RegisterAsap, but
+// drops a packet after dropTimeout rather than after
+// DefaultAsapDropTimeout. A dropTimeout of zero means
+// never drop: the receiver blocks until rcvUnordered
+// takes each packet, which in turn holds up ordered
+// delivery. Handy for tests.
+func (s *Session) RegisterAsapWithDeadline(rcvUnordered chan *Packet, dropTimeout time.Duration) error {
+	return s.registerAsap(rcvUnordered, DefaultAsapLimit, dropTimeout)
+}
+
+func (s *Session) registerAsap(rcvUnordered chan *Packet, limit int64, dropTimeout time.Duration) error {
+	helper := NewAsapHelper(rcvUnordered, limit)
+	helper.DropTimeout = dropTimeout
+	return s.setAsap(helper)
+}
+
+// UnregisterAsap stops any as-soon-as-possible delivery
+// set up by RegisterAsap, leaving the session running.
+func (s *Session) UnregisterAsap() error {
+	return s.setAsap(nil)
+}
+
+func (s *Session) setAsap(helper *AsapHelper) error {
+	select {
+	case s.Swp.Recver.setAsapHelper <- helper:
+		return nil
+	case <-s.Swp.Recver.Halt.ReqStop.Chan:
+		return ErrShutdown
+	}
 }
 
 // ackCallbackFunc is used for testing: used in setPacketRecvCallback
@@ -529,19 +1196,41 @@ func NewReadRequest(p []byte) *ReadRequest {
 	}
 }
 
+// NumReadyPackets returns how many packets Read or
+// ReadCtx could take right now without blocking.
+// See RecvState.PeekNumReady.
+func (s *Session) NumReadyPackets() int64 {
+	return s.Swp.Recver.PeekNumReady()
+}
+
 // Read implements io.Reader
 func (s *Session) Read(fillme []byte) (n int, err error) {
+	var w deadlineWait
+	defer w.stop()
+
 	rr := NewReadRequest(fillme)
 	//p("Read gets fillme with len %v. len(rr.P)=%v", len(fillme), len(rr.P))
 	//p("rr=%p, s=%p", rr, s)
-	select {
-	case s.AcceptReadRequest <- rr:
-		//p("Read: rr request accepted")
-		// good, proceed to get reply
-	case <-s.Halt.Done.Chan:
-		return 0, ErrSessDone
-	case <-s.Halt.ReqStop.Chan:
-		return 0, ErrSessDone
+	for accepted := false; !accepted; {
+		dl, changed := s.getReadDeadline()
+		if pastDeadline(dl) {
+			return 0, ErrDeadlineExceeded
+		}
+		w.arm(dl, changed)
+		select {
+		case s.AcceptReadRequest <- rr:
+			//p("Read: rr request accepted")
+			// good, proceed to get reply
+			accepted = true
+		case <-w.expired:
+			return 0, ErrDeadlineExceeded
+		case <-w.changed:
+			// look again.
+		case <-s.Halt.Done.Chan:
+			return 0, ErrSessDone
+		case <-s.Halt.ReqStop.Chan:
+			return 0, ErrSessDone
+		}
 	}
 	// now get reply.
 	select {
@@ -555,6 +1244,102 @@ func (s *Session) Read(fillme []byte) (n int, err error) {
 	}
 }
 
+// ReadCtx blocks until the next in-order sequence of
+// packets is available on ReadMessagesCh, or until ctx is
+// done, in which case ctx.Err() is returned.
+// The name Read is already taken by our io.Reader
+// implementation, hence ReadMessages and ReadTimeout
+// below are the convenience variants.
+//
+// ReadCtx also honors the read deadline (see SetReadDeadline),
+// returning ErrDeadlineExceeded when it passes.
+func (s *Session) ReadCtx(ctx context.Context) (InOrderSeq, error) {
+	if seq, ok := s.takeUnread(); ok {
+		return seq, nil
+	}
+	var w deadlineWait
+	defer w.stop()
+
+	for {
+		dl, changed := s.getReadDeadline()
+		if pastDeadline(dl) {
+			return InOrderSeq{}, ErrDeadlineExceeded
+		}
+		w.arm(dl, changed)
+		select {
+		case seq := <-s.ReadMessagesCh:
+			s.IncrPacketsReadConsumed(int64(len(seq.Seq)))
+			return seq, nil
+		case <-ctx.Done():
+			return InOrderSeq{}, ctx.Err()
+		case <-w.expired:
+			return InOrderSeq{}, ErrDeadlineExceeded
+		case <-w.changed:
+			// look again.
+		case <-s.Halt.ReqStop.Chan:
+			return InOrderSeq{}, ErrSessDone
+		}
+	}
+}
+
+// ReadMessages is ReadCtx with context.Background().
+func (s *Session) ReadMessages() (InOrderSeq, error) {
+	return s.ReadCtx(context.Background())
+}
+
+// ReadTimeout is ReadCtx that gives up after d,
+// returning context.DeadlineExceeded.
+func (s *Session) ReadTimeout(d time.Duration) (InOrderSeq, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return s.ReadCtx(ctx)
+}
+
+// ReadAll is ReadCtx in a loop, as io.ReadAll is for
+// Read: it returns every packet read, in order, up to
+// and including the first with EOF set (see PushEOF).
+// On an error it returns those read so far along with
+// it. Packets delivered along with the EOF one, but
+// after it, are kept for the next ReadCtx or ReadAll,
+// so a transfer may follow right behind another.
+func (s *Session) ReadAll(ctx context.Context) ([]*Packet, error) {
+	var all []*Packet
+	for {
+		seq, err := s.ReadCtx(ctx)
+		if err != nil {
+			return all, err
+		}
+		for i, pack := range seq.Seq {
+			all = append(all, pack)
+			if pack.EOF {
+				if rest := seq.Seq[i+1:]; len(rest) > 0 {
+					s.unreadMut.Lock()
+					s.unread = InOrderSeq{
+						Seq:      rest,
+						StreamID: seq.StreamID,
+						Gaps:     bridgedGaps(rest),
+					}
+					s.unreadMut.Unlock()
+				}
+				return all, nil
+			}
+		}
+	}
+}
+
+// takeUnread returns, and clears, what ReadAll
+// left unread, if anything.
+func (s *Session) takeUnread() (InOrderSeq, bool) {
+	s.unreadMut.Lock()
+	defer s.unreadMut.Unlock()
+	seq := s.unread
+	if len(seq.Seq) == 0 {
+		return InOrderSeq{}, false
+	}
+	s.unread = InOrderSeq{}
+	return seq, true
+}
+
 // ByteAccount should be accessed with
 // atomics to avoid data races.
 type ByteAccount struct {
@@ -619,7 +1404,14 @@ func (s *Session) Write(payload []byte) (n int, err error) {
 		if i == npack-1 {
 			pack.CliAcked = ca
 		}
-		s.Push(pack)
+		err = s.waitForRelief()
+		if err != nil {
+			return int(atomic.LoadInt64(&ba.NumBytesAcked)), err
+		}
+		err = s.Push(pack)
+		if err != nil {
+			return int(atomic.LoadInt64(&ba.NumBytesAcked)), err
+		}
 		///p("%s Write() sent packet %v of %v", s.MyInbox, i, npack)
 	}
 	select {
@@ -635,6 +1427,13 @@ func (s *Session) Write(payload []byte) (n int, err error) {
 	return nba, s.GetErr()
 }
 
+func int64Max(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 func int64Min(a, b int64) int64 {
 	if a < b {
 		return a
@@ -785,6 +1584,7 @@ func newCloseReq() *closeReq {
 
 func (sess *Session) Close() error {
 	//p("%s sess Close() running, recv.TcpState=%s", sess.MyInbox, sess.Swp.Recver.TcpState)
+	sess.setState(StateClosing)
 	zr := newCloseReq()
 	return sess.Swp.Recver.Close(zr)
 }
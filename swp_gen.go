@@ -355,6 +355,16 @@ func (z *Packet) DecodeMsg(dc *msgp.Reader) (err error) {
 			if err != nil {
 				return
 			}
+		case "NackNum":
+			z.NackNum, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "Nak":
+			z.Nak, err = dc.ReadBool()
+			if err != nil {
+				return
+			}
 		case "TcpEvent":
 			{
 				var zwht int
@@ -374,6 +384,11 @@ func (z *Packet) DecodeMsg(dc *msgp.Reader) (err error) {
 			if err != nil {
 				return
 			}
+		case "ProposeWindowSize":
+			z.ProposeWindowSize, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
 		case "FromRttEstNsec":
 			z.FromRttEstNsec, err = dc.ReadInt64()
 			if err != nil {
@@ -409,6 +424,103 @@ func (z *Packet) DecodeMsg(dc *msgp.Reader) (err error) {
 			if err != nil {
 				return
 			}
+		case "Parity":
+			z.Parity, err = dc.ReadBool()
+			if err != nil {
+				return
+			}
+		case "Control":
+			z.Control, err = dc.ReadBool()
+			if err != nil {
+				return
+			}
+		case "Metadata":
+			var zasp uint32
+			zasp, err = dc.ReadMapHeader()
+			if err != nil {
+				return
+			}
+			if z.Metadata == nil && zasp > 0 {
+				z.Metadata = make(map[string]string, zasp)
+			} else if len(z.Metadata) > 0 {
+				for key, _ := range z.Metadata {
+					delete(z.Metadata, key)
+				}
+			}
+			for zasp > 0 {
+				zasp--
+				var zefw string
+				var zees string
+				zefw, err = dc.ReadString()
+				if err != nil {
+					return
+				}
+				zees, err = dc.ReadString()
+				if err != nil {
+					return
+				}
+				z.Metadata[zefw] = zees
+			}
+		case "Version":
+			z.Version, err = dc.ReadUint8()
+			if err != nil {
+				return
+			}
+		case "StreamID":
+			z.StreamID, err = dc.ReadUint32()
+			if err != nil {
+				return
+			}
+		case "StreamSeq":
+			z.StreamSeq, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "Priority":
+			z.Priority, err = dc.ReadUint8()
+			if err != nil {
+				return
+			}
+		case "KAReply":
+			z.KAReply, err = dc.ReadBool()
+			if err != nil {
+				return
+			}
+		case "CompressedSize":
+			z.CompressedSize, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "CircuitOpen":
+			z.CircuitOpen, err = dc.ReadBool()
+			if err != nil {
+				return
+			}
+		case "CircuitResetNsec":
+			z.CircuitResetNsec, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "EOF":
+			z.EOF, err = dc.ReadBool()
+			if err != nil {
+				return
+			}
+		case "TraceParent":
+			z.TraceParent, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "Nonce":
+			z.Nonce, err = dc.ReadBytes(z.Nonce)
+			if err != nil {
+				return
+			}
+		case "AuthTag":
+			z.AuthTag, err = dc.ReadBytes(z.AuthTag)
+			if err != nil {
+				return
+			}
 		default:
 			err = dc.Skip()
 			if err != nil {
@@ -421,9 +533,9 @@ func (z *Packet) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *Packet) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 21
+	// map header, size 39
 	// write "From"
-	err = en.Append(0xde, 0x0, 0x15, 0xa4, 0x46, 0x72, 0x6f, 0x6d)
+	err = en.Append(0xde, 0x0, 0x27, 0xa4, 0x46, 0x72, 0x6f, 0x6d)
 	if err != nil {
 		return err
 	}
@@ -521,6 +633,24 @@ func (z *Packet) EncodeMsg(en *msgp.Writer) (err error) {
 	if err != nil {
 		return
 	}
+	// write "NackNum"
+	err = en.Append(0xa7, 0x4e, 0x61, 0x63, 0x6b, 0x4e, 0x75, 0x6d)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.NackNum)
+	if err != nil {
+		return
+	}
+	// write "Nak"
+	err = en.Append(0xa3, 0x4e, 0x61, 0x6b)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBool(z.Nak)
+	if err != nil {
+		return
+	}
 	// write "TcpEvent"
 	err = en.Append(0xa8, 0x54, 0x63, 0x70, 0x45, 0x76, 0x65, 0x6e, 0x74)
 	if err != nil {
@@ -548,6 +678,15 @@ func (z *Packet) EncodeMsg(en *msgp.Writer) (err error) {
 	if err != nil {
 		return
 	}
+	// write "ProposeWindowSize"
+	err = en.Append(0xb1, 0x50, 0x72, 0x6f, 0x70, 0x6f, 0x73, 0x65, 0x57, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x53, 0x69, 0x7a, 0x65)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.ProposeWindowSize)
+	if err != nil {
+		return
+	}
 	// write "FromRttEstNsec"
 	err = en.Append(0xae, 0x46, 0x72, 0x6f, 0x6d, 0x52, 0x74, 0x74, 0x45, 0x73, 0x74, 0x4e, 0x73, 0x65, 0x63)
 	if err != nil {
@@ -611,15 +750,160 @@ func (z *Packet) EncodeMsg(en *msgp.Writer) (err error) {
 	if err != nil {
 		return
 	}
+	// write "Parity"
+	err = en.Append(0xa6, 0x50, 0x61, 0x72, 0x69, 0x74, 0x79)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBool(z.Parity)
+	if err != nil {
+		return
+	}
+	// write "Control"
+	err = en.Append(0xa7, 0x43, 0x6f, 0x6e, 0x74, 0x72, 0x6f, 0x6c)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBool(z.Control)
+	if err != nil {
+		return
+	}
+	// write "Metadata"
+	err = en.Append(0xa8, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61)
+	if err != nil {
+		return err
+	}
+	err = en.WriteMapHeader(uint32(len(z.Metadata)))
+	if err != nil {
+		return
+	}
+	for zfme, ziuj := range z.Metadata {
+		err = en.WriteString(zfme)
+		if err != nil {
+			return
+		}
+		err = en.WriteString(ziuj)
+		if err != nil {
+			return
+		}
+	}
+	// write "Version"
+	err = en.Append(0xa7, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
+	if err != nil {
+		return err
+	}
+	err = en.WriteUint8(z.Version)
+	if err != nil {
+		return
+	}
+	// write "StreamID"
+	err = en.Append(0xa8, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x49, 0x44)
+	if err != nil {
+		return err
+	}
+	err = en.WriteUint32(z.StreamID)
+	if err != nil {
+		return
+	}
+	// write "StreamSeq"
+	err = en.Append(0xa9, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x53, 0x65, 0x71)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.StreamSeq)
+	if err != nil {
+		return
+	}
+	// write "Priority"
+	err = en.Append(0xa8, 0x50, 0x72, 0x69, 0x6f, 0x72, 0x69, 0x74, 0x79)
+	if err != nil {
+		return err
+	}
+	err = en.WriteUint8(z.Priority)
+	if err != nil {
+		return
+	}
+	// write "KAReply"
+	err = en.Append(0xa7, 0x4b, 0x41, 0x52, 0x65, 0x70, 0x6c, 0x79)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBool(z.KAReply)
+	if err != nil {
+		return
+	}
+	// write "CompressedSize"
+	err = en.Append(0xae, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x65, 0x64, 0x53, 0x69, 0x7a, 0x65)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.CompressedSize)
+	if err != nil {
+		return
+	}
+	// write "CircuitOpen"
+	err = en.Append(0xab, 0x43, 0x69, 0x72, 0x63, 0x75, 0x69, 0x74, 0x4f, 0x70, 0x65, 0x6e)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBool(z.CircuitOpen)
+	if err != nil {
+		return
+	}
+	// write "CircuitResetNsec"
+	err = en.Append(0xb0, 0x43, 0x69, 0x72, 0x63, 0x75, 0x69, 0x74, 0x52, 0x65, 0x73, 0x65, 0x74, 0x4e, 0x73, 0x65, 0x63)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.CircuitResetNsec)
+	if err != nil {
+		return
+	}
+	// write "EOF"
+	err = en.Append(0xa3, 0x45, 0x4f, 0x46)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBool(z.EOF)
+	if err != nil {
+		return
+	}
+	// write "TraceParent"
+	err = en.Append(0xab, 0x54, 0x72, 0x61, 0x63, 0x65, 0x50, 0x61, 0x72, 0x65, 0x6e, 0x74)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.TraceParent)
+	if err != nil {
+		return
+	}
+	// write "Nonce"
+	err = en.Append(0xa5, 0x4e, 0x6f, 0x6e, 0x63, 0x65)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBytes(z.Nonce)
+	if err != nil {
+		return
+	}
+	// write "AuthTag"
+	err = en.Append(0xa7, 0x41, 0x75, 0x74, 0x68, 0x54, 0x61, 0x67)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBytes(z.AuthTag)
+	if err != nil {
+		return
+	}
 	return
 }
 
 // MarshalMsg implements msgp.Marshaler
 func (z *Packet) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 21
+	// map header, size 39
 	// string "From"
-	o = append(o, 0xde, 0x0, 0x15, 0xa4, 0x46, 0x72, 0x6f, 0x6d)
+	o = append(o, 0xde, 0x0, 0x27, 0xa4, 0x46, 0x72, 0x6f, 0x6d)
 	o = msgp.AppendString(o, z.From)
 	// string "Dest"
 	o = append(o, 0xa4, 0x44, 0x65, 0x73, 0x74)
@@ -651,6 +935,12 @@ func (z *Packet) MarshalMsg(b []byte) (o []byte, err error) {
 	// string "AckReplyTm"
 	o = append(o, 0xaa, 0x41, 0x63, 0x6b, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x54, 0x6d)
 	o = msgp.AppendTime(o, z.AckReplyTm)
+	// string "NackNum"
+	o = append(o, 0xa7, 0x4e, 0x61, 0x63, 0x6b, 0x4e, 0x75, 0x6d)
+	o = msgp.AppendInt64(o, z.NackNum)
+	// string "Nak"
+	o = append(o, 0xa3, 0x4e, 0x61, 0x6b)
+	o = msgp.AppendBool(o, z.Nak)
 	// string "TcpEvent"
 	o = append(o, 0xa8, 0x54, 0x63, 0x70, 0x45, 0x76, 0x65, 0x6e, 0x74)
 	o = msgp.AppendInt(o, int(z.TcpEvent))
@@ -660,6 +950,9 @@ func (z *Packet) MarshalMsg(b []byte) (o []byte, err error) {
 	// string "AvailReaderMsgCap"
 	o = append(o, 0xb1, 0x41, 0x76, 0x61, 0x69, 0x6c, 0x52, 0x65, 0x61, 0x64, 0x65, 0x72, 0x4d, 0x73, 0x67, 0x43, 0x61, 0x70)
 	o = msgp.AppendInt64(o, z.AvailReaderMsgCap)
+	// string "ProposeWindowSize"
+	o = append(o, 0xb1, 0x50, 0x72, 0x6f, 0x70, 0x6f, 0x73, 0x65, 0x57, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x53, 0x69, 0x7a, 0x65)
+	o = msgp.AppendInt64(o, z.ProposeWindowSize)
 	// string "FromRttEstNsec"
 	o = append(o, 0xae, 0x46, 0x72, 0x6f, 0x6d, 0x52, 0x74, 0x74, 0x45, 0x73, 0x74, 0x4e, 0x73, 0x65, 0x63)
 	o = msgp.AppendInt64(o, z.FromRttEstNsec)
@@ -681,6 +974,55 @@ func (z *Packet) MarshalMsg(b []byte) (o []byte, err error) {
 	// string "Blake2bChecksum"
 	o = append(o, 0xaf, 0x42, 0x6c, 0x61, 0x6b, 0x65, 0x32, 0x62, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d)
 	o = msgp.AppendBytes(o, z.Blake2bChecksum)
+	// string "Parity"
+	o = append(o, 0xa6, 0x50, 0x61, 0x72, 0x69, 0x74, 0x79)
+	o = msgp.AppendBool(o, z.Parity)
+	// string "Control"
+	o = append(o, 0xa7, 0x43, 0x6f, 0x6e, 0x74, 0x72, 0x6f, 0x6c)
+	o = msgp.AppendBool(o, z.Control)
+	// string "Metadata"
+	o = append(o, 0xa8, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61)
+	o = msgp.AppendMapHeader(o, uint32(len(z.Metadata)))
+	for zity, zvbi := range z.Metadata {
+		o = msgp.AppendString(o, zity)
+		o = msgp.AppendString(o, zvbi)
+	}
+	// string "Version"
+	o = append(o, 0xa7, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
+	o = msgp.AppendUint8(o, z.Version)
+	// string "StreamID"
+	o = append(o, 0xa8, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x49, 0x44)
+	o = msgp.AppendUint32(o, z.StreamID)
+	// string "StreamSeq"
+	o = append(o, 0xa9, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x53, 0x65, 0x71)
+	o = msgp.AppendInt64(o, z.StreamSeq)
+	// string "Priority"
+	o = append(o, 0xa8, 0x50, 0x72, 0x69, 0x6f, 0x72, 0x69, 0x74, 0x79)
+	o = msgp.AppendUint8(o, z.Priority)
+	// string "KAReply"
+	o = append(o, 0xa7, 0x4b, 0x41, 0x52, 0x65, 0x70, 0x6c, 0x79)
+	o = msgp.AppendBool(o, z.KAReply)
+	// string "CompressedSize"
+	o = append(o, 0xae, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x65, 0x64, 0x53, 0x69, 0x7a, 0x65)
+	o = msgp.AppendInt64(o, z.CompressedSize)
+	// string "CircuitOpen"
+	o = append(o, 0xab, 0x43, 0x69, 0x72, 0x63, 0x75, 0x69, 0x74, 0x4f, 0x70, 0x65, 0x6e)
+	o = msgp.AppendBool(o, z.CircuitOpen)
+	// string "CircuitResetNsec"
+	o = append(o, 0xb0, 0x43, 0x69, 0x72, 0x63, 0x75, 0x69, 0x74, 0x52, 0x65, 0x73, 0x65, 0x74, 0x4e, 0x73, 0x65, 0x63)
+	o = msgp.AppendInt64(o, z.CircuitResetNsec)
+	// string "EOF"
+	o = append(o, 0xa3, 0x45, 0x4f, 0x46)
+	o = msgp.AppendBool(o, z.EOF)
+	// string "TraceParent"
+	o = append(o, 0xab, 0x54, 0x72, 0x61, 0x63, 0x65, 0x50, 0x61, 0x72, 0x65, 0x6e, 0x74)
+	o = msgp.AppendString(o, z.TraceParent)
+	// string "Nonce"
+	o = append(o, 0xa5, 0x4e, 0x6f, 0x6e, 0x63, 0x65)
+	o = msgp.AppendBytes(o, z.Nonce)
+	// string "AuthTag"
+	o = append(o, 0xa7, 0x41, 0x75, 0x74, 0x68, 0x54, 0x61, 0x67)
+	o = msgp.AppendBytes(o, z.AuthTag)
 	return
 }
 
@@ -755,6 +1097,16 @@ func (z *Packet) UnmarshalMsg(bts []byte) (o []byte, err error) {
 			if err != nil {
 				return
 			}
+		case "NackNum":
+			z.NackNum, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "Nak":
+			z.Nak, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				return
+			}
 		case "TcpEvent":
 			{
 				var zcua int
@@ -774,6 +1126,11 @@ func (z *Packet) UnmarshalMsg(bts []byte) (o []byte, err error) {
 			if err != nil {
 				return
 			}
+		case "ProposeWindowSize":
+			z.ProposeWindowSize, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
 		case "FromRttEstNsec":
 			z.FromRttEstNsec, bts, err = msgp.ReadInt64Bytes(bts)
 			if err != nil {
@@ -809,6 +1166,103 @@ func (z *Packet) UnmarshalMsg(bts []byte) (o []byte, err error) {
 			if err != nil {
 				return
 			}
+		case "Parity":
+			z.Parity, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Control":
+			z.Control, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Metadata":
+			var zrin uint32
+			zrin, bts, err = msgp.ReadMapHeaderBytes(bts)
+			if err != nil {
+				return
+			}
+			if z.Metadata == nil && zrin > 0 {
+				z.Metadata = make(map[string]string, zrin)
+			} else if len(z.Metadata) > 0 {
+				for key, _ := range z.Metadata {
+					delete(z.Metadata, key)
+				}
+			}
+			for zrin > 0 {
+				var ztcm string
+				var zpqj string
+				zrin--
+				ztcm, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					return
+				}
+				zpqj, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					return
+				}
+				z.Metadata[ztcm] = zpqj
+			}
+		case "Version":
+			z.Version, bts, err = msgp.ReadUint8Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "StreamID":
+			z.StreamID, bts, err = msgp.ReadUint32Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "StreamSeq":
+			z.StreamSeq, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "Priority":
+			z.Priority, bts, err = msgp.ReadUint8Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "KAReply":
+			z.KAReply, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				return
+			}
+		case "CompressedSize":
+			z.CompressedSize, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "CircuitOpen":
+			z.CircuitOpen, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				return
+			}
+		case "CircuitResetNsec":
+			z.CircuitResetNsec, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "EOF":
+			z.EOF, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				return
+			}
+		case "TraceParent":
+			z.TraceParent, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Nonce":
+			z.Nonce, bts, err = msgp.ReadBytesBytes(bts, z.Nonce)
+			if err != nil {
+				return
+			}
+		case "AuthTag":
+			z.AuthTag, bts, err = msgp.ReadBytesBytes(bts, z.AuthTag)
+			if err != nil {
+				return
+			}
 		default:
 			bts, err = msgp.Skip(bts)
 			if err != nil {
@@ -822,7 +1276,14 @@ func (z *Packet) UnmarshalMsg(bts []byte) (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *Packet) Msgsize() (s int) {
-	s = 3 + 5 + msgp.StringPrefixSize + len(z.From) + 5 + msgp.StringPrefixSize + len(z.Dest) + 14 + msgp.StringPrefixSize + len(z.FromSessNonce) + 14 + msgp.StringPrefixSize + len(z.DestSessNonce) + 16 + msgp.TimeSize + 11 + msgp.TimeSize + 7 + msgp.Int64Size + 9 + msgp.Int64Size + 7 + msgp.Int64Size + 9 + msgp.Int64Size + 11 + msgp.TimeSize + 9 + msgp.IntSize + 20 + msgp.Int64Size + 18 + msgp.Int64Size + 15 + msgp.Int64Size + 14 + msgp.Int64Size + 9 + msgp.Int64Size + 22 + msgp.Int64Size + 5 + msgp.BytesPrefixSize + len(z.Data) + 11 + msgp.IntSize + 16 + msgp.BytesPrefixSize + len(z.Blake2bChecksum)
+	s = 3 + 5 + msgp.StringPrefixSize + len(z.From) + 5 + msgp.StringPrefixSize + len(z.Dest) + 14 + msgp.StringPrefixSize + len(z.FromSessNonce) + 14 + msgp.StringPrefixSize + len(z.DestSessNonce) + 16 + msgp.TimeSize + 11 + msgp.TimeSize + 7 + msgp.Int64Size + 9 + msgp.Int64Size + 7 + msgp.Int64Size + 9 + msgp.Int64Size + 11 + msgp.TimeSize + 8 + msgp.Int64Size + 4 + msgp.BoolSize + 9 + msgp.IntSize + 20 + msgp.Int64Size + 18 + msgp.Int64Size + 18 + msgp.Int64Size + 15 + msgp.Int64Size + 14 + msgp.Int64Size + 9 + msgp.Int64Size + 22 + msgp.Int64Size + 5 + msgp.BytesPrefixSize + len(z.Data) + 11 + msgp.IntSize + 16 + msgp.BytesPrefixSize + len(z.Blake2bChecksum) + 7 + msgp.BoolSize + 8 + msgp.BoolSize + 9 + msgp.MapHeaderSize
+	if z.Metadata != nil {
+		for zcun, zrmr := range z.Metadata {
+			_ = zrmr
+			s += msgp.StringPrefixSize + len(zcun) + msgp.StringPrefixSize + len(zrmr)
+		}
+	}
+	s += 8 + msgp.Uint8Size + 9 + msgp.Uint32Size + 10 + msgp.Int64Size + 9 + msgp.Uint8Size + 8 + msgp.BoolSize + 15 + msgp.Int64Size + 12 + msgp.BoolSize + 17 + msgp.Int64Size + 4 + msgp.BoolSize + 12 + msgp.StringPrefixSize + len(z.TraceParent) + 6 + msgp.BytesPrefixSize + len(z.Nonce) + 8 + msgp.BytesPrefixSize + len(z.AuthTag)
 	return
 }
 
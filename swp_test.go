@@ -1,12 +1,18 @@
 package swp
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/glycerine/bchan"
 	cv "github.com/glycerine/goconvey/convey"
+	"github.com/tinylib/msgp/msgp"
 	"testing"
 )
 
@@ -21,14 +27,7 @@ import (
 
 func Test001Network(t *testing.T) {
 
-	lossProb := float64(0)
-	lat := time.Millisecond
-	net := NewSimNet(lossProb, lat)
-	rtt := 2 * lat
-
-	A, err := NewSession(SessionConfig{Net: net, LocalInbox: "A", DestInbox: "B", WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
-	panicOn(err)
-	B, err := NewSession(SessionConfig{Net: net, LocalInbox: "B", DestInbox: "A", WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
+	A, B, cleanup, err := SwpPipe(WithWindowMsgCount(3))
 	panicOn(err)
 
 	A.SelfConsumeForTesting()
@@ -45,8 +44,7 @@ func Test001Network(t *testing.T) {
 
 	time.Sleep(time.Second)
 
-	A.Stop()
-	B.Stop()
+	cleanup()
 
 	cv.Convey("Given two nodes A and B, sending a packet on a non-lossy network from A to B, the packet should arrive at B", t, func() {
 		cv.So(A.Swp.Recver.DiscardCount, cv.ShouldEqual, 0)
@@ -65,9 +63,7 @@ func Test002LostPacketTimesOutAndIsRetransmitted(t *testing.T) {
 	net.DiscardOnce = 1
 	rtt := 2 * lat
 
-	A, err := NewSession(SessionConfig{Net: net, LocalInbox: "A", DestInbox: "B", WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
-	panicOn(err)
-	B, err := NewSession(SessionConfig{Net: net, LocalInbox: "B", DestInbox: "A", WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithWindowMsgCount(3), WithTimeout(rtt))
 	panicOn(err)
 
 	A.SelfConsumeForTesting()
@@ -92,8 +88,7 @@ func Test002LostPacketTimesOutAndIsRetransmitted(t *testing.T) {
 
 	time.Sleep(time.Second)
 
-	A.Stop()
-	B.Stop()
+	cleanup()
 
 	cv.Convey("Given two nodes A and B, if a packet from A to B is lost, the timeout mechanism in the sender should notice that it didn't get the ack, and should resend.", t, func() {
 		cv.So(A.Swp.Recver.DiscardCount, cv.ShouldEqual, 0)
@@ -118,9 +113,7 @@ func Test003MisorderedPacketsAreReordered(t *testing.T) {
 	// (and should) hang.
 	windowMsgSz := int64(2)
 
-	A, err := NewSession(SessionConfig{Net: net, LocalInbox: "A", DestInbox: "B", WindowMsgCount: windowMsgSz, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
-	panicOn(err)
-	B, err := NewSession(SessionConfig{Net: net, LocalInbox: "B", DestInbox: "A", WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithTimeout(rtt), OnlyOn("A", WithWindowMsgCount(windowMsgSz)), OnlyOn("B", WithWindowMsgCount(3)))
 	panicOn(err)
 
 	// if LastSeenAvailReaderMsgCap is 1, then we never get
@@ -163,8 +156,7 @@ func Test003MisorderedPacketsAreReordered(t *testing.T) {
 
 	time.Sleep(300 * time.Millisecond)
 
-	A.Stop()
-	B.Stop()
+	cleanup()
 
 	cv.Convey("Given two nodes A and B, if a packets 0 and 1 from A to B are reordered so as to arrive in order 1, 0; the sliding window protocol should correctly re-order and deliver them in order.", t, func() {
 		cv.So(A.Swp.Recver.DiscardCount, cv.ShouldEqual, 0)
@@ -184,11 +176,7 @@ func Test004DuplicatedPacketIsDiscarded(t *testing.T) {
 
 	p("effectively turning off replays for this test")
 	rtt = time.Hour
-	A, err := NewSession(SessionConfig{Net: net, LocalInbox: "A", DestInbox: "B",
-		WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
-	panicOn(err)
-	B, err := NewSession(SessionConfig{Net: net, LocalInbox: "B", DestInbox: "A",
-		WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithWindowMsgCount(3), WithTimeout(rtt))
 	panicOn(err)
 
 	A.SelfConsumeForTesting()
@@ -214,8 +202,7 @@ func Test004DuplicatedPacketIsDiscarded(t *testing.T) {
 
 	time.Sleep(100 * time.Millisecond)
 
-	A.Stop()
-	B.Stop()
+	cleanup()
 
 	cv.Convey("Given two nodes A and B, if the network (or resends) results in a packet with a duplicate SeqNum to one already received; the sliding window protocol should reject the delivery and drop the packet.", t, func() {
 		cv.So(A.Swp.Recver.DiscardCount, cv.ShouldEqual, 0)
@@ -226,6 +213,42 @@ func Test004DuplicatedPacketIsDiscarded(t *testing.T) {
 	})
 }
 
+func Test005GapIsNakedForFastRetransmit(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	net.DiscardOnce = 0
+	rtt := 2 * lat
+
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithWindowMsgCount(3), WithTimeout(rtt))
+	panicOn(err)
+
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	for _, s := range []string{"one", "two", "three"} {
+		A.Push(&Packet{
+			From:     "A",
+			Dest:     "B",
+			Data:     []byte(s),
+			TcpEvent: EventData,
+		})
+	}
+
+	time.Sleep(time.Second)
+
+	cleanup()
+
+	cv.Convey("Given two nodes A and B, if the first packet from A to B is lost, B should nak it when the second arrives, and A should retransmit it early.", t, func() {
+		cv.So(atomic.LoadInt64(&B.Swp.Recver.NacksSent), cv.ShouldBeGreaterThanOrEqualTo, 1)
+		cv.So(atomic.LoadInt64(&A.Swp.Sender.NacksActedOn), cv.ShouldBeGreaterThanOrEqualTo, 1)
+		cv.So(len(A.Swp.Sender.SendHistory), cv.ShouldEqual, 3)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, 3)
+		cv.So(HistoryEqual(A.Swp.Sender.SendHistory, B.Swp.Recver.RecvHistory), cv.ShouldBeTrue)
+	})
+}
+
 func Test006AlgorithmWithstandsNoisyNetworks(t *testing.T) {
 
 	// works quickly even with 20% packet loss:
@@ -237,11 +260,7 @@ func Test006AlgorithmWithstandsNoisyNetworks(t *testing.T) {
 	net := NewSimNet(lossProb, lat)
 	rtt := 3 * lat
 
-	A, err := NewSession(SessionConfig{Net: net, LocalInbox: "A", DestInbox: "B",
-		WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
-	panicOn(err)
-	B, err := NewSession(SessionConfig{Net: net, LocalInbox: "B", DestInbox: "A",
-		WindowMsgCount: 3, WindowByteSz: -1, Timeout: rtt, Clk: RealClk})
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithWindowMsgCount(3), WithTimeout(rtt))
 	panicOn(err)
 
 	A.SelfConsumeForTesting()
@@ -275,8 +294,7 @@ func Test006AlgorithmWithstandsNoisyNetworks(t *testing.T) {
 		p("problem in swp_test 006: timeout after 10 seconds waiting")
 	}	
 
-	A.Stop()
-	B.Stop()
+	cleanup()
 
 	smy := net.Summary()
 	smy.Print()
@@ -297,3 +315,430 @@ func Test060NewSessionNonce(t *testing.T) {
 	fmt.Printf("NewSessionNonce()= '%s'.\n", NewSessionNonce())
 	fmt.Printf("NewSessionNonce()= '%s'.\n", NewSessionNonce())
 }
+
+func Test061ReadCtxDeliversAndTimesOut(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe(WithWindowMsgCount(3))
+	panicOn(err)
+
+	A.SelfConsumeForTesting()
+
+	A.Push(&Packet{
+		From:     "A",
+		Dest:     "B",
+		Data:     []byte("one"),
+		TcpEvent: EventData,
+	})
+
+	seq, err := B.ReadTimeout(time.Second)
+	_, err2 := B.ReadTimeout(50 * time.Millisecond)
+
+	cleanup()
+
+	cv.Convey("Given a packet sent from A to B, B.ReadTimeout should return it, and a second ReadTimeout should time out with context.DeadlineExceeded.", t, func() {
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(len(seq.Seq), cv.ShouldEqual, 1)
+		cv.So(string(seq.Seq[0].Data), cv.ShouldEqual, "one")
+		cv.So(err2, cv.ShouldEqual, context.DeadlineExceeded)
+		cv.So(B.CountPacketsReadConsumed(), cv.ShouldEqual, 1)
+	})
+}
+
+func Test066DeadlinesTimeOutPushAndRead(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe(WithWindowMsgCount(3))
+	panicOn(err)
+
+	A.SelfConsumeForTesting()
+
+	A.SetWriteDeadline(time.Now().Add(-time.Second))
+	errPast := A.Push(&Packet{From: "A", Dest: "B", Data: []byte("late"), TcpEvent: EventData})
+	A.SetWriteDeadline(time.Time{})
+	errCleared := A.Push(&Packet{From: "A", Dest: "B", Data: []byte("one"), TcpEvent: EventData})
+
+	seq, errRead := B.ReadTimeout(time.Second)
+
+	B.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, errReadDl := B.ReadMessages()
+
+	cleanup()
+
+	cv.Convey("Given a write deadline in the past, Push should time out; once cleared Push should succeed; and a read deadline should time out ReadMessages with a net.Error whose Timeout() is true.", t, func() {
+		cv.So(errPast, cv.ShouldEqual, ErrDeadlineExceeded)
+		cv.So(errPast.(net.Error).Timeout(), cv.ShouldBeTrue)
+		cv.So(errCleared, cv.ShouldBeNil)
+		cv.So(errRead, cv.ShouldBeNil)
+		cv.So(len(seq.Seq), cv.ShouldEqual, 1)
+		cv.So(errReadDl, cv.ShouldEqual, ErrDeadlineExceeded)
+		cv.So(errReadDl.(net.Error).Timeout(), cv.ShouldBeTrue)
+	})
+}
+
+func Test169DeadlineChangeWakesBlockedCalls(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+	defer cleanup()
+
+	// nothing arrives, so ReadMessages blocks with no
+	// deadline until one is set.
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := B.ReadMessages()
+		readErr <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	t0 := time.Now()
+	B.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	errRead := <-readErr
+	readWait := time.Since(t0)
+
+	// past the window, with no acks, Push blocks.
+	A.Net.(*SimNet).DiscardRange(0, 1000)
+	pushErr := make(chan error, 1)
+	go func() {
+		for {
+			if err := A.Push(&Packet{From: "A", Dest: "B", Data: []byte("x"), TcpEvent: EventData}); err != nil {
+				pushErr <- err
+				return
+			}
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	A.SetWriteDeadline(time.Now().Add(-time.Second))
+	var errPush error
+	select {
+	case errPush = <-pushErr:
+	case <-time.After(5 * time.Second):
+	}
+
+	cv.Convey("Given Read and Push calls blocked with no deadline, a later SetReadDeadline or SetWriteDeadline should wake them with ErrDeadlineExceeded once the new deadline passes.", t, func() {
+		cv.So(errRead, cv.ShouldEqual, ErrDeadlineExceeded)
+		cv.So(readWait, cv.ShouldBeLessThan, 2*time.Second)
+		cv.So(errPush, cv.ShouldEqual, ErrDeadlineExceeded)
+	})
+}
+
+func Test067HalfDuplexSession(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	rtt := 2 * lat
+
+	A, err := NewHalfDuplexSession(net, HalfDuplexSender, "A", "B", 10, rtt)
+	panicOn(err)
+	B, err := NewHalfDuplexSession(net, HalfDuplexReceiver, "B", "A", 10, rtt)
+	panicOn(err)
+
+	B.SelfConsumeForTesting()
+
+	for _, s := range []string{"one", "two", "three", "four"} {
+		A.Push(&Packet{
+			From:     "A",
+			Dest:     "B",
+			Data:     []byte(s),
+			TcpEvent: EventData,
+		})
+	}
+	errB := B.Push(&Packet{From: "B", Dest: "A", Data: []byte("nope"), TcpEvent: EventData})
+
+	time.Sleep(time.Second)
+
+	A.Stop()
+	B.Stop()
+
+	cv.Convey("Given a HalfDuplexSender A and a HalfDuplexReceiver B, data should flow from A to B, while B refuses to Push and keeps only a minimal send window.", t, func() {
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, 4)
+		cv.So(HistoryEqual(A.Swp.Sender.SendHistory, B.Swp.Recver.RecvHistory), cv.ShouldBeTrue)
+		cv.So(errB, cv.ShouldEqual, ErrHalfDuplexReceiver)
+		cv.So(len(B.Swp.Sender.Txq), cv.ShouldEqual, 1)
+		cv.So(len(A.Swp.Recver.Rxq), cv.ShouldEqual, 1)
+	})
+}
+
+func Test168HalfDuplexIdleDirectionIsQuiet(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	rtt := 2 * lat
+
+	var mut sync.Mutex
+	toA := make(map[TcpEvent]int)
+	toB := make(map[TcpEvent]int)
+	net.Sniff("A", func(pack *Packet) {
+		mut.Lock()
+		toA[pack.TcpEvent]++
+		mut.Unlock()
+	})
+	net.Sniff("B", func(pack *Packet) {
+		mut.Lock()
+		toB[pack.TcpEvent]++
+		mut.Unlock()
+	})
+
+	A, err := NewHalfDuplexSession(net, HalfDuplexSender, "A", "B", 10, rtt)
+	panicOn(err)
+	B, err := NewHalfDuplexSession(net, HalfDuplexReceiver, "B", "A", 10, rtt)
+	panicOn(err)
+	B.SelfConsumeForTesting()
+
+	for _, s := range []string{"one", "two"} {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(s), TcpEvent: EventData})
+	}
+	// idle past a few KeepAliveIntervals.
+	time.Sleep(1500 * time.Millisecond)
+
+	A.Stop()
+	B.Stop()
+	mut.Lock()
+	defer mut.Unlock()
+
+	cv.Convey("Given a HalfDuplexSender A and a HalfDuplexReceiver B left idle, B should send A only acks, leaving keepalives to A, and A should send B no acks.", t, func() {
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, 2)
+		cv.So(toA[EventDataAck], cv.ShouldBeGreaterThan, 0)
+		cv.So(len(toA), cv.ShouldEqual, 1)
+		cv.So(atomic.LoadInt64(&B.Swp.Sender.KeepAlivesSent), cv.ShouldEqual, 0)
+
+		cv.So(toB[EventData], cv.ShouldEqual, 2)
+		cv.So(toB[EventKeepAlive], cv.ShouldBeGreaterThan, 0)
+		cv.So(toB[EventDataAck], cv.ShouldEqual, 0)
+	})
+}
+
+func Test069PiggybackedAcks(t *testing.T) {
+
+	lossProb := float64(0)
+	lat := time.Millisecond
+	net := NewSimNet(lossProb, lat)
+	rtt := 2 * lat
+	pw := 50 * time.Millisecond
+
+	A, B, cleanup, err := SwpPipe(WithNet(net), WithTimeout(rtt), func(cfg *SessionConfig) { cfg.PiggybackWindow = pw })
+	panicOn(err)
+
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	n := 5
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("a%v", i)), TcpEvent: EventData})
+		time.Sleep(5 * time.Millisecond)
+		B.Push(&Packet{From: "B", Dest: "A", Data: []byte(fmt.Sprintf("b%v", i)), TcpEvent: EventData})
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(time.Second)
+
+	cleanup()
+
+	cv.Convey("Given traffic in both directions and a PiggybackWindow, some acks should ride on data packets, and all data should still be delivered in order.", t, func() {
+		piggy := atomic.LoadInt64(&A.Swp.Sender.PiggybackedAcks) + atomic.LoadInt64(&B.Swp.Sender.PiggybackedAcks)
+		cv.So(piggy, cv.ShouldBeGreaterThan, 0)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, n)
+		cv.So(len(A.Swp.Recver.RecvHistory), cv.ShouldEqual, n)
+		cv.So(HistoryEqual(A.Swp.Sender.SendHistory, B.Swp.Recver.RecvHistory), cv.ShouldBeTrue)
+		cv.So(HistoryEqual(B.Swp.Sender.SendHistory, A.Swp.Recver.RecvHistory), cv.ShouldBeTrue)
+		cv.So(A.Swp.Sender.SentButNotAckedBySeqNum.tree.Len(), cv.ShouldEqual, 0)
+	})
+}
+
+func Test071PacketMetadataRoundTrips(t *testing.T) {
+
+	pack := &Packet{From: "A", Dest: "B", SeqNum: 3, TcpEvent: EventData}
+	pack.SetMeta("trace-id", "abc123")
+	pack.SetMeta("content-type", "text/plain")
+
+	bts, err := pack.MarshalMsg(nil)
+	panicOn(err)
+	var pack2 Packet
+	_, err = pack2.UnmarshalMsg(bts)
+	panicOn(err)
+
+	cv.Convey("Given Packet.Metadata set with SetMeta, it should survive serialization, and GetMeta should report missing keys.", t, func() {
+		v, ok := pack2.GetMeta("trace-id")
+		cv.So(ok, cv.ShouldBeTrue)
+		cv.So(v, cv.ShouldEqual, "abc123")
+		v, ok = pack2.GetMeta("content-type")
+		cv.So(ok, cv.ShouldBeTrue)
+		cv.So(v, cv.ShouldEqual, "text/plain")
+		_, ok = pack2.GetMeta("nope")
+		cv.So(ok, cv.ShouldBeFalse)
+		cv.So(pack.Msgsize(), cv.ShouldBeGreaterThanOrEqualTo, len(bts))
+	})
+}
+
+func Test077PushOrderedKeepsPerKeyOrder(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	keys := []string{"x", "y", "z"}
+	n := 10
+	var wg sync.WaitGroup
+	for _, k := range keys {
+		wg.Add(1)
+		go func(k string) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				pack := &Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData}
+				pack.SetMeta("shard", k)
+				panicOn(A.PushOrdered(pack, k))
+			}
+		}(k)
+	}
+	wg.Wait()
+	time.Sleep(200 * time.Millisecond)
+
+	A.mut.Lock()
+	locksLeft := len(A.orderMut)
+	A.mut.Unlock()
+
+	cleanup()
+
+	cv.Convey("Given concurrent PushOrdered calls under several keys, every packet should arrive, each key's packets should arrive in the order pushed, and no per-key lock should outlive its calls.", t, func() {
+		cv.So(locksLeft, cv.ShouldEqual, 0)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, n*len(keys))
+		next := make(map[string]int)
+		for _, pack := range B.Swp.Recver.RecvHistory {
+			k, _ := pack.GetMeta("shard")
+			cv.So(string(pack.Data), cv.ShouldEqual, fmt.Sprintf("%v", next[k]))
+			next[k]++
+		}
+	})
+}
+
+func Test084PacketJSONRoundTrips(t *testing.T) {
+
+	tm := time.Date(2017, 3, 4, 5, 6, 7, 890123456, time.UTC)
+	pack := &Packet{From: "A", Dest: "B", SeqNum: 7, AckNum: -1, DataSendTm: tm, TcpEvent: EventData, Data: []byte("hello"), CliAcked: bchan.New(1)}
+	pack.SetMeta("trace-id", "abc123")
+
+	bts, err := json.Marshal(pack)
+	panicOn(err)
+	var pack2 Packet
+	err = json.Unmarshal(bts, &pack2)
+	panicOn(err)
+
+	cv.Convey("Given a Packet, JSON encoding should use RFC3339Nano times and base64 Data, omit CliAcked, and decode back to the same Packet.", t, func() {
+		s := string(bts)
+		cv.So(s, cv.ShouldContainSubstring, `"DataSendTm":"2017-03-04T05:06:07.890123456Z"`)
+		cv.So(s, cv.ShouldContainSubstring, `"Data":"aGVsbG8="`)
+		cv.So(strings.Contains(s, "CliAcked"), cv.ShouldBeFalse)
+		cv.So(pack2.SeqNum, cv.ShouldEqual, 7)
+		cv.So(pack2.AckNum, cv.ShouldEqual, -1)
+		cv.So(pack2.DataSendTm.Equal(tm), cv.ShouldBeTrue)
+		cv.So(string(pack2.Data), cv.ShouldEqual, "hello")
+		cv.So(pack2.TcpEvent, cv.ShouldEqual, EventData)
+		cv.So(pack2.Metadata["trace-id"], cv.ShouldEqual, "abc123")
+	})
+}
+
+func Test087PushBatchIsNotInterleaved(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe()
+	panicOn(err)
+
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	// a steady stream of single pushes...
+	stop := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			A.Push(&Packet{From: "A", Dest: "B", Data: []byte("single"), TcpEvent: EventData})
+		}
+	}()
+
+	// ...with a batch in the middle.
+	time.Sleep(10 * time.Millisecond)
+	nb := 15
+	var batch []*Packet
+	for i := 0; i < nb; i++ {
+		batch = append(batch, &Packet{From: "A", Dest: "B", Data: []byte("batch"), TcpEvent: EventData})
+	}
+	errBatch := A.PushBatch(batch)
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	<-done
+	time.Sleep(200 * time.Millisecond)
+
+	cleanup()
+	errAfter := A.PushBatch(batch[:1])
+
+	cv.Convey("Given concurrent Push calls, a PushBatch should arrive as one consecutive run of SeqNum, and fail once the session is stopped.", t, func() {
+		cv.So(errBatch, cv.ShouldBeNil)
+		cv.So(errAfter, cv.ShouldNotBeNil)
+		first := -1
+		count := 0
+		for i, pack := range B.Swp.Recver.RecvHistory {
+			if string(pack.Data) == "batch" {
+				if first < 0 {
+					first = i
+				}
+				cv.So(i, cv.ShouldEqual, first+count)
+				count++
+			}
+		}
+		cv.So(count, cv.ShouldEqual, nb)
+	})
+}
+
+func Test090PacketVersionAndMinPeerVersion(t *testing.T) {
+
+	cv.Convey("Given a Packet encoded by a peer with a field we don't know, and without Version, decoding should skip the unknown field and leave Version 0.", t, func() {
+		bts := msgp.AppendMapHeader(nil, 3)
+		bts = msgp.AppendString(bts, "From")
+		bts = msgp.AppendString(bts, "A")
+		bts = msgp.AppendString(bts, "FieldFromTheFuture")
+		bts = msgp.AppendInt64(bts, 42)
+		bts = msgp.AppendString(bts, "SeqNum")
+		bts = msgp.AppendInt64(bts, 7)
+
+		var pack Packet
+		left, err := pack.UnmarshalMsg(bts)
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(len(left), cv.ShouldEqual, 0)
+		cv.So(pack.From, cv.ShouldEqual, "A")
+		cv.So(pack.SeqNum, cv.ShouldEqual, 7)
+		cv.So(pack.Version, cv.ShouldEqual, 0)
+	})
+
+	send := func(minPeerVersion uint8) *Session {
+		net := NewSimNet(0, time.Millisecond)
+		rtt := 2 * time.Millisecond
+		A, B, cleanup, err := SwpPipe(WithNet(net), WithTimeout(rtt), OnlyOn("B", func(cfg *SessionConfig) { cfg.MinPeerVersion = minPeerVersion }))
+		panicOn(err)
+		A.SelfConsumeForTesting()
+		B.SelfConsumeForTesting()
+		for i := 0; i < 5; i++ {
+			A.Push(&Packet{From: "A", Dest: "B", Data: []byte("versioned"), TcpEvent: EventData})
+		}
+		time.Sleep(100 * time.Millisecond)
+		cleanup()
+		return B
+	}
+
+	cv.Convey("Given our own peer, packets should arrive with Version == ProtocolVersion, and a MinPeerVersion above it should drop them all.", t, func() {
+		B := send(ProtocolVersion)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, 5)
+		for _, pack := range B.Swp.Recver.RecvHistory {
+			cv.So(pack.Version, cv.ShouldEqual, ProtocolVersion)
+		}
+		cv.So(B.Swp.Recver.OldVersionDropped, cv.ShouldEqual, 0)
+
+		B = send(ProtocolVersion + 1)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, 0)
+		cv.So(B.Swp.Recver.OldVersionDropped, cv.ShouldBeGreaterThan, 0)
+	})
+}
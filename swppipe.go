@@ -0,0 +1,97 @@
+package swp
+
+import (
+	"time"
+)
+
+// SessionOption adjusts the SessionConfig of the
+// sessions SwpPipe makes. Each option is applied to
+// both, and can tell them apart by cfg.LocalInbox;
+// see OnlyOn.
+type SessionOption func(cfg *SessionConfig)
+
+// WithWindowMsgCount sets WindowMsgCount.
+func WithWindowMsgCount(n int64) SessionOption {
+	return func(cfg *SessionConfig) { cfg.WindowMsgCount = n }
+}
+
+// WithTimeout sets Timeout.
+func WithTimeout(d time.Duration) SessionOption {
+	return func(cfg *SessionConfig) { cfg.Timeout = d }
+}
+
+// WithWindowByteSz sets WindowByteSz.
+func WithWindowByteSz(n int64) SessionOption {
+	return func(cfg *SessionConfig) { cfg.WindowByteSz = n }
+}
+
+// WithClock sets Clk, as to a SimClock.
+func WithClock(clk Clock) SessionOption {
+	return func(cfg *SessionConfig) { cfg.Clk = clk }
+}
+
+// WithConfig applies f, for the settings that have
+// no option of their own.
+func WithConfig(f func(cfg *SessionConfig)) SessionOption {
+	return SessionOption(f)
+}
+
+// WithNet replaces the private SimNet.
+func WithNet(net Network) SessionOption {
+	return func(cfg *SessionConfig) { cfg.Net = net }
+}
+
+// WithInboxes names the sessions a and b, in place of
+// "A" and "B". OnlyOn options placed after it go by
+// the new names.
+func WithInboxes(a, b string) SessionOption {
+	return func(cfg *SessionConfig) {
+		if cfg.LocalInbox == "A" {
+			cfg.LocalInbox, cfg.DestInbox = a, b
+		} else {
+			cfg.LocalInbox, cfg.DestInbox = b, a
+		}
+	}
+}
+
+// OnlyOn applies opt to the session named inbox alone.
+func OnlyOn(inbox string, opt SessionOption) SessionOption {
+	return func(cfg *SessionConfig) {
+		if cfg.LocalInbox == inbox {
+			opt(cfg)
+		}
+	}
+}
+
+// SwpPipe makes two started sessions, "A" and "B", each
+// the other's destination, over a private SimNet with no
+// loss and 1 msec of latency. They get a window of 10
+// packets and no byte limit, a 2 msec Timeout, and
+// RealClk, unless opts say otherwise. The SimNet is
+// a.Net.(*SimNet), for tests that tweak it. cleanup stops
+// both sessions; it is safe to Stop them yourself as well.
+func SwpPipe(opts ...SessionOption) (a, b *Session, cleanup func(), err error) {
+	lat := time.Millisecond
+	net := NewSimNet(0, lat)
+	cfgA := SessionConfig{Net: net, LocalInbox: "A", DestInbox: "B", WindowMsgCount: 10, WindowByteSz: -1, Timeout: 2 * lat, Clk: RealClk}
+	cfgB := SessionConfig{Net: net, LocalInbox: "B", DestInbox: "A", WindowMsgCount: 10, WindowByteSz: -1, Timeout: 2 * lat, Clk: RealClk}
+	for _, opt := range opts {
+		opt(&cfgA)
+		opt(&cfgB)
+	}
+
+	a, err = NewSession(cfgA)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	b, err = NewSession(cfgB)
+	if err != nil {
+		a.Stop()
+		return nil, nil, nil, err
+	}
+	cleanup = func() {
+		a.Stop()
+		b.Stop()
+	}
+	return a, b, cleanup, nil
+}
@@ -0,0 +1,66 @@
+// Package swptest has helpers for tests of code built on
+// swp sessions.
+package swptest
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	swp "github.com/glycerine/go-sliding-window"
+)
+
+// pollEvery is how often RequireExactStats looks again.
+const pollEvery = 10 * time.Millisecond
+
+// RequireDeliveredInOrder reads sess.ReadMessagesCh until
+// the payloads of expected have all arrived, reporting with
+// t.Errorf any packet whose Data doesn't match the next one
+// expected. It gives up, with an Errorf saying how far it
+// got, if timeout passes or sess stops first. sess must have
+// no other consumer.
+func RequireDeliveredInOrder(t testing.TB, sess *swp.Session, expected [][]byte, timeout time.Duration) {
+	t.Helper()
+	deadline := time.After(timeout)
+	got := 0
+	for got < len(expected) {
+		select {
+		case seq := <-sess.ReadMessagesCh:
+			for _, pack := range seq.Seq {
+				if got >= len(expected) {
+					t.Errorf("%v: delivery past the %v expected: SeqNum %v, Data %q", sess.MyInbox, len(expected), pack.SeqNum, pack.Data)
+					continue
+				}
+				if !bytes.Equal(pack.Data, expected[got]) {
+					t.Errorf("%v: delivery %v (SeqNum %v) has Data %q; expected %q", sess.MyInbox, got, pack.SeqNum, pack.Data, expected[got])
+				}
+				got++
+			}
+		case <-deadline:
+			t.Errorf("%v: after %v, only %v of %v expected were delivered", sess.MyInbox, timeout, got, len(expected))
+			return
+		case <-sess.Halt.Done.Chan:
+			t.Errorf("%v: session stopped after %v of %v expected were delivered", sess.MyInbox, got, len(expected))
+			return
+		}
+	}
+}
+
+// RequireExactStats polls sess.Stats until check returns
+// true, reporting with t.Errorf the last SessionStats seen
+// if it hasn't within timeout.
+func RequireExactStats(t testing.TB, sess *swp.Session, check func(swp.SessionStats) bool, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		st := sess.Stats()
+		if check(st) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Errorf("%v: after %v, stats still fail the check: %+v", sess.MyInbox, timeout, st)
+			return
+		}
+		time.Sleep(pollEvery)
+	}
+}
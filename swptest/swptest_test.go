@@ -0,0 +1,63 @@
+package swptest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	swp "github.com/glycerine/go-sliding-window"
+)
+
+func TestRequireDeliveredInOrder(t *testing.T) {
+
+	A, B, cleanup, err := swp.SwpPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	A.SelfConsumeForTesting()
+
+	var expected [][]byte
+	for i := 0; i < 5; i++ {
+		data := []byte(fmt.Sprintf("%v", i))
+		expected = append(expected, data)
+		A.Push(&swp.Packet{From: "A", Dest: "B", Data: data, TcpEvent: swp.EventData})
+	}
+	RequireDeliveredInOrder(t, B, expected, 5*time.Second)
+	RequireExactStats(t, A, func(st swp.SessionStats) bool {
+		return st.LargestSeqnoAcked == int64(len(expected)-1)
+	}, 5*time.Second)
+}
+
+// recordTB catches what the helpers report.
+type recordTB struct {
+	testing.TB
+	errs int
+}
+
+func (r *recordTB) Helper() {}
+
+func (r *recordTB) Errorf(format string, args ...interface{}) { r.errs++ }
+
+func TestRequireHelpersReportFailures(t *testing.T) {
+
+	A, B, cleanup, err := swp.SwpPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	A.SelfConsumeForTesting()
+
+	A.Push(&swp.Packet{From: "A", Dest: "B", Data: []byte("0"), TcpEvent: swp.EventData})
+	rec := &recordTB{TB: t}
+	// one mismatch, then a timeout waiting for the second.
+	RequireDeliveredInOrder(rec, B, [][]byte{[]byte("x"), []byte("1")}, 200*time.Millisecond)
+	if rec.errs != 2 {
+		t.Errorf("expected 2 errors reported, got %v", rec.errs)
+	}
+	rec.errs = 0
+	RequireExactStats(rec, A, func(swp.SessionStats) bool { return false }, 50*time.Millisecond)
+	if rec.errs != 1 {
+		t.Errorf("expected 1 error reported, got %v", rec.errs)
+	}
+}
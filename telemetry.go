@@ -0,0 +1,87 @@
+package swp
+
+// Distributed tracing.
+//
+// With a Telemetry provider in the SessionConfig, each
+// data packet carries a W3C TraceContext "traceparent"
+// in Packet.TraceParent, so that its transfer shows up
+// in the traces of the larger system. The sender starts
+// a span as it first sends a packet, ended by the
+// packet's first ack; the receiver starts a child of
+// that span as the packet becomes ready, ended when the
+// consumer takes it.
+//
+// We don't depend on any tracing library: Telemetry and
+// Span are small enough for an adapter to, say,
+// OpenTelemetry to be a few lines, with TraceParent
+// formatting span.SpanContext() in the traceparent
+// form. Without a provider TraceParent stays empty,
+// and costs nothing.
+
+// Span is one traced operation.
+type Span interface {
+	// TraceParent is the span's context in W3C
+	// traceparent form, e.g.
+	// "00-<trace-id>-<span-id>-01".
+	TraceParent() string
+
+	// End finishes the span.
+	End()
+}
+
+// Telemetry starts the spans for packet transfers.
+// Both methods run on the session's own goroutines,
+// so they must not block.
+type Telemetry interface {
+	// StartSend starts the span for the first send of
+	// pack. If pack.TraceParent is already set, by the
+	// Push caller, the span should be its child.
+	StartSend(pack *Packet) Span
+
+	// StartDelivery starts the span for the delivery
+	// of pack, a child of its pack.TraceParent.
+	StartDelivery(pack *Packet) Span
+}
+
+// startSendSpan starts slot's span, and has its
+// packet carry it. Only the sendloop calls it.
+func (s *SenderState) startSendSpan(slot *TxqSlot) {
+	slot.span = nil
+	if s.Telemetry == nil {
+		return
+	}
+	slot.span = s.Telemetry.StartSend(slot.Pack)
+	slot.Pack.TraceParent = slot.span.TraceParent()
+}
+
+// endSendSpan ends slot's span, if any, on its first ack.
+func (s *SenderState) endSendSpan(slot *TxqSlot) {
+	if slot.span != nil {
+		slot.span.End()
+		slot.span = nil
+	}
+}
+
+// startDeliverySpan starts the delivery span of pack,
+// as it becomes ready. Only the recvloop calls it.
+func (r *RecvState) startDeliverySpan(pack *Packet) {
+	if r.Telemetry == nil || pack.TraceParent == "" {
+		return
+	}
+	if r.deliverySpans == nil {
+		r.deliverySpans = make(map[int64]Span)
+	}
+	if old, ok := r.deliverySpans[pack.SeqNum]; ok {
+		old.End()
+	}
+	r.deliverySpans[pack.SeqNum] = r.Telemetry.StartDelivery(pack)
+}
+
+// endDeliverySpan ends the delivery span of
+// seqno, if any, once it is consumed or dropped.
+func (r *RecvState) endDeliverySpan(seqno int64) {
+	if span, ok := r.deliverySpans[seqno]; ok {
+		span.End()
+		delete(r.deliverySpans, seqno)
+	}
+}
@@ -0,0 +1,68 @@
+package swp
+
+import (
+	"time"
+)
+
+// Dumping the send queue.
+//
+// TxqDump is for debugging a stalled session: it lists
+// each packet in flight, oldest SeqNum first, with when
+// it is next due to be retried and how often it has
+// been. The sendloop owns the Txq, so TxqDump asks it
+// for the list, as Snapshot does; it is not meant for
+// the hot path.
+
+// TxqSlotInfo describes one in-flight TxqSlot.
+type TxqSlotInfo struct {
+	SeqNum        int64
+	RetryDeadline time.Time
+	RetryCount    int
+
+	// DataLen is len(Pack.Data), as sent.
+	DataLen int
+}
+
+// txqDumpReq asks the sendloop for its TxqSlotInfo,
+// closing done when slots is set.
+type txqDumpReq struct {
+	slots []TxqSlotInfo
+	done  chan struct{}
+}
+
+// TxqDump returns the packets we have sent but not
+// yet had acked, oldest SeqNum first. It is safe to
+// call from any goroutine, and after Stop.
+func (s *SenderState) TxqDump() []TxqSlotInfo {
+	req := &txqDumpReq{done: make(chan struct{})}
+	select {
+	case s.txqDumpCh <- req:
+		<-req.done
+		return req.slots
+	case <-s.Halt.Done.Chan:
+		// stopped, so nothing else touches the Txq.
+		return s.txqDump()
+	}
+}
+
+// txqDump lists the in-flight slots. Only the
+// sendloop calls it, until the sendloop is done.
+func (s *SenderState) txqDump() []TxqSlotInfo {
+	var slots []TxqSlotInfo
+	for it := s.SentButNotAckedBySeqNum.tree.Min(); !it.Limit(); it = it.Next() {
+		slot := it.Item().(*TxqSlot)
+		slots = append(slots, TxqSlotInfo{
+			SeqNum:        slot.Pack.SeqNum,
+			RetryDeadline: slot.RetryDeadline,
+			RetryCount:    slot.RetryCount,
+			DataLen:       len(slot.Pack.Data),
+		})
+	}
+	return slots
+}
+
+// TxqDump returns our sender's in-flight packets;
+// see SenderState.TxqDump.
+func (s *Session) TxqDump() []TxqSlotInfo {
+	return s.Swp.Sender.TxqDump()
+}
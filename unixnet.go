@@ -0,0 +1,280 @@
+//go:build !windows
+// +build !windows
+
+package swp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/glycerine/idem"
+)
+
+// UnixNet is a Network over Unix domain sockets, for
+// sessions between processes on one host without a
+// broker. An inbox is the path of a socket. See NewUnixNet.
+//
+// On the wire, each packet is its Codec encoding,
+// msgp by default, preceded by a 4 byte big-endian
+// length. Send keeps one connection open per
+// destination, dialing it on first use and again
+// after any write error.
+type UnixNet struct {
+	mut       sync.Mutex
+	conns     map[string]*unixConn
+	accepted  []net.Conn
+	listeners []*net.UnixListener
+	Halt      *idem.Halter
+
+	// Codec is the wire format; nil means
+	// MsgpackCodec. See codec.go.
+	Codec Codec
+}
+
+// unixConn is a pooled outbound connection.
+type unixConn struct {
+	mut sync.Mutex
+	c   net.Conn
+}
+
+// unixNetMaxFrame bounds the length prefix we will
+// believe, so that garbage can't make us allocate
+// without limit.
+const unixNetMaxFrame = 64 << 20
+
+// NewUnixNet makes a UnixNet. Call Stop when done
+// to close its sockets.
+func NewUnixNet() *UnixNet {
+	return &UnixNet{
+		conns: make(map[string]*unixConn),
+		Halt:  idem.NewHalter(),
+	}
+}
+
+// Listen creates a socket at path inbox, replacing
+// one left behind by a listener that is gone, and
+// delivers packets from every connection to it on
+// the returned channel.
+func (u *UnixNet) Listen(inbox string) (chan *Packet, error) {
+	ln, err := u.listen(inbox)
+	if err != nil {
+		return nil, err
+	}
+	mr := make(chan *Packet)
+	go u.accept(ln, func(bts []byte) bool {
+		var pack Packet
+		err := codecOrDefault(u.Codec).Unmarshal(bts, &pack)
+		if err != nil {
+			mylog.Printf("unix net dropping packet that would not decode: '%s'", err)
+			return true
+		}
+		select {
+		case mr <- &pack:
+			return true
+		case <-u.Halt.ReqStop.Chan:
+			return false
+		}
+	})
+	return mr, nil
+}
+
+// RecvRaw implements RawNetwork: it is Listen, but
+// delivers each frame as it came, still encoded.
+func (u *UnixNet) RecvRaw(inbox string) (chan []byte, error) {
+	ln, err := u.listen(inbox)
+	if err != nil {
+		return nil, err
+	}
+	mr := make(chan []byte)
+	go u.accept(ln, func(bts []byte) bool {
+		select {
+		case mr <- bts:
+			return true
+		case <-u.Halt.ReqStop.Chan:
+			return false
+		}
+	})
+	return mr, nil
+}
+
+// listen creates the socket for Listen and RecvRaw.
+func (u *UnixNet) listen(inbox string) (*net.UnixListener, error) {
+	addr := &net.UnixAddr{Name: inbox, Net: "unix"}
+	ln, err := net.ListenUnix("unix", addr)
+	if err != nil {
+		c, derr := net.Dial("unix", inbox)
+		if derr == nil {
+			// someone live is listening there.
+			c.Close()
+			return nil, err
+		}
+		os.Remove(inbox)
+		ln, err = net.ListenUnix("unix", addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	u.mut.Lock()
+	u.listeners = append(u.listeners, ln)
+	u.mut.Unlock()
+	return ln, nil
+}
+
+// accept runs a reader for each connection to ln,
+// handing each frame to handle.
+func (u *UnixNet) accept(ln *net.UnixListener, handle func(bts []byte) bool) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			// closed by Stop
+			return
+		}
+		u.mut.Lock()
+		u.accepted = append(u.accepted, c)
+		u.mut.Unlock()
+		go u.read(c, handle)
+	}
+}
+
+// read hands the frames from c to handle until c
+// closes, or handle returns false.
+func (u *UnixNet) read(c net.Conn, handle func(bts []byte) bool) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	var hdr [4]byte
+	for {
+		_, err := io.ReadFull(br, hdr[:])
+		if err != nil {
+			return
+		}
+		n := binary.BigEndian.Uint32(hdr[:])
+		if n > unixNetMaxFrame {
+			mylog.Printf("unix net closing connection that sent a %v byte frame", n)
+			return
+		}
+		bts := make([]byte, n)
+		_, err = io.ReadFull(br, bts)
+		if err != nil {
+			return
+		}
+		if !handle(bts) {
+			return
+		}
+	}
+}
+
+// Send writes pack to the socket at pack.Dest.
+func (u *UnixNet) Send(pack *Packet, why string) error {
+	bts, err := codecOrDefault(u.Codec).Marshal(pack)
+	if err != nil {
+		return err
+	}
+	return u.SendRaw(pack.Dest, bts)
+}
+
+// SendRaw implements RawNetwork, writing data, already
+// in our Codec, to the socket at dest as one frame.
+func (u *UnixNet) SendRaw(dest string, data []byte) error {
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+
+	uc, err := u.conn(dest)
+	if err != nil {
+		return err
+	}
+	uc.mut.Lock()
+	_, err = uc.c.Write(frame)
+	uc.mut.Unlock()
+	if err != nil {
+		// redial on the next Send.
+		u.mut.Lock()
+		if u.conns[dest] == uc {
+			delete(u.conns, dest)
+		}
+		u.mut.Unlock()
+		uc.c.Close()
+		return err
+	}
+	return nil
+}
+
+// conn returns our connection to dest, dialing if need be.
+func (u *UnixNet) conn(dest string) (*unixConn, error) {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	if uc, ok := u.conns[dest]; ok {
+		return uc, nil
+	}
+	c, err := net.Dial("unix", dest)
+	if err != nil {
+		return nil, fmt.Errorf("unix net could not reach '%s': %v", dest, err)
+	}
+	uc := &unixConn{c: c}
+	u.conns[dest] = uc
+	return uc, nil
+}
+
+// SetCodec implements CodecNetwork. Call it
+// before Listen.
+func (u *UnixNet) SetCodec(c Codec) {
+	u.Codec = c
+}
+
+// RawCodec implements RawNetwork.
+func (u *UnixNet) RawCodec() Codec {
+	return codecOrDefault(u.Codec)
+}
+
+// Flush is a no-op; the packet is in the kernel's
+// hands by the time Send returns.
+func (u *UnixNet) Flush() {}
+
+// BufferCaps returns the OS receive buffer size, in
+// bytes, of our most recent listening socket. Stream
+// sockets don't limit the message count, so msgcap is
+// -1. Both are -1 if we aren't listening.
+func (u *UnixNet) BufferCaps() (bytecap int64, msgcap int64) {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	if len(u.listeners) == 0 {
+		return -1, -1
+	}
+	raw, err := u.listeners[len(u.listeners)-1].SyscallConn()
+	if err != nil {
+		return -1, -1
+	}
+	bytecap = -1
+	raw.Control(func(fd uintptr) {
+		sz, err := syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+		if err == nil {
+			bytecap = int64(sz)
+		}
+	})
+	return bytecap, -1
+}
+
+// Stop closes our listeners, which removes their
+// socket files, and all our connections.
+func (u *UnixNet) Stop() {
+	u.Halt.RequestStop()
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	for _, ln := range u.listeners {
+		ln.Close()
+	}
+	for _, c := range u.accepted {
+		c.Close()
+	}
+	for dest, uc := range u.conns {
+		uc.c.Close()
+		delete(u.conns, dest)
+	}
+	u.Halt.Done.Close()
+}
@@ -0,0 +1,149 @@
+//go:build !windows
+// +build !windows
+
+package swp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+// unixPairTransfer sends n packets from A to B, each
+// session on its own UnixNet using codec, and returns
+// how many were acked, along with B.
+func unixPairTransfer(n int, codec Codec) (int, *Session) {
+
+	dir, err := os.MkdirTemp("", "swp-unixnet")
+	panicOn(err)
+	defer os.RemoveAll(dir)
+	pathA := filepath.Join(dir, "A")
+	pathB := filepath.Join(dir, "B")
+
+	netA := NewUnixNet()
+	defer netA.Stop()
+	netB := NewUnixNet()
+	defer netB.Stop()
+
+	rtt := 100 * time.Millisecond
+	A, B, cleanup, err := SwpPipe(WithInboxes(pathA, pathB), WithTimeout(rtt),
+		OnlyOn(pathA, WithNet(netA)), OnlyOn(pathB, WithNet(netB)),
+		WithConfig(func(cfg *SessionConfig) { cfg.Codec = codec }))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	for i := 0; i < n; i++ {
+		A.Push(&Packet{From: pathA, Dest: pathB, Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+	}
+	got := 0
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		if got = int(A.Swp.Sender.LargestAckedSeqno()) + 1; got == n {
+			break
+		}
+	}
+	cleanup()
+	return got, B
+}
+
+func Test099UnixNetTransfers1000Packets(t *testing.T) {
+
+	n := 1000
+	got, B := unixPairTransfer(n, nil)
+
+	dir, err := os.MkdirTemp("", "swp-unixnet")
+	panicOn(err)
+	defer os.RemoveAll(dir)
+	unet := NewUnixNet()
+	_, err = unet.Listen(filepath.Join(dir, "C"))
+	panicOn(err)
+	bytecap, msgcap := unet.BufferCaps()
+	unet.Stop()
+
+	cv.Convey("Given two sessions, each on its own UnixNet, sending 1000 packets over the sockets should see every one acked, and delivered once and in order. BufferCaps should report the socket's receive buffer.", t, func() {
+		cv.So(got, cv.ShouldEqual, n)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, n)
+		for i, pack := range B.Swp.Recver.RecvHistory {
+			cv.So(string(pack.Data), cv.ShouldEqual, fmt.Sprintf("%v", i))
+		}
+		cv.So(bytecap, cv.ShouldBeGreaterThan, 0)
+		cv.So(msgcap, cv.ShouldEqual, -1)
+	})
+}
+
+func Test101UnixNetWithJSONCodec(t *testing.T) {
+
+	n := 100
+	got, B := unixPairTransfer(n, JSONCodec{})
+
+	cv.Convey("Given SessionConfig.Codec of JSONCodec on both ends, a UnixNet transfer should work just as it does with msgp.", t, func() {
+		cv.So(got, cv.ShouldEqual, n)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, n)
+		for i, pack := range B.Swp.Recver.RecvHistory {
+			cv.So(string(pack.Data), cv.ShouldEqual, fmt.Sprintf("%v", i))
+		}
+	})
+}
+
+func Test172UnixNetWithProtobufCodec(t *testing.T) {
+
+	n := 100
+	got, B := unixPairTransfer(n, ProtobufCodec{})
+
+	cv.Convey("Given SessionConfig.Codec of ProtobufCodec on both ends, a UnixNet transfer should work just as it does with msgp.", t, func() {
+		cv.So(got, cv.ShouldEqual, n)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, n)
+		for i, pack := range B.Swp.Recver.RecvHistory {
+			cv.So(string(pack.Data), cv.ShouldEqual, fmt.Sprintf("%v", i))
+		}
+	})
+}
+
+func Test123UnixNetRawSendAndSlotCache(t *testing.T) {
+
+	dir, err := os.MkdirTemp("", "swp-unixnet")
+	panicOn(err)
+	defer os.RemoveAll(dir)
+	pathC := filepath.Join(dir, "C")
+
+	unet := NewUnixNet()
+	defer unet.Stop()
+	raw, err := unet.RecvRaw(pathC)
+	panicOn(err)
+
+	s := &SenderState{Net: unet}
+	slot := &TxqSlot{Pack: &Packet{From: "A", Dest: pathC, SeqNum: 7, Data: []byte("raw"), TcpEvent: EventData}}
+	frames := make(chan []byte, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			frames <- <-raw
+		}
+	}()
+	panicOn(s.sendSlot(slot, "test"))
+	first := slot.serialized
+	panicOn(s.sendSlot(slot, "test"))
+	reused := &slot.serialized[0] == &first[0]
+
+	var got [2][]byte
+	for i := range got {
+		select {
+		case got[i] = <-frames:
+		case <-time.After(5 * time.Second):
+		}
+	}
+	var pack Packet
+	_, err = pack.UnmarshalMsg(got[0])
+
+	cv.Convey("Given a UnixNet, a slot sent twice with sendSlot should be encoded once and reach RecvRaw as the same msgp bytes both times, decoding to the packet sent.", t, func() {
+		cv.So(reused, cv.ShouldBeTrue)
+		cv.So(got[0], cv.ShouldResemble, first)
+		cv.So(got[1], cv.ShouldResemble, first)
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(pack.SeqNum, cv.ShouldEqual, 7)
+		cv.So(string(pack.Data), cv.ShouldEqual, "raw")
+	})
+}
@@ -0,0 +1,80 @@
+package swp
+
+import (
+	"context"
+	"sort"
+)
+
+// deliveryWaiter is a WaitDelivered call blocked until
+// seqno has been consumed.
+type deliveryWaiter struct {
+	seqno int64
+	done  chan struct{}
+}
+
+// WaitDelivered blocks until the consumer has been
+// handed seqno, that is until LastMsgConsumed >= seqno.
+// It returns ctx.Err() if ctx is done first, and
+// ErrShutdown if the receiver stops. It is safe to call
+// from any goroutine.
+func (r *RecvState) WaitDelivered(seqno int64, ctx context.Context) error {
+	r.waitMut.Lock()
+	if seqno <= r.consumedThrough {
+		r.waitMut.Unlock()
+		return nil
+	}
+	w := &deliveryWaiter{seqno: seqno, done: make(chan struct{})}
+	i := sort.Search(len(r.waiters), func(i int) bool {
+		return r.waiters[i].seqno > seqno
+	})
+	r.waiters = append(r.waiters, nil)
+	copy(r.waiters[i+1:], r.waiters[i:])
+	r.waiters[i] = w
+	r.waitMut.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		r.dropWaiter(w)
+		return ctx.Err()
+	case <-r.Halt.Done.Chan:
+		r.dropWaiter(w)
+		return ErrShutdown
+	}
+}
+
+// WaitDelivered is Swp.Recver.WaitDelivered.
+func (s *Session) WaitDelivered(seqno int64, ctx context.Context) error {
+	return s.Swp.Recver.WaitDelivered(seqno, ctx)
+}
+
+// wakeDelivered publishes LastMsgConsumed for
+// WaitDelivered, and releases each waiter it passes.
+// Only the recvloop calls it, at the top of each pass.
+func (r *RecvState) wakeDelivered() {
+	r.waitMut.Lock()
+	r.consumedThrough = r.LastMsgConsumed
+	n := 0
+	for n < len(r.waiters) && r.waiters[n].seqno <= r.LastMsgConsumed {
+		close(r.waiters[n].done)
+		r.waiters[n] = nil
+		n++
+	}
+	if n > 0 {
+		r.waiters = r.waiters[n:]
+	}
+	r.waitMut.Unlock()
+}
+
+// dropWaiter removes w, when its caller gives up.
+func (r *RecvState) dropWaiter(w *deliveryWaiter) {
+	r.waitMut.Lock()
+	defer r.waitMut.Unlock()
+	for i, o := range r.waiters {
+		if o == w {
+			r.waiters = append(r.waiters[:i], r.waiters[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package swp
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Window resizing.
+//
+// A receiver that wants a bigger or smaller window calls
+// ProposeWindowSize. Its recvloop resizes Rxq at once,
+// then tells the remote sender by setting Packet.ProposeWindowSize
+// on a window update, and on every keepalive after. The
+// remote sender resizes Txq to match as soon as its
+// packets in flight fit in the new window; until then a
+// shrunken advertised window keeps it from sending more.
+//
+// Both queues are only touched by their own loop, so each
+// resize happens whole, between loop iterations. Buffer
+// limits set on a NATS subscription at Start are not
+// changed.
+
+// ErrBadWindowSize is returned by ProposeWindowSize
+// for a window of less than one packet.
+var ErrBadWindowSize = fmt.Errorf("swp: window size must be at least 1")
+
+// ProposeWindowSize resizes our receive window to n
+// packets, and asks the remote sender to follow.
+func (r *RecvState) ProposeWindowSize(n int64) error {
+	if n < 1 {
+		return ErrBadWindowSize
+	}
+	select {
+	case r.proposeWindow <- n:
+		return nil
+	case <-r.Halt.ReqStop.Chan:
+		return ErrSessDone
+	}
+}
+
+// ProposeWindowSize resizes the session's receive
+// window; see RecvState.ProposeWindowSize.
+func (s *Session) ProposeWindowSize(n int64) error {
+	return s.Swp.Recver.ProposeWindowSize(n)
+}
+
+// resizeRxq is called from the recvloop. Held packets
+// that no longer fit are dropped; we never acked them,
+// so the sender will retry them.
+func (r *RecvState) resizeRxq(n int64) {
+	rxq := make([]*RxqSlot, n)
+	for i := range rxq {
+		rxq[i] = &RxqSlot{}
+	}
+	for _, slot := range r.Rxq {
+		if !slot.Received {
+			continue
+		}
+		seq := slot.Pack.SeqNum
+		if InWindow(seq, r.NextFrameExpected, r.NextFrameExpected+n-1) {
+			rxq[seq%n] = slot
+		} else {
+			r.unhold(seq)
+			atomic.AddInt64(&r.DiscardReasons.OOOLimit, 1)
+		}
+	}
+	r.Rxq = rxq
+	atomic.StoreInt64(&r.RecvWindowSize, n)
+	atomic.StoreInt64(&r.snd.proposedWindowSize, n)
+
+	r.UpdateControl(nil)
+	r.ack(r.LastFrameClientConsumed, nil, EventKeepAlive)
+}
+
+// resizeTxq is called from the sendloop, with oldest the
+// smallest SeqNum not yet acked. It applies
+// pendingWindowSize if our packets in flight fit, and
+// otherwise leaves it pending for a later try.
+func (s *SenderState) resizeTxq(oldest int64) {
+	n := s.pendingWindowSize
+	if s.LastFrameSent-oldest+1 > n {
+		return
+	}
+	txq := make([]*TxqSlot, n)
+	for i := range txq {
+		txq[i] = &TxqSlot{}
+	}
+	for seq := oldest; seq <= s.LastFrameSent; seq++ {
+		txq[seq%n] = s.Txq[seq%s.SenderWindowSize]
+	}
+	s.Txq = txq
+	atomic.StoreInt64(&s.SenderWindowSize, n)
+	s.pendingWindowSize = 0
+	atomic.AddInt64(&s.WindowResizes, 1)
+	//p("%v resized send window to %v", s.Inbox, n)
+}
@@ -0,0 +1,81 @@
+package swp
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cv "github.com/glycerine/goconvey/convey"
+)
+
+func Test098ProposeWindowSizeResizesBothEnds(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe(WithWindowMsgCount(4))
+	panicOn(err)
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	push := func(from, to int) {
+		for i := from; i < to; i++ {
+			A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData})
+		}
+	}
+	sendWindow := func() int64 {
+		return atomic.LoadInt64(&A.Swp.Sender.SenderWindowSize)
+	}
+
+	panicOn(B.ProposeWindowSize(16))
+	time.Sleep(50 * time.Millisecond)
+	grown := sendWindow()
+	push(0, 50)
+	time.Sleep(300 * time.Millisecond)
+
+	panicOn(B.ProposeWindowSize(2))
+	push(50, 100)
+	time.Sleep(300 * time.Millisecond)
+	shrunk := sendWindow()
+
+	cleanup()
+
+	cv.Convey("Given a receiver that proposes first a bigger, then a smaller window, the remote sender should resize its window to match each time, and every packet should still be delivered once and in order.", t, func() {
+		cv.So(B.ProposeWindowSize(0), cv.ShouldEqual, ErrBadWindowSize)
+		cv.So(grown, cv.ShouldEqual, 16)
+		cv.So(shrunk, cv.ShouldEqual, 2)
+		cv.So(atomic.LoadInt64(&B.Swp.Recver.RecvWindowSize), cv.ShouldEqual, 2)
+		cv.So(atomic.LoadInt64(&A.Swp.Sender.WindowResizes), cv.ShouldEqual, 2)
+		cv.So(len(B.Swp.Recver.RecvHistory), cv.ShouldEqual, 100)
+		for i, pack := range B.Swp.Recver.RecvHistory {
+			cv.So(string(pack.Data), cv.ShouldEqual, fmt.Sprintf("%v", i))
+		}
+	})
+}
+
+func Test150DrainWindowWaitsForAllAcks(t *testing.T) {
+
+	A, B, cleanup, err := SwpPipe(WithWindowMsgCount(8))
+	panicOn(err)
+	defer cleanup()
+	A.SelfConsumeForTesting()
+	B.SelfConsumeForTesting()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	idle := A.Swp.Sender.DrainWindow(ctx)
+
+	n := 100
+	for i := 0; i < n; i++ {
+		panicOn(A.Push(&Packet{From: "A", Dest: "B", Data: []byte(fmt.Sprintf("%v", i)), TcpEvent: EventData}))
+	}
+	drained := A.Drain(ctx)
+	snap := A.Snapshot()
+
+	cv.Convey("Given 100 packets pushed through a window of 8, DrainWindow should return only once all are acked, leaving no TxqSlot in flight; and at once when nothing was sent.", t, func() {
+		cv.So(idle, cv.ShouldBeNil)
+		cv.So(drained, cv.ShouldBeNil)
+		cv.So(len(snap.Unacked), cv.ShouldEqual, 0)
+		cv.So(snap.LastAckRec, cv.ShouldEqual, n-1)
+		cv.So(snap.LastFrameSent, cv.ShouldEqual, n-1)
+	})
+}